@@ -16,6 +16,7 @@ import (
 	"github.com/binzume/modelconv/geom"
 	"github.com/binzume/modelconv/gltfutil"
 	"github.com/binzume/modelconv/mqo"
+	"github.com/binzume/modelconv/unity"
 	"github.com/qmuntal/gltf"
 )
 
@@ -40,13 +41,30 @@ var (
 	texBytesThreshold      = flag.Int64("texBytesThreshold", 0, "resize large textures (gltf)")
 	texResolutionLimit     = flag.Int("texResolutionLimit", 4096, "resize large textures (gltf)")
 	texResizeScale         = flag.Float64("texResizeScale", 1.0, "resize large textures (gltf)")
+	texKTX2                = flag.String("texKTX2", "", "add KTX2 textures: uastc or etc1s (gltf, requires toktx)")
+	texWebP                = flag.Bool("texWebP", false, "use lossless WebP textures by EXT_texture_webp (gltf)")
+	texConcurrency         = flag.Int("texConcurrency", 0, "number of texture encoding workers. 0: number of CPUs (gltf)")
+	texMemoryLimit         = flag.Int64("texMemoryLimit", 1024, "approximate memory limit for decoded textures in MB (gltf)")
 	reuseGeometry          = flag.Bool("reuseGeometry", false, "use shared geometry data (gltf, experimental)")
 	gltfIgnoreHierarchy    = flag.Bool("ignoreHierarchy", false, "ignore object tree (gltf)")
 	gltfDetectAlphaTexture = flag.Bool("detectAlphaTexture", false, "detect alpha texture (gltf)")
 	gltfExportLight        = flag.Bool("gltfExportLight", false, "export lights (gltf)")
+	gltfExportCamera       = flag.Bool("gltfExportCamera", false, "export cameras (gltf)")
+	gltfExportPose         = flag.Bool("gltfExportPose", false, "export the bone pose as an animation if there are no motions (gltf)")
+	gltfBumpScale          = flag.Float64("bumpScale", 2.0, "strength of normal maps generated from bump maps (gltf)")
 
 	convertPhysics    = flag.Bool("physics", false, "convert physics (experimental)")
+	terrainResolution = flag.Int("terrainResolution", 0, "max vertices per side of terrain mesh (unity, 0:heightmap resolution)")
+	highestLODOnly    = flag.Bool("highestLODOnly", false, "convert only LOD0 of LODGroup instead of MSFT_lod (unity)")
+	unityLightmap     = flag.Bool("unityLightmap", false, "bake lightmaps into unlit textures (unity, experimental)")
+	bakeColors        = flag.String("bakeColors", "", "bake colors into textures (vertex,material,emission or all)")
+	bakeResolution    = flag.Int("bakeResolution", 1024, "texture size for baked vertex colors and occlusion textures")
+	bakeAO            = flag.String("bakeAO", "", "bake ambient occlusion: texture or vertex")
+	aoSamples         = flag.Int("aoSamples", 32, "rays per texel or vertex for -bakeAO")
+	aoDistance        = flag.Float64("aoDistance", 0, "max distance of occluders for -bakeAO (0: 10% of the model size)")
+	unityURP          = flag.Bool("unityURP", false, "use URP shaders for output materials (unity)")
 	vrmExportAllMorph = flag.Bool("vrmExportAllMorph", false, "Export non-standard morph (vrm, experimental)")
+	vrmNoMToon        = flag.Bool("vrmNoMToon", false, "Do not convert MMD materials to MToon (vrm)")
 
 	mmdFixInheritParentThreshold = flag.Float64("mmdFixInheritParentThreshold", 0.4, "Replace parent bone with inherit parent")
 )
@@ -121,11 +139,19 @@ func saveDocument(doc *mqo.Document, output, ext, srcDir string, inputs []string
 			TextureBytesThreshold:  *texBytesThreshold,
 			TextureResolutionLimit: *texResolutionLimit,
 			TextureScale:           float32(*texResizeScale),
+			TextureKTX2:            *texKTX2,
+			TextureWebP:            *texWebP,
+			TextureConcurrency:     *texConcurrency,
+			TextureMemoryBudget:    *texMemoryLimit << 20,
 			ReuseGeometry:          *reuseGeometry,
 			IgnoreObjectHierarchy:  *gltfIgnoreHierarchy,
 			ConvertPhysics:         *convertPhysics,
 			DetectAlphaTexture:     *gltfDetectAlphaTexture,
 			ExportLights:           *gltfExportLight,
+			ExportCameras:          *gltfExportCamera,
+			ExportPoseAnimation:    *gltfExportPose,
+			BumpScale:              float32(*gltfBumpScale),
+			ExportMToon:            ext == ".vrm" && !*vrmNoMToon,
 		}
 		conv := converter.NewMQOToGLTFConverter(opt)
 		gltfdoc, err := conv.Convert(doc, srcDir)
@@ -145,12 +171,44 @@ func saveDocument(doc *mqo.Document, output, ext, srcDir string, inputs []string
 		return saveGltfDocument(gltfdoc, output, ext, srcDir, *vrmconf)
 	} else if isMQO(ext) {
 		return mqo.Save(doc, output)
-	} else if ext == ".pmx" {
-		return saveAsPmx(doc, output)
+	} else if ext == mqo.MotionFileExt {
+		kp := mqo.FindKeyframerPlugin(doc)
+		if kp == nil {
+			return fmt.Errorf("No motion data")
+		}
+		return mqo.SaveMotions(kp.Motions, output)
+	} else if isMMD(ext) {
+		return saveAsPmx(doc, output, srcDir)
+	} else if ext == ".unitypackage" || filepath.Base(output) == "Assets" {
+		return saveAsUnityAssets(doc, output, srcDir, inputs[0])
 	}
 	return fmt.Errorf("Unsuppored output type: %v", ext)
 }
 
+// saveAsUnityAssets writes the document to .unitypackage or Assets dir of the Unity project.
+func saveAsUnityAssets(doc *mqo.Document, output, srcDir, input string) error {
+	var w unity.AssetsWriter
+	if ext := strings.ToLower(filepath.Ext(output)); ext == ".unitypackage" {
+		var err error
+		if w, err = unity.CreatePackage(output); err != nil {
+			return err
+		}
+	} else {
+		w = unity.NewAssetsDirWriter(filepath.Dir(output))
+	}
+	name := filepath.Base(input)
+	name = name[:len(name)-len(filepath.Ext(name))]
+	conv := converter.NewMQOToUnityConverter(&converter.MQOToUnityOption{
+		URP:            *unityURP,
+		ConvertPhysics: *convertPhysics,
+	})
+	if err := conv.Convert(doc, srcDir, name, w); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
 func main() {
 	// defer profile.Start(profile.ProfilePath(".")).Stop()
 	flag.Usage = func() {
@@ -249,11 +307,33 @@ func main() {
 		return
 	}
 
-	doc, err := loadDocument(input)
+	doc, err := loadDocument(input, outputExt)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	for _, f := range flag.Args()[1:inputN] {
+		switch strings.ToLower(filepath.Ext(f)) {
+		case mqo.MotionFileExt:
+			motions, err := mqo.LoadMotions(f)
+			if err != nil {
+				log.Fatal(err)
+			}
+			kp := mqo.GetKeyframerPlugin(doc)
+			kp.Motions = append(kp.Motions, motions...)
+		case ".vmd":
+			if isGltf(outputExt) {
+				continue // see saveDocument()
+			}
+			ani, err := loadAnimation(f)
+			if err != nil {
+				log.Fatal(err)
+			}
+			kp := mqo.GetKeyframerPlugin(doc)
+			kp.Motions = append(kp.Motions, converter.MMDAnimationToMotion(ani, 1))
+		}
+	}
+
 	// transform
 	if scaleVec != nil {
 		doc.ApplyTransform(geom.NewScaleMatrix4(scaleVec.X, scaleVec.Y, scaleVec.Z))
@@ -388,6 +468,44 @@ func main() {
 		input = names[0]
 	}
 	baseDir := filepath.Dir(input)
+	modelName := strings.TrimSuffix(filepath.Base(flag.Arg(0)), filepath.Ext(flag.Arg(0)))
+
+	if *bakeAO != "" {
+		if *bakeAO != "texture" && *bakeAO != "vertex" {
+			log.Fatal("invalid bakeAO: ", *bakeAO)
+		}
+		opt := &converter.AOBakeOption{
+			PerVertex:  *bakeAO == "vertex",
+			Samples:    *aoSamples,
+			Distance:   float32(*aoDistance),
+			Resolution: *bakeResolution,
+			Name:       modelName,
+		}
+		if err := converter.BakeAmbientOcclusion(doc, baseDir, opt); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *bakeColors != "" {
+		opt := &converter.TextureBakeOption{Name: modelName, Resolution: *bakeResolution}
+		for _, c := range strings.Split(*bakeColors, ",") {
+			switch c {
+			case "vertex":
+				opt.VertexColor = true
+			case "material":
+				opt.MaterialColor = true
+			case "emission":
+				opt.Emission = true
+			case "all":
+				opt.VertexColor, opt.MaterialColor, opt.Emission = true, true, true
+			default:
+				log.Fatal("invalid bakeColors: ", c)
+			}
+		}
+		if err := converter.BakeTextures(doc, baseDir, opt); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	log.Print("out: ", output)
 	if err = saveDocument(doc, output, outputExt, baseDir, flag.Args()[0:inputN]); err != nil {
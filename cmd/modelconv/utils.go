@@ -26,7 +26,7 @@ func loadAnimation(input string) (*mmd.Animation, error) {
 	return p.Parse()
 }
 
-func loadDocument(input string) (*mqo.Document, error) {
+func loadDocument(input, outputExt string) (*mqo.Document, error) {
 	ext := strings.ToLower(filepath.Ext(input))
 	switch {
 	case isMQO(ext):
@@ -82,7 +82,14 @@ func loadDocument(input string) (*mqo.Document, error) {
 		if err != nil {
 			return nil, err
 		}
-		return converter.NewUnityToMQOConverter(&converter.UnityToMQOOption{ConvertPhysics: *convertPhysics, SaveTexrure: true}).Convert(scene)
+		return converter.NewUnityToMQOConverter(&converter.UnityToMQOOption{
+			ConvertPhysics:    *convertPhysics,
+			SaveTexrure:       true,
+			TextureTransform:  isGltf(outputExt),
+			TerrainResolution: *terrainResolution,
+			HighestLODOnly:    *highestLODOnly || !isGltf(outputExt),
+			BakeLightmap:      *unityLightmap,
+		}).Convert(scene)
 	case ext == ".fbx":
 		doc, err := fbx.Load(input)
 		if err != nil {
@@ -94,8 +101,11 @@ func loadDocument(input string) (*mqo.Document, error) {
 	}
 }
 
-func saveAsPmx(doc *mqo.Document, path string) error {
-	result, err := converter.NewMQOToMMDConverter(nil).Convert(doc)
+func saveAsPmx(doc *mqo.Document, path, srcDir string) error {
+	result, err := converter.NewMQOToMMDConverter(&converter.MQOToMMDOption{
+		TextureDir: srcDir,
+		OutputDir:  filepath.Dir(path),
+	}).Convert(doc)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,203 @@
+package converter
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"github.com/binzume/modelconv/geom"
+	"github.com/binzume/modelconv/mqo"
+	"golang.org/x/image/draw"
+)
+
+// mergeAlphaTexture copies the alpha texture to the alpha channel of the base texture.
+// The alpha texture is resampled to the size of the base texture. base can be nil.
+// The alpha channel of the alpha texture is used if it has transparency, otherwise the brightness is used.
+func mergeAlphaTexture(base, alpha image.Image) *image.NRGBA {
+	var dst *image.NRGBA
+	if base != nil {
+		dst = image.NewNRGBA(image.Rect(0, 0, base.Bounds().Dx(), base.Bounds().Dy()))
+		draw.Draw(dst, dst.Bounds(), base, base.Bounds().Min, draw.Src)
+	} else {
+		dst = image.NewNRGBA(image.Rect(0, 0, alpha.Bounds().Dx(), alpha.Bounds().Dy()))
+		draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	}
+
+	if alpha.Bounds().Size() != dst.Bounds().Size() {
+		scaled := image.NewNRGBA(dst.Bounds())
+		draw.BiLinear.Scale(scaled, scaled.Bounds(), alpha, alpha.Bounds(), draw.Src, nil)
+		alpha = scaled
+	}
+	b := alpha.Bounds()
+	useAlpha := false
+	for y := b.Min.Y; y < b.Max.Y && !useAlpha; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := alpha.At(x, y).RGBA(); a < 0xffff {
+				useAlpha = true
+				break
+			}
+		}
+	}
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			c := alpha.At(b.Min.X+x, b.Min.Y+y)
+			a := color.GrayModel.Convert(c).(color.Gray).Y
+			if useAlpha {
+				_, _, _, a32 := c.RGBA()
+				a = uint8(a32 >> 8)
+			}
+			i := dst.PixOffset(x, y)
+			// Un-premultiplied base color is kept as is.
+			dst.Pix[i+3] = uint8(uint32(dst.Pix[i+3]) * uint32(a) / 255)
+		}
+	}
+	return dst
+}
+
+// alphaMergedTextureName returns the file name of the merged texture. e.g. base_alpha_merged.png
+// The name always has the suffix not to be the same as the source textures.
+func alphaMergedTextureName(texture, alphaTexture string) string {
+	name := strings.TrimSuffix(filepath.Base(alphaTexture), filepath.Ext(alphaTexture))
+	if texture != "" {
+		name = strings.TrimSuffix(filepath.Base(texture), filepath.Ext(texture)) + "_" + name
+	}
+	return name + "_merged.png"
+}
+
+// alphaModeFromHistogram returns mqo.AlphaModeOpaque, mqo.AlphaModeMask or mqo.AlphaModeBlend and the estimated cutoff for the mask mode.
+// Textures which are almost binary (antialiased edges only) are treated as cutout.
+func alphaModeFromHistogram(hist *[256]int) (int, float32) {
+	var total, transparent, partial int
+	for a, n := range hist {
+		total += n
+		if a <= 16 {
+			transparent += n
+		} else if a < 239 {
+			partial += n
+		}
+	}
+	if (transparent+partial)*1000 <= total {
+		// Ignore a few pixels on the edges of the UV islands.
+		return mqo.AlphaModeOpaque, 0
+	} else if partial*4 < transparent {
+		return mqo.AlphaModeMask, alphaCutoff(hist)
+	}
+	return mqo.AlphaModeBlend, 0
+}
+
+// alphaCutoff returns the threshold which separates transparent and opaque pixels. (Otsu's method)
+func alphaCutoff(hist *[256]int) float32 {
+	var total, sum float64
+	for a, n := range hist {
+		total += float64(n)
+		sum += float64(a * n)
+	}
+	var wb, sumb, best float64
+	lo, hi := 127, 127
+	for a := 0; a < 255; a++ {
+		wb += float64(hist[a])
+		sumb += float64(a * hist[a])
+		wf := total - wb
+		if wb == 0 || wf == 0 {
+			continue
+		}
+		d := sumb/wb - (sum-sumb)/wf
+		if v := wb * wf * d * d; v > best {
+			best, lo, hi = v, a, a
+		} else if v == best {
+			hi = a
+		}
+	}
+	// Middle of the empty range between transparent and opaque pixels.
+	return (float32(lo+hi)/2 + 0.5) / 255
+}
+
+// alphaHistogram counts the alpha values of the image. Only the pixels in the mask are counted if the mask is not nil.
+func alphaHistogram(img image.Image, mask []bool) *[256]int {
+	var hist [256]int
+	b := img.Bounds()
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		hist[255] = b.Dx() * b.Dy()
+		if mask != nil {
+			hist[255] = 0
+			for _, v := range mask {
+				if v {
+					hist[255]++
+				}
+			}
+		}
+		return &hist
+	}
+	nrgba, _ := img.(*image.NRGBA)
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			if mask != nil && !mask[y*b.Dx()+x] {
+				continue
+			}
+			if nrgba != nil {
+				hist[nrgba.Pix[nrgba.PixOffset(b.Min.X+x, b.Min.Y+y)+3]]++
+			} else {
+				_, _, _, a := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+				hist[a>>8]++
+			}
+		}
+	}
+	return &hist
+}
+
+// uvTriangles is the UV triangles of the faces which use a material.
+type uvTriangles [][3]geom.Vector2
+
+// coverage rasterizes the triangles into a w*h mask. UVs outside [0,1] are wrapped (repeat).
+func (t uvTriangles) coverage(w, h int) []bool {
+	mask := make([]bool, w*h)
+	set := func(x, y int) {
+		x, y = x%w, y%h
+		if x < 0 {
+			x += w
+		}
+		if y < 0 {
+			y += h
+		}
+		mask[y*w+x] = true
+	}
+	edge := func(a, b [2]float32, x, y float32) float32 {
+		return (b[0]-a[0])*(y-a[1]) - (b[1]-a[1])*(x-a[0])
+	}
+	for _, tri := range t {
+		var p [3][2]float32
+		minX, minY, maxX, maxY := math.MaxInt32, math.MaxInt32, math.MinInt32, math.MinInt32
+		for i, uv := range tri {
+			p[i] = [2]float32{uv.X * float32(w), uv.Y * float32(h)}
+			x, y := int(math.Floor(float64(p[i][0]))), int(math.Floor(float64(p[i][1])))
+			minX, minY, maxX, maxY = minInt(minX, x), minInt(minY, y), maxInt(maxX, x), maxInt(maxY, y)
+		}
+		if (maxX-minX+1)*(maxY-minY+1) > w*h*4 {
+			for i := range mask {
+				mask[i] = true
+			}
+			return mask
+		}
+		covered := false
+		if area := edge(p[0], p[1], p[2][0], p[2][1]); area != 0 {
+			for y := minY; y <= maxY; y++ {
+				for x := minX; x <= maxX; x++ {
+					cx, cy := float32(x)+0.5, float32(y)+0.5
+					e0, e1, e2 := edge(p[1], p[2], cx, cy), edge(p[2], p[0], cx, cy), edge(p[0], p[1], cx, cy)
+					if area > 0 && e0 >= 0 && e1 >= 0 && e2 >= 0 || area < 0 && e0 <= 0 && e1 <= 0 && e2 <= 0 {
+						set(x, y)
+						covered = true
+					}
+				}
+			}
+		}
+		if !covered {
+			// Triangles smaller than a pixel. (Vertices on the right or bottom edge must not be wrapped)
+			cx, cy := (p[0][0]+p[1][0]+p[2][0])/3, (p[0][1]+p[1][1]+p[2][1])/3
+			set(int(math.Floor(float64(cx))), int(math.Floor(float64(cy))))
+		}
+	}
+	return mask
+}
@@ -0,0 +1,175 @@
+package converter
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/binzume/modelconv/geom"
+	"github.com/binzume/modelconv/mqo"
+	"github.com/qmuntal/gltf"
+)
+
+func writeTestPNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAlphaMergedTextureName(t *testing.T) {
+	if name := alphaMergedTextureName("", "mask.png"); name != "mask_merged.png" {
+		t.Error("name: ", name)
+	}
+	if name := alphaMergedTextureName("tex/base.bmp", "tex/mask.png"); name != "base_mask_merged.png" {
+		t.Error("name: ", name)
+	}
+}
+
+func TestSaveAlphaMergedTextureNotOverwriteInputs(t *testing.T) {
+	dir := t.TempDir()
+	mask := image.NewGray(image.Rect(0, 0, 4, 4))
+	mask.SetGray(1, 1, color.Gray{Y: 255})
+	writeTestPNG(t, filepath.Join(dir, "mask.png"), mask)
+	// A texture which has the same name as the merged texture.
+	writeTestPNG(t, filepath.Join(dir, "mask_merged.png"), image.NewGray(image.Rect(0, 0, 2, 2)))
+	original, _ := os.ReadFile(filepath.Join(dir, "mask_merged.png"))
+
+	doc := mqo.NewDocument()
+	white := geom.Vector4{X: 1, Y: 1, Z: 1, W: 1}
+	doc.Materials = []*mqo.Material{
+		{Name: "mat1", Color: white, AlphaTexture: "mask.png"},
+		{Name: "mat2", Color: white, Texture: "mask_merged.png"},
+	}
+	c := NewMQOToMMDConverter(&MQOToMMDOption{TextureDir: dir})
+	name, err := c.saveAlphaMergedTexture(doc.Materials[0], c.inputTextures(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "mask_merged_2.png" {
+		t.Error("name: ", name)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "mask_merged.png")); !bytes.Equal(b, original) {
+		t.Error("input texture is overwritten")
+	}
+	if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAlphaCutoff(t *testing.T) {
+	var hist [256]int
+	hist[0], hist[255] = 100, 100
+	if c := alphaCutoff(&hist); c != 0.5 {
+		t.Error("cutoff: ", c)
+	}
+
+	// Antialiased edges between 10 and 240.
+	hist = [256]int{}
+	hist[10], hist[20], hist[180], hist[240] = 500, 5, 5, 300
+	if c := alphaCutoff(&hist); c <= 20.0/255 || c >= 180.0/255 {
+		t.Error("cutoff: ", c)
+	}
+	if mode, c := alphaModeFromHistogram(&hist); mode != mqo.AlphaModeMask || c != alphaCutoff(&hist) {
+		t.Error("mode: ", mode, c)
+	}
+
+	hist = [256]int{}
+	hist[128], hist[255] = 100, 100
+	if mode, _ := alphaModeFromHistogram(&hist); mode != mqo.AlphaModeBlend {
+		t.Error("mode: ", mode)
+	}
+	hist = [256]int{}
+	hist[0], hist[255] = 1, 10000
+	if mode, _ := alphaModeFromHistogram(&hist); mode != mqo.AlphaModeOpaque {
+		t.Error("mode: ", mode)
+	}
+}
+
+func TestUVTrianglesCoverage(t *testing.T) {
+	tris := uvTriangles{{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 0, Y: 1}}}
+	mask := tris.coverage(4, 4)
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			if mask[y*4+x] != (x+y <= 3) {
+				t.Errorf("(%d,%d): %v", x, y, mask[y*4+x])
+			}
+		}
+	}
+
+	// Wrapped and smaller than a pixel.
+	tris = uvTriangles{{{X: 1.6, Y: -0.4}, {X: 1.61, Y: -0.4}, {X: 1.6, Y: -0.39}}}
+	mask = tris.coverage(4, 4)
+	for i, v := range mask {
+		if v != (i == 2*4+2) {
+			t.Errorf("%d: %v", i, v)
+		}
+	}
+}
+
+func TestAlphaHistogramMask(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 2; x < 4; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{255, 255, 255, 255})
+		}
+	}
+	mask := make([]bool, 16)
+	for y := 0; y < 4; y++ {
+		mask[y*4+2], mask[y*4+3] = true, true
+	}
+
+	hist := alphaHistogram(img, nil)
+	if hist[0] != 8 || hist[255] != 8 {
+		t.Error("hist: ", hist[0], hist[255])
+	}
+	hist = alphaHistogram(img, mask)
+	if hist[0] != 0 || hist[255] != 8 {
+		t.Error("masked hist: ", hist[0], hist[255])
+	}
+}
+
+func TestAddAlphaMergedTextureCoverage(t *testing.T) {
+	dir := t.TempDir()
+	// Transparent left half.
+	alpha := image.NewGray(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 4; x < 8; x++ {
+			alpha.SetGray(x, y, color.Gray{255})
+		}
+	}
+	writeTestPNG(t, filepath.Join(dir, "alpha.png"), alpha)
+
+	m := &mqoToGltf{Document: gltf.NewDocument(), MQOToGLTFOption: &MQOToGLTFOption{}, extensions: map[string]bool{}}
+	m.textureJobs = newTexturePool(1, 1<<30, false)
+	textures := newTextureCache(dir, 1<<20)
+	mat := &mqo.Material{AlphaTexture: "alpha.png"}
+
+	id, mode, _, err := m.addAlphaMergedTexture(mat, textures, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode != mqo.AlphaModeMask {
+		t.Error("mode: ", mode)
+	}
+
+	right := uvTriangles{{{X: 0.5, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}}, {{X: 0.5, Y: 0}, {X: 1, Y: 1}, {X: 0.5, Y: 1}}}
+	id2, mode, _, err := m.addAlphaMergedTexture(mat, textures, right)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode != mqo.AlphaModeOpaque {
+		t.Error("mode: ", mode)
+	}
+	if *id != *id2 || len(m.Textures) != 1 {
+		t.Error("the merged texture should be shared")
+	}
+}
@@ -0,0 +1,371 @@
+package converter
+
+import (
+	"image"
+	"image/color"
+	"log"
+	"math"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/binzume/modelconv/geom"
+	"github.com/binzume/modelconv/mqo"
+)
+
+// AOBakeOption specifies the parameters of BakeAmbientOcclusion().
+type AOBakeOption struct {
+	PerVertex  bool    // Multiply AO into the vertex colors instead of the occlusion textures.
+	Samples    int     // Rays per texel or vertex. Default: 32
+	Distance   float32 // Max distance of the occluders. Default: 10% of the size of the model
+	Resolution int     // Size of the occlusion textures. Default: 1024
+	Dilation   int     // Pixels to extend the UV islands. Default: 4
+	Name       string  // Model name in the texture file names. e.g. Name_Material_ao.png
+	OutputDir  string  // Relative to srcDir. Default: "saved_textures"
+}
+
+// BakeAmbientOcclusion computes ambient occlusion of the visible objects by ray tracing.
+// Mirror and subdivision surfaces are applied to a copy of the objects, so the document is not modified except the results.
+// Occlusion textures are referenced by the "Occlusion" mapping of the glTF shader, or Material.Extra["occlusionTexture"] for other shaders.
+func BakeAmbientOcclusion(doc *mqo.Document, srcDir string, option *AOBakeOption) error {
+	if option == nil {
+		option = &AOBakeOption{}
+	}
+	samples := option.Samples
+	if samples <= 0 {
+		samples = 32
+	}
+	resolution := option.Resolution
+	if resolution <= 0 {
+		resolution = 1024
+	}
+	dilation := option.Dilation
+	if dilation == 0 {
+		dilation = 4
+	}
+	outDir := option.OutputDir
+	if outDir == "" {
+		outDir = "saved_textures"
+	}
+
+	// Plugins are not copied not to modify the bones of the document.
+	frozen := &mqo.Document{Materials: doc.Materials}
+	for _, obj := range doc.Objects {
+		frozen.Objects = append(frozen.Objects, obj.Clone())
+	}
+	frozen.ApplyMirrorAndPatch()
+	scene := newAOScene(frozen)
+	if len(scene.tris) == 0 {
+		return nil
+	}
+	distance := option.Distance
+	if distance <= 0 {
+		size := scene.nodes[0].max.Sub(&scene.nodes[0].min)
+		distance = size.Len() * 0.1
+	}
+	dirs := aoSampleDirections(samples)
+
+	if option.PerVertex {
+		// Vertex colors of the control points. They are interpolated when the subdivision surfaces are applied.
+		for _, obj := range doc.Objects {
+			if !obj.Visible || len(obj.Faces) == 0 {
+				continue
+			}
+			normals := obj.GetSmoothNormals()
+			ao := make([]float32, len(obj.Vertexes))
+			parallelFor(len(obj.Vertexes), func(i int) {
+				ao[i] = scene.occlusion(obj.Vertexes[i], &normals[i], dirs, distance, uint32(i))
+			})
+			if len(obj.VertexColors) != len(obj.Vertexes) {
+				obj.VertexColors = make([]mqo.Vector4, len(obj.Vertexes))
+				for i := range obj.VertexColors {
+					obj.VertexColors[i] = mqo.Vector4{X: 1, Y: 1, Z: 1, W: 1}
+				}
+			}
+			for i, v := range ao {
+				c := &obj.VertexColors[i]
+				c.X, c.Y, c.Z = c.X*v, c.Y*v, c.Z*v
+			}
+		}
+		return nil
+	}
+
+	names := map[string]bool{}
+	for i, mat := range doc.Materials {
+		if strings.HasSuffix(mat.Name, "$IGNORE") || strings.HasPrefix(mat.Name, "$MORPH:") || materialIsUnlit(mat) {
+			continue
+		}
+		img := bakeOcclusionTexture(frozen, scene, i, resolution, dilation, dirs, distance)
+		if img == nil {
+			continue
+		}
+		name := bakedTextureName(names, option.Name, mat.Name, "_ao.png")
+		if err := saveBakedTexture(filepath.Join(srcDir, outDir, name), img); err != nil {
+			return err
+		}
+		texture := filepath.ToSlash(filepath.Join(outDir, name))
+		if mat.GetShaderName() == mqo.ShaderNameGlTF {
+			mat.Ex2.ShaderMapping["Occlusion"] = texture
+		} else {
+			if mat.Extra == nil {
+				mat.Extra = map[string]interface{}{}
+			}
+			mat.Extra["occlusionTexture"] = texture
+		}
+		log.Printf("AO: %v -> %v", mat.Name, texture)
+	}
+	return nil
+}
+
+// bakeOcclusionTexture returns nil if the material is not used by the visible faces with UVs.
+func bakeOcclusionTexture(doc *mqo.Document, scene *aoScene, material, resolution, dilation int, dirs []geom.Vector3, distance float32) *image.NRGBA {
+	type texel struct {
+		x, y   int
+		pos    geom.Vector3
+		normal geom.Vector3
+	}
+	var texels []texel
+	for _, obj := range doc.Objects {
+		if !obj.Visible {
+			continue
+		}
+		var normals []geom.Vector3
+		for _, f := range obj.Faces {
+			if f.Material != material || len(f.Verts) < 3 || len(f.UVs) != len(f.Verts) {
+				continue
+			}
+			if normals == nil {
+				normals = obj.GetSmoothNormals()
+			}
+			rasterizeFaceUV(f, resolution, resolution, func(x, y int, vs [3]int, b [3]float32) {
+				t := texel{x: x, y: y}
+				for j, v := range vs {
+					t.pos = *t.pos.Add(obj.Vertexes[f.Verts[v]].Scale(b[j]))
+					n := &normals[f.Verts[v]]
+					if len(f.Normals) == len(f.Verts) && f.Normals[v] != nil {
+						n = f.Normals[v]
+					}
+					t.normal = *t.normal.Add(n.Scale(b[j]))
+				}
+				t.normal.Normalize()
+				texels = append(texels, t)
+			})
+		}
+	}
+	if len(texels) == 0 {
+		return nil
+	}
+
+	ao := make([]float32, len(texels))
+	parallelFor(len(texels), func(i int) {
+		t := &texels[i]
+		ao[i] = scene.occlusion(&t.pos, &t.normal, dirs, distance, uint32(t.y*resolution+t.x))
+	})
+
+	img := image.NewNRGBA(image.Rect(0, 0, resolution, resolution))
+	covered := make([]bool, resolution*resolution)
+	for i, t := range texels {
+		v := toUint8(ao[i])
+		img.SetNRGBA(t.x, t.y, color.NRGBA{R: v, G: v, B: v, A: 255})
+		covered[t.y*resolution+t.x] = true
+	}
+	covered = dilateImage(img, covered, dilation)
+	for i, c := range covered {
+		if !c {
+			img.Pix[i*4], img.Pix[i*4+1], img.Pix[i*4+2], img.Pix[i*4+3] = 255, 255, 255, 255
+		}
+	}
+	return img
+}
+
+// aoSampleDirections returns cosine weighted directions around +Z. (Fibonacci spiral)
+func aoSampleDirections(n int) []geom.Vector3 {
+	dirs := make([]geom.Vector3, n)
+	golden := math.Pi * (3 - math.Sqrt(5))
+	for i := range dirs {
+		r := math.Sqrt((float64(i) + 0.5) / float64(n))
+		a := golden * float64(i)
+		dirs[i] = geom.Vector3{X: float32(r * math.Cos(a)), Y: float32(r * math.Sin(a)), Z: float32(math.Sqrt(1 - r*r))}
+	}
+	return dirs
+}
+
+func parallelFor(n int, f func(i int)) {
+	workers := runtime.NumCPU()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < n; i += workers {
+				f(i)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+type aoTriangle struct {
+	p0, e1, e2 geom.Vector3
+	center     geom.Vector3
+}
+
+type aoNode struct {
+	min, max    geom.Vector3
+	left, right int // children. leaf if left < 0
+	start, end  int // triangles of the leaf
+}
+
+// aoScene is a BVH of the triangles of the visible objects.
+type aoScene struct {
+	tris  []aoTriangle
+	nodes []aoNode
+}
+
+func newAOScene(doc *mqo.Document) *aoScene {
+	s := &aoScene{}
+	for _, obj := range doc.Objects {
+		if !obj.Visible {
+			continue
+		}
+		for _, f := range obj.Faces {
+			if len(f.Verts) < 3 {
+				continue
+			}
+			var poly []*geom.Vector3
+			for _, v := range f.Verts {
+				poly = append(poly, obj.Vertexes[v])
+			}
+			for _, tri := range geom.Triangulate(poly) {
+				p0, p1, p2 := poly[tri[0]], poly[tri[1]], poly[tri[2]]
+				t := aoTriangle{p0: *p0, e1: *p1.Sub(p0), e2: *p2.Sub(p0)}
+				t.center = *p0.Add(p1).Add(p2).Scale(1.0 / 3)
+				s.tris = append(s.tris, t)
+			}
+		}
+	}
+	if len(s.tris) > 0 {
+		s.build(0, len(s.tris))
+	}
+	return s
+}
+
+func (s *aoScene) build(start, end int) int {
+	node := aoNode{left: -1, right: -1, start: start, end: end}
+	node.min = s.tris[start].p0
+	node.max = node.min
+	for _, t := range s.tris[start:end] {
+		for _, p := range []geom.Vector3{t.p0, *t.p0.Add(&t.e1), *t.p0.Add(&t.e2)} {
+			node.min = geom.Vector3{X: geom.Min(node.min.X, p.X), Y: geom.Min(node.min.Y, p.Y), Z: geom.Min(node.min.Z, p.Z)}
+			node.max = geom.Vector3{X: geom.Max(node.max.X, p.X), Y: geom.Max(node.max.Y, p.Y), Z: geom.Max(node.max.Z, p.Z)}
+		}
+	}
+	index := len(s.nodes)
+	s.nodes = append(s.nodes, node)
+	if end-start <= 4 {
+		return index
+	}
+
+	// Split at the median of the longest axis.
+	size := node.max.Sub(&node.min)
+	axis := func(v *geom.Vector3) float32 { return v.X }
+	if size.Y > size.X && size.Y >= size.Z {
+		axis = func(v *geom.Vector3) float32 { return v.Y }
+	} else if size.Z > size.X && size.Z > size.Y {
+		axis = func(v *geom.Vector3) float32 { return v.Z }
+	}
+	tris := s.tris[start:end]
+	sort.Slice(tris, func(i, j int) bool { return axis(&tris[i].center) < axis(&tris[j].center) })
+	mid := (start + end) / 2
+	left := s.build(start, mid)
+	right := s.build(mid, end)
+	s.nodes[index].left, s.nodes[index].right = left, right
+	return index
+}
+
+// occlusion returns the ratio of the rays which are not occluded. (1: not occluded)
+// The sample directions are rotated around the normal by the seed to avoid banding.
+func (s *aoScene) occlusion(pos, normal *geom.Vector3, dirs []geom.Vector3, distance float32, seed uint32) float32 {
+	// Orthonormal basis
+	up := geom.Vector3{X: 0, Y: 1, Z: 0}
+	if geom.Abs(normal.Y) > 0.9 {
+		up = geom.Vector3{X: 1, Y: 0, Z: 0}
+	}
+	tangent := up.Cross(normal).Normalize()
+	bitangent := normal.Cross(tangent)
+	seed = seed*2654435761 + 1
+	angle := float64(seed>>8) / float64(1<<24) * 2 * math.Pi
+	sin, cos := float32(math.Sin(angle)), float32(math.Cos(angle))
+
+	origin := *pos.Add(normal.Scale(distance * 1e-3))
+	hits := 0
+	for _, d := range dirs {
+		x, y := d.X*cos-d.Y*sin, d.X*sin+d.Y*cos
+		dir := *tangent.Scale(x).Add(bitangent.Scale(y)).Add(normal.Scale(d.Z))
+		if s.intersects(&origin, &dir, distance) {
+			hits++
+		}
+	}
+	return 1 - float32(hits)/float32(len(dirs))
+}
+
+func (s *aoScene) intersects(origin, dir *geom.Vector3, distance float32) bool {
+	inv := geom.Vector3{X: 1 / dir.X, Y: 1 / dir.Y, Z: 1 / dir.Z}
+	var buf [64]int
+	stack := append(buf[:0], 0)
+	for len(stack) > 0 {
+		n := &s.nodes[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
+		if !rayBoxIntersects(origin, &inv, &n.min, &n.max, distance) {
+			continue
+		}
+		if n.left >= 0 {
+			stack = append(stack, n.left, n.right)
+			continue
+		}
+		for i := n.start; i < n.end; i++ {
+			if t := rayTriangleIntersects(origin, dir, &s.tris[i]); t > 0 && t < distance {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func rayBoxIntersects(origin, inv, min, max *geom.Vector3, distance float32) bool {
+	tmin, tmax := float32(0), distance
+	for _, a := range [][4]float32{{origin.X, inv.X, min.X, max.X}, {origin.Y, inv.Y, min.Y, max.Y}, {origin.Z, inv.Z, min.Z, max.Z}} {
+		t0, t1 := (a[2]-a[0])*a[1], (a[3]-a[0])*a[1]
+		if t0 > t1 {
+			t0, t1 = t1, t0
+		}
+		tmin, tmax = geom.Max(tmin, t0), geom.Min(tmax, t1)
+		if tmin > tmax {
+			return false
+		}
+	}
+	return true
+}
+
+// rayTriangleIntersects returns the distance to the triangle or -1. (Moller-Trumbore)
+func rayTriangleIntersects(origin, dir *geom.Vector3, t *aoTriangle) float32 {
+	p := dir.Cross(&t.e2)
+	det := t.e1.Dot(p)
+	if geom.Abs(det) < 1e-12 {
+		return -1
+	}
+	inv := 1 / det
+	s := origin.Sub(&t.p0)
+	u := s.Dot(p) * inv
+	if u < 0 || u > 1 {
+		return -1
+	}
+	q := s.Cross(&t.e1)
+	v := dir.Dot(q) * inv
+	if v < 0 || u+v > 1 {
+		return -1
+	}
+	return t.e2.Dot(q) * inv
+}
@@ -0,0 +1,126 @@
+package converter
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/binzume/modelconv/mqo"
+)
+
+// newTestAODocument returns a 10x10 floor and the roofs over the both sides of the floor.
+func newTestAODocument() *mqo.Document {
+	doc := mqo.NewDocument()
+	up := &mqo.Vector3{X: 0, Y: 1, Z: 0}
+	floor := mqo.NewObject("floor")
+	floor.Vertexes = []*mqo.Vector3{{X: -5, Z: 0}, {X: 5, Z: 0}, {X: 5, Z: 10}, {X: -5, Z: 10}}
+	floor.Faces = []*mqo.Face{{Verts: []int{0, 1, 2, 3}, Material: 0,
+		UVs:     []mqo.Vector2{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}, {X: 0, Y: 1}},
+		Normals: []*mqo.Vector3{up, up, up, up}}}
+
+	// The right half is made by the mirror.
+	roof := mqo.NewObject("roof")
+	roof.Vertexes = []*mqo.Vector3{{X: -4, Y: 1, Z: 0}, {X: -1, Y: 1, Z: 0}, {X: -1, Y: 1, Z: 10}, {X: -4, Y: 1, Z: 10}}
+	roof.Faces = []*mqo.Face{{Verts: []int{0, 1, 2, 3}, Material: 1,
+		UVs: []mqo.Vector2{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}, {X: 0, Y: 1}}}}
+	roof.Mirror, roof.MirrorAxis = mqo.MirrorSeparate, mqo.MirrorAxisX
+
+	doc.Objects = []*mqo.Object{floor, roof}
+	doc.Materials = []*mqo.Material{
+		{Name: "floor", Color: mqo.Vector4{X: 1, Y: 1, Z: 1, W: 1}, Shader: mqo.ShaderPhong},
+		{Name: "roof", Color: mqo.Vector4{X: 1, Y: 1, Z: 1, W: 1}, Ex2: mqo.NewMaterialEx2("pmd")},
+	}
+	return doc
+}
+
+func TestBakeAmbientOcclusionTexture(t *testing.T) {
+	dir := t.TempDir()
+	doc := newTestAODocument()
+
+	err := BakeAmbientOcclusion(doc, dir, &AOBakeOption{Name: "model", Resolution: 32, Samples: 64, Distance: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The document is not modified except the materials.
+	roof := doc.Objects[1]
+	if roof.Mirror != mqo.MirrorSeparate || len(roof.Vertexes) != 4 || len(roof.Faces) != 1 {
+		t.Error("the mirror is applied to the document")
+	}
+	floor, roofMat := doc.Materials[0], doc.Materials[1]
+	if floor.Shader != mqo.ShaderPhong || floor.Ex2 != nil || roofMat.Ex2.ShaderName != "pmd" {
+		t.Error("the shaders are changed")
+	}
+
+	texture, _ := floor.Extra["occlusionTexture"].(string)
+	if texture != "saved_textures/model_floor_ao.png" {
+		t.Fatal("texture: ", texture)
+	}
+	f, err := os.Open(filepath.Join(dir, texture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ao := func(x, y float32) uint32 {
+		r, _, _, _ := img.At(int(x*32), int(y*32)).RGBA()
+		return r >> 8
+	}
+	// Under the roof, under the mirrored roof and the gap between the roofs.
+	if !(ao(0.7, 0.5) < ao(0.5, 0.5) && ao(0.3, 0.5) < ao(0.5, 0.5)) {
+		t.Error("occlusion: ", ao(0.3, 0.5), ao(0.5, 0.5), ao(0.7, 0.5))
+	}
+	if _, ok := roofMat.Extra["occlusionTexture"]; !ok {
+		t.Error("roof texture is not baked")
+	}
+}
+
+func TestBakeAmbientOcclusionGltfShader(t *testing.T) {
+	doc := newTestAODocument()
+	doc.Materials[0].Ex2 = mqo.NewMaterialEx2(mqo.ShaderNameGlTF)
+	doc.Materials[1].Shader = mqo.ShaderConstant
+	doc.Materials[1].Ex2 = nil
+
+	if err := BakeAmbientOcclusion(doc, t.TempDir(), &AOBakeOption{Resolution: 8, Samples: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Materials[0].Ex2.Mapping("Occlusion") != "saved_textures/floor_ao.png" || doc.Materials[0].Extra != nil {
+		t.Error("occlusion mapping: ", doc.Materials[0].Ex2.ShaderMapping)
+	}
+	if doc.Materials[1].Extra != nil {
+		t.Error("unlit materials should not be baked")
+	}
+}
+
+func TestBakeAmbientOcclusionVertex(t *testing.T) {
+	doc := newTestAODocument()
+	doc.Objects[0].VertexColors = []mqo.Vector4{{X: 1, Y: 0.5, Z: 1, W: 1}, {X: 1, Y: 1, Z: 1, W: 1}, {X: 1, Y: 1, Z: 1, W: 1}, {X: 1, Y: 1, Z: 1, W: 1}}
+
+	if err := BakeAmbientOcclusion(doc, t.TempDir(), &AOBakeOption{PerVertex: true, Samples: 16}); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Objects[1].Vertexes) != 4 || len(doc.Objects[1].VertexColors) != 4 {
+		t.Error("vertex colors of the original vertices: ", len(doc.Objects[1].VertexColors))
+	}
+	if c := doc.Objects[0].VertexColors[0]; c.Y > 0.5 || c.Y != c.X*0.5 || c.W != 1 {
+		t.Error("AO is not multiplied: ", c)
+	}
+}
+
+func TestConvertMaterialOcclusionTexture(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPNG(t, filepath.Join(dir, "ao.png"), image.NewGray(image.Rect(0, 0, 4, 4)))
+	m := newTestTextureConverter(1)
+	m.MQOToGLTFOption = &MQOToGLTFOption{}
+	mat := &mqo.Material{Name: "mat", Color: mqo.Vector4{X: 1, Y: 1, Z: 1, W: 1}, Ex2: mqo.NewMaterialEx2("pmd"),
+		Extra: map[string]interface{}{"occlusionTexture": "ao.png"}}
+
+	mm := m.convertMaterial(mat, newTextureCache(dir, 0), nil)
+	if mm.OcclusionTexture == nil || mm.OcclusionTexture.Index == nil {
+		t.Fatal("occlusion texture is not converted")
+	}
+}
@@ -0,0 +1,583 @@
+package converter
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/bits"
+)
+
+// DDS (DirectDraw Surface) decoder. Only the first surface (top mip level of the first face) is decoded.
+// Supported: DXT1-5 (BC1-3), BC4, BC5, BC7 and uncompressed RGB(A)/luminance formats.
+
+func init() {
+	image.RegisterFormat("dds", "DDS ", decodeDDS, decodeDDSConfig)
+}
+
+const (
+	ddsHeaderSize     = 4 + 124
+	ddsDX10HeaderSize = 20
+
+	ddpfAlphaPixels = 0x1
+	ddpfAlpha       = 0x2
+	ddpfFourCC      = 0x4
+	ddpfRGB         = 0x40
+	ddpfLuminance   = 0x20000
+
+	// Larger images are rejected before allocating the pixels.
+	ddsMaxPixels = 16384 * 16384
+)
+
+type ddsPixelFormat struct {
+	flags    uint32
+	fourCC   string
+	bitCount uint32
+	masks    [4]uint32 // R, G, B, A
+}
+
+type ddsFormat struct {
+	width, height int
+	blockSize     int                                  // 0: uncompressed
+	decodeBlock   func(b []byte, dst *[16]color.NRGBA) // for block compressed formats
+	pf            ddsPixelFormat                       // for uncompressed formats
+	premultiplied bool                                 // DXT2 and DXT4
+}
+
+func readDDSHeader(r io.Reader) (*ddsFormat, error) {
+	var h [ddsHeaderSize]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return nil, err
+	}
+	if string(h[:4]) != "DDS " {
+		return nil, errors.New("dds: invalid header")
+	}
+	u32 := func(off int) uint32 { return binary.LittleEndian.Uint32(h[4+off:]) }
+	f := &ddsFormat{height: int(u32(8)), width: int(u32(12))}
+	f.pf = ddsPixelFormat{
+		flags:    u32(76),
+		fourCC:   string(h[4+80 : 4+84]),
+		bitCount: u32(84),
+		masks:    [4]uint32{u32(88), u32(92), u32(96), u32(100)},
+	}
+	if f.width <= 0 || f.height <= 0 || f.width > 1<<16 || f.height > 1<<16 || f.width*f.height > ddsMaxPixels {
+		return nil, fmt.Errorf("dds: invalid size %vx%v", f.width, f.height)
+	}
+
+	if f.pf.flags&ddpfFourCC == 0 {
+		if f.pf.bitCount == 0 || f.pf.bitCount > 32 || f.pf.bitCount%8 != 0 {
+			return nil, fmt.Errorf("dds: unsupported bit count %v", f.pf.bitCount)
+		}
+		return f, nil
+	}
+
+	switch f.pf.fourCC {
+	case "DXT1":
+		f.blockSize, f.decodeBlock = 8, decodeBC1Block
+	case "DXT2", "DXT3":
+		f.blockSize, f.decodeBlock = 16, decodeBC2Block
+		f.premultiplied = f.pf.fourCC == "DXT2"
+	case "DXT4", "DXT5":
+		f.blockSize, f.decodeBlock = 16, decodeBC3Block
+		f.premultiplied = f.pf.fourCC == "DXT4"
+	case "ATI1", "BC4U":
+		f.blockSize, f.decodeBlock = 8, decodeBC4Block
+	case "BC4S":
+		f.blockSize, f.decodeBlock = 8, decodeBC4SBlock
+	case "ATI2", "BC5U":
+		f.blockSize, f.decodeBlock = 16, decodeBC5Block
+	case "BC5S":
+		f.blockSize, f.decodeBlock = 16, decodeBC5SBlock
+	case "DX10":
+		var h10 [ddsDX10HeaderSize]byte
+		if _, err := io.ReadFull(r, h10[:]); err != nil {
+			return nil, err
+		}
+		if err := f.setDXGIFormat(binary.LittleEndian.Uint32(h10[:])); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("dds: unsupported format %q", f.pf.fourCC)
+	}
+	return f, nil
+}
+
+// setDXGIFormat sets the format from DXGI_FORMAT in the DX10 header.
+func (f *ddsFormat) setDXGIFormat(format uint32) error {
+	switch format {
+	case 70, 71, 72: // BC1_TYPELESS, BC1_UNORM, BC1_UNORM_SRGB
+		f.blockSize, f.decodeBlock = 8, decodeBC1Block
+	case 73, 74, 75: // BC2
+		f.blockSize, f.decodeBlock = 16, decodeBC2Block
+	case 76, 77, 78: // BC3
+		f.blockSize, f.decodeBlock = 16, decodeBC3Block
+	case 79, 80: // BC4_TYPELESS, BC4_UNORM
+		f.blockSize, f.decodeBlock = 8, decodeBC4Block
+	case 81: // BC4_SNORM
+		f.blockSize, f.decodeBlock = 8, decodeBC4SBlock
+	case 82, 83: // BC5_TYPELESS, BC5_UNORM
+		f.blockSize, f.decodeBlock = 16, decodeBC5Block
+	case 84: // BC5_SNORM
+		f.blockSize, f.decodeBlock = 16, decodeBC5SBlock
+	case 97, 98, 99: // BC7
+		f.blockSize, f.decodeBlock = 16, decodeBC7Block
+	case 27, 28, 29: // R8G8B8A8
+		f.pf = ddsPixelFormat{flags: ddpfRGB | ddpfAlphaPixels, bitCount: 32, masks: [4]uint32{0xff, 0xff00, 0xff0000, 0xff000000}}
+	case 87, 90, 91: // B8G8R8A8
+		f.pf = ddsPixelFormat{flags: ddpfRGB | ddpfAlphaPixels, bitCount: 32, masks: [4]uint32{0xff0000, 0xff00, 0xff, 0xff000000}}
+	case 88, 92, 93: // B8G8R8X8
+		f.pf = ddsPixelFormat{flags: ddpfRGB, bitCount: 32, masks: [4]uint32{0xff0000, 0xff00, 0xff, 0}}
+	case 61: // R8_UNORM
+		f.pf = ddsPixelFormat{flags: ddpfLuminance, bitCount: 8, masks: [4]uint32{0xff, 0, 0, 0}}
+	case 65: // A8_UNORM
+		f.pf = ddsPixelFormat{flags: ddpfAlpha, bitCount: 8, masks: [4]uint32{0, 0, 0, 0xff}}
+	default:
+		return fmt.Errorf("dds: unsupported DXGI format %v", format)
+	}
+	return nil
+}
+
+func decodeDDSConfig(r io.Reader) (image.Config, error) {
+	f, err := readDDSHeader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.NRGBAModel, Width: f.width, Height: f.height}, nil
+}
+
+func decodeDDS(r io.Reader) (image.Image, error) {
+	f, err := readDDSHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, f.width, f.height))
+	if f.blockSize == 0 {
+		return img, f.decodeUncompressed(r, img)
+	}
+
+	bw, bh := (f.width+3)/4, (f.height+3)/4
+	data := make([]byte, bw*bh*f.blockSize)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	var block [16]color.NRGBA
+	for by := 0; by < bh; by++ {
+		for bx := 0; bx < bw; bx++ {
+			off := (by*bw + bx) * f.blockSize
+			f.decodeBlock(data[off:off+f.blockSize], &block)
+			if f.premultiplied {
+				unpremultiplyBlock(&block)
+			}
+			for i, c := range block {
+				x, y := bx*4+i%4, by*4+i/4
+				if x < f.width && y < f.height {
+					img.SetNRGBA(x, y, c)
+				}
+			}
+		}
+	}
+	return img, nil
+}
+
+// unpremultiplyBlock converts the premultiplied colors to straight alpha.
+func unpremultiplyBlock(block *[16]color.NRGBA) {
+	for i, c := range block {
+		if c.A == 0 || c.A == 255 {
+			continue
+		}
+		div := func(v uint8) uint8 {
+			return uint8(minInt((int(v)*255+int(c.A)/2)/int(c.A), 255))
+		}
+		block[i] = color.NRGBA{div(c.R), div(c.G), div(c.B), c.A}
+	}
+}
+
+func (f *ddsFormat) decodeUncompressed(r io.Reader, img *image.NRGBA) error {
+	bpp := int(f.pf.bitCount / 8)
+	data, err := ioutil.ReadAll(io.LimitReader(r, int64(f.width*f.height*bpp)))
+	if err != nil {
+		return err
+	}
+	if len(data) < f.width*f.height*bpp {
+		return io.ErrUnexpectedEOF
+	}
+	masks := f.pf.masks
+	if f.pf.flags&(ddpfAlphaPixels|ddpfAlpha) == 0 {
+		masks[3] = 0
+	}
+	for i := 0; i < f.width*f.height; i++ {
+		var v uint32
+		for b := 0; b < bpp; b++ {
+			v |= uint32(data[i*bpp+b]) << (8 * b)
+		}
+		c := color.NRGBA{255, 255, 255, 255}
+		if f.pf.flags&ddpfLuminance != 0 {
+			c.R = extractMasked(v, masks[0])
+			c.G, c.B = c.R, c.R
+		} else if f.pf.flags&ddpfRGB != 0 {
+			c.R, c.G, c.B = extractMasked(v, masks[0]), extractMasked(v, masks[1]), extractMasked(v, masks[2])
+		}
+		if masks[3] != 0 {
+			c.A = extractMasked(v, masks[3])
+		}
+		img.Pix[i*4], img.Pix[i*4+1], img.Pix[i*4+2], img.Pix[i*4+3] = c.R, c.G, c.B, c.A
+	}
+	return nil
+}
+
+// extractMasked extracts the masked bits and scales them to 8 bits.
+func extractMasked(v, mask uint32) uint8 {
+	if mask == 0 {
+		return 0
+	}
+	shift := bits.TrailingZeros32(mask)
+	max := uint64(mask >> shift)
+	return uint8((uint64((v&mask)>>shift)*255 + max/2) / max)
+}
+
+func rgb565(c uint16) color.NRGBA {
+	r, g, b := uint8(c>>11&31), uint8(c>>5&63), uint8(c&31)
+	return color.NRGBA{r<<3 | r>>2, g<<2 | g>>4, b<<3 | b>>2, 255}
+}
+
+// decodeBC1Colors decodes the color part of BC1-3 blocks. BC2 and BC3 always use the 4 colors mode.
+func decodeBC1Colors(b []byte, dst *[16]color.NRGBA, allow3Colors bool) {
+	c0, c1 := binary.LittleEndian.Uint16(b), binary.LittleEndian.Uint16(b[2:])
+	var colors [4]color.NRGBA
+	colors[0], colors[1] = rgb565(c0), rgb565(c1)
+	mix := func(w0, w1, d uint32) color.NRGBA {
+		return color.NRGBA{
+			uint8((uint32(colors[0].R)*w0 + uint32(colors[1].R)*w1) / d),
+			uint8((uint32(colors[0].G)*w0 + uint32(colors[1].G)*w1) / d),
+			uint8((uint32(colors[0].B)*w0 + uint32(colors[1].B)*w1) / d),
+			255,
+		}
+	}
+	if c0 > c1 || !allow3Colors {
+		colors[2], colors[3] = mix(2, 1, 3), mix(1, 2, 3)
+	} else {
+		colors[2], colors[3] = mix(1, 1, 2), color.NRGBA{}
+	}
+	indices := binary.LittleEndian.Uint32(b[4:])
+	for i := range dst {
+		dst[i] = colors[indices>>(i*2)&3]
+	}
+}
+
+func decodeBC1Block(b []byte, dst *[16]color.NRGBA) {
+	decodeBC1Colors(b, dst, true)
+}
+
+func decodeBC2Block(b []byte, dst *[16]color.NRGBA) {
+	decodeBC1Colors(b[8:], dst, false)
+	alpha := binary.LittleEndian.Uint64(b)
+	for i := range dst {
+		a := uint8(alpha >> (i * 4) & 15)
+		dst[i].A = a<<4 | a
+	}
+}
+
+func decodeBC3Block(b []byte, dst *[16]color.NRGBA) {
+	decodeBC1Colors(b[8:], dst, false)
+	var alpha [16]uint8
+	decodeBC4Channel(b, &alpha)
+	for i := range dst {
+		dst[i].A = alpha[i]
+	}
+}
+
+// decodeBC4Channel decodes a BC4 (BC3 alpha) block.
+func decodeBC4Channel(b []byte, dst *[16]uint8) {
+	var values [8]uint32
+	values[0], values[1] = uint32(b[0]), uint32(b[1])
+	if values[0] > values[1] {
+		for i := uint32(1); i < 7; i++ {
+			values[i+1] = (values[0]*(7-i) + values[1]*i + 3) / 7
+		}
+	} else {
+		for i := uint32(1); i < 5; i++ {
+			values[i+1] = (values[0]*(5-i) + values[1]*i + 2) / 5
+		}
+		values[6], values[7] = 0, 255
+	}
+	indices := uint64(b[2]) | uint64(b[3])<<8 | uint64(b[4])<<16 | uint64(b[5])<<24 | uint64(b[6])<<32 | uint64(b[7])<<40
+	for i := range dst {
+		dst[i] = uint8(values[indices>>(i*3)&7])
+	}
+}
+
+// decodeBC4SChannel decodes a signed BC4 block. -1.0 to 1.0 is mapped to 0 to 255.
+func decodeBC4SChannel(b []byte, dst *[16]uint8) {
+	clamp := func(v int8) float64 { return math.Max(float64(v), -127) }
+	var values [8]float64
+	values[0], values[1] = clamp(int8(b[0])), clamp(int8(b[1]))
+	if values[0] > values[1] {
+		for i := 1; i < 7; i++ {
+			values[i+1] = (values[0]*float64(7-i) + values[1]*float64(i)) / 7
+		}
+	} else {
+		for i := 1; i < 5; i++ {
+			values[i+1] = (values[0]*float64(5-i) + values[1]*float64(i)) / 5
+		}
+		values[6], values[7] = -127, 127
+	}
+	indices := uint64(b[2]) | uint64(b[3])<<8 | uint64(b[4])<<16 | uint64(b[5])<<24 | uint64(b[6])<<32 | uint64(b[7])<<40
+	for i := range dst {
+		dst[i] = uint8((values[indices>>(i*3)&7]/127*0.5+0.5)*255 + 0.5)
+	}
+}
+
+func decodeBC4Block(b []byte, dst *[16]color.NRGBA) {
+	var v [16]uint8
+	decodeBC4Channel(b, &v)
+	for i := range dst {
+		dst[i] = color.NRGBA{v[i], v[i], v[i], 255}
+	}
+}
+
+func decodeBC4SBlock(b []byte, dst *[16]color.NRGBA) {
+	var v [16]uint8
+	decodeBC4SChannel(b, &v)
+	for i := range dst {
+		dst[i] = color.NRGBA{v[i], v[i], v[i], 255}
+	}
+}
+
+// decodeBC5Block decodes a two channel block. BC5 textures are usually normal maps, so Z is reconstructed to B.
+func decodeBC5Block(b []byte, dst *[16]color.NRGBA) {
+	var r, g [16]uint8
+	decodeBC4Channel(b, &r)
+	decodeBC4Channel(b[8:], &g)
+	setBC5Colors(&r, &g, dst)
+}
+
+func decodeBC5SBlock(b []byte, dst *[16]color.NRGBA) {
+	var r, g [16]uint8
+	decodeBC4SChannel(b, &r)
+	decodeBC4SChannel(b[8:], &g)
+	setBC5Colors(&r, &g, dst)
+}
+
+func setBC5Colors(r, g *[16]uint8, dst *[16]color.NRGBA) {
+	for i := range dst {
+		x, y := float64(r[i])/255*2-1, float64(g[i])/255*2-1
+		z := math.Sqrt(math.Max(0, 1-x*x-y*y))
+		dst[i] = color.NRGBA{r[i], g[i], uint8((z*0.5+0.5)*255 + 0.5), 255}
+	}
+}
+
+// BC7 modes. (BPTC)
+var bc7Modes = [8]struct {
+	subsets, partitionBits, rotationBits, indexSelectionBits int
+	colorBits, alphaBits                                     int
+	endpointPBits, sharedPBits                               bool
+	indexBits, index2Bits                                    int
+}{
+	{3, 4, 0, 0, 4, 0, true, false, 3, 0},
+	{2, 6, 0, 0, 6, 0, false, true, 3, 0},
+	{3, 6, 0, 0, 5, 0, false, false, 2, 0},
+	{2, 6, 0, 0, 7, 0, true, false, 2, 0},
+	{1, 0, 2, 1, 5, 6, false, false, 2, 3},
+	{1, 0, 2, 0, 7, 8, false, false, 2, 2},
+	{1, 0, 0, 0, 7, 7, true, false, 4, 0},
+	{2, 6, 0, 0, 5, 5, true, false, 2, 0},
+}
+
+// bc7Partitions2 are the pixels in the second subset.
+var bc7Partitions2 = [64]uint16{
+	0xcccc, 0x8888, 0xeeee, 0xecc8, 0xc880, 0xfeec, 0xfec8, 0xec80,
+	0xc800, 0xffec, 0xfe80, 0xe800, 0xffe8, 0xff00, 0xfff0, 0xf000,
+	0xf710, 0x008e, 0x7100, 0x08ce, 0x008c, 0x7310, 0x3100, 0x8cce,
+	0x088c, 0x3110, 0x6666, 0x366c, 0x17e8, 0x0ff0, 0x718e, 0x399c,
+	0xaaaa, 0xf0f0, 0x5a5a, 0x33cc, 0x3c3c, 0x55aa, 0x9696, 0xa55a,
+	0x73ce, 0x13c8, 0x324c, 0x3bdc, 0x6996, 0xc33c, 0x9966, 0x0660,
+	0x0272, 0x04e4, 0x4e40, 0x2720, 0xc936, 0x936c, 0x39c6, 0x639c,
+	0x9336, 0x9cc6, 0x817e, 0xe718, 0xccf0, 0x0fcc, 0x7744, 0xee22,
+}
+
+var bc7Partitions3 = [64]string{
+	"0011001102212222", "0001001122112221", "0000200122112211", "0222002200110111",
+	"0000000011221122", "0011001100220022", "0022002211111111", "0011001122112211",
+	"0000000011112222", "0000111111112222", "0000111122222222", "0012001200120012",
+	"0112011201120112", "0122012201220122", "0011011211221222", "0011200122002220",
+	"0001001101121122", "0111001120012200", "0000112211221122", "0022002200221111",
+	"0111011102220222", "0001000122212221", "0000001101220122", "0000110022102210",
+	"0122012200110000", "0012001211222222", "0110122112210110", "0000011012211221",
+	"0022110211020022", "0110011020022222", "0011012201220011", "0000200022112221",
+	"0000000211221222", "0222002200120011", "0011001200220222", "0120012001200120",
+	"0000111122220000", "0120120120120120", "0120201212010120", "0011220011220011",
+	"0011112222000011", "0101010122222222", "0000000021212121", "0022112200221122",
+	"0022001100220011", "0220122102201221", "0101222222220101", "0000212121212121",
+	"0101010101012222", "0222011102220111", "0002111200021112", "0000211221122112",
+	"0222011101110222", "0002111211120002", "0110011001102222", "0000000021122112",
+	"0110011022222222", "0022001100110022", "0022112211220022", "0000000000002112",
+	"0002000100020001", "0222122202221222", "0101222222222222", "0111201122012220",
+}
+
+var bc7Anchors2 = [64]uint8{
+	15, 15, 15, 15, 15, 15, 15, 15, 15, 15, 15, 15, 15, 15, 15, 15,
+	15, 2, 8, 2, 2, 8, 8, 15, 2, 8, 2, 2, 8, 8, 2, 2,
+	15, 15, 6, 8, 2, 8, 15, 15, 2, 8, 2, 2, 2, 15, 15, 6,
+	6, 2, 6, 8, 15, 15, 2, 2, 15, 15, 15, 15, 15, 2, 2, 15,
+}
+
+var bc7Anchors3 = [2][64]uint8{
+	{
+		3, 3, 15, 15, 8, 3, 15, 15, 8, 8, 6, 6, 6, 5, 3, 3,
+		3, 3, 8, 15, 3, 3, 6, 10, 5, 8, 8, 6, 8, 5, 15, 15,
+		8, 15, 3, 5, 6, 10, 8, 15, 15, 3, 15, 5, 15, 15, 15, 15,
+		3, 15, 5, 5, 5, 8, 5, 10, 5, 10, 8, 13, 15, 12, 3, 3,
+	},
+	{
+		15, 8, 8, 3, 15, 15, 3, 8, 15, 15, 15, 15, 15, 15, 15, 8,
+		15, 8, 15, 3, 15, 8, 15, 8, 3, 15, 6, 10, 15, 15, 10, 8,
+		15, 3, 15, 10, 10, 8, 9, 10, 6, 15, 8, 15, 3, 6, 6, 8,
+		15, 3, 15, 15, 15, 15, 15, 15, 15, 15, 15, 15, 3, 15, 15, 8,
+	},
+}
+
+var bc7Weights = [5][]uint32{
+	2: {0, 21, 43, 64},
+	3: {0, 9, 18, 27, 37, 46, 55, 64},
+	4: {0, 4, 9, 13, 17, 21, 26, 30, 34, 38, 43, 47, 51, 55, 60, 64},
+}
+
+type bc7BitReader struct {
+	b   []byte
+	pos uint
+}
+
+func (r *bc7BitReader) read(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		v |= uint32(r.b[r.pos>>3]>>(r.pos&7)&1) << i
+		r.pos++
+	}
+	return v
+}
+
+func decodeBC7Block(b []byte, dst *[16]color.NRGBA) {
+	if b[0] == 0 {
+		// Reserved mode.
+		*dst = [16]color.NRGBA{}
+		return
+	}
+	modeIndex := bits.TrailingZeros8(b[0])
+	mode := &bc7Modes[modeIndex]
+	r := &bc7BitReader{b: b, pos: uint(modeIndex + 1)}
+
+	partition := r.read(mode.partitionBits)
+	rotation := r.read(mode.rotationBits)
+	indexSelection := r.read(mode.indexSelectionBits)
+
+	var endpoints [6][4]uint32
+	numEndpoints := mode.subsets * 2
+	for c := 0; c < 3; c++ {
+		for i := 0; i < numEndpoints; i++ {
+			endpoints[i][c] = r.read(mode.colorBits)
+		}
+	}
+	for i := 0; i < numEndpoints; i++ {
+		endpoints[i][3] = r.read(mode.alphaBits)
+	}
+
+	colorBits, alphaBits := mode.colorBits, mode.alphaBits
+	if mode.endpointPBits || mode.sharedPBits {
+		var pbits [6]uint32
+		if mode.endpointPBits {
+			for i := 0; i < numEndpoints; i++ {
+				pbits[i] = r.read(1)
+			}
+		} else {
+			for s := 0; s < mode.subsets; s++ {
+				p := r.read(1)
+				pbits[s*2], pbits[s*2+1] = p, p
+			}
+		}
+		for i := 0; i < numEndpoints; i++ {
+			for c := 0; c < 4; c++ {
+				endpoints[i][c] = endpoints[i][c]<<1 | pbits[i]
+			}
+		}
+		colorBits++
+		if alphaBits > 0 {
+			alphaBits++
+		}
+	}
+	for i := 0; i < numEndpoints; i++ {
+		for c := 0; c < 4; c++ {
+			n := colorBits
+			if c == 3 {
+				n = alphaBits
+			}
+			if n == 0 {
+				endpoints[i][c] = 255
+			} else {
+				v := endpoints[i][c] << (8 - n)
+				endpoints[i][c] = v | v>>n
+			}
+		}
+	}
+
+	var subsets [16]int
+	anchors := [3]int{0, 0, 0}
+	switch mode.subsets {
+	case 2:
+		for i := range subsets {
+			subsets[i] = int(bc7Partitions2[partition] >> i & 1)
+		}
+		anchors[1] = int(bc7Anchors2[partition])
+	case 3:
+		for i := range subsets {
+			subsets[i] = int(bc7Partitions3[partition][i] - '0')
+		}
+		anchors[1], anchors[2] = int(bc7Anchors3[0][partition]), int(bc7Anchors3[1][partition])
+	}
+
+	var indices, indices2 [16]uint32
+	for i := range indices {
+		n := mode.indexBits
+		if i == anchors[subsets[i]] {
+			n--
+		}
+		indices[i] = r.read(n)
+	}
+	if mode.index2Bits > 0 {
+		for i := range indices2 {
+			n := mode.index2Bits
+			if i == 0 {
+				n--
+			}
+			indices2[i] = r.read(n)
+		}
+	}
+
+	colorIndices, colorWeights := &indices, bc7Weights[mode.indexBits]
+	alphaIndices, alphaWeights := &indices, bc7Weights[mode.indexBits]
+	if mode.index2Bits > 0 {
+		alphaIndices, alphaWeights = &indices2, bc7Weights[mode.index2Bits]
+		if indexSelection != 0 {
+			colorIndices, colorWeights, alphaIndices, alphaWeights = alphaIndices, alphaWeights, colorIndices, colorWeights
+		}
+	}
+
+	for i := range dst {
+		e0, e1 := &endpoints[subsets[i]*2], &endpoints[subsets[i]*2+1]
+		var c [4]uint8
+		for ch := 0; ch < 4; ch++ {
+			w := colorWeights[colorIndices[i]]
+			if ch == 3 {
+				w = alphaWeights[alphaIndices[i]]
+			}
+			c[ch] = uint8(((64-w)*e0[ch] + w*e1[ch] + 32) >> 6)
+		}
+		if rotation > 0 {
+			c[3], c[rotation-1] = c[rotation-1], c[3]
+		}
+		dst[i] = color.NRGBA{c[0], c[1], c[2], c[3]}
+	}
+}
@@ -0,0 +1,101 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func testDDSFile(fourCC string, width, height uint32, data []byte) []byte {
+	h := make([]byte, ddsHeaderSize)
+	copy(h, "DDS ")
+	binary.LittleEndian.PutUint32(h[4:], 124)
+	binary.LittleEndian.PutUint32(h[4+8:], height)
+	binary.LittleEndian.PutUint32(h[4+12:], width)
+	binary.LittleEndian.PutUint32(h[4+72:], 32)
+	binary.LittleEndian.PutUint32(h[4+76:], ddpfFourCC)
+	copy(h[4+80:], fourCC)
+	return append(h, data...)
+}
+
+func TestDecodeBCnBlocks(t *testing.T) {
+	red, blue := color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 0, 255, 255}
+
+	// BC7 mode 6: e0 = (127,0,64,127) with p-bit 1, e1 = 0 with p-bit 0.
+	bc7 := &vp8lBitWriter{}
+	bc7.write(1<<6, 7)
+	for _, v := range []uint32{127, 0, 0, 0, 64, 0, 127, 0} {
+		bc7.write(v, 7)
+	}
+	bc7.write(1, 1)
+	bc7.write(0, 1)
+	bc7.write(0, 3) // anchor index
+	bc7.write(15, 4)
+	bc7.write(0, 4*14)
+
+	tests := []struct {
+		name   string
+		decode func(b []byte, dst *[16]color.NRGBA)
+		block  []byte
+		want   []color.NRGBA
+	}{
+		{"BC1 4 colors", decodeBC1Block, []byte{0x00, 0xf8, 0x1f, 0x00, 0xe4, 0, 0, 0},
+			[]color.NRGBA{red, blue, {170, 0, 85, 255}, {85, 0, 170, 255}, red}},
+		{"BC1 3 colors", decodeBC1Block, []byte{0x1f, 0x00, 0x00, 0xf8, 0xe4, 0, 0, 0},
+			[]color.NRGBA{blue, red, {127, 0, 127, 255}, {}, blue}},
+		{"BC2", decodeBC2Block, []byte{0x0f, 0x08, 0, 0, 0, 0, 0, 0, 0x00, 0xf8, 0x00, 0xf8, 0, 0, 0, 0},
+			[]color.NRGBA{{255, 0, 0, 255}, {255, 0, 0, 0}, {255, 0, 0, 136}, {255, 0, 0, 0}}},
+		{"BC3", decodeBC3Block, []byte{255, 0, 0x88, 0, 0, 0, 0, 0, 0x00, 0xf8, 0x00, 0xf8, 0, 0, 0, 0},
+			[]color.NRGBA{{255, 0, 0, 255}, {255, 0, 0, 0}, {255, 0, 0, 219}, {255, 0, 0, 255}}},
+		{"BC4 6 values", decodeBC4Block, []byte{0, 255, 0xf2, 0x03, 0, 0, 0, 0},
+			[]color.NRGBA{{51, 51, 51, 255}, {0, 0, 0, 255}, {255, 255, 255, 255}, {255, 255, 255, 255}}},
+		{"BC5", decodeBC5Block, []byte{200, 100, 0, 0, 0, 0, 0, 0, 10, 20, 1, 0, 0, 0, 0, 0},
+			[]color.NRGBA{{200, 20, 128, 255}, {200, 10, 128, 255}}}, // Z is 0 outside the unit circle.
+		{"BC7 mode 6", decodeBC7Block, bc7.bytes(),
+			[]color.NRGBA{{255, 1, 129, 255}, {0, 0, 0, 0}, {255, 1, 129, 255}}},
+	}
+	for _, tt := range tests {
+		var dst [16]color.NRGBA
+		tt.decode(tt.block, &dst)
+		for i, want := range tt.want {
+			if dst[i] != want {
+				t.Errorf("%s: pixel %d = %v, want %v", tt.name, i, dst[i], want)
+			}
+		}
+	}
+}
+
+func TestDecodeDDSPremultiplied(t *testing.T) {
+	// Color (132,0,0) with alpha 136.
+	block := []byte{0x88, 0x88, 0x88, 0x88, 0x88, 0x88, 0x88, 0x88, 0x00, 0x80, 0x00, 0x80, 0, 0, 0, 0}
+
+	img, err := decodeDDS(bytes.NewReader(testDDSFile("DXT3", 4, 4, block)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := img.(*image.NRGBA).NRGBAAt(1, 1); c != (color.NRGBA{132, 0, 0, 136}) {
+		t.Errorf("DXT3: %v", c)
+	}
+
+	img, err = decodeDDS(bytes.NewReader(testDDSFile("DXT2", 4, 4, block)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := img.(*image.NRGBA).NRGBAAt(1, 1); c != (color.NRGBA{248, 0, 0, 136}) {
+		t.Errorf("DXT2: %v", c)
+	}
+}
+
+func TestDecodeDDSTooLarge(t *testing.T) {
+	if _, err := decodeDDSConfig(bytes.NewReader(testDDSFile("DXT1", 1<<16, 1<<16, nil))); err == nil {
+		t.Error("65536x65536 image should be rejected")
+	}
+	if _, err := decodeDDS(bytes.NewReader(testDDSFile("DXT1", 16384, 16385, nil))); err == nil {
+		t.Error("16384x16385 image should be rejected")
+	}
+	if _, err := decodeDDSConfig(bytes.NewReader(testDDSFile("DXT1", 16384, 16384, nil))); err != nil {
+		t.Error(err)
+	}
+}
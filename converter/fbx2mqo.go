@@ -17,6 +17,13 @@ type FBXToMQOOption struct {
 	RootTransform     *geom.Matrix4
 	TargetModelName   string
 	MaterialOverride  []int
+
+	// Bones resolved by caller. Key is the path of the names (e.g. "Armature/Hips/Spine").
+	// Deformers are bound to the bone whose path ends with the path of the model.
+	BoneMap map[string]*mqo.Bone
+
+	// Keep the lightmap UVs (the second UV set or the first one) of the faces in Object.Extra["lightmapUVs"].
+	LightmapUVs bool
 }
 
 type FBXToMQOConverter struct {
@@ -200,23 +207,14 @@ func (c *fbxToMqoState) convertGeometry(g *fbx.Geometry, obj *mqo.Object, transf
 	normByVertex := normalNode.GetMappingInformationType() == "ByControlPoint" && len(normArray) >= len(g.Vertices)
 	normByPolygonVertex := normalNode.GetMappingInformationType() == "ByPolygonVertex"
 
-	uvnode := g.GetLayerElementUV()
-	var uv []*geom.Vector2
-	var uvIndex []int32
-	if uvnode.GetMappingInformationType() == "ByPolygonVertex" {
-		uv = uvnode.Array.GetVec2Array()
-		if uvnode.GetReferenceInformationType() == "IndexToDirect" {
-			uvIndex = uvnode.GetIndexes()
-			if len(uvIndex) < g.PolygonVertexCount {
-				uv = nil
-				uvIndex = nil
-			}
-		} else {
-			if len(uv) < g.PolygonVertexCount {
-				uv = nil
-			}
+	uv := polygonVertexUVs(g, g.GetLayerElementUV())
+	var uv2 []*geom.Vector2
+	if c.LightmapUVs {
+		if uv2 = polygonVertexUVs(g, g.GetLayerElementUVAt(1)); uv2 == nil {
+			uv2 = uv
 		}
 	}
+	var lightmapUVs [][]geom.Vector2
 
 	rs := transform.Clone()
 	rs[12], rs[13], rs[14] = 0, 0, 0
@@ -243,16 +241,19 @@ func (c *fbxToMqoState) convertGeometry(g *fbx.Geometry, obj *mqo.Object, transf
 				face.Normals = append(face.Normals, normalTransform.ApplyTo(normArray[vcount+n]).Normalize())
 			}
 		}
-		if uvIndex != nil { // Indexed
+		if uv != nil {
 			for n := range f {
-				v := uv[uvIndex[vcount+n]]
+				v := uv[vcount+n]
 				face.UVs = append(face.UVs, geom.Vector2{X: v.X, Y: 1 - v.Y})
 			}
-		} else if uv != nil {
+		}
+		if uv2 != nil {
+			// Lightmap UVs: origin is bottom-left.
+			faceUV2 := make([]geom.Vector2, len(f))
 			for n := range f {
-				v := uv[vcount+n]
-				face.UVs = append(face.UVs, geom.Vector2{X: v.X, Y: 1 - v.Y})
+				faceUV2[len(f)-1-n] = *uv2[vcount+n]
 			}
+			lightmapUVs = append(lightmapUVs, faceUV2)
 		}
 		vcount += len(f)
 		face.Flip()
@@ -265,8 +266,12 @@ func (c *fbxToMqoState) convertGeometry(g *fbx.Geometry, obj *mqo.Object, transf
 		if deformer.Kind() == "BlendShapeChannel" {
 			// TODO: Apply deformer.FullWeights
 			if !c.DisableBlendShape {
+				// Unity names the blend shapes by the channels.
+				name := strings.TrimSuffix(strings.TrimPrefix(deformer.Name(), "SubDeformer::"), "::SubDeformer")
 				for _, shape := range deformer.GetShapes() {
-					shapes = append(shapes, c.convertShape(shape, obj, g, transform))
+					o := c.convertShape(shape, obj, g, transform)
+					o.Extra["blendShapeName"] = name
+					shapes = append(shapes, o)
 				}
 			}
 		} else {
@@ -281,15 +286,53 @@ func (c *fbxToMqoState) convertGeometry(g *fbx.Geometry, obj *mqo.Object, transf
 			shapes = append(shapes, c.convertShape(shape, obj, g, transform))
 		}
 	}
+	if lightmapUVs != nil && len(obj.Faces) == len(lightmapUVs) {
+		obj.Extra["lightmapUVs"] = lightmapUVs
+	}
 	return shapes
 }
 
+// polygonVertexUVs returns the UVs of the polygon vertices. (nil: not mapped by polygon vertex)
+func polygonVertexUVs(g *fbx.Geometry, uvnode *fbx.LayerElement) []*geom.Vector2 {
+	if uvnode.GetMappingInformationType() != fbx.ByPolygonVertex {
+		return nil
+	}
+	uv := uvnode.Array.GetVec2Array()
+	if uvnode.GetReferenceInformationType() != "IndexToDirect" {
+		if len(uv) < g.PolygonVertexCount {
+			return nil
+		}
+		return uv
+	}
+	uvIndex := uvnode.GetIndexes()
+	if len(uvIndex) < g.PolygonVertexCount {
+		return nil
+	}
+	indexed := make([]*geom.Vector2, len(uvIndex))
+	for i, idx := range uvIndex {
+		if idx < 0 || int(idx) >= len(uv) {
+			return nil
+		}
+		indexed[i] = uv[idx]
+	}
+	return indexed
+}
+
 func (c *fbxToMqoState) convertDeformer(sub *fbx.Deformer, objID int) {
 	model := sub.GetTarget()
 	if model == nil {
 		log.Println("ERR: Deformer has no model: ", sub.ID(), sub.Kind())
 		return
 	}
+	if c.BoneMap != nil {
+		bone := findBoneByPath(c.BoneMap, fbxModelPath(model, c.src.Scene))
+		if bone == nil {
+			log.Println("WARN: Bone not found: ", model.Name())
+			return
+		}
+		c.setVertexWeights(sub, bone, objID)
+		return
+	}
 	var modelPath []*fbx.Model
 	m := model
 	for m != nil && m != c.src.Scene {
@@ -315,6 +358,33 @@ func (c *fbxToMqoState) convertDeformer(sub *fbx.Deformer, objID int) {
 	}
 	bone := c.bones[c.boneNodeMap[model]-1]
 	bone.Pos.Vector3 = *c.coordMat.Mul(sub.GetTransformLink()).ApplyTo(&geom.Vector3{})
+	c.setVertexWeights(sub, bone, objID)
+}
+
+func fbxModelPath(model, root *fbx.Model) string {
+	var names []string
+	for m := model; m != nil && m != root; m = m.Parent {
+		names = append([]string{strings.TrimSuffix(strings.TrimPrefix(m.Name(), "Model::"), "::Model")}, names...)
+	}
+	return strings.Join(names, "/")
+}
+
+// findBoneByPath returns the bone whose path ends with the path. Returns nil if not found or ambiguous.
+func findBoneByPath(bones map[string]*mqo.Bone, path string) *mqo.Bone {
+	var found *mqo.Bone
+	for p, b := range bones {
+		if p == path || strings.HasSuffix(p, "/"+path) {
+			if found != nil && found != b {
+				log.Println("WARN: Ambiguous bone: ", path)
+				return nil
+			}
+			found = b
+		}
+	}
+	return found
+}
+
+func (c *fbxToMqoState) setVertexWeights(sub *fbx.Deformer, bone *mqo.Bone, objID int) {
 	weights := sub.GetWeights()
 	indexes := sub.GetIndexes()
 	if len(weights) == len(indexes) {
@@ -0,0 +1,53 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/binzume/modelconv/fbx"
+	"github.com/binzume/modelconv/geom"
+	"github.com/binzume/modelconv/mqo"
+)
+
+func TestConvertGeometryLightmapUVs(t *testing.T) {
+	g := fbx.NewGeometry("tri", []*geom.Vector3{{X: 0}, {X: 1}, {Y: 1}}, [][]int{{0, 1, 2}})
+	g.PolygonVertexCount = 3
+	uv0 := fbx.NewNode("LayerElementUV", int32(0))
+	uv0.Children = []*fbx.Node{
+		fbx.NewNode("MappingInformationType", "ByPolygonVertex"),
+		fbx.NewNode("ReferenceInformationType", "Direct"),
+		fbx.NewNode("UV", []float32{0, 0, 1, 0, 0, 1}),
+	}
+	uv1 := fbx.NewNode("LayerElementUV", int32(1))
+	uv1.Children = []*fbx.Node{
+		fbx.NewNode("MappingInformationType", "ByPolygonVertex"),
+		fbx.NewNode("ReferenceInformationType", "IndexToDirect"),
+		fbx.NewNode("UV", []float32{0.1, 0.2, 0.3, 0.4}),
+		fbx.NewNode("UVIndex", []int32{1, 0, 1}),
+	}
+	g.AddChild(uv0)
+	g.AddChild(uv1)
+
+	convert := func(lightmapUVs bool) *mqo.Object {
+		c := &fbxToMqoState{FBXToMQOOption: &FBXToMQOOption{LightmapUVs: lightmapUVs}, dst: mqo.NewDocument()}
+		obj := mqo.NewObject("tri")
+		c.convertGeometry(g, obj, geom.NewMatrix4(), nil)
+		return obj
+	}
+
+	obj := convert(true)
+	if f := obj.Faces[0]; len(f.UVs) != 3 || f.UVs[0] != (geom.Vector2{X: 0, Y: 0}) || f.UVs[2] != (geom.Vector2{X: 0, Y: 1}) {
+		t.Error("uv: ", f.UVs)
+	}
+	uvs, ok := obj.Extra["lightmapUVs"].([][]geom.Vector2)
+	if !ok || len(uvs) != 1 {
+		t.Fatal("lightmap uvs: ", obj.Extra)
+	}
+	// Flipped with the face. The origin is bottom-left.
+	if uv := uvs[0]; len(uv) != 3 || uv[0] != (geom.Vector2{X: 0.3, Y: 0.4}) || uv[1] != (geom.Vector2{X: 0.1, Y: 0.2}) {
+		t.Error("lightmap uvs: ", uv)
+	}
+
+	if _, ok := convert(false).Extra["lightmapUVs"]; ok {
+		t.Error("lightmap uvs should not be kept by default")
+	}
+}
@@ -1,6 +1,7 @@
 package converter
 
 import (
+	"encoding/json"
 	"log"
 
 	"github.com/binzume/modelconv/geom"
@@ -31,13 +32,14 @@ func (c *gltfToMqo) convertMaterial(src *gltf.Document, m *gltf.Material) *mqo.M
 	mat.DoubleSided = m.DoubleSided
 	mat.Shader = 2
 	mat.EmissionColor = &mqo.Vector3{X: m.EmissiveFactor[0], Y: m.EmissiveFactor[1], Z: m.EmissiveFactor[2]}
-	mat.Ex2 = &mqo.MaterialEx2{
-		ShaderType: "hlsl",
-		ShaderName: "glTF",
-		ShaderParams: map[string]interface{}{
-			"AlphaMode":   m.AlphaMode,
-			"AlphaCutoff": m.AlphaCutoffOrDefault(),
-		},
+	mat.Ex2 = mqo.NewMaterialEx2(mqo.ShaderNameGlTF)
+	mat.Ex2.ShaderType = mqo.ShaderTypeHLSL
+	mat.Ex2.ShaderParams["AlphaMode"] = int(m.AlphaMode) + mqo.AlphaModeOpaque
+	mat.Ex2.ShaderParams["AlphaCutOff"] = m.AlphaCutoffOrDefault()
+	setTexture := func(name string, index uint32) {
+		if uri := textureURI(src, index); uri != "" {
+			mat.Ex2.ShaderMapping[name] = uri
+		}
 	}
 	if m.PBRMetallicRoughness != nil {
 		col := m.PBRMetallicRoughness.BaseColorFactorOrDefault()
@@ -45,20 +47,167 @@ func (c *gltfToMqo) convertMaterial(src *gltf.Document, m *gltf.Material) *mqo.M
 		mat.Specular = m.PBRMetallicRoughness.MetallicFactorOrDefault()
 		mat.Ex2.ShaderParams["Metallic"] = m.PBRMetallicRoughness.MetallicFactorOrDefault()
 		mat.Ex2.ShaderParams["Roughness"] = m.PBRMetallicRoughness.RoughnessFactorOrDefault()
-		if m.PBRMetallicRoughness.BaseColorTexture != nil {
-			i := m.PBRMetallicRoughness.BaseColorTexture.Index
-			mat.Texture = src.Images[*src.Textures[i].Source].URI
+		if t := m.PBRMetallicRoughness.BaseColorTexture; t != nil {
+			mat.Texture = textureURI(src, t.Index)
+		}
+		if t := m.PBRMetallicRoughness.MetallicRoughnessTexture; t != nil {
+			setTexture("MetallicRoughness", t.Index)
 		}
 	}
+	if t := m.NormalTexture; t != nil && t.Index != nil {
+		mat.BumpTexture = textureURI(src, *t.Index)
+		mat.Ex2.ShaderParams["NormalScale"] = t.ScaleOrDefault()
+	}
+	if t := m.OcclusionTexture; t != nil && t.Index != nil {
+		setTexture("Occlusion", *t.Index)
+		mat.Ex2.ShaderParams["OcclusionStrength"] = t.StrengthOrDefault()
+	}
+	if t := m.EmissiveTexture; t != nil {
+		setTexture("Emissive", t.Index)
+	}
+
+	// Extensions
+	_, unlit := m.Extensions["KHR_materials_unlit"]
+	mat.Ex2.ShaderParams["Extensions.Unlit"] = unlit
+	if ext := materialExtension(m, "KHR_materials_emissive_strength"); ext != nil {
+		mat.Ex2.ShaderParams["Extensions.EmissiveStrength"] = ext.float("emissiveStrength", 1)
+	}
+	if ext := materialExtension(m, "KHR_materials_specular"); ext != nil {
+		mat.Ex2.ShaderParams["Extensions.SpecularExt"] = true
+		mat.Ex2.ShaderParams["Extensions.SpecularFactor"] = ext.float("specularFactor", 1)
+		mat.Ex2.ShaderParams["Extensions.SpecularColorFactor"] = ext.color("specularColorFactor", 1)
+		ext.texture(src, mat, "specularTexture", "Specular")
+		ext.texture(src, mat, "specularColorTexture", "SpecularColor")
+	}
+	if ext := materialExtension(m, "KHR_materials_clearcoat"); ext != nil {
+		mat.Ex2.ShaderParams["Extensions.Clearcoat"] = true
+		mat.Ex2.ShaderParams["Extensions.ClearcoatFactor"] = ext.float("clearcoatFactor", 0)
+		mat.Ex2.ShaderParams["Extensions.ClearcoatRoughnessFactor"] = ext.float("clearcoatRoughnessFactor", 0)
+		ext.texture(src, mat, "clearcoatTexture", "Clearcoat")
+		ext.texture(src, mat, "clearcoatRoughnessTexture", "ClearcoatRoughness")
+		ext.texture(src, mat, "clearcoatNormalTexture", "ClearcoatNormal")
+	}
+	if ext := materialExtension(m, "KHR_materials_sheen"); ext != nil {
+		mat.Ex2.ShaderParams["Extensions.Sheen"] = true
+		mat.Ex2.ShaderParams["Extensions.SheenColorFactor"] = ext.color("sheenColorFactor", 0)
+		mat.Ex2.ShaderParams["Extensions.SheenRoughnessFactor"] = ext.float("sheenRoughnessFactor", 0)
+		ext.texture(src, mat, "sheenColorTexture", "SheenColor")
+		ext.texture(src, mat, "sheenRoughnessTexture", "SheenRoughness")
+	}
+	if ext := materialExtension(m, "KHR_materials_ior"); ext != nil {
+		mat.Ex2.ShaderParams["Extensions.IorExt"] = true
+		mat.Ex2.ShaderParams["Extensions.Ior"] = ext.float("ior", 1.5)
+	}
+	if ext := materialExtension(m, "KHR_materials_volume"); ext != nil {
+		mat.Ex2.ShaderParams["Extensions.Volume"] = true
+		mat.Ex2.ShaderParams["Extensions.ThicknessFactor"] = ext.float("thicknessFactor", 0)
+		mat.Ex2.ShaderParams["Extensions.AttenuationDistance"] = ext.float("attenuationDistance", 0)
+		mat.Ex2.ShaderParams["Extensions.AttenuationColor"] = ext.color("attenuationColor", 1)
+		ext.texture(src, mat, "thicknessTexture", "Thickness")
+	}
+	if ext := materialExtension(m, "KHR_materials_transmission"); ext != nil {
+		mat.Ex2.ShaderParams["Extensions.Transmission"] = true
+		mat.Ex2.ShaderParams["Extensions.TransmissionFactor"] = ext.float("transmissionFactor", 0)
+		ext.texture(src, mat, "transmissionTexture", "Transmission")
+	}
+	if ext := materialExtension(m, "KHR_materials_iridescence"); ext != nil {
+		mat.Ex2.ShaderParams["Extensions.Iridescence"] = true
+		mat.Ex2.ShaderParams["Extensions.IridescenceFactor"] = ext.float("iridescenceFactor", 0)
+		mat.Ex2.ShaderParams["Extensions.IridescenceIor"] = ext.float("iridescenceIor", 1.3)
+		mat.Ex2.ShaderParams["Extensions.IridescenceThicknessMinimum"] = ext.float("iridescenceThicknessMinimum", 100)
+		mat.Ex2.ShaderParams["Extensions.IridescenceThicknessMaximum"] = ext.float("iridescenceThicknessMaximum", 400)
+		ext.texture(src, mat, "iridescenceTexture", "Iridescence")
+		ext.texture(src, mat, "iridescenceThicknessTexture", "IridescenceThickness")
+	}
+	if ext := materialExtension(m, "KHR_materials_anisotropy"); ext != nil {
+		mat.Ex2.ShaderParams["Extensions.Anisotropy"] = true
+		mat.Ex2.ShaderParams["Extensions.AnisotropyStrength"] = ext.float("anisotropyStrength", 0)
+		mat.Ex2.ShaderParams["Extensions.AnisotropyRotation"] = ext.float("anisotropyRotation", 0)
+		ext.texture(src, mat, "anisotropyTexture", "Anisotropy")
+	}
 	return mat
 }
 
+// textureURI returns the image URI of the texture. The WebP image of EXT_texture_webp is used if there is no fallback image.
+// Embedded images are not supported.
+func textureURI(src *gltf.Document, index uint32) string {
+	if int(index) >= len(src.Textures) {
+		return ""
+	}
+	tex := src.Textures[index]
+	source := tex.Source
+	if source == nil {
+		if s, ok := decodeExtension(tex.Extensions, webpExtension)["source"].(float64); ok {
+			source = gltf.Index(uint32(s))
+		}
+	}
+	if source == nil || int(*source) >= len(src.Images) {
+		return ""
+	}
+	return src.Images[*source].URI
+}
+
+type gltfExtension map[string]interface{}
+
+// materialExtension decodes the material extension.
+func materialExtension(m *gltf.Material, name string) gltfExtension {
+	return decodeExtension(m.Extensions, name)
+}
+
+// decodeExtension decodes the extension as a map. Unregistered extensions are json.RawMessage.
+func decodeExtension(extensions gltf.Extensions, name string) gltfExtension {
+	v, ok := extensions[name]
+	if !ok {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	ext := gltfExtension{}
+	if err := json.Unmarshal(b, &ext); err != nil {
+		log.Println("Invalid extension:", name, err)
+		return nil
+	}
+	return ext
+}
+
+func (ext gltfExtension) float(name string, def float32) float32 {
+	if v, ok := ext[name].(float64); ok {
+		return float32(v)
+	}
+	return def
+}
+
+func (ext gltfExtension) color(name string, def float32) []float32 {
+	col := []float32{def, def, def, 1}
+	if v, ok := ext[name].([]interface{}); ok {
+		for i := 0; i < len(v) && i < 4; i++ {
+			if f, ok := v[i].(float64); ok {
+				col[i] = float32(f)
+			}
+		}
+	}
+	return col
+}
+
+func (ext gltfExtension) texture(src *gltf.Document, mat *mqo.Material, name, mapping string) {
+	if t, ok := ext[name].(map[string]interface{}); ok {
+		if index, ok := t["index"].(float64); ok {
+			if uri := textureURI(src, uint32(index)); uri != "" {
+				mat.Ex2.ShaderMapping[mapping] = uri
+			}
+		}
+	}
+}
+
 func (c *gltfToMqo) convertMesh(src *gltf.Document, m *gltf.Mesh) *mqo.Object {
 	obj := mqo.NewObject(m.Name)
 	for _, p := range m.Primitives {
 		if p.Indices == nil {
 			continue
 		}
+		base := len(obj.Vertexes)
 		if a, ok := p.Attributes["POSITION"]; ok {
 			acr := src.Accessors[a]
 			pos, err := modeler.ReadPosition(src, acr, [][3]float32{})
@@ -70,6 +219,19 @@ func (c *gltfToMqo) convertMesh(src *gltf.Document, m *gltf.Mesh) *mqo.Object {
 				obj.Vertexes = append(obj.Vertexes, &mqo.Vector3{X: v[0], Y: v[1], Z: v[2]})
 			}
 		}
+		if a, ok := p.Attributes["COLOR_0"]; ok {
+			colors, err := modeler.ReadColor(src, src.Accessors[a], [][4]uint8{})
+			if err != nil {
+				log.Fatalf("err %v", err)
+				continue
+			}
+			for len(obj.VertexColors) < base {
+				obj.VertexColors = append(obj.VertexColors, mqo.Vector4{X: 1, Y: 1, Z: 1, W: 1})
+			}
+			for _, c := range colors {
+				obj.VertexColors = append(obj.VertexColors, mqo.ColorFromABGR(uint32(c[0])|uint32(c[1])<<8|uint32(c[2])<<16|uint32(c[3])<<24))
+			}
+		}
 		var texCoord [][2]float32
 		if a, ok := p.Attributes["TEXCOORD_0"]; ok {
 			acr := src.Accessors[a]
@@ -101,6 +263,9 @@ func (c *gltfToMqo) convertMesh(src *gltf.Document, m *gltf.Mesh) *mqo.Object {
 			obj.Faces = append(obj.Faces, f)
 		}
 	}
+	for obj.VertexColors != nil && len(obj.VertexColors) < len(obj.Vertexes) {
+		obj.VertexColors = append(obj.VertexColors, mqo.Vector4{X: 1, Y: 1, Z: 1, W: 1})
+	}
 	return obj
 }
 
@@ -149,5 +314,13 @@ func (c *gltfToMqo) Convert(src *gltf.Document) (*mqo.Document, error) {
 	}
 	mqo.GetBonePlugin(mqdoc).SetBones(bones)
 
+	for _, anim := range src.Animations {
+		motion := GltfAnimationToMotion(src, anim, 1)
+		if len(motion.Bones) > 0 || len(motion.Morphs) > 0 {
+			kp := mqo.GetKeyframerPlugin(mqdoc)
+			kp.Motions = append(kp.Motions, motion)
+		}
+	}
+
 	return mqdoc, nil
 }
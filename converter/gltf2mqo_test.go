@@ -0,0 +1,203 @@
+package converter
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/binzume/modelconv/mqo"
+	"github.com/qmuntal/gltf"
+)
+
+func TestMaterialRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	// Mapping slot -> texture. Each image has a different color so that they are not merged.
+	mappings := map[string]string{
+		"Metallic":             "metallic.png",
+		"Roughness":            "roughness.png",
+		"Occlusion":            "occlusion.png",
+		"Emissive":             "emissive.png",
+		"Specular":             "specular.png",
+		"SpecularColor":        "specular_color.png",
+		"Clearcoat":            "clearcoat.png",
+		"ClearcoatRoughness":   "clearcoat_roughness.png",
+		"ClearcoatNormal":      "clearcoat_normal.png",
+		"SheenColor":           "sheen_color.png",
+		"SheenRoughness":       "sheen_roughness.png",
+		"Thickness":            "thickness.png",
+		"Transmission":         "transmission.png",
+		"Iridescence":          "iridescence.png",
+		"IridescenceThickness": "iridescence_thickness.png",
+		"Anisotropy":           "anisotropy.png",
+	}
+	level := map[string]uint8{"metallic.png": 200, "roughness.png": 50}
+	var v uint8 = 10
+	// Tangent-space normal map. (Greyscale images are converted from height maps)
+	normal := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for i := 0; i < len(normal.Pix); i += 4 {
+		copy(normal.Pix[i:], []uint8{128, 128, 255, 255})
+	}
+	writeTestPNG(t, dir+"/normal.png", normal)
+	for _, name := range append([]string{"base.png"}, mapValues(mappings)...) {
+		if _, ok := level[name]; !ok {
+			level[name] = v
+			v += 10
+		}
+		img := image.NewGray(image.Rect(0, 0, 4, 4))
+		for i := range img.Pix {
+			img.Pix[i] = level[name]
+		}
+		writeTestPNG(t, dir+"/"+name, img)
+	}
+
+	ex2 := mqo.NewMaterialEx2(mqo.ShaderNameGlTF)
+	ex2.ShaderType = mqo.ShaderTypeHLSL
+	params := map[string]interface{}{
+		"Metallic":          0.25,
+		"Roughness":         0.75,
+		"AlphaMode":         2,
+		"AlphaCutOff":       0.25,
+		"NormalScale":       0.5,
+		"OcclusionStrength": 0.5,
+
+		"Extensions.EmissiveStrength":            1.5,
+		"Extensions.SpecularExt":                 true,
+		"Extensions.SpecularFactor":              0.5,
+		"Extensions.SpecularColorFactor":         []float32{0.5, 0.25, 1, 1},
+		"Extensions.Clearcoat":                   true,
+		"Extensions.ClearcoatFactor":             0.5,
+		"Extensions.ClearcoatRoughnessFactor":    0.25,
+		"Extensions.Sheen":                       true,
+		"Extensions.SheenColorFactor":            []float32{1, 0.5, 0.25, 1},
+		"Extensions.SheenRoughnessFactor":        0.5,
+		"Extensions.IorExt":                      true,
+		"Extensions.Ior":                         1.25,
+		"Extensions.Volume":                      true,
+		"Extensions.ThicknessFactor":             0.5,
+		"Extensions.AttenuationDistance":         2.0,
+		"Extensions.AttenuationColor":            []float32{0.5, 0.5, 0.25, 1},
+		"Extensions.Transmission":                true,
+		"Extensions.TransmissionFactor":          0.75,
+		"Extensions.Iridescence":                 true,
+		"Extensions.IridescenceFactor":           0.5,
+		"Extensions.IridescenceIor":              1.5,
+		"Extensions.IridescenceThicknessMinimum": 200.0,
+		"Extensions.IridescenceThicknessMaximum": 500.0,
+		"Extensions.Anisotropy":                  true,
+		"Extensions.AnisotropyStrength":          0.5,
+		"Extensions.AnisotropyRotation":          1.0,
+	}
+	for k, v := range params {
+		ex2.ShaderParams[k] = v
+	}
+	for k, v := range mappings {
+		ex2.ShaderMapping[k] = v
+	}
+	doc := newTestBakeDocument(&mqo.Material{
+		Name:          "mat",
+		Color:         mqo.Vector4{X: 1, Y: 0.5, Z: 0.25, W: 1},
+		EmissionColor: &mqo.Vector3{X: 2, Y: 1, Z: 0},
+		Texture:       "base.png",
+		BumpTexture:   "normal.png",
+		Ex2:           ex2,
+	})
+
+	gltfdoc, err := NewMQOToGLTFConverter(nil).Convert(doc, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Metallic and roughness are packed into a texture. (G: roughness, B: metallic)
+	mr := gltfdoc.Materials[0].PBRMetallicRoughness.MetallicRoughnessTexture
+	if mr == nil {
+		t.Fatal("no metallicRoughnessTexture")
+	}
+	packed := gltfdoc.Images[*gltfdoc.Textures[mr.Index].Source]
+	bv := gltfdoc.BufferViews[*packed.BufferView]
+	img, _, err := image.Decode(bytes.NewReader(gltfdoc.Buffers[bv.Buffer].Data[bv.ByteOffset : bv.ByteOffset+bv.ByteLength]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := color.NRGBAModel.Convert(img.At(1, 1)).(color.NRGBA); c != (color.NRGBA{R: 255, G: 50, B: 200, A: 255}) {
+		t.Error("packed metallic roughness: ", c)
+	}
+
+	// External images. (gltfToMqo reads only the image URIs)
+	for _, img := range gltfdoc.Images {
+		img.URI = img.Name
+		img.BufferView = nil
+	}
+	var buf bytes.Buffer
+	if err := gltf.NewEncoder(&buf).Encode(gltfdoc); err != nil {
+		t.Fatal(err)
+	}
+	var decoded gltf.Document
+	if err := gltf.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	result, err := NewGLTFToMQOConverter(nil).Convert(&decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mat := result.Materials[0]
+
+	if mat.Texture != "base.png" || mat.BumpTexture != "normal.png" {
+		t.Error("textures: ", mat.Texture, mat.BumpTexture)
+	}
+	if name := mat.Ex2.Mapping("MetallicRoughness"); name != packed.Name {
+		t.Error("MetallicRoughness: ", name, packed.Name)
+	}
+	for slot, name := range mappings {
+		if slot == "Metallic" || slot == "Roughness" {
+			continue
+		}
+		if mat.Ex2.Mapping(slot) != name {
+			t.Errorf("mapping %v: %v, expected: %v", slot, mat.Ex2.Mapping(slot), name)
+		}
+	}
+
+	for k, v := range params {
+		if k == "Extensions.EmissiveStrength" {
+			continue
+		}
+		switch expected := v.(type) {
+		case bool:
+			if mat.Ex2.BoolParam(k) != expected {
+				t.Errorf("%v: %v", k, mat.Ex2.ShaderParams[k])
+			}
+		case float64:
+			if !nearlyEqual(float32(mat.Ex2.FloatParam(k)), float32(expected)) {
+				t.Errorf("%v: %v, expected: %v", k, mat.Ex2.ShaderParams[k], expected)
+			}
+		case int:
+			if mat.Ex2.IntParam(k) != expected {
+				t.Errorf("%v: %v, expected: %v", k, mat.Ex2.ShaderParams[k], expected)
+			}
+		case []float32:
+			c := mat.Ex2.ColorParam(k)
+			for i := 0; i < 3; i++ {
+				if len(c) < 3 || !nearlyEqual(c[i], expected[i]) {
+					t.Errorf("%v: %v, expected: %v", k, c, expected)
+					break
+				}
+			}
+		}
+	}
+
+	// Emission color over 1 is normalized by KHR_materials_emissive_strength.
+	if c := mat.EmissionColor; c == nil || *c != (mqo.Vector3{X: 1, Y: 0.5, Z: 0}) {
+		t.Error("emission: ", c)
+	}
+	if s := mat.Ex2.FloatParam("Extensions.EmissiveStrength"); !nearlyEqual(float32(s), 3) {
+		t.Error("emissive strength: ", s)
+	}
+}
+
+func mapValues(m map[string]string) []string {
+	var values []string
+	for _, v := range m {
+		values = append(values, v)
+	}
+	return values
+}
@@ -0,0 +1,152 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/qmuntal/gltf"
+	"golang.org/x/image/draw"
+)
+
+const basisuExtension = "KHR_texture_basisu"
+
+// KTX2Command is the command to encode textures. (toktx in KTX-Software 4.x)
+// UASTC and ETC1S (BasisLZ) encoders are out of scope of this package, so the external command is required.
+var KTX2Command = "toktx"
+
+// ktx2Encoder returns the path of the encoder command. The conversion fails if the mode or the encoder is not available.
+func ktx2Encoder(mode string) (string, error) {
+	if mode != "uastc" && mode != "etc1s" {
+		return "", fmt.Errorf("unsupported KTX2 mode: %v", mode)
+	}
+	cmd, err := exec.LookPath(KTX2Command)
+	if err != nil {
+		return "", fmt.Errorf("%v is required to encode KTX2 textures: %w", KTX2Command, err)
+	}
+	return cmd, nil
+}
+
+// encodeKTX2 encodes the image as KTX2 with mipmaps. mode: "uastc" or "etc1s"
+// Normal maps and other non-color textures must be linear.
+func encodeKTX2(img image.Image, mode string, linear bool) ([]byte, error) {
+	cmd, err := ktx2Encoder(mode)
+	if err != nil {
+		return nil, err
+	}
+	img = resizeToMultipleOf4(img)
+	tmpDir, err := ioutil.TempDir("", "modelconv_ktx2_")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	src := filepath.Join(tmpDir, "src.png")
+	dst := filepath.Join(tmpDir, "dst.ktx2")
+	f, err := os.Create(src)
+	if err != nil {
+		return nil, err
+	}
+	err = png.Encode(f, img)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"--t2", "--encode", mode, "--genmipmap"}
+	if linear {
+		args = append(args, "--assign_oetf", "linear", "--assign_primaries", "none")
+	}
+	args = append(args, dst, src)
+	if out, err := exec.Command(cmd, args...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%v: %v %s", KTX2Command, err, strings.TrimSpace(string(out)))
+	}
+	return ioutil.ReadFile(dst)
+}
+
+// resizeToMultipleOf4 scales the image up to the size of multiples of 4. Block compressed textures are encoded by 4x4 blocks.
+// The image is scaled instead of padded, so UVs are not changed.
+func resizeToMultipleOf4(img image.Image) image.Image {
+	b := img.Bounds()
+	w, h := (b.Dx()+3)/4*4, (b.Dy()+3)/4*4
+	if w == b.Dx() && h == b.Dy() {
+		return img
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// linearTextures returns the textures which are not color data.
+func (m *mqoToGltf) linearTextures() map[uint32]bool {
+	linear := map[uint32]bool{}
+	for _, mm := range m.Materials {
+		if t := mm.NormalTexture; t != nil && t.Index != nil {
+			linear[*t.Index] = true
+		}
+		if t := mm.OcclusionTexture; t != nil && t.Index != nil {
+			linear[*t.Index] = true
+		}
+		if mm.PBRMetallicRoughness != nil && mm.PBRMetallicRoughness.MetallicRoughnessTexture != nil {
+			linear[mm.PBRMetallicRoughness.MetallicRoughnessTexture.Index] = true
+		}
+	}
+	return linear
+}
+
+// addKTX2Textures adds KTX2 images to all textures by KHR_texture_basisu. Original PNG/JPEG images are kept as fallback.
+func (m *mqoToGltf) addKTX2Textures(mode string) error {
+	type ktx2Key struct {
+		source uint32
+		linear bool
+	}
+	linear := m.linearTextures()
+	encoded := map[ktx2Key]uint32{} // source image and color space -> KTX2 image
+	for i, tex := range m.Textures {
+		source := textureSource(tex)
+		if source == nil {
+			continue
+		}
+		key := ktx2Key{*source, linear[uint32(i)]}
+		ktxImage, ok := encoded[key]
+		if !ok {
+			src := m.Images[*source]
+			if src.BufferView == nil {
+				continue
+			}
+			bv := m.BufferViews[*src.BufferView]
+			img, _, err := image.Decode(bytes.NewReader(m.Buffers[bv.Buffer].Data[bv.ByteOffset : bv.ByteOffset+bv.ByteLength]))
+			if err != nil {
+				return err
+			}
+			data, err := encodeKTX2(img, mode, key.linear)
+			if err != nil {
+				return err
+			}
+			name := strings.TrimSuffix(src.Name, filepath.Ext(src.Name))
+			if key.linear {
+				name += "_linear"
+			}
+			name += ".ktx2"
+			ktxImage, err = m.writeImage(name, "image/ktx2", bytes.NewBuffer(data))
+			if err != nil {
+				return err
+			}
+			encoded[key] = ktxImage
+			log.Printf("KTX2: %v (%v, %d bytes)", name, mode, len(data))
+		}
+		if tex.Extensions == nil {
+			tex.Extensions = gltf.Extensions{}
+		}
+		tex.Extensions[basisuExtension] = map[string]interface{}{"source": ktxImage}
+		m.extensions[basisuExtension] = true
+	}
+	return nil
+}
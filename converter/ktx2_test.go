@@ -0,0 +1,87 @@
+package converter
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/binzume/modelconv/mqo"
+	"github.com/qmuntal/gltf"
+)
+
+func TestResizeToMultipleOf4(t *testing.T) {
+	if img := resizeToMultipleOf4(image.NewNRGBA(image.Rect(0, 0, 8, 4))); img.Bounds().Dx() != 8 || img.Bounds().Dy() != 4 {
+		t.Error("size: ", img.Bounds())
+	}
+	if img := resizeToMultipleOf4(image.NewNRGBA(image.Rect(0, 0, 5, 3))); img.Bounds().Dx() != 8 || img.Bounds().Dy() != 4 {
+		t.Error("size: ", img.Bounds())
+	}
+}
+
+func TestAddKTX2TexturesColorSpace(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+	dir := t.TempDir()
+	// Fake toktx: copies the source to the destination and logs the arguments.
+	script := filepath.Join(dir, "toktx")
+	logFile := filepath.Join(dir, "args.log")
+	err := os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" >> "+logFile+"\neval dst=\\${$(($#-1))}\neval src=\\${$#}\ncp \"$src\" \"$dst\"\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(cmd string) { KTX2Command = cmd }(KTX2Command)
+	KTX2Command = script
+
+	var b bytes.Buffer
+	png.Encode(&b, image.NewNRGBA(image.Rect(0, 0, 4, 4)))
+	m := &mqoToGltf{Document: gltf.NewDocument(), extensions: map[string]bool{}}
+	m.Buffers = append(m.Buffers, &gltf.Buffer{})
+	img, err := m.writeImage("tex.png", "image/png", &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same image is used as a color texture and a normal texture.
+	m.Textures = []*gltf.Texture{{Source: gltf.Index(img)}, {Source: gltf.Index(img)}, {Source: gltf.Index(img)}}
+	m.Materials = []*gltf.Material{{
+		PBRMetallicRoughness: &gltf.PBRMetallicRoughness{BaseColorTexture: &gltf.TextureInfo{Index: 0}},
+		NormalTexture:        &gltf.NormalTexture{Index: gltf.Index(1)},
+		EmissiveTexture:      &gltf.TextureInfo{Index: 2},
+	}}
+	if err := m.addKTX2Textures("uastc"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Images) != 3 {
+		t.Fatal("images: ", len(m.Images))
+	}
+	src := func(i int) uint32 {
+		return m.Textures[i].Extensions[basisuExtension].(map[string]interface{})["source"].(uint32)
+	}
+	if src(0) != src(2) || src(0) == src(1) {
+		t.Error("sources: ", src(0), src(1), src(2))
+	}
+	args, _ := os.ReadFile(logFile)
+	if lines := strings.Split(strings.TrimSpace(string(args)), "\n"); len(lines) != 2 || strings.Contains(lines[0], "linear") == strings.Contains(lines[1], "linear") {
+		t.Error("args: ", string(args))
+	}
+}
+
+func TestConvertWithoutKTX2Encoder(t *testing.T) {
+	defer func(cmd string) { KTX2Command = cmd }(KTX2Command)
+	KTX2Command = filepath.Join(t.TempDir(), "toktx")
+
+	_, err := NewMQOToGLTFConverter(&MQOToGLTFOption{TextureKTX2: "uastc"}).Convert(mqo.NewDocument(), t.TempDir())
+	if err == nil {
+		t.Error("KTX2 textures are requested without the encoder.")
+	}
+	_, err = NewMQOToGLTFConverter(&MQOToGLTFOption{TextureKTX2: "bc7"}).Convert(mqo.NewDocument(), t.TempDir())
+	if err == nil {
+		t.Error("Unsupported KTX2 mode is accepted.")
+	}
+}
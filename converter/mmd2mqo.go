@@ -39,12 +39,19 @@ func (c *mmdToMQO) convertMaterial(mat *mmd.Material, model *mmd.Document) *mqo.
 		m.Texture = model.Textures[mat.TextureID]
 	}
 
-	m.Ex2 = &mqo.MaterialEx2{
-		ShaderType: "hlsl",
-		ShaderName: "pmd",
-		ShaderParams: map[string]interface{}{
-			"Edge": mat.EdgeScale > 0,
-		},
+	m.Ex2 = mqo.NewMaterialEx2("pmd")
+	m.Ex2.ShaderType = "hlsl"
+	m.Ex2.ShaderParams["Edge"] = mat.Flags&mmd.MaterialFlagDrawEdge != 0 && mat.EdgeScale > 0
+	m.Ex2.ShaderParams["EdgeSize"] = mat.EdgeScale
+	m.Ex2.ShaderParams["EdgeColor"] = []float32{mat.EdgeColor.X, mat.EdgeColor.Y, mat.EdgeColor.Z, mat.EdgeColor.W}
+	if mat.ToonType == 1 && mat.Toon >= 0 {
+		m.Ex2.ShaderParams["SharedToon"] = mat.Toon
+	} else if mat.Toon >= 0 && mat.Toon < len(model.Textures) {
+		m.Ex2.ShaderMapping["Toon"] = model.Textures[mat.Toon]
+	}
+	if mat.EnvMode != 0 && mat.EnvID >= 0 && mat.EnvID < len(model.Textures) {
+		m.Ex2.ShaderMapping["Sphere"] = model.Textures[mat.EnvID]
+		m.Ex2.ShaderParams["SphereMode"] = int(mat.EnvMode)
 	}
 	return &m
 }
@@ -94,6 +101,7 @@ func (c *mmdToMQO) convertBones(pmx *mmd.Document) []*mqo.Bone {
 
 func (c *mmdToMQO) convertFaces(pmx *mmd.Document, faces []int, face2mat []int, o *mqo.Object, vmap map[int]int) {
 	o.Faces = make([]*mqo.Face, len(faces))
+	var edgeScale []float32
 	for i, fi := range faces {
 		face := pmx.Faces[fi]
 		verts := make([]int, len(face.Verts))
@@ -110,10 +118,12 @@ func (c *mmdToMQO) convertFaces(pmx *mmd.Document, faces []int, face2mat []int,
 				vmap[vi] = len(o.Vertexes)
 				verts[i] = vmap[vi]
 				o.Vertexes = append(o.Vertexes, c.convertVec3(&v.Pos))
+				edgeScale = append(edgeScale, v.EdgeScale)
 			}
 		}
 		o.Faces[i] = &mqo.Face{Verts: verts, Material: face2mat[fi], UVs: uvs, Normals: normals}
 	}
+	o.Extra["edgeScale"] = edgeScale
 }
 
 func (c *mmdToMQO) setWeight(pmx *mmd.Document, bones []*mqo.Bone, objid int, vmap map[int]int) {
@@ -0,0 +1,453 @@
+package converter
+
+import (
+	"log"
+	"math"
+	"sort"
+
+	"github.com/binzume/modelconv/geom"
+	"github.com/binzume/modelconv/mmd"
+	"github.com/binzume/modelconv/mqo"
+	"github.com/qmuntal/gltf"
+	"github.com/qmuntal/gltf/modeler"
+)
+
+const mmdFrameRate = 30
+
+// MMDAnimationToMotion converts VMD motion to MQO coordinates.
+func MMDAnimationToMotion(anim *mmd.Animation, scale float32) *mqo.Motion {
+	motion := &mqo.Motion{Name: anim.Name, FrameRate: mmdFrameRate}
+	for name, ch := range anim.GetBoneChannels() {
+		bm := &mqo.BoneMotion{Name: name}
+		for i, f := range ch.Frames {
+			p, r := ch.Positions[i], ch.Rotations[i]
+			k := &mqo.BoneKeyframe{Frame: int(f), MvX: p.X * scale, MvY: p.Y * scale, MvZ: -p.Z * scale}
+			k.SetRotation(&geom.Quaternion{X: -r.X, Y: -r.Y, Z: r.Z, W: r.W})
+			bm.Keys = append(bm.Keys, k)
+		}
+		motion.Bones = append(motion.Bones, bm)
+	}
+	for name, ch := range anim.GetMorphChannels() {
+		mm := &mqo.MorphMotion{Name: name}
+		for i, f := range ch.Frames {
+			mm.Keys = append(mm.Keys, &mqo.MorphKeyframe{Frame: int(f), Value: ch.Weights[i]})
+		}
+		motion.Morphs = append(motion.Morphs, mm)
+	}
+	sort.Slice(motion.Bones, func(i, j int) bool { return motion.Bones[i].Name < motion.Bones[j].Name })
+	sort.Slice(motion.Morphs, func(i, j int) bool { return motion.Morphs[i].Name < motion.Morphs[j].Name })
+	return motion
+}
+
+// MotionToMMDAnimation converts MQO motion to VMD coordinates.
+func MotionToMMDAnimation(motion *mqo.Motion, scale float32) *mmd.Animation {
+	anim := &mmd.Animation{Name: motion.Name}
+	frameScale := mmdFrameRate / motion.GetFrameRate()
+	for _, b := range motion.Bones {
+		for _, k := range b.Keys {
+			r := k.GetRotation()
+			anim.Bone = append(anim.Bone, &mmd.AnimationBoneSample{
+				Target:   b.Name,
+				Frame:    int(math.Round(float64(float32(k.Frame) * frameScale))),
+				Position: mmd.Vector3{X: k.MvX * scale, Y: k.MvY * scale, Z: -k.MvZ * scale},
+				Rotation: mmd.Vector4{X: -r.X, Y: -r.Y, Z: r.Z, W: r.W},
+			})
+		}
+	}
+	for _, m := range motion.Morphs {
+		for _, k := range m.Keys {
+			anim.Morph = append(anim.Morph, &mmd.AnimationMorphSample{
+				Target: m.Name,
+				Frame:  int(math.Round(float64(float32(k.Frame) * frameScale))),
+				Value:  k.Value,
+			})
+		}
+	}
+	return anim
+}
+
+func morphValueAt(keys []*mqo.MorphKeyframe, frame int) float32 {
+	i := sort.Search(len(keys), func(i int) bool { return keys[i].Frame >= frame })
+	if i == 0 {
+		return keys[0].Value
+	} else if i == len(keys) {
+		return keys[len(keys)-1].Value
+	}
+	k0, k1 := keys[i-1], keys[i]
+	t := float32(frame-k0.Frame) / float32(k1.Frame-k0.Frame)
+	return k0.Value*(1-t) + k1.Value*t
+}
+
+func addGltfSampler(a *gltf.Animation, node uint32, path gltf.TRSProperty, input, output uint32, interpolation gltf.Interpolation) {
+	a.Samplers = append(a.Samplers, &gltf.AnimationSampler{
+		Input:         gltf.Index(input),
+		Output:        gltf.Index(output),
+		Interpolation: interpolation,
+	})
+	a.Channels = append(a.Channels, &gltf.Channel{
+		Sampler: gltf.Index(uint32(len(a.Samplers) - 1)),
+		Target: gltf.ChannelTarget{
+			Node: gltf.Index(node),
+			Path: path,
+		},
+	})
+}
+
+func hasBoneTangents(keys []*mqo.BoneKeyframe) bool {
+	for _, k := range keys {
+		if k.In == nil || k.Out == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// AddMotionToGltf adds MQO motion as a glTF animation. bones is JointNodeToBone of the converter.
+func AddMotionToGltf(doc *gltf.Document, motion *mqo.Motion, bones map[uint32]*mqo.Bone, scale float32) {
+	addMotionToGltf(doc, motion, bones, nil, scale)
+}
+
+// motionTarget is the node animated by the ObjectMotion. base is the rest translation of the node in MQO coordinates.
+type motionTarget struct {
+	node uint32
+	base geom.Vector3
+}
+
+func addMotionToGltf(doc *gltf.Document, motion *mqo.Motion, bones map[uint32]*mqo.Bone, objects map[int]*motionTarget, scale float32) {
+	a := &gltf.Animation{Name: motion.Name}
+	fps := motion.GetFrameRate()
+
+	boneByID := map[int]*mqo.Bone{}
+	boneToNode := map[string]uint32{}
+	for n, b := range bones {
+		boneByID[b.ID] = b
+		boneToNode[b.Name] = n
+	}
+
+	for _, bm := range motion.Bones {
+		n, ok := boneToNode[bm.Name]
+		if !ok || len(bm.Keys) == 0 {
+			continue
+		}
+		b := bones[n]
+		base := b.Pos.Vector3
+		if parent := boneByID[b.Parent]; parent != nil {
+			base = *base.Sub(&parent.Pos.Vector3)
+		}
+		addTransformChannels(doc, a, n, &base, bm, fps, scale)
+	}
+	for _, om := range motion.Objects {
+		if target, ok := objects[om.ObjectID]; ok && len(om.Keys) > 0 {
+			addTransformChannels(doc, a, target.node, &target.base, &om.BoneMotion, fps, scale)
+		}
+	}
+
+	morphByName := map[string]*mqo.MorphMotion{}
+	for _, m := range motion.Morphs {
+		if len(m.Keys) > 0 {
+			morphByName[m.Name] = m
+		}
+	}
+	for ni, node := range doc.Nodes {
+		if node.Mesh == nil {
+			continue
+		}
+		names := meshTargetNames(doc.Meshes[*node.Mesh])
+		frameSet := map[int]bool{}
+		for _, name := range names {
+			if m := morphByName[name]; m != nil {
+				for _, k := range m.Keys {
+					frameSet[k.Frame] = true
+				}
+			}
+		}
+		if len(frameSet) == 0 {
+			continue
+		}
+		var frames []int
+		for f := range frameSet {
+			frames = append(frames, f)
+		}
+		sort.Ints(frames)
+
+		// CUBICSPLINE only if all morphs have tangents at the same frames.
+		cubic := true
+		for _, name := range names {
+			if m := morphByName[name]; m != nil {
+				cubic = cubic && len(m.Keys) == len(frames)
+				for i, k := range m.Keys {
+					cubic = cubic && k.In != nil && k.Out != nil && i < len(frames) && k.Frame == frames[i]
+				}
+			}
+		}
+
+		var keys []float32
+		weights := make([]float32, 0, len(frames)*len(names))
+		for i, f := range frames {
+			keys = append(keys, float32(f)/fps)
+			if cubic {
+				inTangents := make([]float32, len(names))
+				values := make([]float32, len(names))
+				outTangents := make([]float32, len(names))
+				for j, name := range names {
+					if m := morphByName[name]; m != nil {
+						inTangents[j], values[j], outTangents[j] = *m.Keys[i].In, m.Keys[i].Value, *m.Keys[i].Out
+					}
+				}
+				weights = append(append(append(weights, inTangents...), values...), outTangents...)
+				continue
+			}
+			for _, name := range names {
+				var w float32
+				if m := morphByName[name]; m != nil {
+					w = morphValueAt(m.Keys, f)
+				}
+				weights = append(weights, w)
+			}
+		}
+		interpolation := gltf.InterpolationLinear
+		if cubic {
+			interpolation = gltf.InterpolationCubicSpline
+		}
+		keysAcc := modeler.WriteAccessor(doc, gltf.TargetArrayBuffer, keys)
+		addGltfSampler(a, uint32(ni), gltf.TRSWeights, keysAcc, modeler.WriteAccessor(doc, gltf.TargetArrayBuffer, weights), interpolation)
+	}
+
+	if len(a.Channels) > 0 {
+		doc.Animations = append(doc.Animations, a)
+	}
+}
+
+// addTransformChannels adds the TRS channels of the node. base is added to the translations.
+func addTransformChannels(doc *gltf.Document, a *gltf.Animation, n uint32, base *geom.Vector3, bm *mqo.BoneMotion, fps, scale float32) {
+	// CUBICSPLINE: in-tangent, value, out-tangent for each keyframe.
+	cubic := hasBoneTangents(bm.Keys)
+	var keys []float32
+	var translations [][3]float32
+	var rotations [][4]float32
+	var scales [][3]float32
+	translate, rotate, scaling := false, false, false
+	var prevRot *geom.Quaternion
+	for _, k := range bm.Keys {
+		keys = append(keys, float32(k.Frame)/fps)
+		mv := k.GetTranslation()
+		translate = translate || *mv != mqo.Vector3{}
+		r := k.GetRotation()
+		rotate = rotate || *r != geom.Quaternion{W: 1}
+		sc := k.GetScale()
+		scaling = scaling || k.Scale != nil
+		if !cubic {
+			translations = append(translations, [3]float32{(base.X + mv.X) * scale, (base.Y + mv.Y) * scale, (base.Z + mv.Z) * scale})
+			rotations = append(rotations, [4]float32{r.X, r.Y, r.Z, r.W})
+			scales = append(scales, [3]float32{sc.X, sc.Y, sc.Z})
+			continue
+		}
+		rin, rout := k.In.GetRotation(), k.Out.GetRotation()
+		if prevRot != nil && prevRot.Dot(r) < 0 {
+			r, rin, rout = r.Scale(-1), rin.Scale(-1), rout.Scale(-1)
+		}
+		prevRot = r
+		sin, sout := &mqo.Vector3{}, &mqo.Vector3{}
+		if k.In.Sc != nil {
+			sin = &k.In.Sc.Vector3
+		}
+		if k.Out.Sc != nil {
+			sout = &k.Out.Sc.Vector3
+		}
+		translations = append(translations,
+			[3]float32{k.In.Mv.X * scale, k.In.Mv.Y * scale, k.In.Mv.Z * scale},
+			[3]float32{(base.X + mv.X) * scale, (base.Y + mv.Y) * scale, (base.Z + mv.Z) * scale},
+			[3]float32{k.Out.Mv.X * scale, k.Out.Mv.Y * scale, k.Out.Mv.Z * scale})
+		rotations = append(rotations, [4]float32{rin.X, rin.Y, rin.Z, rin.W}, [4]float32{r.X, r.Y, r.Z, r.W}, [4]float32{rout.X, rout.Y, rout.Z, rout.W})
+		scales = append(scales, [3]float32{sin.X, sin.Y, sin.Z}, [3]float32{sc.X, sc.Y, sc.Z}, [3]float32{sout.X, sout.Y, sout.Z})
+	}
+	interpolation := gltf.InterpolationLinear
+	if cubic {
+		interpolation = gltf.InterpolationCubicSpline
+	}
+	keysAcc := modeler.WriteAccessor(doc, gltf.TargetArrayBuffer, keys)
+	if rotate {
+		addGltfSampler(a, n, gltf.TRSRotation, keysAcc, modeler.WriteAccessor(doc, gltf.TargetArrayBuffer, rotations), interpolation)
+	}
+	if translate {
+		addGltfSampler(a, n, gltf.TRSTranslation, keysAcc, modeler.WriteAccessor(doc, gltf.TargetArrayBuffer, translations), interpolation)
+	}
+	if scaling {
+		addGltfSampler(a, n, gltf.TRSScale, keysAcc, modeler.WriteAccessor(doc, gltf.TargetArrayBuffer, scales), interpolation)
+	}
+}
+
+func meshTargetNames(mesh *gltf.Mesh) []string {
+	var names []string
+	if extras, ok := mesh.Extras.(map[string]interface{}); ok {
+		switch v := extras["targetNames"].(type) {
+		case []string:
+			names = v
+		case []interface{}:
+			for _, n := range v {
+				s, _ := n.(string)
+				names = append(names, s)
+			}
+		}
+	}
+	if len(mesh.Primitives) > 0 {
+		for i := len(names); i < len(mesh.Primitives[0].Targets); i++ {
+			names = append(names, "")
+		}
+	}
+	return names
+}
+
+type gltfSampler struct {
+	times  []float32
+	values [][]float32
+}
+
+func readGltfSampler(doc *gltf.Document, s *gltf.AnimationSampler) *gltfSampler {
+	if s.Input == nil || s.Output == nil {
+		return nil
+	}
+	input, err := modeler.ReadAccessor(doc, doc.Accessors[*s.Input], nil)
+	if err != nil {
+		return nil
+	}
+	times, ok := input.([]float32)
+	if !ok || len(times) == 0 {
+		return nil
+	}
+	output, err := modeler.ReadAccessor(doc, doc.Accessors[*s.Output], nil)
+	if err != nil {
+		return nil
+	}
+	var flat []float32
+	switch v := output.(type) {
+	case []float32:
+		flat = v
+	case [][3]float32:
+		for _, e := range v {
+			flat = append(flat, e[:]...)
+		}
+	case [][4]float32:
+		for _, e := range v {
+			flat = append(flat, e[:]...)
+		}
+	default:
+		log.Printf("Unsupported animation output: %T", output)
+		return nil
+	}
+	stride := len(flat) / len(times)
+	if s.Interpolation == gltf.InterpolationCubicSpline {
+		stride /= 3 // in-tangent, value, out-tangent
+	}
+	r := &gltfSampler{times: times}
+	for i := range times {
+		if s.Interpolation == gltf.InterpolationCubicSpline {
+			r.values = append(r.values, flat[(i*3+1)*stride:(i*3+2)*stride])
+		} else {
+			r.values = append(r.values, flat[i*stride:(i+1)*stride])
+		}
+	}
+	return r
+}
+
+func (s *gltfSampler) at(t float32) []float32 {
+	i := sort.Search(len(s.times), func(i int) bool { return s.times[i] >= t })
+	if i == 0 {
+		return s.values[0]
+	} else if i == len(s.times) {
+		return s.values[len(s.values)-1]
+	}
+	t0, t1 := s.times[i-1], s.times[i]
+	a := (t - t0) / (t1 - t0)
+	v := make([]float32, len(s.values[i]))
+	for j := range v {
+		v[j] = s.values[i-1][j]*(1-a) + s.values[i][j]*a
+	}
+	return v
+}
+
+// GltfAnimationToMotion converts glTF animation to MQO motion. Keyframes are relative to the rest pose of nodes.
+func GltfAnimationToMotion(doc *gltf.Document, anim *gltf.Animation, scale float32) *mqo.Motion {
+	motion := &mqo.Motion{Name: anim.Name, FrameRate: mmdFrameRate}
+	type nodeSamplers struct{ translation, rotation, weights *gltfSampler }
+	nodes := map[uint32]*nodeSamplers{}
+	var nodeOrder []uint32
+	for _, ch := range anim.Channels {
+		if ch.Target.Node == nil || ch.Sampler == nil || int(*ch.Sampler) >= len(anim.Samplers) {
+			continue
+		}
+		s := readGltfSampler(doc, anim.Samplers[*ch.Sampler])
+		if s == nil {
+			continue
+		}
+		n := *ch.Target.Node
+		if nodes[n] == nil {
+			nodes[n] = &nodeSamplers{}
+			nodeOrder = append(nodeOrder, n)
+		}
+		switch ch.Target.Path {
+		case gltf.TRSTranslation:
+			nodes[n].translation = s
+		case gltf.TRSRotation:
+			nodes[n].rotation = s
+		case gltf.TRSWeights:
+			nodes[n].weights = s
+		}
+	}
+
+	fps := motion.GetFrameRate()
+	framesOf := func(samplers ...*gltfSampler) []int {
+		set := map[int]bool{}
+		for _, s := range samplers {
+			if s != nil {
+				for _, t := range s.times {
+					set[int(math.Round(float64(t*fps)))] = true
+				}
+			}
+		}
+		var frames []int
+		for f := range set {
+			frames = append(frames, f)
+		}
+		sort.Ints(frames)
+		return frames
+	}
+
+	for _, n := range nodeOrder {
+		node, s := doc.Nodes[n], nodes[n]
+		if s.translation != nil || s.rotation != nil {
+			bm := &mqo.BoneMotion{Name: node.Name}
+			restRot := geom.NewQuaternionFromArray(node.RotationOrDefault())
+			restInv := restRot.Inverse()
+			for _, f := range framesOf(s.translation, s.rotation) {
+				t := float32(f) / fps
+				k := &mqo.BoneKeyframe{Frame: f}
+				if s.translation != nil {
+					v := s.translation.at(t)
+					k.MvX, k.MvY, k.MvZ = (v[0]-node.Translation[0])*scale, (v[1]-node.Translation[1])*scale, (v[2]-node.Translation[2])*scale
+				}
+				if s.rotation != nil {
+					v := s.rotation.at(t)
+					q := geom.NewQuaternion(v[0], v[1], v[2], v[3]).Normalize()
+					k.SetRotation(restInv.Mul(q))
+				}
+				bm.Keys = append(bm.Keys, k)
+			}
+			motion.Bones = append(motion.Bones, bm)
+		}
+		if s.weights != nil && node.Mesh != nil {
+			names := meshTargetNames(doc.Meshes[*node.Mesh])
+			for i, name := range names {
+				if name == "" || i >= len(s.weights.values[0]) {
+					continue
+				}
+				mm := &mqo.MorphMotion{Name: name}
+				for _, f := range framesOf(s.weights) {
+					mm.Keys = append(mm.Keys, &mqo.MorphKeyframe{Frame: f, Value: s.weights.at(float32(f) / fps)[i]})
+				}
+				motion.Morphs = append(motion.Morphs, mm)
+			}
+		}
+	}
+	return motion
+}
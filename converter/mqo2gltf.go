@@ -1,23 +1,24 @@
 package converter
 
 import (
-	"bytes"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
-	"math"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/binzume/modelconv/geom"
 	"github.com/binzume/modelconv/mqo"
+	"github.com/binzume/modelconv/unity"
+	"github.com/binzume/modelconv/vrm"
 	"github.com/qmuntal/gltf"
 	"github.com/qmuntal/gltf/modeler"
 
 	"image"
 	"image/color"
-	"image/jpeg"
-	"image/png"
 
 	_ "image/gif"
 	_ "image/jpeg"
@@ -41,10 +42,18 @@ type MQOToGLTFOption struct {
 	TextureScale           float32
 	IgnoreObjectHierarchy  bool
 	DetectAlphaTexture     bool
-
-	ExportLights   bool
-	ReuseGeometry  bool // experimental
-	ConvertPhysics bool // experimental. BLENDER_physics?
+	BumpScale              float32 // Strength of normal maps generated from height maps. Default: 2.0
+	TextureKTX2            string  // "uastc" or "etc1s": Add KTX2 textures by KHR_texture_basisu (requires toktx. Convert fails without it)
+	TextureWebP            bool    // Use lossless WebP textures by EXT_texture_webp if they are smaller
+	TextureConcurrency     int     // Number of texture workers. 0: number of CPUs
+	TextureMemoryBudget    int64   // Approximate bytes of decoded images in memory. Default: 1GiB
+
+	ExportLights        bool
+	ExportCameras       bool
+	ExportMToon         bool // MToon material properties for VRM
+	ExportPoseAnimation bool // Export the pose of the bones (PoseSet) as a "Pose" animation if the document has no motions
+	ReuseGeometry       bool // experimental
+	ConvertPhysics      bool // experimental. BLENDER_physics?
 }
 
 type mqoToGltf struct {
@@ -54,11 +63,18 @@ type mqoToGltf struct {
 	convertMorph    bool
 	JointNodeToBone map[uint32]*mqo.Bone
 	extensions      map[string]bool
+	normalMapped    map[int]bool // glTF material index
+	textureJobs     *texturePool
 }
 
+// textureCache keeps the decoded images up to cacheLimit bytes. Least recently used images are evicted.
 type textureCache struct {
-	srcDir   string
-	textures map[string]*textureInfo
+	srcDir      string
+	textures    map[string]*textureInfo
+	mu          sync.Mutex // textures are taken by the texture workers
+	cached      []*textureInfo
+	cachedBytes int64
+	cacheLimit  int64
 }
 
 type textureInfo struct {
@@ -68,33 +84,6 @@ type textureInfo struct {
 	err  error
 }
 
-type uvrect struct {
-	top, bottom, left, right float32
-}
-
-func newUVRectFromPoint(p geom.Vector2) *uvrect {
-	x := p.X - float32(math.Floor(float64(p.X)))
-	y := p.Y - float32(math.Floor(float64(p.Y)))
-	return &uvrect{y, y, x, x}
-}
-
-func (b *uvrect) Add(p geom.Vector2) {
-	x := p.X - float32(math.Floor(float64(p.X)))
-	y := p.Y - float32(math.Floor(float64(p.Y)))
-	if x < b.left {
-		b.left = x
-	}
-	if x > b.right {
-		b.right = x
-	}
-	if y < b.top {
-		b.top = y
-	}
-	if y > b.bottom {
-		b.bottom = y
-	}
-}
-
 const BlenderPhysicsName = "BLENDER_physics"
 
 type BlenderPhysicsBody struct {
@@ -105,7 +94,17 @@ type BlenderPhysicsBody struct {
 	CollisionMasks  int                      `json:"collisionMasks"`
 }
 
+func newTextureCache(srcDir string, cacheLimit int64) *textureCache {
+	return &textureCache{srcDir: srcDir, textures: map[string]*textureInfo{}, cacheLimit: cacheLimit}
+}
+
 func (c *textureCache) get(name string) *textureInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entry(name)
+}
+
+func (c *textureCache) entry(name string) *textureInfo {
 	if t, ok := c.textures[name]; ok {
 		return t
 	}
@@ -114,25 +113,88 @@ func (c *textureCache) get(name string) *textureInfo {
 	return t
 }
 
+func (c *textureCache) path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(c.srcDir, name)
+}
+
 func (c *textureCache) getImage(name string) (image.Image, error) {
-	t := c.get(name)
-	if t.img != nil || t.err != nil {
-		return t.img, t.err
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.entry(name)
+	if t.img != nil {
+		for i, ct := range c.cached {
+			if ct == t {
+				// Most recently used.
+				c.cached = append(append(c.cached[:i], c.cached[i+1:]...), t)
+				break
+			}
+		}
+		return t.img, nil
+	} else if t.err != nil {
+		return nil, t.err
+	}
+
+	t.img, t.err = c.decode(name)
+	if t.err != nil {
+		return nil, t.err
+	}
+	c.cached = append(c.cached, t)
+	c.cachedBytes += imageBytes(t.img.Bounds().Dx(), t.img.Bounds().Dy())
+	for c.cachedBytes > c.cacheLimit && len(c.cached) > 1 {
+		c.uncache(c.cached[0])
+	}
+	return t.img, nil
+}
+
+// takeImage returns the decoded image and removes it from the cache. The image is not cached if it is decoded.
+func (c *textureCache) takeImage(name string) (image.Image, error) {
+	c.mu.Lock()
+	if t, ok := c.textures[name]; ok && t.img != nil {
+		img := t.img
+		c.uncache(t)
+		c.mu.Unlock()
+		return img, nil
+	}
+	c.mu.Unlock()
+	return c.decode(name)
+}
+
+func (c *textureCache) uncache(t *textureInfo) {
+	for i, ct := range c.cached {
+		if ct == t {
+			c.cached = append(c.cached[:i], c.cached[i+1:]...)
+			c.cachedBytes -= imageBytes(t.img.Bounds().Dx(), t.img.Bounds().Dy())
+			t.img = nil
+			return
+		}
 	}
+}
 
-	f, err := os.Open(filepath.Join(c.srcDir, t.name))
+func (c *textureCache) decode(name string) (image.Image, error) {
+	f, err := os.Open(c.path(name))
 	if err != nil {
-		t.err = err
 		return nil, err
 	}
 	defer f.Close()
+	return decodeImage(f, name)
+}
 
-	if strings.ToLower(filepath.Ext(t.name)) == ".tga" {
-		t.img, t.err = tga.Decode(f)
-	} else {
-		t.img, _, t.err = image.Decode(f)
+func decodeImage(r io.Reader, name string) (image.Image, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".tga":
+		return tga.Decode(r)
+	case ".exr":
+		img, err := unity.DecodeEXR(r)
+		if err != nil {
+			return nil, err
+		}
+		return img, nil
 	}
-	return t.img, t.err
+	img, _, err := image.Decode(r)
+	return img, err
 }
 
 type geomCache struct {
@@ -152,12 +214,19 @@ func NewMQOToGLTFConverter(options *MQOToGLTFOption) *mqoToGltf {
 	if options.TextureScale == 0 {
 		options.TextureScale = 1.0
 	}
+	if options.BumpScale == 0 {
+		options.BumpScale = 2.0
+	}
+	if options.TextureMemoryBudget == 0 {
+		options.TextureMemoryBudget = 1 << 30
+	}
 	return &mqoToGltf{
 		MQOToGLTFOption: options,
 		Document:        gltf.NewDocument(),
 		convertBone:     true,
 		convertMorph:    true,
 		extensions:      map[string]bool{},
+		normalMapped:    map[int]bool{},
 	}
 }
 
@@ -278,6 +347,33 @@ func (m *mqoToGltf) getWeights(bones []*mqo.Bone, obj *mqo.Object, boneIDToJoint
 	return jointIds, joints, weights
 }
 
+func toGltfCamera(name string, param map[string]interface{}) *gltf.Camera {
+	getFloat := func(name string) float32 {
+		v, _ := param[name].(float32)
+		return v
+	}
+	camera := &gltf.Camera{Name: name}
+	if param["type"] == "orthographic" {
+		camera.Orthographic = &gltf.Orthographic{
+			Xmag:  getFloat("xmag"),
+			Ymag:  getFloat("ymag"),
+			Znear: getFloat("znear"),
+			Zfar:  getFloat("zfar"),
+		}
+	} else {
+		zfar := getFloat("zfar")
+		camera.Perspective = &gltf.Perspective{
+			Yfov:  getFloat("yfov"),
+			Znear: getFloat("znear"),
+			Zfar:  &zfar,
+		}
+		if aspect, ok := param["aspectRatio"].(float32); ok {
+			camera.Perspective.AspectRatio = &aspect
+		}
+	}
+	return camera
+}
+
 func (m *mqoToGltf) addSkin(joints []uint32, jointToBone map[uint32]*mqo.Bone) uint32 {
 	invmats := make([][4][4]float32, len(joints))
 	scale := m.Scale
@@ -297,44 +393,33 @@ func (m *mqoToGltf) addSkin(joints []uint32, jointToBone map[uint32]*mqo.Bone) u
 	return uint32(len(m.Skins) - 1)
 }
 
-func (m *mqoToGltf) hasAlpha(texture string, textures *textureCache, rect *uvrect) bool {
-	if texture == "" || strings.HasSuffix(texture, ".jpg") || strings.HasSuffix(texture, ".bmp") {
-		return false
+// gltfShaderIsUnlit returns true if the glTF shader material is converted to KHR_materials_unlit.
+// Rough dielectric materials without Extensions.Unlit are treated as unlit.
+func gltfShaderIsUnlit(ex *mqo.MaterialEx2) bool {
+	unlit, ok := ex.ShaderParams["Extensions.Unlit"].(bool)
+	return unlit || !ok && ex.FloatParam("Metallic") == 0 && ex.FloatParam("Roughness") == 1
+}
+
+// detectAlphaMode returns the alpha mode of the texture by the pixels covered by the UV triangles.
+func (m *mqoToGltf) detectAlphaMode(texture string, textures *textureCache, tris uvTriangles) (int, float32) {
+	ext := strings.ToLower(filepath.Ext(texture))
+	if texture == "" || ext == ".jpg" || ext == ".jpeg" || ext == ".bmp" {
+		return mqo.AlphaModeOpaque, 0
 	}
 	img, err := textures.getImage(texture)
 	if err != nil {
-		return false
-	}
-	if rect != nil {
-		if s, ok := img.(interface {
-			SubImage(r image.Rectangle) image.Image
-		}); ok {
-			b := img.Bounds()
-			r := image.Rectangle{
-				Min: image.Point{X: int(float32(b.Dx()) * rect.left), Y: int(float32(b.Dy()) * rect.top)},
-				Max: image.Point{X: int(float32(b.Dx()) * rect.right), Y: int(float32(b.Dy()) * rect.bottom)},
-			}
-			img = s.SubImage(r)
-		}
+		return mqo.AlphaModeOpaque, 0
 	}
-	switch img.ColorModel() {
-	case color.YCbCrModel, color.CMYKModel:
-		return false
-	case color.RGBAModel:
-		return !img.(*image.RGBA).Opaque()
-	case color.NRGBAModel:
-		return !img.(*image.NRGBA).Opaque()
+	var mask []bool
+	if len(tris) > 0 {
+		mask = tris.coverage(img.Bounds().Dx(), img.Bounds().Dy())
 	}
-	return false
+	return alphaModeFromHistogram(alphaHistogram(img, mask))
 }
 
-func scaleTexture(texture string, mime string, textures *textureCache, scale float32, limit int) (io.Reader, error) {
-	img, err := textures.getImage(texture)
-	if err != nil {
-		return nil, err
-	}
+// scaleImage resizes the image by the scale. The width is limited to the limit if it is not 0.
+func scaleImage(img image.Image, scale float32, limit int) image.Image {
 	rect := img.Bounds()
-
 	if limit > 0 {
 		sz := int(float32(rect.Dx()) * scale)
 		if sz > limit {
@@ -347,17 +432,7 @@ func scaleTexture(texture string, mime string, textures *textureCache, scale flo
 		draw.CatmullRom.Scale(dst, dst.Bounds(), img, rect, draw.Over, nil)
 		img = dst
 	}
-
-	w := new(bytes.Buffer)
-	if mime == "image/png" {
-		err = png.Encode(w, img)
-	} else {
-		err = jpeg.Encode(w, img, nil)
-	}
-	if err != nil {
-		return nil, err
-	}
-	return w, nil
+	return img
 }
 
 func (m *mqoToGltf) addTexture(texture string, textures *textureCache) (*uint32, error) {
@@ -366,22 +441,13 @@ func (m *mqoToGltf) addTexture(texture string, textures *textureCache) (*uint32,
 		return t.id, nil
 	}
 	ext := strings.ToLower(filepath.Ext(texture))
-	path := texture
-	if !filepath.IsAbs(path) {
-		path = filepath.Join(textures.srcDir, texture)
-	}
-
-	encode := m.TextureReCompress
-	if m.TextureBytesThreshold > 0 {
-		stat, err := os.Stat(path)
-		if err != nil {
-			return nil, err
-		}
-		if stat.Size() > m.TextureBytesThreshold {
-			encode = true
-		}
+	path := textures.path(texture)
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
 	}
 
+	encode := m.TextureReCompress || m.TextureBytesThreshold > 0 && stat.Size() > m.TextureBytesThreshold
 	var mimeType string
 	if ext == ".jpg" || ext == ".jpeg" {
 		mimeType = "image/jpeg"
@@ -392,33 +458,106 @@ func (m *mqoToGltf) addTexture(texture string, textures *textureCache) (*uint32,
 		encode = true
 	}
 
-	var r io.Reader
-	if encode {
-		r2, err := scaleTexture(texture, mimeType, textures, m.TextureScale, m.TextureResolutionLimit)
-		if err != nil {
-			return nil, err
+	memory := stat.Size()
+	if encode || m.TextureWebP {
+		// Decoded image and resized image.
+		memory *= 8
+		if f, err := os.Open(path); err == nil {
+			if cfg, err := decodeImageConfig(f, texture); err == nil {
+				memory = imageBytes(cfg.Width, cfg.Height) * 2
+			}
+			f.Close()
 		}
-		r = r2
-	} else {
-		f, err := os.Open(path)
+	}
+
+	t.id = m.writeTexture(filepath.Base(texture), mimeType, memory, func() (image.Image, []byte, error) {
+		if !encode {
+			data, err := ioutil.ReadFile(path)
+			return nil, data, err
+		}
+		img, err := textures.takeImage(texture)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		defer f.Close()
-		r = f
-	}
-	img, err := modeler.WriteImage(m.Document, filepath.Base(texture), mimeType, r)
+		return scaleImage(img, m.TextureScale, m.TextureResolutionLimit), nil, nil
+	})
+	return t.id, nil
+}
+
+// writeTexture adds the texture. The image is encoded by the texture workers and written to the buffer in Convert().
+// memory is the estimated size of the decoded images used by the source function.
+func (m *mqoToGltf) writeTexture(name, mimeType string, memory int64, source textureSourceFunc) *uint32 {
+	m.Textures = append(m.Textures, &gltf.Texture{Sampler: gltf.Index(0)})
+	index := uint32(len(m.Textures)) - 1
+	m.textureJobs.submit(&textureJob{texture: index, name: name, mimeType: mimeType}, memory, source)
+	return gltf.Index(index)
+}
+
+func (m *mqoToGltf) writeImage(name, mimeType string, r io.Reader) (uint32, error) {
+	img, err := modeler.WriteImage(m.Document, name, mimeType, r)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	m.Buffers[0].ByteLength = uint32(len(m.Buffers[0].Data)) // avoid AddImage bug
-	m.Textures = append(m.Textures,
-		&gltf.Texture{Sampler: gltf.Index(0), Source: gltf.Index(img)})
+	return img, nil
+}
+
+// addAlphaMergedTexture adds the base color texture with the alpha texture in the alpha channel.
+// The alpha mode and the cutoff are estimated from the alpha histogram of the merged texture in the UV triangles.
+// The texture is shared by the materials with the same textures, but the alpha mode is estimated for each material.
+func (m *mqoToGltf) addAlphaMergedTexture(mat *mqo.Material, textures *textureCache, uvs uvTriangles) (*uint32, int, float32, error) {
+	alpha, err := textures.getImage(mat.AlphaTexture)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	var base image.Image
+	if mat.Texture != "" {
+		if base, err = textures.getImage(mat.Texture); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+	img := mergeAlphaTexture(base, alpha)
+	if m.TextureResolutionLimit > 0 && img.Bounds().Dx() > m.TextureResolutionLimit {
+		scale := float32(m.TextureResolutionLimit) / float32(img.Bounds().Dx())
+		dst := image.NewNRGBA(image.Rect(0, 0, m.TextureResolutionLimit, int(float32(img.Bounds().Dy())*scale)))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+		img = dst
+	}
+	var mask []bool
+	if len(uvs) > 0 {
+		mask = uvs.coverage(img.Bounds().Dx(), img.Bounds().Dy())
+	}
+	mode, cutoff := alphaModeFromHistogram(alphaHistogram(img, mask))
 
-	t.id = gltf.Index(uint32(len(m.Textures)) - 1)
+	t := textures.get(mat.Texture + "#alpha:" + mat.AlphaTexture)
+	if t.id == nil {
+		t.id = m.addImageTexture(alphaMergedTextureName(mat.Texture, mat.AlphaTexture), img)
+	}
+	return t.id, mode, cutoff, nil
+}
 
+// addNormalTexture adds the bump texture. Greyscale height maps are converted to normal maps.
+func (m *mqoToGltf) addNormalTexture(texture string, textures *textureCache) (*uint32, error) {
+	img, err := textures.getImage(texture)
+	if err != nil || !isHeightMap(img) {
+		return m.addTexture(texture, textures)
+	}
+	t := textures.get(texture + "#normal")
+	if t.id != nil {
+		return t.id, nil
+	}
+	name := strings.TrimSuffix(filepath.Base(texture), filepath.Ext(texture)) + "_normal.png"
+	// The image is taken again by the worker not to keep it in the closure while it is evicted from the cache.
+	t.id = m.writeTexture(name, "image/png", imageBytes(img.Bounds().Dx(), img.Bounds().Dy())*2, func() (image.Image, []byte, error) {
+		img, err := textures.takeImage(texture)
+		if err != nil {
+			return nil, nil, err
+		}
+		return heightToNormalMap(img, m.BumpScale), nil, nil
+	})
 	return t.id, nil
 }
+
 func (m *mqoToGltf) tryAddTexture(texturePath string, textures *textureCache) *gltf.TextureInfo {
 	if texturePath == "" {
 		return nil
@@ -431,7 +570,7 @@ func (m *mqoToGltf) tryAddTexture(texturePath string, textures *textureCache) *g
 	return nil
 }
 
-func (m *mqoToGltf) convertMaterial(mat *mqo.Material, textures *textureCache, bounds *uvrect) *gltf.Material {
+func (m *mqoToGltf) convertMaterial(mat *mqo.Material, textures *textureCache, uvs uvTriangles) *gltf.Material {
 	var unlitMaterialExt = "KHR_materials_unlit"
 	var rf float32 = 0.4
 	var mf = mat.Specular
@@ -450,12 +589,6 @@ func (m *mqoToGltf) convertMaterial(mat *mqo.Material, textures *textureCache, b
 		} else {
 			mm.EmissiveFactor = [3]float32{(mat.Emission), (mat.Emission), (mat.Emission)}
 		}
-		s := geom.Max(geom.Max(mm.EmissiveFactor[0], mm.EmissiveFactor[1]), mm.EmissiveFactor[2])
-		if s > 1 {
-			mm.EmissiveFactor[0] /= s
-			mm.EmissiveFactor[1] /= s
-			mm.EmissiveFactor[2] /= s
-		}
 	}
 
 	addExt := func(name string, ext interface{}) {
@@ -465,6 +598,13 @@ func (m *mqoToGltf) convertMaterial(mat *mqo.Material, textures *textureCache, b
 		mm.Extensions[name] = ext
 		m.extensions[name] = true
 	}
+	var emissiveStrength float32 = 1
+	if s := geom.Max(geom.Max(mm.EmissiveFactor[0], mm.EmissiveFactor[1]), mm.EmissiveFactor[2]); s > 1 {
+		mm.EmissiveFactor[0] /= s
+		mm.EmissiveFactor[1] /= s
+		mm.EmissiveFactor[2] /= s
+		emissiveStrength = s
+	}
 	if mat.GetShaderName() == "glTF" {
 		metallicFactor := float32(mat.Ex2.FloatParam("Metallic"))
 		mm.PBRMetallicRoughness.MetallicFactor = &metallicFactor
@@ -481,7 +621,7 @@ func (m *mqoToGltf) convertMaterial(mat *mqo.Material, textures *textureCache, b
 			mm.AlphaMode = gltf.AlphaBlend
 		}
 
-		if mat.Ex2.BoolParam("Extensions.Unlit") || metallicFactor == 0 && roughnessFactor == 1 {
+		if gltfShaderIsUnlit(mat.Ex2) {
 			addExt(unlitMaterialExt, map[string]string{})
 		}
 		if mat.Ex2.BoolParam("Extensions.SpecularExt") {
@@ -568,22 +708,216 @@ func (m *mqoToGltf) convertMaterial(mat *mqo.Material, textures *textureCache, b
 			}
 			addExt("KHR_materials_transmission", ext)
 		}
-	} else if mat.Color.W < 0.99 || (m.DetectAlphaTexture && m.hasAlpha(mat.Texture, textures, bounds)) {
+		if v := mat.Ex2.FloatParam("Extensions.EmissiveStrength"); v > 0 {
+			emissiveStrength *= float32(v)
+		}
+		if mat.Ex2.BoolParam("Extensions.Iridescence") {
+			ext := map[string]interface{}{}
+			if v := mat.Ex2.FloatParam("Extensions.IridescenceFactor"); v != 0 {
+				ext["iridescenceFactor"] = v
+			}
+			if v := mat.Ex2.FloatParam("Extensions.IridescenceIor"); v != 0 {
+				ext["iridescenceIor"] = v
+			}
+			if v := mat.Ex2.FloatParam("Extensions.IridescenceThicknessMinimum"); v != 0 {
+				ext["iridescenceThicknessMinimum"] = v
+			}
+			if v := mat.Ex2.FloatParam("Extensions.IridescenceThicknessMaximum"); v != 0 {
+				ext["iridescenceThicknessMaximum"] = v
+			}
+			if t := m.tryAddTexture(mat.Ex2.Mapping("Iridescence"), textures); t != nil {
+				ext["iridescenceTexture"] = t
+			}
+			if t := m.tryAddTexture(mat.Ex2.Mapping("IridescenceThickness"), textures); t != nil {
+				ext["iridescenceThicknessTexture"] = t
+			}
+			addExt("KHR_materials_iridescence", ext)
+		}
+		if mat.Ex2.BoolParam("Extensions.Anisotropy") {
+			ext := map[string]interface{}{}
+			if v := mat.Ex2.FloatParam("Extensions.AnisotropyStrength"); v != 0 {
+				ext["anisotropyStrength"] = v
+			}
+			if v := mat.Ex2.FloatParam("Extensions.AnisotropyRotation"); v != 0 {
+				ext["anisotropyRotation"] = v
+			}
+			if t := m.tryAddTexture(mat.Ex2.Mapping("Anisotropy"), textures); t != nil {
+				ext["anisotropyTexture"] = t
+			}
+			addExt("KHR_materials_anisotropy", ext)
+		}
+	} else if mat.Color.W < 0.99 {
 		mm.AlphaMode = gltf.AlphaBlend
+	} else if m.DetectAlphaTexture {
+		switch mode, cutoff := m.detectAlphaMode(mat.Texture, textures, uvs); mode {
+		case mqo.AlphaModeMask:
+			mm.AlphaMode = gltf.AlphaMask
+			mm.AlphaCutoff = &cutoff
+		case mqo.AlphaModeBlend:
+			mm.AlphaMode = gltf.AlphaBlend
+		}
+	}
+	if emissiveStrength != 1 {
+		addExt("KHR_materials_emissive_strength", map[string]interface{}{"emissiveStrength": emissiveStrength})
 	}
 	if m.ForceUnlit || mat.GetShaderName() == "Constant" {
 		addExt(unlitMaterialExt, map[string]string{})
 	}
 
-	mm.PBRMetallicRoughness.BaseColorTexture = m.tryAddTexture(mat.Texture, textures)
-	if t := m.tryAddTexture(mat.BumpTexture, textures); t != nil {
-		mm.NormalTexture = &gltf.NormalTexture{Index: &t.Index}
+	if mat.AlphaTexture != "" {
+		if tex, mode, cutoff, err := m.addAlphaMergedTexture(mat, textures, uvs); err == nil {
+			mm.PBRMetallicRoughness.BaseColorTexture = &gltf.TextureInfo{Index: *tex}
+			explicit := mat.GetShaderName() == "glTF" && mat.Ex2.IntParam("AlphaMode") != 0
+			if mode == mqo.AlphaModeMask && !explicit && mm.AlphaMode != gltf.AlphaBlend {
+				mm.AlphaMode = gltf.AlphaMask
+				mm.AlphaCutoff = &cutoff
+			} else if mode == mqo.AlphaModeBlend && !explicit {
+				mm.AlphaMode = gltf.AlphaBlend
+			}
+		} else {
+			log.Print("Texture read error:", mat.AlphaTexture, err)
+		}
+	}
+	if mm.PBRMetallicRoughness.BaseColorTexture == nil {
+		mm.PBRMetallicRoughness.BaseColorTexture = m.tryAddTexture(mat.Texture, textures)
+	}
+	if mat.BumpTexture != "" {
+		if tex, err := m.addNormalTexture(mat.BumpTexture, textures); err == nil {
+			mm.NormalTexture = &gltf.NormalTexture{Index: tex}
+		} else {
+			log.Print("Texture read error:", mat.BumpTexture, err)
+		}
+	}
+	if mat.GetShaderName() == "glTF" {
+		m.convertGltfShaderTextures(mat.Ex2, mm, textures)
+	}
+	if occlusion, ok := mat.Extra["occlusionTexture"].(string); ok && mm.OcclusionTexture == nil {
+		// Baked by BakeAmbientOcclusion() without changing the shader.
+		if t := m.tryAddTexture(occlusion, textures); t != nil {
+			mm.OcclusionTexture = &gltf.OcclusionTexture{Index: &t.Index}
+		}
 	}
 	return mm
 }
 
+func (m *mqoToGltf) convertGltfShaderTextures(ex *mqo.MaterialEx2, mm *gltf.Material, textures *textureCache) {
+	if t := m.tryAddTexture(ex.Mapping("MetallicRoughness"), textures); t != nil {
+		mm.PBRMetallicRoughness.MetallicRoughnessTexture = t
+	} else if ex.Mapping("Metallic") != "" || ex.Mapping("Roughness") != "" {
+		if tex, err := m.addMetallicRoughnessTexture(ex.Mapping("Metallic"), ex.Mapping("Roughness"), textures); err == nil {
+			mm.PBRMetallicRoughness.MetallicRoughnessTexture = &gltf.TextureInfo{Index: *tex}
+		} else {
+			log.Print("Texture read error:", err)
+		}
+	}
+	if t := m.tryAddTexture(ex.Mapping("Occlusion"), textures); t != nil {
+		mm.OcclusionTexture = &gltf.OcclusionTexture{Index: &t.Index}
+		if _, ok := ex.ShaderParams["OcclusionStrength"]; ok {
+			strength := float32(ex.FloatParam("OcclusionStrength"))
+			mm.OcclusionTexture.Strength = &strength
+		}
+	}
+	if t := m.tryAddTexture(ex.Mapping("Emissive"), textures); t != nil {
+		mm.EmissiveTexture = t
+		if mm.EmissiveFactor == [3]float32{} {
+			mm.EmissiveFactor = [3]float32{1, 1, 1}
+		}
+	}
+	if mm.NormalTexture != nil {
+		if _, ok := ex.ShaderParams["NormalScale"]; ok {
+			scale := float32(ex.FloatParam("NormalScale"))
+			mm.NormalTexture.Scale = &scale
+		}
+	}
+
+	// KHR_texture_transform
+	uvTransform := ex.ColorParam("UVTransform") // scaleX, scaleY, offsetX, offsetY
+	if len(uvTransform) < 4 {
+		return
+	}
+	transform := map[string]interface{}{
+		"scale":  uvTransform[0:2],
+		"offset": uvTransform[2:4],
+	}
+	const textureTransformExt = "KHR_texture_transform"
+	var exts []*gltf.Extensions
+	if t := mm.PBRMetallicRoughness.BaseColorTexture; t != nil {
+		exts = append(exts, &t.Extensions)
+	}
+	if t := mm.PBRMetallicRoughness.MetallicRoughnessTexture; t != nil {
+		exts = append(exts, &t.Extensions)
+	}
+	if t := mm.EmissiveTexture; t != nil {
+		exts = append(exts, &t.Extensions)
+	}
+	if t := mm.NormalTexture; t != nil {
+		exts = append(exts, &t.Extensions)
+	}
+	if t := mm.OcclusionTexture; t != nil {
+		exts = append(exts, &t.Extensions)
+	}
+	for _, ext := range exts {
+		if *ext == nil {
+			*ext = gltf.Extensions{}
+		}
+		(*ext)[textureTransformExt] = transform
+		m.extensions[textureTransformExt] = true
+	}
+}
+
+// addMetallicRoughnessTexture packs separate metallic and roughness textures. (G: roughness, B: metallic)
+func (m *mqoToGltf) addMetallicRoughnessTexture(metallic, roughness string, textures *textureCache) (*uint32, error) {
+	t := textures.get(metallic + "#roughness:" + roughness)
+	if t.id != nil {
+		return t.id, nil
+	}
+	var imgs [2]image.Image
+	size := image.Point{}
+	for i, name := range []string{metallic, roughness} {
+		if name == "" {
+			continue
+		}
+		img, err := textures.getImage(name)
+		if err != nil {
+			return nil, err
+		}
+		imgs[i] = img
+		if img.Bounds().Dx() > size.X {
+			size = img.Bounds().Size()
+		}
+	}
+	name := metallic
+	if name == "" {
+		name = roughness
+	}
+	name = strings.TrimSuffix(filepath.Base(name), filepath.Ext(name)) + "_metallicRoughness.png"
+	t.id = m.writeTexture(name, "image/png", imageBytes(size.X, size.Y)*3, func() (image.Image, []byte, error) {
+		dst := image.NewNRGBA(image.Rectangle{Max: size})
+		for y := 0; y < size.Y; y++ {
+			for x := 0; x < size.X; x++ {
+				c := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+				for i, img := range imgs {
+					if img == nil {
+						continue
+					}
+					b := img.Bounds()
+					v := color.GrayModel.Convert(img.At(b.Min.X+x*b.Dx()/size.X, b.Min.Y+y*b.Dy()/size.Y)).(color.Gray).Y
+					if i == 0 {
+						c.B = v
+					} else {
+						c.G = v
+					}
+				}
+				dst.SetNRGBA(x, y, c)
+			}
+		}
+		return dst, nil, nil
+	})
+	return t.id, nil
+}
+
 func (m *mqoToGltf) ConvertObject(obj *mqo.Object, bones []*mqo.Bone, boneIDToJoint map[int]uint32,
-	morphObjs []*mqo.Object, materialMap map[int]int, shared *geomCache, uvBounds map[int]*uvrect) (*gltf.Mesh, []uint32) {
+	morphObjs []*mqo.Object, materialMap map[int]int, shared *geomCache, uvs map[int]uvTriangles) (*gltf.Mesh, []uint32) {
 	scale := m.Scale
 	obj.FixhNormals()
 	obj.Triangulate()
@@ -616,10 +950,10 @@ func (m *mqoToGltf) ConvertObject(obj *mqo.Object, bones []*mqo.Bone, boneIDToJo
 		copy(verts, f.Verts)
 		if len(f.UVs) > 0 {
 			useTexcood0 = true
-			bounds := uvBounds[f.Material]
-			if bounds == nil {
-				bounds = newUVRectFromPoint(f.UVs[0])
-				uvBounds[f.Material] = bounds
+			if m.DetectAlphaTexture {
+				for i := 2; i < len(f.UVs); i++ {
+					uvs[f.Material] = append(uvs[f.Material], [3]geom.Vector2{f.UVs[0], f.UVs[i-1], f.UVs[i]})
+				}
 			}
 
 			for i, index := range verts {
@@ -649,7 +983,6 @@ func (m *mqoToGltf) ConvertObject(obj *mqo.Object, bones []*mqo.Bone, boneIDToJo
 				indicesMap[index] = append(indicesMap[index], verts[i])
 				texcood0[verts[i]] = [2]float32{f.UVs[i].X, f.UVs[i].Y}
 				normal.ToArray(normals[verts[i]][:])
-				bounds.Add(f.UVs[i])
 			}
 		} else {
 			for i, index := range verts {
@@ -662,6 +995,35 @@ func (m *mqoToGltf) ConvertObject(obj *mqo.Object, bones []*mqo.Bone, boneIDToJo
 		indices[mat] = append(indices[mat], uint32(verts[2]), uint32(verts[1]), uint32(verts[0]))
 	}
 
+	var tangents [][4]float32
+	if useTexcood0 && obj.Shading > 0 && !m.ForceUnlit && m.hasNormalMap(materials) {
+		var triangles [][]uint32
+		for _, mat := range materials {
+			triangles = append(triangles, indices[mat])
+		}
+		var tangentSrc []int
+		tangents, tangentSrc = generateTangents(vertexes, normals, texcood0, triangles)
+		// Vertices shared by mirrored faces are split.
+		for _, i := range tangentSrc[len(vertexes):] {
+			srcIndices = append(srcIndices, srcIndices[i])
+			vertexes = append(vertexes, vertexes[i])
+			normals = append(normals, normals[i])
+			texcood0 = append(texcood0, texcood0[i])
+			if len(joints) > 0 {
+				joints0 = append(joints0, joints0[i])
+				weights0 = append(weights0, weights0[i])
+			}
+		}
+	}
+
+	var colors [][4]uint8
+	if len(obj.VertexColors) == len(obj.Vertexes) {
+		for _, i := range srcIndices {
+			c := mqo.ColorToABGR(&obj.VertexColors[i])
+			colors = append(colors, [4]uint8{uint8(c), uint8(c >> 8), uint8(c >> 16), uint8(c >> 24)})
+		}
+	}
+
 	attributes := map[string]uint32{}
 
 	if !partial && shared != nil && shared.attributes != nil {
@@ -669,16 +1031,28 @@ func (m *mqoToGltf) ConvertObject(obj *mqo.Object, bones []*mqo.Bone, boneIDToJo
 		if useTexcood0 {
 			attributes["TEXCOORD_0"] = shared.attributes["TEXCOORD_0"]
 		}
+		if colors != nil {
+			attributes["COLOR_0"] = shared.attributes["COLOR_0"]
+		}
 		if obj.Shading > 0 && !m.ForceUnlit {
 			attributes["NORMAL"] = shared.attributes["NORMAL"]
+			if tangent, ok := shared.attributes["TANGENT"]; ok {
+				attributes["TANGENT"] = tangent
+			}
 		}
 	} else if len(vertexes) > 0 {
 		attributes["POSITION"] = modeler.WritePosition(m.Document, vertexes)
 		if useTexcood0 {
 			attributes["TEXCOORD_0"] = modeler.WriteTextureCoord(m.Document, texcood0)
 		}
+		if colors != nil {
+			attributes["COLOR_0"] = modeler.WriteColor(m.Document, colors)
+		}
 		if obj.Shading > 0 && !m.ForceUnlit {
 			attributes["NORMAL"] = modeler.WriteNormal(m.Document, normals)
+			if tangents != nil {
+				attributes["TANGENT"] = modeler.WriteTangent(m.Document, tangents)
+			}
 		}
 	}
 
@@ -736,6 +1110,15 @@ func (m *mqoToGltf) ConvertObject(obj *mqo.Object, bones []*mqo.Bone, boneIDToJo
 	}, joints
 }
 
+func (m *mqoToGltf) hasNormalMap(materials []int) bool {
+	for _, mat := range materials {
+		if m.normalMapped[mat] {
+			return true
+		}
+	}
+	return false
+}
+
 func (m *mqoToGltf) checkMaterials(obj *mqo.Object, materials map[int]bool) {
 	for _, f := range obj.Faces {
 		materials[f.Material] = true
@@ -743,10 +1126,17 @@ func (m *mqoToGltf) checkMaterials(obj *mqo.Object, materials map[int]bool) {
 }
 
 func (m *mqoToGltf) Convert(doc *mqo.Document, textureDir string) (*gltf.Document, error) {
+	if m.TextureKTX2 != "" {
+		// Fail before converting the textures.
+		if _, err := ktx2Encoder(m.TextureKTX2); err != nil {
+			return nil, err
+		}
+	}
+	doc.ApplyMirrorAndPatch()
 	objectByName := map[string]*mqo.Object{}
 	morphTargets := map[string]*mqo.Object{}
 	morphBases := map[string]*mqo.MorphTargetList{}
-	uvBounds := map[int]*uvrect{}
+	uvs := map[int]uvTriangles{}
 	for _, obj := range doc.Objects {
 		objectByName[obj.Name] = obj
 	}
@@ -763,7 +1153,8 @@ func (m *mqoToGltf) Convert(doc *mqo.Document, textureDir string) (*gltf.Documen
 	var targetObjects []*mqo.Object
 	materialUsed := map[int]bool{}
 	for _, obj := range doc.Objects {
-		if (!m.IgnoreObjectHierarchy || obj.Visible && len(obj.Faces) > 0) && morphTargets[obj.Name] == nil {
+		_, lodGroup := obj.Extra["lodMembers"]
+		if (!m.IgnoreObjectHierarchy || obj.Visible && (len(obj.Faces) > 0 || lodGroup)) && morphTargets[obj.Name] == nil {
 			targetObjects = append(targetObjects, obj)
 			if obj.Visible {
 				m.checkMaterials(obj, materialUsed)
@@ -779,6 +1170,7 @@ func (m *mqoToGltf) Convert(doc *mqo.Document, textureDir string) (*gltf.Documen
 		}
 		if !strings.HasSuffix(mat.Name, "$IGNORE") && !strings.HasPrefix(mat.Name, "$MORPH:") {
 			materialMap[i] = materialCount
+			m.normalMapped[materialCount] = mat.BumpTexture != "" && !m.ForceUnlit
 			materialCount++
 		}
 	}
@@ -815,10 +1207,42 @@ func (m *mqoToGltf) Convert(doc *mqo.Document, textureDir string) (*gltf.Documen
 		}
 	}
 
+	// MSFT_lod: lower LOD nodes are not in the scene.
+	lodNodes := map[*mqo.Object]bool{}
+	lodMembers := map[*mqo.Object]bool{}
+	objectIndex := map[*mqo.Object]uint32{}
+	for i, obj := range targetObjects {
+		objectIndex[obj] = uint32(i)
+		if lods, ok := obj.Extra["lods"].([]*mqo.Object); ok && obj.Visible {
+			for _, lod := range lods {
+				lodNodes[lod] = true
+			}
+		}
+		if members, ok := obj.Extra["lodMembers"].([]*mqo.Object); ok {
+			for _, member := range members {
+				lodMembers[member] = true
+			}
+		}
+	}
+
+	// Animated objects are exported as the nodes at their pivots. Other nodes are placed at the world origin.
+	animatedObjects := map[int]bool{}
+	if kp := mqo.FindKeyframerPlugin(doc); kp != nil && !m.IgnoreObjectHierarchy {
+		for _, motion := range kp.Motions {
+			for _, om := range motion.Objects {
+				animatedObjects[om.ObjectID] = true
+			}
+		}
+	}
+	objectTargets := map[int]*motionTarget{}
+	nodePivots := map[*gltf.Node]geom.Vector3{}
+
 	var lights []map[string]interface{}
 	var nodePath []*gltf.Node
 	for i, obj := range targetObjects {
 		var morphTargets []*mqo.Object
+		var morphWeights []float32
+		hasMorphWeight := false
 		if m.convertMorph {
 			if morph, ok := morphBases[obj.Name]; ok {
 				for _, t := range morph.Target {
@@ -827,6 +1251,9 @@ func (m *mqoToGltf) Convert(doc *mqo.Document, textureDir string) (*gltf.Documen
 						continue
 					}
 					morphTargets = append(morphTargets, objectByName[t.Name])
+					w, _ := objectByName[t.Name].Extra["morphWeight"].(float32)
+					morphWeights = append(morphWeights, w)
+					hasMorphWeight = hasMorphWeight || w != 0
 				}
 			}
 		}
@@ -842,7 +1269,10 @@ func (m *mqoToGltf) Convert(doc *mqo.Document, textureDir string) (*gltf.Documen
 					}
 				}
 			}
-			mesh, joints := m.ConvertObject(obj, bones, boneIDToJoint, morphTargets, materialMap, shared, uvBounds)
+			mesh, joints := m.ConvertObject(obj, bones, boneIDToJoint, morphTargets, materialMap, shared, uvs)
+			if hasMorphWeight {
+				mesh.Weights = morphWeights
+			}
 			if len(mesh.Primitives) > 0 {
 				node.Mesh = gltf.Index(uint32(len(m.Document.Meshes)))
 				m.Document.Meshes = append(m.Document.Meshes, mesh)
@@ -859,7 +1289,13 @@ func (m *mqoToGltf) Convert(doc *mqo.Document, textureDir string) (*gltf.Documen
 					lights = append(lights, lightParam)
 				}
 			}
-			if (m.ExportLights && obj.Extra["light"] != nil || shared != nil) && obj.InternalTransform != nil {
+			if m.ExportCameras {
+				if cameraParam, ok := obj.Extra["camera"].(map[string]interface{}); ok {
+					node.Camera = gltf.Index(uint32(len(m.Document.Cameras)))
+					m.Document.Cameras = append(m.Document.Cameras, toGltfCamera(obj.Name, cameraParam))
+				}
+			}
+			if (m.ExportLights && obj.Extra["light"] != nil || m.ExportCameras && obj.Extra["camera"] != nil || shared != nil) && obj.InternalTransform != nil {
 				m := obj.InternalTransform.TranslationScale(m.Scale)
 				if shared != nil {
 					m = m.Mul(shared.matrix)
@@ -872,12 +1308,33 @@ func (m *mqoToGltf) Convert(doc *mqo.Document, textureDir string) (*gltf.Documen
 				node.Matrix[15] = 1
 			}
 		}
-		m.Nodes[i] = node
-		// node.AddChild()
 		if len(nodePath) > obj.Depth {
 			nodePath = nodePath[:obj.Depth]
 		}
+		var parentPivot, pivot geom.Vector3
 		if !m.IgnoreObjectHierarchy && len(nodePath) > 0 {
+			parentPivot = nodePivots[nodePath[len(nodePath)-1]]
+		}
+		if animatedObjects[obj.UID] && obj.InternalTransform != nil {
+			pivot = *obj.InternalTransform.ApplyTo(&geom.Vector3{})
+			if node.Mesh != nil || node.Camera != nil || node.Extensions != nil || node.MatrixOrDefault() != gltf.DefaultMatrix {
+				// Move the contents to the child node to keep the pivot of the animation.
+				content := *node
+				setNodeOrigin(&content, &pivot, m.Scale)
+				m.Nodes = append(m.Nodes, &content)
+				node = &gltf.Node{Name: obj.Name, Children: []uint32{uint32(len(m.Nodes) - 1)}}
+			}
+			base := pivot.Sub(&parentPivot)
+			node.Translation = [3]float32{base.X * m.Scale, base.Y * m.Scale, base.Z * m.Scale}
+			objectTargets[obj.UID] = &motionTarget{node: uint32(i), base: *base}
+		} else {
+			setNodeOrigin(node, &parentPivot, m.Scale)
+		}
+		nodePivots[node] = pivot
+		m.Nodes[i] = node
+		if lodNodes[obj] || lodMembers[obj] {
+			// referenced by MSFT_lod or the LOD group
+		} else if !m.IgnoreObjectHierarchy && len(nodePath) > 0 {
 			parent := nodePath[len(nodePath)-1]
 			parent.Children = append(parent.Children, uint32(i))
 		} else {
@@ -892,12 +1349,48 @@ func (m *mqoToGltf) Convert(doc *mqo.Document, textureDir string) (*gltf.Documen
 			physics := mqo.GetPhysicsPlugin(doc)
 			for _, b := range physics.Bodies {
 				if b.TargetObjID != 0 && b.TargetObjID == obj.UID {
-					addPhysicsBody(node, b, m.Scale, geom.NewVector3(0, 0, 0))
+					addPhysicsBody(node, b, m.Scale, &pivot)
 				}
 			}
 		}
 	}
 
+	for i, obj := range targetObjects {
+		if members, ok := obj.Extra["lodMembers"].([]*mqo.Object); ok {
+			for _, member := range members {
+				if n, ok := objectIndex[member]; ok {
+					m.Nodes[i].Children = append(m.Nodes[i].Children, n)
+				}
+			}
+		}
+	}
+
+	for i, obj := range targetObjects {
+		lods, ok := obj.Extra["lods"].([]*mqo.Object)
+		if !ok || lodNodes[obj] || !obj.Visible {
+			continue
+		}
+		coverage, _ := obj.Extra["lodScreenCoverage"].([]float32)
+		var ids []uint32
+		for _, lod := range lods {
+			if n, ok := objectIndex[lod]; ok {
+				ids = append(ids, n)
+			}
+		}
+		if len(ids) == 0 || len(ids) != len(lods) {
+			continue
+		}
+		node := m.Nodes[i]
+		if node.Extensions == nil {
+			node.Extensions = gltf.Extensions{}
+		}
+		node.Extensions["MSFT_lod"] = map[string]interface{}{"ids": ids}
+		if len(coverage) == len(ids)+1 {
+			node.Extras = map[string]interface{}{"MSFT_screencoverage": coverage}
+		}
+		m.extensions["MSFT_lod"] = true
+	}
+
 	if len(lights) > 0 {
 		m.extensions["KHR_lights_punctual"] = true
 		if m.Document.Extensions == nil {
@@ -906,20 +1399,64 @@ func (m *mqoToGltf) Convert(doc *mqo.Document, textureDir string) (*gltf.Documen
 		m.Document.Extensions["KHR_lights_punctual"] = map[string]interface{}{"lights": lights}
 	}
 
-	textures := &textureCache{srcDir: textureDir, textures: map[string]*textureInfo{}}
+	textures := newTextureCache(textureDir, m.TextureMemoryBudget/4)
+	m.textureJobs = newTexturePool(m.TextureConcurrency, m.TextureMemoryBudget, m.TextureWebP)
+	var mtoonProps []*vrm.MaterialProperty
+	hasMToon := false
 	for i, mat := range doc.Materials {
 		if _, ok := materialMap[i]; !ok {
 			continue
 		}
-		mm := m.convertMaterial(mat, textures, uvBounds[i])
+		mm := m.convertMaterial(mat, textures, uvs[i])
+		if m.ExportMToon {
+			mp := m.convertMToon(mat, mm, textures, targetObjects, i)
+			if mp == nil {
+				mp = vrm.NewMaterialProperty(mat.Name)
+				mp.Shader = "VRM_USE_GLTFSHADER"
+			} else {
+				hasMToon = true
+			}
+			mtoonProps = append(mtoonProps, mp)
+		}
 		m.Document.Materials = append(m.Document.Materials, mm)
 	}
+	if hasMToon {
+		// VRM extension with the material properties. Other fields are filled by ApplyConfig().
+		ext := vrm.NewVRM()
+		ext.MaterialProperties = mtoonProps
+		if m.Document.Extensions == nil {
+			m.Document.Extensions = gltf.Extensions{}
+		}
+		m.Document.Extensions[vrm.ExtensionName] = ext
+		m.extensions[vrm.ExtensionName] = true
+	}
+	if err := m.textureJobs.flush(m); err != nil {
+		return nil, err
+	}
+	if m.TextureKTX2 != "" {
+		if err := m.addKTX2Textures(m.TextureKTX2); err != nil {
+			return nil, fmt.Errorf("KTX2 encode error: %w", err)
+		}
+	}
 	if m.ConvertPhysics {
 		m.extensions[BlenderPhysicsName] = true
 	}
+	if kp := mqo.FindKeyframerPlugin(doc); kp != nil && len(kp.Motions) > 0 {
+		for _, motion := range kp.Motions {
+			addMotionToGltf(m.Document, motion, m.JointNodeToBone, objectTargets, m.Scale)
+		}
+	} else if m.convertBone && m.ExportPoseAnimation {
+		if pose := mqo.GetBonePlugin(doc).PoseMotion("Pose"); pose != nil {
+			AddMotionToGltf(m.Document, pose, m.JointNodeToBone, m.Scale)
+		}
+	}
 	for ext := range m.extensions {
 		m.ExtensionsUsed = append(m.ExtensionsUsed, ext)
 	}
+	if m.extensions[webpExtension] {
+		// WebP textures have no fallback images.
+		m.ExtensionsRequired = append(m.ExtensionsRequired, webpExtension)
+	}
 
 	if len(m.Document.Textures) > 0 {
 		m.Document.Samplers = []*gltf.Sampler{{}}
@@ -928,6 +1465,20 @@ func (m *mqoToGltf) Convert(doc *mqo.Document, textureDir string) (*gltf.Documen
 	return m.Document, nil
 }
 
+// setNodeOrigin moves the node so that the world origin of the contents is at the origin.
+func setNodeOrigin(node *gltf.Node, origin *geom.Vector3, scale float32) {
+	if *origin == (geom.Vector3{}) {
+		return
+	}
+	if node.MatrixOrDefault() == gltf.DefaultMatrix {
+		node.Translation = [3]float32{-origin.X * scale, -origin.Y * scale, -origin.Z * scale}
+		return
+	}
+	node.Matrix[12] -= origin.X * scale
+	node.Matrix[13] -= origin.Y * scale
+	node.Matrix[14] -= origin.Z * scale
+}
+
 func addPhysicsBody(node *gltf.Node, body *mqo.PhysicsBody, scale float32, nodePos *geom.Vector3) {
 	var shapes []map[string]interface{}
 
@@ -0,0 +1,144 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/binzume/modelconv/geom"
+	"github.com/binzume/modelconv/mqo"
+	"github.com/qmuntal/gltf"
+	"github.com/qmuntal/gltf/modeler"
+)
+
+func TestConvertMaterialUnlit(t *testing.T) {
+	gltfShader := func(params map[string]interface{}) *mqo.MaterialEx2 {
+		return &mqo.MaterialEx2{ShaderType: "hlsl", ShaderName: "glTF", ShaderParams: params}
+	}
+	tests := []struct {
+		name  string
+		ex2   *mqo.MaterialEx2
+		unlit bool
+	}{
+		// Classifications before Extensions.Unlit was honored.
+		{"phong", nil, false},
+		{"constant", &mqo.MaterialEx2{ShaderName: "Constant"}, true},
+		{"gltf lit", gltfShader(map[string]interface{}{"Metallic": 0.5, "Roughness": 0.5}), false},
+		{"gltf rough dielectric", gltfShader(map[string]interface{}{"Metallic": 0.0, "Roughness": 1.0}), true},
+		{"gltf unlit", gltfShader(map[string]interface{}{"Metallic": 0.5, "Roughness": 0.5, "Extensions.Unlit": true}), true},
+		// Explicit Extensions.Unlit=false overrides the heuristic.
+		{"gltf explicit lit", gltfShader(map[string]interface{}{"Metallic": 0.0, "Roughness": 1.0, "Extensions.Unlit": false}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mqoToGltf{MQOToGLTFOption: &MQOToGLTFOption{}, extensions: map[string]bool{}}
+			mat := &mqo.Material{Name: tt.name, Color: geom.Vector4{X: 1, Y: 1, Z: 1, W: 1}, Ex2: tt.ex2}
+			mm := m.convertMaterial(mat, newTextureCache(t.TempDir(), 0), nil)
+			_, unlit := mm.Extensions["KHR_materials_unlit"]
+			if unlit != tt.unlit {
+				t.Errorf("unlit: %v, expected: %v", unlit, tt.unlit)
+			}
+		})
+	}
+}
+
+func TestConvertPoseAnimation(t *testing.T) {
+	newDoc := func() *mqo.Document {
+		doc := newTestBakeDocument(&mqo.Material{Name: "mat", Color: mqo.Vector4{X: 1, Y: 1, Z: 1, W: 1}})
+		doc.Objects[0].UID = 1
+		bp := mqo.GetBonePlugin(doc)
+		bone := &mqo.Bone{ID: 1, Name: "root"}
+		bp.SetBones([]*mqo.Bone{bone})
+		for i := range doc.Objects[0].Vertexes {
+			bone.SetVertexWeight(1, i+1, 1)
+		}
+		bp.PoseSet.BonePoses = []*mqo.BonePose{{ID: 1, RotH: 30}}
+		return doc
+	}
+
+	gltfdoc, err := NewMQOToGLTFConverter(nil).Convert(newDoc(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gltfdoc.Animations) != 0 {
+		t.Error("pose is exported without the option: ", len(gltfdoc.Animations))
+	}
+
+	gltfdoc, err = NewMQOToGLTFConverter(&MQOToGLTFOption{ExportPoseAnimation: true}).Convert(newDoc(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gltfdoc.Animations) != 1 || gltfdoc.Animations[0].Name != "Pose" {
+		t.Error("pose animation: ", gltfdoc.Animations)
+	}
+}
+
+func TestConvertObjectAnimation(t *testing.T) {
+	doc := newTestBakeDocument(&mqo.Material{Name: "mat", Color: mqo.Vector4{X: 1, Y: 1, Z: 1, W: 1}})
+	prop := doc.Objects[0]
+	prop.UID = 1
+	prop.InternalTransform = geom.NewTranslateMatrix4(10, 0, 0)
+	child := prop.Clone()
+	child.Name = "child"
+	child.UID = 2
+	child.Depth = 1
+	child.InternalTransform = nil
+	doc.Objects = append(doc.Objects, child)
+	kp := mqo.GetKeyframerPlugin(doc)
+	kp.Motions = append(kp.Motions, &mqo.Motion{Name: "Move", Objects: []*mqo.ObjectMotion{
+		{ObjectID: 1, BoneMotion: mqo.BoneMotion{Name: "obj", Keys: []*mqo.BoneKeyframe{{Frame: 0}, {Frame: 30, MvY: 5}}}},
+	}})
+
+	gltfdoc, err := NewMQOToGLTFConverter(&MQOToGLTFOption{Scale: 1}).Convert(doc, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pivot := gltfdoc.Nodes[0]
+	if pivot.Mesh != nil || pivot.Translation != [3]float32{10, 0, 0} || len(pivot.Children) != 2 {
+		t.Fatal("invalid pivot node: ", pivot)
+	}
+	// The mesh of the animated object is moved to the child node.
+	for _, n := range pivot.Children {
+		if node := gltfdoc.Nodes[n]; node.Mesh == nil || node.Translation != [3]float32{-10, 0, 0} {
+			t.Error("invalid child node: ", node.Name, node.Translation)
+		}
+	}
+	if len(gltfdoc.Animations) != 1 || len(gltfdoc.Animations[0].Channels) != 1 || len(gltfdoc.Skins) != 0 {
+		t.Fatal("invalid animation")
+	}
+	ch := gltfdoc.Animations[0].Channels[0]
+	if *ch.Target.Node != 0 || ch.Target.Path != gltf.TRSTranslation {
+		t.Fatal("invalid channel: ", ch.Target)
+	}
+	values, err := modeler.ReadAccessor(gltfdoc, gltfdoc.Accessors[*gltfdoc.Animations[0].Samplers[0].Output], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := values.([][3]float32); len(v) != 2 || v[0] != [3]float32{10, 0, 0} || v[1] != [3]float32{10, 5, 0} {
+		t.Error("invalid translations: ", v)
+	}
+}
+
+func TestConvertObjectMirroredTangents(t *testing.T) {
+	doc := mqo.NewDocument()
+	doc.Materials = []*mqo.Material{{Name: "mat", Color: mqo.Vector4{X: 1, Y: 1, Z: 1, W: 1}, BumpTexture: "bump.png"}}
+	obj := mqo.NewObject("obj")
+	obj.Vertexes = []*mqo.Vector3{{X: 0, Y: 1}, {X: 1, Y: 1}, {X: 2, Y: 1}, {X: 0, Y: 0}, {X: 1, Y: 0}, {X: 2, Y: 0}}
+	// The right half is mirrored at x=1.
+	obj.Faces = []*mqo.Face{
+		{Verts: []int{0, 1, 4, 3}, UVs: []mqo.Vector2{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}, {X: 0, Y: 1}}},
+		{Verts: []int{1, 2, 5, 4}, UVs: []mqo.Vector2{{X: 1, Y: 0}, {X: 0, Y: 0}, {X: 0, Y: 1}, {X: 1, Y: 1}}},
+	}
+	doc.Objects = append(doc.Objects, obj)
+
+	gltfdoc, err := NewMQOToGLTFConverter(nil).Convert(doc, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs := gltfdoc.Meshes[0].Primitives[0].Attributes
+	tangent, ok := attrs["TANGENT"]
+	if !ok {
+		t.Fatal("no tangents")
+	}
+	if n := gltfdoc.Accessors[attrs["POSITION"]].Count; n != 8 || gltfdoc.Accessors[tangent].Count != n || gltfdoc.Accessors[attrs["TEXCOORD_0"]].Count != n {
+		t.Error("vertices on the mirror line are not split: ", n, gltfdoc.Accessors[tangent].Count)
+	}
+}
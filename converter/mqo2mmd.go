@@ -2,20 +2,39 @@ package converter
 
 import (
 	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/binzume/modelconv/mmd"
 	"github.com/binzume/modelconv/mqo"
 )
 
+type MQOToMMDOption struct {
+	TextureDir string
+	OutputDir  string // Merged alpha textures are saved to this dir. Default: TextureDir
+}
+
 type mqoToMMD struct {
+	*MQOToMMDOption
 	Scale float32
 }
 
-func NewMQOToMMDConverter(options interface{}) *mqoToMMD {
-	return &mqoToMMD{Scale: 1.0 / 80}
+func NewMQOToMMDConverter(options *MQOToMMDOption) *mqoToMMD {
+	if options == nil {
+		options = &MQOToMMDOption{}
+	}
+	if options.OutputDir == "" {
+		options.OutputDir = options.TextureDir
+	}
+	return &mqoToMMD{MQOToMMDOption: options, Scale: 1.0 / 80}
 }
 
 func (c *mqoToMMD) Convert(doc *mqo.Document) (*mmd.Document, error) {
+	doc.ApplyMirrorAndPatch()
 	dst := mmd.NewDocument()
 	bones := mqo.GetBonePlugin(doc).Bones()
 	boneIndexByID := map[int]int{}
@@ -53,6 +72,16 @@ func (c *mqoToMMD) Convert(doc *mqo.Document) (*mmd.Document, error) {
 	}
 
 	doc.FixObjectID()
+	useVertexColor := false
+	for _, obj := range doc.Objects {
+		if obj.Visible && obj.VertexColors != nil && morphTargets[obj.Name] == nil {
+			useVertexColor = true
+		}
+	}
+	if useVertexColor {
+		dst.Header.Info[mmd.AttrExtUV] = 1 // vertex color as additional UV1
+	}
+	inputTextures := c.inputTextures(doc)
 	for mi, m := range doc.Materials {
 		faceCount := 0
 		for _, obj := range doc.Objects {
@@ -66,6 +95,7 @@ func (c *mqoToMMD) Convert(doc *mqo.Document) (*mmd.Document, error) {
 			indicesMap := map[vertexKey]int{}
 			vmap := map[int][]int{}
 			normals := obj.GetSmoothNormals()
+			edgeScales, _ := obj.Extra["edgeScale"].([]float32)
 
 			for _, f := range obj.Faces {
 				if len(f.Verts) < 3 || f.Material != mi {
@@ -90,6 +120,16 @@ func (c *mqoToMMD) Convert(doc *mqo.Document) (*mmd.Document, error) {
 							Normal:    mmd.Vector3{X: normals[v].X, Y: normals[v].Y, Z: normals[v].Z},
 							EdgeScale: 1,
 						}
+						if v < len(edgeScales) {
+							vert.EdgeScale = edgeScales[v]
+						}
+						if useVertexColor {
+							col := mqo.Vector4{X: 1, Y: 1, Z: 1, W: 1}
+							if v < len(obj.VertexColors) {
+								col = obj.VertexColors[v]
+							}
+							vert.ExtUVs = []mmd.Vector4{{X: col.X, Y: col.Y, Z: col.Z, W: col.W}}
+						}
 						dst.Vertexes = append(dst.Vertexes, vert)
 						if morphBases[obj.Name] != nil {
 							for _, t := range morphBases[obj.Name].Target {
@@ -115,11 +155,20 @@ func (c *mqoToMMD) Convert(doc *mqo.Document) (*mmd.Document, error) {
 			c.setWeights(dst, obj, vmap, bones)
 		}
 		texture := -1
-		if m.Texture != "" {
+		textureName := m.Texture
+		if m.AlphaTexture != "" && c.OutputDir != "" {
+			// PMX has no alpha texture slot.
+			if name, err := c.saveAlphaMergedTexture(m, inputTextures); err == nil {
+				textureName = name
+			} else {
+				log.Print("Texture read error:", m.AlphaTexture, err)
+			}
+		}
+		if textureName != "" {
 			texture = len(dst.Textures)
-			dst.Textures = append(dst.Textures, m.Texture)
+			dst.Textures = append(dst.Textures, textureName)
 		}
-		dst.Materials = append(dst.Materials, c.convertMaterial(m, faceCount, texture))
+		dst.Materials = append(dst.Materials, c.convertMaterial(dst, m, faceCount, texture))
 	}
 
 	// Physics
@@ -162,15 +211,123 @@ func (c *mqoToMMD) convertBone(bone *mqo.Bone) *mmd.Bone {
 	}
 }
 
-func (c *mqoToMMD) convertMaterial(m *mqo.Material, faceCount, texture int) *mmd.Material {
-	return &mmd.Material{
+func (c *mqoToMMD) textureIndex(dst *mmd.Document, name string) int {
+	for i, t := range dst.Textures {
+		if t == name {
+			return i
+		}
+	}
+	dst.Textures = append(dst.Textures, name)
+	return len(dst.Textures) - 1
+}
+
+// texturePath returns the cleaned absolute path of the texture.
+func (c *mqoToMMD) texturePath(name string) string {
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(c.TextureDir, name)
+	}
+	if abs, err := filepath.Abs(name); err == nil {
+		return abs
+	}
+	return filepath.Clean(name)
+}
+
+// inputTextures returns the paths of all textures used by the document.
+func (c *mqoToMMD) inputTextures(doc *mqo.Document) map[string]bool {
+	textures := map[string]bool{}
+	add := func(name string) {
+		if name != "" {
+			textures[c.texturePath(name)] = true
+		}
+	}
+	for _, m := range doc.Materials {
+		add(m.Texture)
+		add(m.AlphaTexture)
+		add(m.BumpTexture)
+		if m.Ex2 != nil {
+			for _, t := range m.Ex2.ShaderMapping {
+				add(t)
+			}
+		}
+	}
+	return textures
+}
+
+// saveAlphaMergedTexture saves the texture with the alpha texture to OutputDir and returns the file name.
+// Textures used by the document are never overwritten.
+func (c *mqoToMMD) saveAlphaMergedTexture(m *mqo.Material, inputTextures map[string]bool) (string, error) {
+	load := func(name string) (image.Image, error) {
+		name = c.texturePath(name)
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return decodeImage(f, name)
+	}
+	alpha, err := load(m.AlphaTexture)
+	if err != nil {
+		return "", err
+	}
+	var base image.Image
+	if m.Texture != "" {
+		if base, err = load(m.Texture); err != nil {
+			return "", err
+		}
+	}
+	name := alphaMergedTextureName(m.Texture, m.AlphaTexture)
+	for n := 2; inputTextures[c.outputPath(name)]; n++ {
+		name = fmt.Sprintf("%s_%d.png", strings.TrimSuffix(alphaMergedTextureName(m.Texture, m.AlphaTexture), ".png"), n)
+	}
+	f, err := os.Create(c.outputPath(name))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return name, png.Encode(f, mergeAlphaTexture(base, alpha))
+}
+
+func (c *mqoToMMD) outputPath(name string) string {
+	p := filepath.Join(c.OutputDir, name)
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
+
+func (c *mqoToMMD) convertMaterial(dst *mmd.Document, m *mqo.Material, faceCount, texture int) *mmd.Material {
+	mat := &mmd.Material{
 		Name:        m.Name,
 		Color:       mmd.Vector4{X: m.Color.X, Y: m.Color.Y, Z: m.Color.Z, W: m.Color.W},
 		Specularity: m.Power,
 		TextureID:   texture,
+		EnvID:       -1,
 		Toon:        -1,
 		Count:       faceCount * 3,
 	}
+	if m.DoubleSided {
+		mat.Flags |= mmd.MaterialFlagDoubleSided
+	}
+	if m.Ex2 != nil && m.Ex2.ShaderName == "pmd" {
+		if m.Ex2.BoolParam("Edge") {
+			mat.Flags |= mmd.MaterialFlagDrawEdge
+		}
+		mat.EdgeScale = float32(m.Ex2.FloatParam("EdgeSize"))
+		if ec := m.Ex2.ColorParam("EdgeColor"); ec != nil {
+			mat.EdgeColor = mmd.Vector4{X: ec[0], Y: ec[1], Z: ec[2], W: ec[3]}
+		}
+		if toon, ok := sharedToon(m.Ex2); ok {
+			mat.ToonType = 1
+			mat.Toon = toon
+		} else if toon := m.Ex2.Mapping("Toon"); toon != "" {
+			mat.Toon = c.textureIndex(dst, toon)
+		}
+		if sphere := m.Ex2.Mapping("Sphere"); sphere != "" {
+			mat.EnvID = c.textureIndex(dst, sphere)
+			mat.EnvMode = byte(m.Ex2.IntParam("SphereMode"))
+		}
+	}
+	return mat
 }
 
 func (c *mqoToMMD) convertBody(b *mqo.PhysicsBody, boneIndexByID map[int]int) []*mmd.RigidBody {
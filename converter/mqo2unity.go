@@ -0,0 +1,670 @@
+package converter
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/binzume/modelconv/geom"
+	"github.com/binzume/modelconv/mqo"
+	"github.com/binzume/modelconv/unity"
+)
+
+type MQOToUnityOption struct {
+	Scale          float32 // Default: 0.001
+	URP            bool    // Use Universal Render Pipeline shaders
+	ConvertPhysics bool
+}
+
+type mqoToUnity struct {
+	*MQOToUnityOption
+}
+
+type mqoToUnityState struct {
+	*MQOToUnityOption
+	w          unity.AssetsWriter
+	dir        string
+	textureDir string
+
+	lastFileID int64
+	docs       []*unity.YAMLDoc
+	elements   []unity.Element
+	fileIDs    map[unity.Element]int64
+
+	textures   map[string]*unity.Ref
+	materials  map[int]*unity.Ref
+	assetPaths map[string]bool
+	guidSeed   string
+}
+
+// unityNode is a GameObject in the prefab.
+type unityNode struct {
+	obj       *unity.GameObject
+	transform *unity.Transform
+	position  geom.Vector3 // world position
+}
+
+func NewMQOToUnityConverter(options *MQOToUnityOption) *mqoToUnity {
+	if options == nil {
+		options = &MQOToUnityOption{}
+	}
+	if options.Scale == 0 {
+		options.Scale = 0.001
+	}
+	return &mqoToUnity{MQOToUnityOption: options}
+}
+
+// Convert writes the document as a prefab with meshes, materials and textures to Assets/name/.
+func (conv *mqoToUnity) Convert(doc *mqo.Document, textureDir, name string, w unity.AssetsWriter) error {
+	c := &mqoToUnityState{
+		MQOToUnityOption: conv.MQOToUnityOption,
+		w:                w,
+		dir:              "Assets/" + name,
+		textureDir:       textureDir,
+		fileIDs:          map[unity.Element]int64{},
+		textures:         map[string]*unity.Ref{},
+		materials:        map[int]*unity.Ref{},
+		assetPaths:       map[string]bool{},
+	}
+	// Assets at the same paths of the other exports must not have the same GUIDs.
+	seed := make([]byte, 16)
+	if _, err := rand.Read(seed); err != nil {
+		return err
+	}
+	c.guidSeed = hex.EncodeToString(seed)
+
+	doc.ApplyMirrorAndPatch()
+	doc.FixObjectID()
+	doc.FixNames()
+
+	objectByName := map[string]*mqo.Object{}
+	for _, obj := range doc.Objects {
+		objectByName[obj.Name] = obj
+	}
+	morphTargets := map[*mqo.Object][]*mqo.Object{}
+	morphObjects := map[*mqo.Object]bool{}
+	for _, m := range mqo.GetMorphPlugin(doc).Morphs() {
+		base := objectByName[m.Base]
+		for _, t := range m.Target {
+			if target := objectByName[t.Name]; base != nil && target != nil && len(target.Vertexes) == len(base.Vertexes) {
+				morphTargets[base] = append(morphTargets[base], target)
+				morphObjects[target] = true
+			}
+		}
+	}
+
+	root := c.addNode(name, nil, &geom.Vector3{})
+
+	bones := mqo.GetBonePlugin(doc).Bones()
+	boneNodes := c.addBoneNodes(bones, root)
+	var boneRefs []*unity.Ref
+	var bindPoses []*geom.Matrix4
+	var boneNames []string
+	for _, b := range bones {
+		n := boneNodes[b.ID]
+		boneRefs = append(boneRefs, c.ref(n.transform))
+		bindPoses = append(bindPoses, geom.NewTranslateMatrix4(-n.position.X, -n.position.Y, -n.position.Z))
+		boneNames = append(boneNames, b.Name)
+	}
+
+	objectNodes := map[int]*unityNode{}
+	parents := []*unityNode{root}
+	depths := []int{-1}
+	for _, obj := range doc.Objects {
+		if morphObjects[obj] || strings.HasPrefix(obj.Name, "$MORPH:") {
+			continue
+		}
+		for len(depths) > 1 && depths[len(depths)-1] >= obj.Depth {
+			parents, depths = parents[:len(parents)-1], depths[:len(depths)-1]
+		}
+		node := c.addNode(obj.Name, parents[len(parents)-1], &geom.Vector3{})
+		if !obj.Visible {
+			node.obj.IsActive = 0
+		}
+		objectNodes[obj.UID] = node
+		parents, depths = append(parents, node), append(depths, obj.Depth)
+
+		mesh, materials, skinned, err := c.convertMesh(doc, obj, bones, morphTargets[obj])
+		if err != nil {
+			return err
+		}
+		if mesh == nil {
+			continue
+		}
+		var materialRefs []*unity.Ref
+		for _, mat := range materials {
+			ref, err := c.convertMaterial(doc, mat)
+			if err != nil {
+				return err
+			}
+			materialRefs = append(materialRefs, ref)
+		}
+		if skinned {
+			mesh.SetBones(bindPoses, boneNames, name)
+		}
+		meshRef, err := c.writeMesh(mesh)
+		if err != nil {
+			return err
+		}
+		if skinned {
+			aabb := mesh.LocalAABB
+			c.addComponent(node, &unity.SkinnedMeshRenderer{
+				Enabled:        1,
+				CastShadows:    1,
+				ReceiveShadows: 1,
+				Materials:      materialRefs,
+				Mesh:           meshRef,
+				Bones:          boneRefs,
+				RootBone:       c.ref(root.transform),
+				AABB:           &aabb,
+			})
+		} else {
+			c.addComponent(node, &unity.MeshFilter{Mesh: meshRef})
+			c.addComponent(node, &unity.MeshRenderer{
+				Enabled:              1,
+				CastShadows:          1,
+				ReceiveShadows:       1,
+				DynamicOccludee:      1,
+				MotionVectors:        1,
+				LightProbeUsage:      1,
+				ReflectionProbeUsage: 1,
+				Materials:            materialRefs,
+			})
+		}
+	}
+
+	if c.ConvertPhysics {
+		c.convertPhysics(mqo.GetPhysicsPlugin(doc), root, boneNodes, objectNodes)
+	}
+
+	for _, e := range c.elements {
+		d, err := unity.NewYAMLDoc(c.fileIDs[e], e)
+		if err != nil {
+			return err
+		}
+		c.docs = append(c.docs, d)
+	}
+	var b bytes.Buffer
+	if err := unity.WriteYamlDocuments(&b, c.docs); err != nil {
+		return err
+	}
+	prefabPath := c.dir + "/" + name + ".prefab"
+	return c.w.WriteAsset(prefabPath, unity.NewMetaFile(c.guid(prefabPath), "PrefabImporter", nil), b.Bytes())
+}
+
+// assetPath returns an unused asset path in the dir. Names are suffixed with a number if they are conflicted after sanitizing.
+func (c *mqoToUnityState) assetPath(dir, name, ext string) string {
+	name = safeFileName(name)
+	assetPath := c.dir + "/" + dir + "/" + name + ext
+	for n := 2; c.assetPaths[strings.ToLower(assetPath)]; n++ {
+		// Unity projects can be on case-insensitive file systems.
+		assetPath = fmt.Sprintf("%s/%s/%s_%d%s", c.dir, dir, name, n, ext)
+	}
+	c.assetPaths[strings.ToLower(assetPath)] = true
+	return assetPath
+}
+
+// guid returns the GUID of the asset. It is stable only within the export.
+func (c *mqoToUnityState) guid(assetPath string) string {
+	return unity.NewGUID(c.guidSeed + assetPath)
+}
+
+func (c *mqoToUnityState) ref(e unity.Element) *unity.Ref {
+	return &unity.Ref{FileID: c.fileIDs[e]}
+}
+
+func (c *mqoToUnityState) addElement(e unity.Element) int64 {
+	c.lastFileID++
+	c.fileIDs[e] = c.lastFileID
+	c.elements = append(c.elements, e)
+	return c.lastFileID
+}
+
+// toUnity converts the position in the document to the Unity coordinate system. (left-handed)
+func (c *mqoToUnityState) toUnity(v *geom.Vector3) *geom.Vector3 {
+	return &geom.Vector3{X: v.X * c.Scale, Y: v.Y * c.Scale, Z: -v.Z * c.Scale}
+}
+
+func (c *mqoToUnityState) addNode(name string, parent *unityNode, position *geom.Vector3) *unityNode {
+	obj := &unity.GameObject{Name: name, IsActive: 1}
+	tr := &unity.Transform{
+		LocalRotation: geom.Vector4{W: 1},
+		LocalPosition: *position,
+		LocalScale:    geom.Vector3{X: 1, Y: 1, Z: 1},
+		Children:      []*unity.Ref{},
+	}
+	c.addElement(obj)
+	node := &unityNode{obj: obj, transform: tr, position: *position}
+	c.addComponent(node, tr)
+	if parent != nil {
+		tr.Father = *c.ref(parent.transform)
+		tr.RootOrder = len(parent.transform.Children)
+		parent.transform.Children = append(parent.transform.Children, c.ref(tr))
+		node.position = *parent.position.Add(position)
+	}
+	return node
+}
+
+func (c *mqoToUnityState) addComponent(node *unityNode, component unity.Component) {
+	id := c.addElement(component)
+	switch co := component.(type) {
+	case *unity.Transform:
+		co.GameObject = *c.ref(node.obj)
+	case *unity.MeshFilter:
+		co.GameObject = *c.ref(node.obj)
+	case *unity.MeshRenderer:
+		co.GameObject = *c.ref(node.obj)
+	case *unity.SkinnedMeshRenderer:
+		co.GameObject = *c.ref(node.obj)
+	case *unity.Rigidbody:
+		co.GameObject = *c.ref(node.obj)
+	case *unity.BoxCollider:
+		co.GameObject = *c.ref(node.obj)
+	case *unity.SphereCollider:
+		co.GameObject = *c.ref(node.obj)
+	case *unity.CapsuleCollider:
+		co.GameObject = *c.ref(node.obj)
+	}
+	node.obj.Components = append(node.obj.Components, &unity.ComponentRef{Ref: unity.Ref{FileID: id}})
+}
+
+func (c *mqoToUnityState) addBoneNodes(bones []*mqo.Bone, root *unityNode) map[int]*unityNode {
+	boneByID := map[int]*mqo.Bone{}
+	for _, b := range bones {
+		boneByID[b.ID] = b
+	}
+	nodes := map[int]*unityNode{}
+	var addBone func(b *mqo.Bone) *unityNode
+	addBone = func(b *mqo.Bone) *unityNode {
+		if n, ok := nodes[b.ID]; ok {
+			return n
+		}
+		parent := root
+		if p, ok := boneByID[b.Parent]; ok && b.Parent != b.ID {
+			parent = addBone(p)
+		}
+		pos := c.toUnity(&b.Pos.Vector3)
+		nodes[b.ID] = c.addNode(b.Name, parent, pos.Sub(&parent.position))
+		return nodes[b.ID]
+	}
+	for _, b := range bones {
+		addBone(b)
+	}
+	return nodes
+}
+
+// convertMesh returns the mesh and the materials of the sub meshes.
+func (c *mqoToUnityState) convertMesh(doc *mqo.Document, obj *mqo.Object, bones []*mqo.Bone, morphTargets []*mqo.Object) (*unity.Mesh, []int, bool, error) {
+	obj.FixhNormals()
+	obj.Triangulate()
+
+	type vertexKey struct {
+		index  int
+		uv     geom.Vector2
+		normal geom.Vector3
+	}
+	vertexMap := map[vertexKey]int{}
+	var srcIndices []int
+	var positions, normals, uvs, colors [][]float32
+	subMeshes := map[int][]int{}
+	var materials []int
+	for _, f := range obj.Faces {
+		if len(f.Verts) != 3 || f.Material < 0 || f.Material >= len(doc.Materials) || strings.HasSuffix(doc.Materials[f.Material].Name, "$IGNORE") {
+			continue
+		}
+		var tri [3]int
+		for i, v := range f.Verts {
+			key := vertexKey{index: v}
+			if len(f.UVs) == len(f.Verts) {
+				key.uv = f.UVs[i]
+			}
+			if len(f.Normals) == len(f.Verts) && f.Normals[i] != nil {
+				key.normal = *f.Normals[i]
+			}
+			index, ok := vertexMap[key]
+			if !ok {
+				index = len(positions)
+				vertexMap[key] = index
+				srcIndices = append(srcIndices, v)
+				p := c.toUnity(obj.Vertexes[v])
+				positions = append(positions, []float32{p.X, p.Y, p.Z})
+				normals = append(normals, []float32{key.normal.X, key.normal.Y, -key.normal.Z})
+				uvs = append(uvs, []float32{key.uv.X, 1 - key.uv.Y})
+				if len(obj.VertexColors) == len(obj.Vertexes) {
+					col := obj.VertexColors[v]
+					colors = append(colors, []float32{col.X, col.Y, col.Z, col.W})
+				}
+			}
+			tri[i] = index
+		}
+		if _, ok := subMeshes[f.Material]; !ok {
+			materials = append(materials, f.Material)
+		}
+		// Unity: left-handed
+		subMeshes[f.Material] = append(subMeshes[f.Material], tri[2], tri[1], tri[0])
+	}
+	if len(materials) == 0 {
+		return nil, nil, false, nil
+	}
+
+	attributes := map[int][][]float32{
+		unity.VertexChannelPosition:  positions,
+		unity.VertexChannelNormal:    normals,
+		unity.VertexChannelTexCoord0: uvs,
+	}
+	if len(colors) > 0 {
+		attributes[unity.VertexChannelColor] = colors
+	}
+	joints, weights := c.getWeights(obj, bones, srcIndices)
+	if joints != nil {
+		attributes[unity.VertexChannelBlendWeight] = weights
+		attributes[unity.VertexChannelBlendIndex] = joints
+	}
+	var indices [][]int
+	for _, mat := range materials {
+		indices = append(indices, subMeshes[mat])
+	}
+	mesh := unity.NewMesh(obj.Name, attributes, indices)
+
+	for _, target := range morphTargets {
+		var shapeIndices []int
+		var deltas []*geom.Vector3
+		for i, src := range srcIndices {
+			d := c.toUnity(target.Vertexes[src].Sub(obj.Vertexes[src]))
+			if d.LenSqr() > 0 {
+				shapeIndices = append(shapeIndices, i)
+				deltas = append(deltas, d)
+			}
+		}
+		mesh.AddBlendShape(target.Name, shapeIndices, deltas)
+	}
+	return mesh, materials, joints != nil, nil
+}
+
+// getWeights returns up to 4 bone indices and normalized weights of the vertices.
+func (c *mqoToUnityState) getWeights(obj *mqo.Object, bones []*mqo.Bone, srcIndices []int) ([][]float32, [][]float32) {
+	type boneWeight struct {
+		bone   int
+		weight float32
+	}
+	vertexWeights := map[int][]boneWeight{}
+	for i, b := range bones {
+		for _, bw := range b.Weights {
+			if bw.ObjectID != obj.UID {
+				continue
+			}
+			for _, vw := range bw.Vertexes {
+				v := obj.GetVertexIndexByID(vw.VertexID)
+				if v >= 0 && vw.Weight > 0 {
+					vertexWeights[v] = append(vertexWeights[v], boneWeight{i, vw.Weight * 0.01})
+				}
+			}
+		}
+	}
+	if len(vertexWeights) == 0 {
+		return nil, nil
+	}
+	joints := make([][]float32, len(srcIndices))
+	weights := make([][]float32, len(srcIndices))
+	for i, src := range srcIndices {
+		w := vertexWeights[src]
+		sort.SliceStable(w, func(i, j int) bool { return w[i].weight > w[j].weight })
+		joints[i] = make([]float32, 4)
+		weights[i] = make([]float32, 4)
+		var sum float32
+		for j := 0; j < 4 && j < len(w); j++ {
+			sum += w[j].weight
+		}
+		for j := 0; j < 4 && j < len(w); j++ {
+			joints[i][j] = float32(w[j].bone)
+			weights[i][j] = w[j].weight / sum
+		}
+	}
+	return joints, weights
+}
+
+func (c *mqoToUnityState) writeMesh(mesh *unity.Mesh) (*unity.Ref, error) {
+	assetPath := c.assetPath("Meshes", mesh.Name, ".asset")
+	d, err := unity.NewYAMLDoc(unity.MeshFileID, mesh)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := unity.WriteYamlDocuments(&b, []*unity.YAMLDoc{d}); err != nil {
+		return nil, err
+	}
+	guid := c.guid(assetPath)
+	meta := unity.NewMetaFile(guid, "NativeFormatImporter", map[string]interface{}{"mainObjectFileID": unity.MeshFileID})
+	return &unity.Ref{FileID: unity.MeshFileID, GUID: guid, Type: 2}, c.w.WriteAsset(assetPath, meta, b.Bytes())
+}
+
+// convertMaterial writes the material as Standard or URP/Lit material.
+func (c *mqoToUnityState) convertMaterial(doc *mqo.Document, index int) (*unity.Ref, error) {
+	if ref, ok := c.materials[index]; ok {
+		return ref, nil
+	}
+	mat := doc.Materials[index]
+	m := &unity.Material{SerializedVersion: 6, Name: mat.Name, CustomRenderQueue: -1, StringTagMap: map[string]string{}}
+	m.SavedProperties.SerializedVersion = 3
+	var keywords []string
+	setFloat := func(name string, v float32) {
+		m.SavedProperties.Floats = append(m.SavedProperties.Floats, map[string]float32{name: v})
+	}
+	setColor := func(name string, col *unity.Color) {
+		m.SavedProperties.Colors = append(m.SavedProperties.Colors, map[string]*unity.Color{name: col})
+	}
+	setTexture := func(texture string, normalMap bool, names ...string) bool {
+		ref := c.convertTexture(texture, normalMap)
+		if ref == nil {
+			return false
+		}
+		for _, name := range names {
+			m.SavedProperties.TexEnvs = append(m.SavedProperties.TexEnvs, map[string]*unity.TextureEnv{
+				name: {Texture: ref, Scale: geom.Vector2{X: 1, Y: 1}},
+			})
+		}
+		return true
+	}
+
+	unlit := mat.GetShaderName() == "Constant"
+	metallic, roughness := geom.Clamp(mat.Specular, 0, 1), float32(0.4)
+	alphaMode := mqo.AlphaModeOpaque
+	var cutoff float32 = 0.5
+	if mat.GetShaderName() == mqo.ShaderNameGlTF {
+		metallic = float32(mat.Ex2.FloatParam("Metallic"))
+		roughness = float32(mat.Ex2.FloatParam("Roughness"))
+		unlit = unlit || mat.Ex2.BoolParam("Extensions.Unlit")
+		if mode := mat.Ex2.IntParam("AlphaMode"); mode != 0 {
+			alphaMode = mode
+		}
+		if _, ok := mat.Ex2.ShaderParams["AlphaCutOff"]; ok {
+			cutoff = float32(mat.Ex2.FloatParam("AlphaCutOff"))
+		}
+	} else if mat.Color.W < 0.99 {
+		alphaMode = mqo.AlphaModeBlend
+	}
+
+	col := &unity.Color{R: mat.Color.X, G: mat.Color.Y, B: mat.Color.Z, A: mat.Color.W}
+	setColor("_Color", col)
+	setColor("_BaseColor", col)
+	setTexture(mat.Texture, false, "_MainTex", "_BaseMap")
+	setFloat("_Cutoff", cutoff)
+
+	if c.URP {
+		if unlit {
+			m.Shader = unity.GetShaderRef("URP/Unlit")
+		} else {
+			m.Shader = unity.GetShaderRef("URP/Lit")
+		}
+		setFloat("_Cull", map[bool]float32{true: 0, false: 2}[mat.DoubleSided])
+		switch alphaMode {
+		case mqo.AlphaModeMask:
+			setFloat("_AlphaClip", 1)
+			keywords = append(keywords, "_ALPHATEST_ON")
+		case mqo.AlphaModeBlend:
+			setFloat("_Surface", 1)
+			keywords = append(keywords, "_SURFACE_TYPE_TRANSPARENT")
+		}
+	} else {
+		if unlit {
+			m.Shader = unity.GetShaderRef(map[int]string{
+				mqo.AlphaModeOpaque: "Unlit/Texture",
+				mqo.AlphaModeMask:   "Unlit/Transparent Cutout",
+				mqo.AlphaModeBlend:  "Unlit/Transparent"}[alphaMode])
+		} else {
+			m.Shader = unity.GetShaderRef("Standard")
+		}
+		switch alphaMode {
+		case mqo.AlphaModeMask:
+			setFloat("_Mode", 1)
+			keywords = append(keywords, "_ALPHATEST_ON")
+		case mqo.AlphaModeBlend:
+			setFloat("_Mode", 2) // Fade
+			keywords = append(keywords, "_ALPHABLEND_ON")
+		}
+	}
+	switch alphaMode {
+	case mqo.AlphaModeMask:
+		m.CustomRenderQueue = 2450
+		m.StringTagMap["RenderType"] = "TransparentCutout"
+	case mqo.AlphaModeBlend:
+		setFloat("_SrcBlend", 5) // SrcAlpha
+		setFloat("_DstBlend", 10)
+		setFloat("_ZWrite", 0)
+		m.CustomRenderQueue = 3000
+		m.StringTagMap["RenderType"] = "Transparent"
+	}
+
+	if !unlit {
+		setFloat("_Metallic", metallic)
+		setFloat("_Glossiness", 1-roughness)
+		setFloat("_Smoothness", 1-roughness)
+		if setTexture(mat.BumpTexture, true, "_BumpMap") {
+			keywords = append(keywords, "_NORMALMAP")
+		}
+		emission := mat.EmissionColor
+		if emission == nil && mat.Emission > 0 {
+			emission = &geom.Vector3{X: mat.Emission, Y: mat.Emission, Z: mat.Emission}
+		}
+		if mat.GetShaderName() == mqo.ShaderNameGlTF {
+			if setTexture(mat.Ex2.Mapping("Emissive"), false, "_EmissionMap") && emission == nil {
+				emission = &geom.Vector3{X: 1, Y: 1, Z: 1}
+			}
+			setTexture(mat.Ex2.Mapping("Occlusion"), false, "_OcclusionMap")
+		}
+		if emission != nil && emission.Len() > 0 {
+			setColor("_EmissionColor", &unity.Color{R: emission.X, G: emission.Y, B: emission.Z, A: 1})
+			keywords = append(keywords, "_EMISSION")
+		}
+	}
+	m.ShaderKeywords = strings.Join(keywords, " ")
+
+	d, err := unity.NewYAMLDoc(unity.MaterialFileID, m)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := unity.WriteYamlDocuments(&b, []*unity.YAMLDoc{d}); err != nil {
+		return nil, err
+	}
+	assetPath := c.assetPath("Materials", mat.Name, ".mat")
+	guid := c.guid(assetPath)
+	meta := unity.NewMetaFile(guid, "NativeFormatImporter", map[string]interface{}{"mainObjectFileID": unity.MaterialFileID})
+	if err := c.w.WriteAsset(assetPath, meta, b.Bytes()); err != nil {
+		return nil, err
+	}
+	ref := &unity.Ref{FileID: unity.MaterialFileID, GUID: guid, Type: 2}
+	c.materials[index] = ref
+	return ref, nil
+}
+
+// convertTexture copies the texture file. Returns nil if the texture is not found.
+func (c *mqoToUnityState) convertTexture(texture string, normalMap bool) *unity.Ref {
+	if texture == "" {
+		return nil
+	}
+	if ref, ok := c.textures[texture]; ok {
+		return ref
+	}
+	c.textures[texture] = nil
+	src := texture
+	if !filepath.IsAbs(src) {
+		src = filepath.Join(c.textureDir, texture)
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		log.Println("Texture read error:", texture, err)
+		return nil
+	}
+	name := path.Base(filepath.ToSlash(texture))
+	ext := path.Ext(name)
+	assetPath := c.assetPath("Textures", strings.TrimSuffix(name, ext), ext)
+	guid := c.guid(assetPath)
+	params := map[string]interface{}{}
+	if normalMap {
+		params["textureType"] = 1
+	} else {
+		params["alphaIsTransparency"] = 1
+	}
+	if err := c.w.WriteAsset(assetPath, unity.NewMetaFile(guid, "TextureImporter", params), data); err != nil {
+		log.Println("Texture write error:", texture, err)
+		return nil
+	}
+	ref := &unity.Ref{FileID: unity.TextureFileID, GUID: guid, Type: 3}
+	c.textures[texture] = ref
+	return ref
+}
+
+// convertPhysics adds colliders to the bones or objects. Rigidbodies are added to the objects only.
+func (c *mqoToUnityState) convertPhysics(physics *mqo.PhysicsPlugin, root *unityNode, boneNodes, objectNodes map[int]*unityNode) {
+	for _, body := range physics.Bodies {
+		target := root
+		if n, ok := boneNodes[body.TargetBoneID]; ok && body.TargetBoneID != 0 {
+			target = n
+		} else if n, ok := objectNodes[body.TargetObjID]; ok && body.TargetObjID != 0 {
+			target = n
+			c.addComponent(target, &unity.Rigidbody{
+				Mass:        body.Mass,
+				Drag:        body.LinearDamping,
+				AngularDrag: body.AngularDamping,
+				UseGravity:  1,
+				IsKinematic: map[bool]int{true: 1, false: 0}[body.Kinematic],
+			})
+		}
+		for _, s := range body.Shapes {
+			node := target
+			center := c.toUnity((*geom.Vector3)(&s.Position)).Sub(&target.position)
+			if s.Rotation != (mqo.Vector3XmlAttr{}) {
+				// Colliders can't be rotated.
+				name := body.Name
+				if name == "" {
+					name = "Collider"
+				}
+				node = c.addNode(name, target, center)
+				q := (&geom.EulerAngles{Vector3: geom.Vector3(s.Rotation), Order: geom.RotationOrderZXY}).ToQuaternion()
+				node.transform.LocalRotation = geom.Vector4{X: -q.X, Y: -q.Y, Z: q.Z, W: q.W}
+				center = &geom.Vector3{}
+			}
+			size := geom.Vector3(s.Size)
+			switch s.Type {
+			case "BOX":
+				c.addComponent(node, &unity.BoxCollider{Center: *center, Size: *size.Scale(2 * c.Scale)})
+			case "SPHERE":
+				c.addComponent(node, &unity.SphereCollider{Center: *center, Radius: size.X * c.Scale})
+			case "CAPSULE":
+				c.addComponent(node, &unity.CapsuleCollider{Center: *center, Radius: size.X * c.Scale, Height: (size.Y + size.X*2) * c.Scale, Direction: 1})
+			}
+		}
+	}
+}
+
+func safeFileName(name string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", ":", "_", "*", "_", "?", "_", "\"", "_", "<", "_", ">", "_", "|", "_").Replace(name)
+}
@@ -0,0 +1,77 @@
+package converter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/binzume/modelconv/geom"
+	"github.com/binzume/modelconv/mqo"
+	"github.com/binzume/modelconv/unity"
+)
+
+type testAssetsWriter struct {
+	assets map[string]*unity.MetaFile
+}
+
+func (w *testAssetsWriter) WriteAsset(assetPath string, meta *unity.MetaFile, data []byte) error {
+	w.assets[assetPath] = meta
+	return nil
+}
+
+func (w *testAssetsWriter) Close() error {
+	return nil
+}
+
+func TestConvertToUnityAssetNames(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"x/tex.png", "y/tex.png"} {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	doc := mqo.NewDocument()
+	white := geom.Vector4{X: 1, Y: 1, Z: 1, W: 1}
+	doc.Materials = []*mqo.Material{
+		{Name: "a/b", Color: white, Texture: "x/tex.png"},
+		{Name: "a_b", Color: white, Texture: "y/tex.png"},
+	}
+	obj := mqo.NewObject("obj")
+	obj.Vertexes = []*geom.Vector3{{X: 0}, {X: 1}, {Y: 1}}
+	obj.Faces = []*mqo.Face{
+		{Verts: []int{0, 1, 2}, Material: 0, UVs: make([]geom.Vector2, 3)},
+		{Verts: []int{2, 1, 0}, Material: 1, UVs: make([]geom.Vector2, 3)},
+	}
+	doc.Objects = append(doc.Objects, obj)
+
+	w := &testAssetsWriter{assets: map[string]*unity.MetaFile{}}
+	if err := NewMQOToUnityConverter(nil).Convert(doc, dir, "test", w); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{
+		"Assets/test/Materials/a_b.mat", "Assets/test/Materials/a_b_2.mat",
+		"Assets/test/Textures/tex.png", "Assets/test/Textures/tex_2.png",
+	} {
+		if w.assets[p] == nil {
+			t.Error("asset not found: ", p, w.assets)
+		}
+	}
+	guids := map[string]bool{}
+	for p, meta := range w.assets {
+		if guids[meta.GUID] {
+			t.Error("duplicated GUID: ", p, meta.GUID)
+		}
+		guids[meta.GUID] = true
+	}
+
+	w2 := &testAssetsWriter{assets: map[string]*unity.MetaFile{}}
+	if err := NewMQOToUnityConverter(nil).Convert(doc, dir, "test", w2); err != nil {
+		t.Fatal(err)
+	}
+	for p, meta := range w2.assets {
+		if guids[meta.GUID] {
+			t.Error("same GUID as the previous export: ", p, meta.GUID)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package converter
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/binzume/modelconv/geom"
+	"github.com/binzume/modelconv/mqo"
+	"github.com/binzume/modelconv/vrm"
+	"github.com/qmuntal/gltf"
+)
+
+const MToonShaderName = "VRM/MToon"
+
+// mmdSharedToonShadeColors is approximated shadow colors of MMD shared toon textures (toon01.bmp ... toon10.bmp).
+var mmdSharedToonShadeColors = [][3]float32{
+	{0.80, 0.80, 0.80},
+	{0.98, 0.86, 0.82},
+	{0.55, 0.55, 0.55},
+	{0.93, 0.82, 0.74},
+	{0.92, 0.88, 0.80},
+	{0.86, 0.82, 0.78},
+	{0.78, 0.80, 0.86},
+	{0.86, 0.78, 0.74},
+	{0.95, 0.90, 0.86},
+	{0.90, 0.90, 0.90},
+}
+
+// sharedToon returns the index of the MMD shared toon texture (0-9) of the material.
+func sharedToon(ex *mqo.MaterialEx2) (int, bool) {
+	var toon int
+	switch v := ex.ShaderParams["SharedToon"].(type) {
+	case int:
+		toon = v
+	case float64:
+		toon = int(v)
+	case float32:
+		toon = int(v)
+	default:
+		return 0, false
+	}
+	return toon, toon >= 0 && toon < len(mmdSharedToonShadeColors)
+}
+
+// MMD edge size 1.0 -> MToon outline width (cm)
+const mmdEdgeToOutlineWidth = 0.1
+
+const outlineWidthTextureSize = 512
+
+type toonRamp struct {
+	shade  [3]float32
+	toony  float32
+	shift  float32
+	linear bool
+}
+
+func luminance(c [3]float32) float32 {
+	return c[0]*0.299 + c[1]*0.587 + c[2]*0.114
+}
+
+func averageColor(img image.Image, rect image.Rectangle) [3]float32 {
+	var sum [3]float32
+	n := 0
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			sum[0] += float32(r) / 0xffff
+			sum[1] += float32(g) / 0xffff
+			sum[2] += float32(b) / 0xffff
+			n++
+		}
+	}
+	if n > 0 {
+		sum[0] /= float32(n)
+		sum[1] /= float32(n)
+		sum[2] /= float32(n)
+	}
+	return sum
+}
+
+// analyzeToonRamp estimates MToon shading parameters from MMD toon texture.
+// MMD samples toon textures vertically. (top: lit, bottom: shadow)
+func analyzeToonRamp(img image.Image) *toonRamp {
+	b := img.Bounds()
+	h := b.Dy()
+	if h == 0 || b.Dx() == 0 {
+		return nil
+	}
+	rows := make([]float32, h)
+	for y := 0; y < h; y++ {
+		rows[y] = luminance(averageColor(img, image.Rect(b.Min.X, b.Min.Y+y, b.Max.X, b.Min.Y+y+1)))
+	}
+	lit := averageColor(img, image.Rect(b.Min.X, b.Min.Y, b.Max.X, b.Min.Y+1))
+	ramp := &toonRamp{shade: averageColor(img, image.Rect(b.Min.X, b.Max.Y-1, b.Max.X, b.Max.Y)), toony: 0.9}
+	if lit[0] > 0 && lit[1] > 0 && lit[2] > 0 {
+		// normalize by lit color.
+		for i := range ramp.shade {
+			ramp.shade[i] = geom.Min(ramp.shade[i]/lit[i], 1)
+		}
+	}
+
+	top, bottom := rows[0], rows[h-1]
+	if top-bottom < 0.01 {
+		return ramp
+	}
+	start, end := 0, h-1
+	for y, l := range rows {
+		t := (top - l) / (top - bottom)
+		if t < 0.1 {
+			start = y
+		}
+		if t < 0.9 {
+			end = y
+		}
+	}
+	w := float32(end-start+1) / float32(h)
+	mid := (float32(start+end) + 1) * 0.5 / float32(h)
+	ramp.toony = geom.Clamp(1-2*w, 0, 1)
+	ramp.shift = geom.Clamp((1-2*mid)-w, -1, 1)
+	return ramp
+}
+
+// analyzeSphereRim estimates rim color from MMD multiply sphere map.
+func analyzeSphereRim(img image.Image) [3]float32 {
+	b := img.Bounds()
+	cx, cy := b.Min.X+b.Dx()/2, b.Min.Y+b.Dy()/2
+	center := averageColor(img, image.Rect(cx-b.Dx()/8, cy-b.Dy()/8, cx+b.Dx()/8+1, cy+b.Dy()/8+1))
+	var rim [3]float32
+	n := 0
+	for i := 0; i < 32; i++ {
+		a := float64(i) * math.Pi * 2 / 32
+		x := cx + int(float64(b.Dx())*0.45*math.Cos(a))
+		y := cy + int(float64(b.Dy())*0.45*math.Sin(a))
+		c := averageColor(img, image.Rect(x, y, x+1, y+1))
+		rim[0] += c[0]
+		rim[1] += c[1]
+		rim[2] += c[2]
+		n++
+	}
+	for i := range rim {
+		rim[i] = geom.Max(rim[i]/float32(n)-center[i], 0)
+	}
+	return rim
+}
+
+// bakeOutlineWidthTexture rasterizes per-vertex MMD edge scale into UV space.
+func bakeOutlineWidthTexture(objs []*mqo.Object, mat int, size int) (*image.Gray, float32) {
+	var maxScale float32
+	uniform := true
+	first := float32(-1)
+	for _, obj := range objs {
+		scales, _ := obj.Extra["edgeScale"].([]float32)
+		for _, f := range obj.Faces {
+			if f.Material != mat {
+				continue
+			}
+			for _, v := range f.Verts {
+				s := float32(1)
+				if v < len(scales) {
+					s = scales[v]
+				}
+				if first < 0 {
+					first = s
+				}
+				uniform = uniform && s == first
+				maxScale = geom.Max(maxScale, s)
+			}
+		}
+	}
+	if uniform || maxScale <= 0 {
+		return nil, maxScale
+	}
+
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for _, obj := range objs {
+		scales, _ := obj.Extra["edgeScale"].([]float32)
+		for _, f := range obj.Faces {
+			if f.Material != mat || len(f.UVs) != len(f.Verts) {
+				continue
+			}
+			value := func(i int) float32 {
+				if f.Verts[i] < len(scales) {
+					return scales[f.Verts[i]] / maxScale
+				}
+				return 1 / maxScale
+			}
+			for i := 1; i < len(f.Verts)-1; i++ {
+				rasterizeUVTriangle(img, [3]geom.Vector2{f.UVs[0], f.UVs[i], f.UVs[i+1]}, [3]float32{value(0), value(i), value(i + 1)})
+			}
+		}
+	}
+	return img, maxScale
+}
+
+func rasterizeUVTriangle(img *image.Gray, uv [3]geom.Vector2, values [3]float32) {
+	size := img.Bounds().Dx()
+	ox := float32(math.Floor(float64(geom.Min(geom.Min(uv[0].X, uv[1].X), uv[2].X))))
+	oy := float32(math.Floor(float64(geom.Min(geom.Min(uv[0].Y, uv[1].Y), uv[2].Y))))
+	var p [3][2]float32
+	for i := range uv {
+		p[i] = [2]float32{(uv[i].X - ox) * float32(size), (uv[i].Y - oy) * float32(size)}
+	}
+	area := (p[1][0]-p[0][0])*(p[2][1]-p[0][1]) - (p[2][0]-p[0][0])*(p[1][1]-p[0][1])
+	if area == 0 {
+		return
+	}
+	minX := int(geom.Min(geom.Min(p[0][0], p[1][0]), p[2][0]))
+	maxX := int(geom.Max(geom.Max(p[0][0], p[1][0]), p[2][0])) + 1
+	minY := int(geom.Min(geom.Min(p[0][1], p[1][1]), p[2][1]))
+	maxY := int(geom.Max(geom.Max(p[0][1], p[1][1]), p[2][1])) + 1
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			px, py := float32(x)+0.5, float32(y)+0.5
+			w0 := ((p[1][0]-px)*(p[2][1]-py) - (p[2][0]-px)*(p[1][1]-py)) / area
+			w1 := ((p[2][0]-px)*(p[0][1]-py) - (p[0][0]-px)*(p[2][1]-py)) / area
+			w2 := 1 - w0 - w1
+			const e = -0.02 // conservative
+			if w0 < e || w1 < e || w2 < e {
+				continue
+			}
+			v := geom.Clamp(w0*values[0]+w1*values[1]+w2*values[2], 0, 1)
+			img.SetGray(((x%size)+size)%size, ((y%size)+size)%size, color.Gray{Y: uint8(v*255 + 0.5)})
+		}
+	}
+}
+
+// addImageTexture adds the generated image. It is encoded by the texture workers.
+func (m *mqoToGltf) addImageTexture(name string, img image.Image) *uint32 {
+	return m.writeTexture(name, "image/png", imageBytes(img.Bounds().Dx(), img.Bounds().Dy()), func() (image.Image, []byte, error) {
+		return img, nil, nil
+	})
+}
+
+// convertMToon converts MMD(pmd shader) material parameters to MToon material property.
+func (m *mqoToGltf) convertMToon(mat *mqo.Material, mm *gltf.Material, textures *textureCache, objs []*mqo.Object, matIndex int) *vrm.MaterialProperty {
+	if mat.Ex2 == nil || mat.Ex2.ShaderName != "pmd" {
+		return nil
+	}
+	mp := vrm.NewMaterialProperty(mat.Name)
+	mp.Shader = MToonShaderName
+	mp.FloatProperties["_MToonVersion"] = 38
+	mp.FloatProperties["_DebugMode"] = 0
+	mp.FloatProperties["_ReceiveShadowRate"] = 1
+	mp.FloatProperties["_ShadingGradeRate"] = 1
+	mp.FloatProperties["_LightColorAttenuation"] = 0
+	mp.FloatProperties["_IndirectLightIntensity"] = 0.1
+	mp.FloatProperties["_BumpScale"] = 1
+	mp.FloatProperties["_OutlineCullMode"] = 1
+	mp.FloatProperties["_OutlineScaledMaxDistance"] = 1
+
+	c := mat.Color
+	mp.VectorProperties["_Color"] = []float64{float64(c.X), float64(c.Y), float64(c.Z), float64(c.W)}
+	mp.VectorProperties["_MainTex"] = []float64{0, 0, 1, 1}
+	mp.VectorProperties["_ShadeTexture"] = []float64{0, 0, 1, 1}
+	mp.VectorProperties["_EmissionColor"] = []float64{0, 0, 0, 1}
+	if mm.PBRMetallicRoughness != nil && mm.PBRMetallicRoughness.BaseColorTexture != nil {
+		mp.TextureProperties["_MainTex"] = mm.PBRMetallicRoughness.BaseColorTexture.Index
+		mp.TextureProperties["_ShadeTexture"] = mm.PBRMetallicRoughness.BaseColorTexture.Index
+	}
+
+	// Culling
+	if mat.DoubleSided {
+		mp.FloatProperties["_CullMode"] = 0
+	} else {
+		mp.FloatProperties["_CullMode"] = 2
+	}
+
+	// Blend mode
+	switch mm.AlphaMode {
+	case gltf.AlphaMask:
+		mp.RenderQueue = 2450
+		mp.FloatProperties["_BlendMode"] = 1
+		mp.FloatProperties["_Cutoff"] = float64(mm.AlphaCutoffOrDefault())
+		mp.FloatProperties["_SrcBlend"] = 1
+		mp.FloatProperties["_DstBlend"] = 0
+		mp.FloatProperties["_ZWrite"] = 1
+		mp.KeywordMap["_ALPHATEST_ON"] = true
+		mp.TagMap["RenderType"] = "TransparentCutout"
+	case gltf.AlphaBlend:
+		mp.RenderQueue = 3000
+		mp.FloatProperties["_BlendMode"] = 2
+		mp.FloatProperties["_SrcBlend"] = 5
+		mp.FloatProperties["_DstBlend"] = 10
+		mp.FloatProperties["_ZWrite"] = 0
+		mp.KeywordMap["_ALPHABLEND_ON"] = true
+		mp.TagMap["RenderType"] = "Transparent"
+	default:
+		mp.FloatProperties["_BlendMode"] = 0
+		mp.FloatProperties["_SrcBlend"] = 1
+		mp.FloatProperties["_DstBlend"] = 0
+		mp.FloatProperties["_ZWrite"] = 1
+		mp.TagMap["RenderType"] = "Opaque"
+	}
+
+	// Toon
+	var ramp *toonRamp
+	if toon := mat.Ex2.Mapping("Toon"); toon != "" {
+		if img, err := textures.getImage(toon); err == nil {
+			ramp = analyzeToonRamp(img)
+		}
+	}
+	if shared, ok := sharedToon(mat.Ex2); ok && ramp == nil {
+		ramp = &toonRamp{shade: mmdSharedToonShadeColors[shared], toony: 0.9}
+	}
+	if ramp == nil {
+		ramp = &toonRamp{shade: [3]float32{1, 1, 1}, toony: 0.9}
+	}
+	mp.VectorProperties["_ShadeColor"] = []float64{float64(c.X * ramp.shade[0]), float64(c.Y * ramp.shade[1]), float64(c.Z * ramp.shade[2]), 1}
+	mp.FloatProperties["_ShadeToony"] = float64(ramp.toony)
+	mp.FloatProperties["_ShadeShift"] = float64(ramp.shift)
+
+	// Sphere
+	mp.VectorProperties["_RimColor"] = []float64{0, 0, 0, 1}
+	mp.FloatProperties["_RimLightingMix"] = 0
+	mp.FloatProperties["_RimFresnelPower"] = 1
+	mp.FloatProperties["_RimLift"] = 0
+	if sphere := mat.Ex2.Mapping("Sphere"); sphere != "" {
+		switch mat.Ex2.IntParam("SphereMode") {
+		case 1: // multiply
+			if img, err := textures.getImage(sphere); err == nil {
+				rim := analyzeSphereRim(img)
+				if luminance(rim) > 0.01 {
+					mp.VectorProperties["_RimColor"] = []float64{float64(rim[0]), float64(rim[1]), float64(rim[2]), 1}
+					mp.FloatProperties["_RimLightingMix"] = 1
+					mp.FloatProperties["_RimFresnelPower"] = 5
+				}
+			}
+		case 2: // add
+			if t := m.tryAddTexture(sphere, textures); t != nil {
+				mp.TextureProperties["_SphereAdd"] = t.Index
+				mp.VectorProperties["_SphereAdd"] = []float64{0, 0, 1, 1}
+			}
+		}
+	}
+
+	// Outline
+	mp.FloatProperties["_OutlineWidthMode"] = 0
+	mp.FloatProperties["_OutlineWidth"] = 0
+	mp.FloatProperties["_OutlineColorMode"] = 0
+	mp.FloatProperties["_OutlineLightingMix"] = 1
+	mp.VectorProperties["_OutlineColor"] = []float64{0, 0, 0, 1}
+	edgeSize := float32(mat.Ex2.FloatParam("EdgeSize"))
+	if mat.Ex2.BoolParam("Edge") && edgeSize > 0 {
+		tex, maxScale := bakeOutlineWidthTexture(objs, matIndex, outlineWidthTextureSize)
+		if maxScale > 0 {
+			mp.FloatProperties["_OutlineWidthMode"] = 1
+			mp.FloatProperties["_OutlineWidth"] = float64(edgeSize * maxScale * mmdEdgeToOutlineWidth)
+			mp.KeywordMap["MTOON_OUTLINE_WIDTH_WORLD"] = true
+			mp.KeywordMap["MTOON_OUTLINE_COLOR_FIXED"] = true
+			if ec := mat.Ex2.ColorParam("EdgeColor"); ec != nil {
+				mp.VectorProperties["_OutlineColor"] = []float64{float64(ec[0]), float64(ec[1]), float64(ec[2]), float64(ec[3])}
+			}
+			if tex != nil {
+				mp.TextureProperties["_OutlineWidthTexture"] = *m.addImageTexture(mat.Name+"_outline.png", tex)
+				mp.VectorProperties["_OutlineWidthTexture"] = []float64{0, 0, 1, 1}
+			}
+		}
+	}
+	return mp
+}
@@ -0,0 +1,161 @@
+package converter
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/binzume/modelconv/mqo"
+	"github.com/qmuntal/gltf"
+)
+
+func TestAnalyzeToonRamp(t *testing.T) {
+	if r := analyzeToonRamp(image.NewGray(image.Rect(0, 0, 0, 0))); r != nil {
+		t.Error("empty image: ", r)
+	}
+
+	flat := image.NewGray(image.Rect(0, 0, 4, 8))
+	for i := range flat.Pix {
+		flat.Pix[i] = 200
+	}
+	if r := analyzeToonRamp(flat); r == nil || r.shade != [3]float32{1, 1, 1} || r.toony != 0.9 || r.shift != 0 {
+		t.Error("flat: ", r)
+	}
+
+	// Hard step at the middle. (top: lit, bottom: shadow)
+	step := image.NewNRGBA(image.Rect(0, 0, 4, 8))
+	for y := 0; y < 8; y++ {
+		c := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+		if y >= 4 {
+			c = color.NRGBA{R: 204, G: 153, B: 102, A: 255}
+		}
+		for x := 0; x < 4; x++ {
+			step.SetNRGBA(x, y, c)
+		}
+	}
+	r := analyzeToonRamp(step)
+	if r == nil || !nearlyEqual(r.shade[0], 0.8) || !nearlyEqual(r.shade[1], 0.6) || !nearlyEqual(r.shade[2], 0.4) {
+		t.Fatal("shade: ", r)
+	}
+	if !nearlyEqual(r.toony, 0.75) || !nearlyEqual(r.shift, 0) {
+		t.Error("step: ", r.toony, r.shift)
+	}
+
+	// Smooth gradient is less toony.
+	gradient := image.NewGray(image.Rect(0, 0, 4, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 4; x++ {
+			gradient.SetGray(x, y, color.Gray{Y: uint8(255 - y*20)})
+		}
+	}
+	if g := analyzeToonRamp(gradient); g == nil || g.toony >= r.toony {
+		t.Error("gradient: ", g)
+	}
+}
+
+func newTestOutlineObject(mat int, scales []float32) *mqo.Object {
+	obj := mqo.NewObject("obj")
+	obj.Vertexes = []*mqo.Vector3{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}, {X: 0, Y: 1}}
+	obj.Faces = []*mqo.Face{{Verts: []int{0, 1, 2, 3}, Material: mat,
+		UVs: []mqo.Vector2{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}, {X: 0, Y: 1}}}}
+	if scales != nil {
+		obj.Extra["edgeScale"] = scales
+	}
+	return obj
+}
+
+func TestBakeOutlineWidthTexture(t *testing.T) {
+	// Uniform edge scale doesn't need the texture.
+	if img, maxScale := bakeOutlineWidthTexture([]*mqo.Object{newTestOutlineObject(0, nil)}, 0, 8); img != nil || maxScale != 1 {
+		t.Error("uniform: ", img != nil, maxScale)
+	}
+	if img, maxScale := bakeOutlineWidthTexture([]*mqo.Object{newTestOutlineObject(0, []float32{2, 2, 2, 2})}, 0, 8); img != nil || maxScale != 2 {
+		t.Error("uniform scale: ", img != nil, maxScale)
+	}
+	// Faces of the other materials are ignored.
+	objs := []*mqo.Object{newTestOutlineObject(0, []float32{2, 1, 1, 2}), newTestOutlineObject(1, []float32{4, 4, 0, 0})}
+	img, maxScale := bakeOutlineWidthTexture(objs, 0, 8)
+	if img == nil || maxScale != 2 {
+		t.Fatal("max scale: ", maxScale)
+	}
+	// Linear from 2/2 (u=0) to 1/2 (u=1) at the pixel centers.
+	if l, r := img.GrayAt(0, 4).Y, img.GrayAt(7, 4).Y; math.Abs(float64(l)-247) > 1 || math.Abs(float64(r)-135) > 1 {
+		t.Error("width: ", l, r)
+	}
+	if img.GrayAt(0, 0).Y < img.GrayAt(4, 0).Y || img.GrayAt(4, 0).Y < img.GrayAt(7, 0).Y {
+		t.Error("interpolation: ", img.GrayAt(0, 0), img.GrayAt(4, 0), img.GrayAt(7, 0))
+	}
+}
+
+func TestConvertMToon(t *testing.T) {
+	dir := t.TempDir()
+	m := newTestTextureConverter(1)
+	textures := newTextureCache(dir, 0)
+
+	if mp := m.convertMToon(&mqo.Material{Name: "phong"}, &gltf.Material{}, textures, nil, 0); mp != nil {
+		t.Error("not a pmd material: ", mp)
+	}
+
+	ex := mqo.NewMaterialEx2("pmd")
+	ex.ShaderParams["SharedToon"] = 2
+	ex.ShaderParams["Edge"] = true
+	ex.ShaderParams["EdgeSize"] = 1.0
+	ex.ShaderParams["EdgeColor"] = []float32{1, 0, 0, 1}
+	mat := &mqo.Material{Name: "skin", Color: mqo.Vector4{X: 1, Y: 0.5, Z: 1, W: 1}, DoubleSided: true, Ex2: ex}
+	cutoff := float32(0.25)
+	mm := &gltf.Material{
+		AlphaMode:            gltf.AlphaMask,
+		AlphaCutoff:          &cutoff,
+		PBRMetallicRoughness: &gltf.PBRMetallicRoughness{BaseColorTexture: &gltf.TextureInfo{Index: 3}},
+	}
+	objs := []*mqo.Object{newTestOutlineObject(0, []float32{2, 1, 1, 2})}
+
+	mp := m.convertMToon(mat, mm, textures, objs, 0)
+	if mp == nil || mp.Shader != MToonShaderName {
+		t.Fatal("shader: ", mp)
+	}
+	if mp.TextureProperties["_MainTex"] != 3 || mp.TextureProperties["_ShadeTexture"] != 3 {
+		t.Error("textures: ", mp.TextureProperties)
+	}
+	if mp.FloatProperties["_CullMode"] != 0 || mp.FloatProperties["_BlendMode"] != 1 || mp.FloatProperties["_Cutoff"] != 0.25 || !mp.KeywordMap["_ALPHATEST_ON"] {
+		t.Error("render mode: ", mp.FloatProperties, mp.KeywordMap)
+	}
+	// toon03.bmp
+	if s := mp.VectorProperties["_ShadeColor"]; !nearlyEqual(float32(s[0]), 0.55) || !nearlyEqual(float32(s[1]), 0.275) {
+		t.Error("shade: ", s)
+	}
+	// EdgeSize * max edge scale * mmdEdgeToOutlineWidth
+	if w := mp.FloatProperties["_OutlineWidth"]; !nearlyEqual(float32(w), 0.2) || mp.FloatProperties["_OutlineWidthMode"] != 1 {
+		t.Error("outline: ", w)
+	}
+	if c := mp.VectorProperties["_OutlineColor"]; c[0] != 1 || c[1] != 0 {
+		t.Error("outline color: ", c)
+	}
+	if tex, ok := mp.TextureProperties["_OutlineWidthTexture"]; !ok || int(tex) != len(m.Textures)-1 {
+		t.Error("outline width texture: ", mp.TextureProperties)
+	}
+
+	// Toon texture is preferred to the shared toon.
+	step := image.NewGray(image.Rect(0, 0, 4, 8))
+	for i := range step.Pix {
+		step.Pix[i] = 255
+		if i >= len(step.Pix)/2 {
+			step.Pix[i] = 102
+		}
+	}
+	writeTestPNG(t, filepath.Join(dir, "toon.png"), step)
+	ex.ShaderMapping["Toon"] = "toon.png"
+	ex.ShaderParams["Edge"] = false
+	mp = m.convertMToon(mat, &gltf.Material{}, textures, objs, 0)
+	if s := mp.VectorProperties["_ShadeColor"]; !nearlyEqual(float32(s[0]), 0.4) || !nearlyEqual(float32(mp.FloatProperties["_ShadeToony"]), 0.75) {
+		t.Error("toon texture: ", s, mp.FloatProperties["_ShadeToony"])
+	}
+	if mp.FloatProperties["_OutlineWidthMode"] != 0 || mp.FloatProperties["_BlendMode"] != 0 || mp.FloatProperties["_CullMode"] != 0 {
+		t.Error("no outline: ", mp.FloatProperties)
+	}
+	if err := m.textureJobs.flush(m); err != nil {
+		t.Fatal(err)
+	}
+}
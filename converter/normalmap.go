@@ -0,0 +1,178 @@
+package converter
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/binzume/modelconv/geom"
+)
+
+// isHeightMap returns true if the image looks like a greyscale bump map rather than a tangent-space normal map.
+func isHeightMap(img image.Image) bool {
+	switch img.ColorModel() {
+	case color.GrayModel, color.Gray16Model:
+		return true
+	}
+	b := img.Bounds()
+	step := b.Dx() * b.Dy() / 4096
+	if step < 1 {
+		step = 1
+	}
+	grey, bluish, count := 0, 0, 0
+	for i := 0; i < b.Dx()*b.Dy(); i += step {
+		r, g, bl, _ := img.At(b.Min.X+i%b.Dx(), b.Min.Y+i/b.Dx()).RGBA()
+		r, g, bl = r>>8, g>>8, bl>>8
+		if absDiff(r, g) <= 8 && absDiff(g, bl) <= 8 {
+			grey++
+		} else if bl >= 128 && bl >= r && bl >= g {
+			bluish++
+		}
+		count++
+	}
+	return grey*10 >= count*9 && bluish*20 < count
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// heightToNormalMap converts the height map to a tangent-space normal map. (+X: right, +Y: up)
+// Gradients are calculated by the Sobel operator with wrapping around the edges, so tiled textures have no seams.
+func heightToNormalMap(img image.Image, strength float32) *image.NRGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	heights := make([]float32, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			heights[y*w+x] = float32(color.GrayModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray).Y) / 255
+		}
+	}
+	at := func(x, y int) float32 {
+		return heights[((y+h)%h)*w+(x+w)%w]
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx := (at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1)) - (at(x-1, y-1) + 2*at(x-1, y) + at(x-1, y+1))
+			dy := (at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1)) - (at(x-1, y-1) + 2*at(x, y-1) + at(x+1, y-1))
+			// Image Y axis is downward.
+			n := (&geom.Vector3{X: -dx * strength, Y: dy * strength, Z: 1}).Normalize()
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: toUint8(n.X*0.5 + 0.5),
+				G: toUint8(n.Y*0.5 + 0.5),
+				B: toUint8(n.Z*0.5 + 0.5),
+				A: 255,
+			})
+		}
+	}
+	return dst
+}
+
+// generateTangents calculates MikkTSpace-compatible tangents from the triangles and UVs.
+// The tangents of the faces are projected onto the vertex normal and accumulated with the corner angle as the weight.
+// Faces with mirrored UVs are not mixed: a vertex shared by faces with different orientations is split, and the triangles are updated in place.
+// Vertices on UV seams must have separate indices. The new vertices are appended, and src maps every vertex to the source index.
+// W is the handedness of the bitangent which points to the top of the texture (glTF convention).
+func generateTangents(positions [][3]float32, normals [][3]float32, uvs [][2]float32, triangles [][]uint32) (tangents [][4]float32, src []int) {
+	type groupKey struct {
+		vert uint32
+		sign float32
+	}
+	vec := func(v [3]float32) *geom.Vector3 { return &geom.Vector3{X: v[0], Y: v[1], Z: v[2]} }
+	groups := map[groupKey]int{} // -> output vertex
+	var sums []geom.Vector3
+	for i := range positions {
+		src = append(src, i)
+	}
+	vertSign := make([]float32, len(positions)) // sign of the group which uses the source index. 0: unused
+	var degenerate []*uint32
+	for _, indices := range triangles {
+		for i := 0; i+2 < len(indices); i += 3 {
+			tri := [3]uint32{indices[i], indices[i+1], indices[i+2]}
+			p0, p1, p2 := vec(positions[tri[0]]), vec(positions[tri[1]]), vec(positions[tri[2]])
+			e1, e2 := p1.Sub(p0), p2.Sub(p0)
+			du1, dv1 := uvs[tri[1]][0]-uvs[tri[0]][0], uvs[tri[1]][1]-uvs[tri[0]][1]
+			du2, dv2 := uvs[tri[2]][0]-uvs[tri[0]][0], uvs[tri[2]][1]-uvs[tri[0]][1]
+			det := du1*dv2 - du2*dv1
+			// glTF UV origin is top-left. bitangent = -dP/dv
+			t := e1.Scale(dv2).Sub(e2.Scale(dv1))
+			bt := e1.Scale(du2).Sub(e2.Scale(du1))
+			if det < 0 {
+				t, bt = t.Scale(-1), bt.Scale(-1)
+			}
+			for c := 0; c < 3; c++ {
+				corner := &indices[i+c]
+				v := tri[c]
+				a, b := vec(positions[tri[(c+1)%3]]).Sub(vec(positions[v])), vec(positions[tri[(c+2)%3]]).Sub(vec(positions[v]))
+				n := vec(normals[v])
+				tp := t.Sub(n.Scale(n.Dot(t)))
+				if det == 0 || tp.LenSqr() < 1e-12 || a.LenSqr() == 0 || b.LenSqr() == 0 {
+					degenerate = append(degenerate, corner)
+					continue
+				}
+				var sign float32 = 1
+				if n.Cross(t).Dot(bt) < 0 {
+					sign = -1
+				}
+				cos := a.Dot(b) / float32(math.Sqrt(float64(a.LenSqr()*b.LenSqr())))
+				angle := float32(math.Acos(float64(geom.Clamp(cos, -1, 1))))
+
+				key := groupKey{v, sign}
+				out, ok := groups[key]
+				if !ok {
+					out = int(v)
+					if vertSign[v] != 0 {
+						// Mirrored faces share the vertex. Split it.
+						out = len(src)
+						src = append(src, int(v))
+					} else {
+						vertSign[v] = sign
+					}
+					groups[key] = out
+				}
+				for len(sums) < len(src) {
+					sums = append(sums, geom.Vector3{})
+				}
+				sums[out] = *sums[out].Add(tp.Normalize().Scale(angle))
+				*corner = uint32(out)
+			}
+		}
+	}
+	// Degenerate corners use the tangent of the vertex.
+	for _, corner := range degenerate {
+		if v := *corner; v < uint32(len(positions)) && vertSign[v] == 0 {
+			vertSign[v] = 1
+		}
+	}
+
+	tangents = make([][4]float32, len(src))
+	for i, si := range src {
+		n := vec(normals[si])
+		var t *geom.Vector3
+		if i < len(sums) {
+			t = sums[i].Sub(n.Scale(n.Dot(&sums[i])))
+		}
+		if t == nil || t.LenSqr() < 1e-12 {
+			// Any vector perpendicular to the normal.
+			t = n.Cross(&geom.Vector3{X: 0, Y: 0, Z: 1})
+			if t.LenSqr() < 1e-6 {
+				t = n.Cross(&geom.Vector3{X: 0, Y: 1, Z: 0})
+			}
+		}
+		t = t.Normalize()
+		w := vertSign[si]
+		if i >= len(positions) {
+			w = -w
+		}
+		if w == 0 {
+			w = 1
+		}
+		tangents[i] = [4]float32{t.X, t.Y, t.Z, w}
+	}
+	return tangents, src
+}
@@ -0,0 +1,122 @@
+package converter
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestIsHeightMap(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 8, 8))
+	if !isHeightMap(gray) {
+		t.Error("gray image should be a height map")
+	}
+
+	rgbGray := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	normal := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			v := uint8(x * 30)
+			rgbGray.SetNRGBA(x, y, color.NRGBA{R: v, G: v + 2, B: v, A: 255})
+			normal.SetNRGBA(x, y, color.NRGBA{R: 128 + uint8(x), G: 128 - uint8(y), B: 255, A: 255})
+		}
+	}
+	if !isHeightMap(rgbGray) {
+		t.Error("greyscale RGB image should be a height map")
+	}
+	if isHeightMap(normal) {
+		t.Error("normal map should not be a height map")
+	}
+}
+
+func TestHeightToNormalMapWrap(t *testing.T) {
+	const w, h = 8, 4
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		img.SetGray(0, y, color.Gray{Y: 255})
+	}
+	dst := heightToNormalMap(img, 1)
+
+	// Flat area
+	if c := dst.NRGBAAt(w/2, 1); c.R != 128 || c.G != 128 || c.B != 255 {
+		t.Error("flat: ", c)
+	}
+	// The right edge is next to the left edge.
+	if c := dst.NRGBAAt(w-1, 1); c.R >= 128 || c.G != 128 {
+		t.Error("right edge: ", c)
+	}
+	if c := dst.NRGBAAt(1, 1); c.R <= 128 || c.G != 128 {
+		t.Error("slope: ", c)
+	}
+	// No vertical gradient because the rows wrap around.
+	if c0, c1 := dst.NRGBAAt(w-1, 0), dst.NRGBAAt(w-1, h-1); c0 != c1 {
+		t.Error("top and bottom rows: ", c0, c1)
+	}
+}
+
+func TestGenerateTangents(t *testing.T) {
+	positions := [][3]float32{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {2, 0, 0}, {3, 0, 0}, {2, 1, 0}}
+	normals := [][3]float32{{0, 0, 1}, {0, 0, 1}, {0, 0, 1}, {0, 0, 1}, {0, 0, 1}, {0, 0, 1}}
+	// glTF UVs (top-left origin). The second triangle is mirrored horizontally.
+	uvs := [][2]float32{{0, 1}, {1, 1}, {0, 0}, {1, 1}, {0, 1}, {1, 0}}
+	tangents, src := generateTangents(positions, normals, uvs, [][]uint32{{0, 1, 2, 3, 4, 5}})
+	if len(tangents) != len(positions) || len(src) != len(positions) {
+		t.Fatal("vertices are split: ", len(tangents), src)
+	}
+	for i, tan := range tangents[:3] {
+		if tan != [4]float32{1, 0, 0, 1} {
+			t.Error("tangent: ", i, tan)
+		}
+	}
+	for i, tan := range tangents[3:] {
+		if tan != [4]float32{-1, 0, 0, -1} {
+			t.Error("mirrored tangent: ", i, tan)
+		}
+	}
+}
+
+func TestGenerateTangentsMirrorSplit(t *testing.T) {
+	// 0-1-2
+	// | | |
+	// 3-4-5
+	positions := [][3]float32{{0, 1, 0}, {1, 1, 0}, {2, 1, 0}, {0, 0, 0}, {1, 0, 0}, {2, 0, 0}}
+	normals := make([][3]float32, len(positions))
+	for i := range normals {
+		normals[i] = [3]float32{0, 0, 1}
+	}
+	// The right half is mirrored at x=1.
+	uvs := [][2]float32{{0, 0}, {1, 0}, {0, 0}, {0, 1}, {1, 1}, {0, 1}}
+	left := []uint32{3, 4, 1, 3, 1, 0}
+	right := []uint32{4, 5, 2, 4, 2, 1}
+	tangents, src := generateTangents(positions, normals, uvs, [][]uint32{left, right})
+
+	if len(tangents) != 8 || len(src) != 8 || src[6] != 4 || src[7] != 1 {
+		t.Fatal("vertices on the mirror line are not split: ", src)
+	}
+	for _, i := range left {
+		if tangents[i] != [4]float32{1, 0, 0, 1} {
+			t.Error("tangent: ", i, tangents[i])
+		}
+	}
+	if right[0] != 6 || right[2] != 2 || right[4] != 2 || right[5] != 7 {
+		t.Error("triangles are not updated: ", right)
+	}
+	for _, i := range right {
+		if tangents[i] != [4]float32{-1, 0, 0, -1} {
+			t.Error("mirrored tangent: ", i, tangents[i])
+		}
+	}
+}
+
+func TestGenerateTangentsAngleWeight(t *testing.T) {
+	// The tangents of the faces are projected onto the vertex normal.
+	positions := [][3]float32{{0, 0, 0}, {1, 0, 1}, {0, 1, 0}}
+	normals := [][3]float32{{0, 0, 1}, {0, 0, 1}, {0, 0, 1}}
+	uvs := [][2]float32{{0, 1}, {1, 1}, {0, 0}}
+	tangents, _ := generateTangents(positions, normals, uvs, [][]uint32{{0, 1, 2}})
+	for i, tan := range tangents {
+		if tan != [4]float32{1, 0, 0, 1} {
+			t.Error("tangent: ", i, tan)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package converter
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/binzume/modelconv/geom"
+	"github.com/binzume/modelconv/mqo"
+)
+
+// TextureBakeOption specifies the colors baked into the textures by BakeTextures().
+type TextureBakeOption struct {
+	VertexColor   bool
+	MaterialColor bool // RGB of Material.Color. Alpha is kept in the material.
+	Emission      bool // Emission is added to the color. Only for the unlit materials, lit materials keep the emission.
+
+	Name       string // Model name in the texture file names. e.g. Name_Material_baked.png
+	Resolution int    // Texture size for the vertex colors of the materials without texture. Default: 1024
+	Dilation   int    // Pixels to extend the UV islands. Default: 4
+	OutputDir  string // Relative to srcDir. Default: "saved_textures"
+}
+
+// BakeTextures rasterizes the faces in UV space and bakes the colors into new textures of the materials.
+// Baked colors are removed from the materials and the objects, so the appearance is kept in the runtimes which ignore vertex colors.
+// Materials which have faces without UVs are not baked.
+func BakeTextures(doc *mqo.Document, srcDir string, option *TextureBakeOption) error {
+	if option == nil {
+		option = &TextureBakeOption{VertexColor: true, MaterialColor: true, Emission: true}
+	}
+	resolution := option.Resolution
+	if resolution <= 0 {
+		resolution = 1024
+	}
+	dilation := option.Dilation
+	if dilation == 0 {
+		dilation = 4
+	}
+	outDir := option.OutputDir
+	if outDir == "" {
+		outDir = "saved_textures"
+	}
+
+	bakeable := map[int]bool{}
+	for _, obj := range doc.Objects {
+		if !obj.Visible {
+			continue
+		}
+		for _, f := range obj.Faces {
+			if len(f.Verts) < 3 || f.Material < 0 || f.Material >= len(doc.Materials) {
+				continue
+			}
+			if b, ok := bakeable[f.Material]; ok && !b {
+				continue
+			}
+			bakeable[f.Material] = len(f.UVs) == len(f.Verts)
+		}
+	}
+
+	textures := newTextureCache(srcDir, 1<<28)
+	names := map[string]bool{}
+	baked := map[int]bool{}
+	for i, mat := range doc.Materials {
+		if !bakeable[i] || strings.HasSuffix(mat.Name, "$IGNORE") || strings.HasPrefix(mat.Name, "$MORPH:") {
+			continue
+		}
+		vertexColor := option.VertexColor && materialHasVertexColor(doc, i)
+		tint := option.MaterialColor && (mat.Color.X != 1 || mat.Color.Y != 1 || mat.Color.Z != 1)
+		emission := option.Emission && materialEmission(mat) != [3]float32{}
+		if emission && !materialIsUnlit(mat) {
+			// Baked emission would be shaded by the lights.
+			log.Println("Emission is not baked into the lit material: ", mat.Name)
+			emission = false
+		}
+		if !vertexColor && !tint && !emission {
+			continue
+		}
+
+		var base image.Image
+		if mat.Texture != "" {
+			img, err := textures.getImage(mat.Texture)
+			if err != nil {
+				log.Println("Can not bake texture: ", mat.Name, err)
+				continue
+			}
+			base = img
+		}
+		img := bakeMaterialTexture(doc, i, base, resolution, dilation, vertexColor, tint, emission)
+
+		name := bakedTextureName(names, option.Name, mat.Name, "_baked.png")
+		if err := saveBakedTexture(filepath.Join(srcDir, outDir, name), img); err != nil {
+			return err
+		}
+		mat.Texture = filepath.ToSlash(filepath.Join(outDir, name))
+		if tint {
+			mat.Color.X, mat.Color.Y, mat.Color.Z = 1, 1, 1
+		}
+		if emission {
+			mat.Emission = 0
+			mat.EmissionColor = nil
+		}
+		baked[i] = vertexColor
+		log.Printf("Baked: %v -> %v", mat.Name, mat.Texture)
+	}
+
+	if !option.VertexColor {
+		return nil
+	}
+	for _, obj := range doc.Objects {
+		if obj.VertexColors == nil {
+			continue
+		}
+		all := true
+		for _, f := range obj.Faces {
+			all = all && baked[f.Material]
+		}
+		if all {
+			obj.VertexColors = nil
+		} else if obj.Visible {
+			log.Println("Vertex colors are not baked: ", obj.Name)
+		}
+	}
+	return nil
+}
+
+// bakedTextureName returns a file name which is not used by the other baked textures. e.g. model_material_baked.png
+func bakedTextureName(used map[string]bool, model, material, suffix string) string {
+	base := safeFileName(material)
+	if model != "" {
+		base = safeFileName(model) + "_" + base
+	}
+	name := base + suffix
+	for n := 2; used[strings.ToLower(name)]; n++ {
+		name = fmt.Sprintf("%s_%d%s", base, n, suffix)
+	}
+	used[strings.ToLower(name)] = true
+	return name
+}
+
+// materialIsUnlit returns true if the material is converted to an unlit material.
+func materialIsUnlit(mat *mqo.Material) bool {
+	return mat.GetShaderName() == "Constant" || mat.GetShaderName() == mqo.ShaderNameGlTF && gltfShaderIsUnlit(mat.Ex2)
+}
+
+func materialHasVertexColor(doc *mqo.Document, material int) bool {
+	for _, obj := range doc.Objects {
+		if !obj.Visible || len(obj.VertexColors) != len(obj.Vertexes) {
+			continue
+		}
+		for _, f := range obj.Faces {
+			if f.Material != material {
+				continue
+			}
+			for _, v := range f.Verts {
+				if c := obj.VertexColors[v]; c.X != 1 || c.Y != 1 || c.Z != 1 || c.W != 1 {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// materialEmission returns the emissive color. (same as glTF emissiveFactor)
+func materialEmission(mat *mqo.Material) [3]float32 {
+	if mat.EmissionColor != nil {
+		return [3]float32{mat.EmissionColor.X, mat.EmissionColor.Y, mat.EmissionColor.Z}
+	}
+	return [3]float32{mat.Emission, mat.Emission, mat.Emission}
+}
+
+// bakeMaterialTexture returns base * tint * vertex color + emission in linear color space.
+// The base texture is used as is (same resolution), so the pixels outside the faces are also converted.
+func bakeMaterialTexture(doc *mqo.Document, material int, base image.Image, resolution, dilation int, vertexColor, tint, emission bool) *image.NRGBA {
+	w, h := resolution, resolution
+	if base != nil {
+		w, h = base.Bounds().Dx(), base.Bounds().Dy()
+	} else if !vertexColor {
+		w, h = 16, 16 // flat color
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	if base != nil {
+		draw.Draw(dst, dst.Bounds(), base, base.Bounds().Min, draw.Src)
+	} else {
+		draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	}
+
+	// Vertex colors are rasterized separately to extend them around the UV islands.
+	var colors *image.NRGBA
+	var covered []bool
+	if vertexColor {
+		colors = image.NewNRGBA(dst.Bounds())
+		covered = make([]bool, w*h)
+		for _, obj := range doc.Objects {
+			if !obj.Visible || len(obj.VertexColors) != len(obj.Vertexes) {
+				continue
+			}
+			for _, f := range obj.Faces {
+				if f.Material != material || len(f.UVs) != len(f.Verts) {
+					continue
+				}
+				rasterizeFaceUV(f, w, h, func(x, y int, vs [3]int, b [3]float32) {
+					var c geom.Vector4
+					for j, v := range vs {
+						c = *c.Add(obj.VertexColors[f.Verts[v]].Scale(b[j]))
+					}
+					colors.SetNRGBA(x, y, color.NRGBA{R: toUint8(c.X), G: toUint8(c.Y), B: toUint8(c.Z), A: toUint8(c.W)})
+					covered[y*w+x] = true
+				})
+			}
+		}
+		covered = dilateImage(colors, covered, dilation)
+	}
+
+	mat := doc.Materials[material]
+	factor := [4]float32{1, 1, 1, 1}
+	if tint {
+		factor = [4]float32{mat.Color.X, mat.Color.Y, mat.Color.Z, 1}
+	}
+	var emissive [3]float32
+	if emission {
+		emissive = materialEmission(mat)
+	}
+	for i := 0; i < len(dst.Pix); i += 4 {
+		f := factor
+		if covered != nil && covered[i/4] {
+			for j := range f {
+				f[j] *= float32(colors.Pix[i+j]) / 255
+			}
+		}
+		p := dst.Pix[i : i+4]
+		for j := 0; j < 3; j++ {
+			p[j] = toUint8(linearToSrgb(srgbToLinear(float32(p[j])/255)*f[j] + emissive[j]))
+		}
+		p[3] = toUint8(float32(p[3]) / 255 * f[3])
+	}
+	return dst
+}
+
+// rasterizeFaceUV calls f for the pixels covered by the triangles of the face. UVs are moved to the tile which contains the center of the triangle.
+func rasterizeFaceUV(face *mqo.Face, w, h int, f func(x, y int, verts [3]int, b [3]float32)) {
+	for i := 1; i+1 < len(face.Verts); i++ {
+		tri := [3]int{0, i, i + 1}
+		var center geom.Vector2
+		for _, v := range tri {
+			center.X += face.UVs[v].X / 3
+			center.Y += face.UVs[v].Y / 3
+		}
+		ox, oy := float32(math.Floor(float64(center.X))), float32(math.Floor(float64(center.Y)))
+		var p [3]geom.Vector2
+		for j, v := range tri {
+			p[j] = geom.Vector2{X: (face.UVs[v].X - ox) * float32(w), Y: (face.UVs[v].Y - oy) * float32(h)}
+		}
+		rasterizeTriangle(p[0], p[1], p[2], w, h, func(x, y int, b [3]float32) {
+			f(x, y, tri, b)
+		})
+	}
+}
+
+func saveBakedTexture(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	w, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	return png.Encode(w, img)
+}
@@ -0,0 +1,111 @@
+package converter
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/binzume/modelconv/mqo"
+)
+
+func newTestBakeDocument(materials ...*mqo.Material) *mqo.Document {
+	doc := mqo.NewDocument()
+	doc.Materials = materials
+	for i := range materials {
+		obj := mqo.NewObject("obj")
+		obj.Vertexes = []*mqo.Vector3{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}, {X: 0, Y: 1}}
+		obj.Faces = []*mqo.Face{{Verts: []int{0, 1, 2, 3}, Material: i,
+			UVs: []mqo.Vector2{{X: 0, Y: 1}, {X: 1, Y: 1}, {X: 1, Y: 0}, {X: 0, Y: 0}}}}
+		doc.Objects = append(doc.Objects, obj)
+	}
+	return doc
+}
+
+func TestBakeTexturesNames(t *testing.T) {
+	dir := t.TempDir()
+	red := mqo.Vector4{X: 1, W: 1}
+	doc := newTestBakeDocument(
+		&mqo.Material{Name: "Body", Color: red},
+		&mqo.Material{Name: "body", Color: red},
+		&mqo.Material{Name: "a/b", Color: red},
+	)
+
+	if err := BakeTextures(doc, dir, &TextureBakeOption{Name: "model", MaterialColor: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"saved_textures/model_Body_baked.png", "saved_textures/model_body_2_baked.png", "saved_textures/model_a_b_baked.png"}
+	for i, mat := range doc.Materials {
+		if mat.Texture != expected[i] {
+			t.Errorf("material %d: %v", i, mat.Texture)
+		}
+		if _, err := os.Stat(filepath.Join(dir, mat.Texture)); err != nil {
+			t.Error(err)
+		}
+		if mat.Color != (mqo.Vector4{X: 1, Y: 1, Z: 1, W: 1}) {
+			t.Error("material color is not removed: ", mat.Color)
+		}
+	}
+}
+
+func TestBakeTexturesEmission(t *testing.T) {
+	dir := t.TempDir()
+	lit := &mqo.Material{Name: "lit", Color: mqo.Vector4{X: 0.2, Y: 0.2, Z: 0.2, W: 1}, Emission: 0.1, Shader: mqo.ShaderPhong}
+	unlit := &mqo.Material{Name: "unlit", Color: mqo.Vector4{X: 0.2, Y: 0.2, Z: 0.2, W: 1}, Emission: 0.1, Shader: mqo.ShaderConstant}
+	doc := newTestBakeDocument(lit, unlit)
+
+	// Default option bakes all colors.
+	if err := BakeTextures(doc, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if lit.Emission != 0.1 || unlit.Emission != 0 {
+		t.Error("emission: ", lit.Emission, unlit.Emission)
+	}
+	pixel := func(texture string) uint8 {
+		f, err := os.Open(filepath.Join(dir, texture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		img, err := png.Decode(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, _, _, _ := img.At(0, 0).RGBA()
+		return uint8(r >> 8)
+	}
+	// The material color is multiplied in linear color space.
+	if p := pixel(lit.Texture); p != toUint8(linearToSrgb(0.2)) {
+		t.Error("lit: ", p)
+	}
+	expected := toUint8(linearToSrgb(0.2 + 0.1))
+	if p := pixel(unlit.Texture); p != expected {
+		t.Error("unlit: ", p, expected)
+	}
+}
+
+func TestBakeTexturesGltfUnlit(t *testing.T) {
+	mat := &mqo.Material{Name: "mat", Color: mqo.Vector4{X: 1, Y: 1, Z: 1, W: 1}, Emission: 0.5, Ex2: mqo.NewMaterialEx2(mqo.ShaderNameGlTF)}
+	if materialIsUnlit(mat) {
+		t.Error("glTF shader is lit by default")
+	}
+	mat.Ex2.ShaderParams["Roughness"] = 1.0
+	if !materialIsUnlit(mat) {
+		t.Error("rough dielectric glTF shader is converted to unlit")
+	}
+	mat.Ex2.ShaderParams["Roughness"] = 0.5
+	mat.Ex2.ShaderParams["Extensions.Unlit"] = true
+	if !materialIsUnlit(mat) {
+		t.Error("unlit glTF shader")
+	}
+
+	doc := newTestBakeDocument(mat)
+	if err := BakeTextures(doc, t.TempDir(), &TextureBakeOption{Emission: true}); err != nil {
+		t.Fatal(err)
+	}
+	if mat.Emission != 0 || mat.Texture != "saved_textures/mat_baked.png" {
+		t.Error("emission is not baked: ", mat.Emission, mat.Texture)
+	}
+}
@@ -0,0 +1,294 @@
+package converter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/binzume/modelconv/vrm"
+	"github.com/blezek/tga"
+	"github.com/qmuntal/gltf"
+)
+
+// textureSourceFunc returns the decoded image (img) or the file content to be embedded as is (data).
+type textureSourceFunc func() (img image.Image, data []byte, err error)
+
+// texturePool encodes textures by worker goroutines.
+// Images are written to the document in the order of the requests by flush(), so the output doesn't depend on the scheduling.
+type texturePool struct {
+	sem    chan struct{}
+	budget *memoryBudget
+	webp   bool
+	jobs   []*textureJob
+}
+
+type textureJob struct {
+	texture  uint32 // index of the texture in the document
+	name     string
+	mimeType string
+	data     []byte
+	webp     bool
+	srcBytes int // for logging
+	err      error
+	webpErr  error
+	done     chan struct{}
+}
+
+func newTexturePool(concurrency int, memoryBudget int64, webp bool) *texturePool {
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+	return &texturePool{
+		sem:    make(chan struct{}, concurrency),
+		budget: newMemoryBudget(memoryBudget),
+		webp:   webp,
+	}
+}
+
+// submit runs the source function and encodes the image in a worker goroutine.
+// memory is the estimated size of the decoded images to be held by the job.
+func (p *texturePool) submit(job *textureJob, memory int64, source textureSourceFunc) {
+	job.done = make(chan struct{})
+	p.jobs = append(p.jobs, job)
+	// Acquired by the caller to limit the images captured by the queued jobs too.
+	memory = p.budget.acquire(memory)
+	go func() {
+		defer close(job.done)
+		defer p.budget.release(memory)
+		p.sem <- struct{}{}
+		defer func() { <-p.sem }()
+
+		img, data, err := source()
+		if err != nil {
+			job.err = err
+			return
+		}
+		if data == nil {
+			var buf bytes.Buffer
+			if job.mimeType == "image/jpeg" {
+				err = jpeg.Encode(&buf, img, nil)
+			} else {
+				err = png.Encode(&buf, img)
+			}
+			if err != nil {
+				job.err = err
+				return
+			}
+			data = buf.Bytes()
+		}
+		job.data, job.srcBytes = data, len(data)
+		if p.webp {
+			if img == nil {
+				if img, _, err = image.Decode(bytes.NewReader(data)); err != nil {
+					job.webpErr = err
+					return
+				}
+			}
+			webp, err := encodeWebPLossless(img)
+			if err != nil {
+				job.webpErr = err
+				return
+			}
+			if len(webp) < len(data) {
+				job.data, job.webp = webp, true
+			}
+		}
+	}()
+}
+
+// flush waits for all jobs and writes the images. Textures with identical content share a single image.
+func (p *texturePool) flush(m *mqoToGltf) error {
+	images := map[[sha256.Size]byte]uint32{}
+	failed := map[uint32]bool{}
+	shared, saved := 0, 0
+	for _, job := range p.jobs {
+		<-job.done
+		tex := m.Textures[job.texture]
+		if job.err != nil {
+			log.Print("Texture read error:", job.name, job.err)
+			failed[job.texture] = true
+			continue
+		} else if job.webpErr != nil {
+			log.Print("WebP: ", job.name, ": ", job.webpErr)
+		}
+		sum := sha256.Sum256(job.data)
+		if img, ok := images[sum]; ok {
+			setTextureSource(tex, img, job.webp)
+			shared++
+			saved += len(job.data)
+			job.data = nil
+			continue
+		}
+		if job.webp {
+			img, err := m.writeImage(strings.TrimSuffix(job.name, filepath.Ext(job.name))+".webp", "image/webp", bytes.NewReader(job.data))
+			if err != nil {
+				return err
+			}
+			m.extensions[webpExtension] = true
+			images[sum] = img
+			setTextureSource(tex, img, true)
+			log.Printf("WebP: %v (%d -> %d bytes)", job.name, job.srcBytes, len(job.data))
+		} else {
+			img, err := m.writeImage(job.name, job.mimeType, bytes.NewReader(job.data))
+			if err != nil {
+				return err
+			}
+			images[sum] = img
+			setTextureSource(tex, img, false)
+		}
+		job.data = nil
+	}
+	if shared > 0 {
+		log.Printf("Texture dedup: %d images shared (%d bytes saved)", shared, saved)
+	}
+	p.jobs = nil
+	if len(failed) > 0 {
+		m.removeTextures(failed)
+	}
+	return nil
+}
+
+func setTextureSource(tex *gltf.Texture, img uint32, webp bool) {
+	if webp {
+		tex.Extensions = gltf.Extensions{webpExtension: map[string]interface{}{"source": img}}
+	} else {
+		tex.Source = gltf.Index(img)
+	}
+}
+
+// removeTextures removes the textures and the references from the materials.
+func (m *mqoToGltf) removeTextures(removed map[uint32]bool) {
+	indices := make([]uint32, len(m.Textures))
+	textures := m.Textures[:0]
+	for i, tex := range m.Textures {
+		indices[i] = uint32(len(textures))
+		if !removed[uint32(i)] {
+			textures = append(textures, tex)
+		}
+	}
+	m.Textures = textures
+
+	for _, mat := range m.Materials {
+		if pbr := mat.PBRMetallicRoughness; pbr != nil {
+			if t := pbr.BaseColorTexture; t != nil {
+				if removed[t.Index] {
+					pbr.BaseColorTexture = nil
+				} else {
+					t.Index = indices[t.Index]
+				}
+			}
+			if t := pbr.MetallicRoughnessTexture; t != nil {
+				if removed[t.Index] {
+					pbr.MetallicRoughnessTexture = nil
+				} else {
+					t.Index = indices[t.Index]
+				}
+			}
+		}
+		if t := mat.EmissiveTexture; t != nil {
+			if removed[t.Index] {
+				mat.EmissiveTexture = nil
+			} else {
+				t.Index = indices[t.Index]
+			}
+		}
+		if t := mat.NormalTexture; t != nil && t.Index != nil {
+			if removed[*t.Index] {
+				mat.NormalTexture = nil
+			} else {
+				t.Index = gltf.Index(indices[*t.Index])
+			}
+		}
+		if t := mat.OcclusionTexture; t != nil && t.Index != nil {
+			if removed[*t.Index] {
+				mat.OcclusionTexture = nil
+			} else {
+				t.Index = gltf.Index(indices[*t.Index])
+			}
+		}
+		// KHR_materials_* extensions
+		for _, ext := range mat.Extensions {
+			props, ok := ext.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for name, v := range props {
+				if t, ok := v.(*gltf.TextureInfo); ok {
+					if removed[t.Index] {
+						delete(props, name)
+					} else {
+						t.Index = indices[t.Index]
+					}
+				}
+			}
+		}
+	}
+	if ext, ok := m.Document.Extensions[vrm.ExtensionName].(*vrm.VRM); ok {
+		for _, mp := range ext.MaterialProperties {
+			for name, index := range mp.TextureProperties {
+				if removed[index] {
+					delete(mp.TextureProperties, name)
+				} else {
+					mp.TextureProperties[name] = indices[index]
+				}
+			}
+		}
+	}
+}
+
+// memoryBudget limits the total size of the decoded images held by the texture jobs.
+type memoryBudget struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int64
+	used  int64
+}
+
+func newMemoryBudget(limit int64) *memoryBudget {
+	b := &memoryBudget{limit: limit}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire blocks until the memory is available. Requests larger than the limit are clamped.
+func (b *memoryBudget) acquire(n int64) int64 {
+	if n > b.limit {
+		n = b.limit
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.used+n > b.limit {
+		b.cond.Wait()
+	}
+	b.used += n
+	return n
+}
+
+func (b *memoryBudget) release(n int64) {
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// imageBytes returns the approximate memory size of the decoded image.
+func imageBytes(width, height int) int64 {
+	return int64(width) * int64(height) * 4
+}
+
+// decodeImageConfig returns the size of the image file without decoding pixels.
+func decodeImageConfig(r io.Reader, name string) (image.Config, error) {
+	if strings.ToLower(filepath.Ext(name)) == ".tga" {
+		return tga.DecodeConfig(r)
+	}
+	cfg, _, err := image.DecodeConfig(r)
+	return cfg, err
+}
@@ -0,0 +1,144 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"testing"
+	"time"
+
+	"github.com/binzume/modelconv/vrm"
+	"github.com/qmuntal/gltf"
+)
+
+func newTestTextureConverter(concurrency int) *mqoToGltf {
+	m := &mqoToGltf{Document: gltf.NewDocument(), extensions: map[string]bool{}}
+	m.Buffers = append(m.Buffers, &gltf.Buffer{})
+	m.textureJobs = newTexturePool(concurrency, 1<<30, false)
+	return m
+}
+
+func TestMemoryBudget(t *testing.T) {
+	b := newMemoryBudget(100)
+	if n := b.acquire(60); n != 60 {
+		t.Fatal(n)
+	}
+
+	acquired := make(chan int64)
+	go func() { acquired <- b.acquire(60) }()
+	select {
+	case <-acquired:
+		t.Fatal("acquire should block until the memory is released")
+	case <-time.After(50 * time.Millisecond):
+	}
+	b.release(60)
+	select {
+	case n := <-acquired:
+		b.release(n)
+	case <-time.After(5 * time.Second):
+		t.Fatal("acquire is not unblocked")
+	}
+
+	// Larger requests are clamped not to block forever.
+	if n := b.acquire(1000); n != 100 {
+		t.Error(n)
+	}
+}
+
+func TestTexturePoolOrder(t *testing.T) {
+	const n = 4
+	m := newTestTextureConverter(n)
+
+	// The jobs finish in the reverse order.
+	gates := make([]chan struct{}, n)
+	for i := range gates {
+		gates[i] = make(chan struct{})
+	}
+	close(gates[n-1])
+	for i := 0; i < n; i++ {
+		i := i
+		m.writeTexture(fmt.Sprintf("tex%d.png", i), "image/png", 0, func() (image.Image, []byte, error) {
+			<-gates[i]
+			if i > 0 {
+				close(gates[i-1])
+			}
+			return nil, []byte(fmt.Sprintf("data%d", i)), nil
+		})
+	}
+	if err := m.textureJobs.flush(m); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Images) != n {
+		t.Fatal(len(m.Images))
+	}
+	for i, img := range m.Images {
+		if img.Name != fmt.Sprintf("tex%d.png", i) {
+			t.Errorf("image %d: %v", i, img.Name)
+		}
+		if src := m.Textures[i].Source; src == nil || *src != uint32(i) {
+			t.Errorf("texture %d: %v", i, src)
+		}
+	}
+}
+
+func TestTexturePoolDropFailed(t *testing.T) {
+	m := newTestTextureConverter(2)
+	for i := 0; i < 3; i++ {
+		i := i
+		m.writeTexture(fmt.Sprintf("tex%d.png", i), "image/png", 0, func() (image.Image, []byte, error) {
+			if i == 1 {
+				return nil, nil, errors.New("broken")
+			}
+			return nil, []byte(fmt.Sprintf("data%d", i)), nil
+		})
+	}
+	m.Materials = append(m.Materials, &gltf.Material{
+		PBRMetallicRoughness: &gltf.PBRMetallicRoughness{BaseColorTexture: &gltf.TextureInfo{Index: 0}},
+		NormalTexture:        &gltf.NormalTexture{Index: gltf.Index(1)},
+		EmissiveTexture:      &gltf.TextureInfo{Index: 2},
+		Extensions: gltf.Extensions{
+			"KHR_materials_clearcoat": map[string]interface{}{
+				"clearcoatFactor":           1.0,
+				"clearcoatTexture":          &gltf.TextureInfo{Index: 2},
+				"clearcoatRoughnessTexture": &gltf.TextureInfo{Index: 1},
+			},
+			"KHR_materials_unlit": map[string]string{},
+		},
+	})
+	mp := vrm.NewMaterialProperty("mat")
+	mp.TextureProperties["_MainTex"] = 0
+	mp.TextureProperties["_BumpMap"] = 1
+	mp.TextureProperties["_EmissionMap"] = 2
+	ext := vrm.NewVRM()
+	ext.MaterialProperties = append(ext.MaterialProperties, mp)
+	m.Document.Extensions = gltf.Extensions{vrm.ExtensionName: ext}
+
+	if err := m.textureJobs.flush(m); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Textures) != 2 || len(m.Images) != 2 {
+		t.Fatalf("textures: %d images: %d", len(m.Textures), len(m.Images))
+	}
+	mat := m.Materials[0]
+	if mat.PBRMetallicRoughness.BaseColorTexture.Index != 0 {
+		t.Error("base color", mat.PBRMetallicRoughness.BaseColorTexture.Index)
+	}
+	if mat.NormalTexture != nil {
+		t.Error("the failed texture should be dropped")
+	}
+	if mat.EmissiveTexture.Index != 1 {
+		t.Error("emissive", mat.EmissiveTexture.Index)
+	}
+	clearcoat := mat.Extensions["KHR_materials_clearcoat"].(map[string]interface{})
+	if tex, ok := clearcoat["clearcoatTexture"].(*gltf.TextureInfo); !ok || tex.Index != 1 {
+		t.Error("clearcoat texture", clearcoat["clearcoatTexture"])
+	}
+	if _, ok := clearcoat["clearcoatRoughnessTexture"]; ok || clearcoat["clearcoatFactor"] != 1.0 {
+		t.Error("clearcoat", clearcoat)
+	}
+	if _, ok := mp.TextureProperties["_BumpMap"]; ok || mp.TextureProperties["_EmissionMap"] != 1 {
+		t.Error("texture properties", mp.TextureProperties)
+	}
+}
@@ -2,6 +2,7 @@ package converter
 
 import (
 	"fmt"
+	"image"
 	"io"
 	"log"
 	"os"
@@ -18,6 +19,21 @@ type UnityToMQOOption struct {
 	SaveTexrure    bool
 	ConvertScale   float32
 	ConvertPhysics bool
+
+	// Keep texture tiling as material parameter (KHR_texture_transform) instead of modifying UVs.
+	TextureTransform bool
+
+	// Max vertices per side of the terrain mesh. (0: heightmap resolution)
+	TerrainResolution int
+
+	// Convert only LOD0 of LODGroups instead of MSFT_lod.
+	HighestLODOnly bool
+
+	// Bake lightmaps into the textures of the static objects. (unlit)
+	BakeLightmap bool
+
+	// Aspect ratio of the screen for the cameras. The screen size is not saved in the scene. Default: 16/9
+	ScreenAspectRatio float32
 }
 
 type UnityToMQOConverter struct {
@@ -26,14 +42,34 @@ type UnityToMQOConverter struct {
 
 type unityToMqoState struct {
 	UnityToMQOOption
-	src *unity.Scene
-	dst *mqo.Document
-	mat map[string]struct {
-		index   int
-		uvScale *geom.Vector2
-	}
+	src       *unity.Scene
+	dst       *mqo.Document
+	mat       map[string]*unityMaterial
 	matToGUID map[int]string
 
+	bones           []*mqo.Bone
+	boneTransforms  []*unity.Transform
+	boneByTransform map[*unity.Transform]*mqo.Bone
+	bindPositions   map[*mqo.Bone]*geom.Vector3
+	worldTransforms map[*unity.Transform]*geom.Matrix4
+	rootTransform   *geom.Matrix4
+
+	animations         []*unityAnimation
+	animatedTransforms map[*unity.Transform]bool
+	activeAnimated     map[*unity.Transform]bool
+	animatedObjects    map[*unity.Transform]*mqo.Object
+
+	lodGroups    []*unityLODGroup
+	lodRenderers map[unity.Element]*unityLODLevel
+
+	lightmapSettings *unity.LightmapSettings
+	lightmaps        map[int]image.Image
+	lightmapErr      error
+	materialImages   map[string]image.Image
+
+	prefabScenes  map[string]*unity.Scene
+	treeTemplates map[string]*terrainTreeTemplate
+
 	// TODL: LRU cache
 	lastFbx   *fbx.Document
 	lastFbxID string
@@ -53,154 +89,136 @@ func NewUnityToMQOConverter(options *UnityToMQOOption) *UnityToMQOConverter {
 
 func (conv *UnityToMQOConverter) Convert(secne *unity.Scene) (*mqo.Document, error) {
 	state := unityToMqoState{
-		UnityToMQOOption: *conv.options,
-		src:              secne,
-		dst:              mqo.NewDocument(),
-		mat: map[string]struct {
-			index   int
-			uvScale *geom.Vector2
-		}{},
-		matToGUID: map[int]string{},
+		UnityToMQOOption:   *conv.options,
+		src:                secne,
+		dst:                mqo.NewDocument(),
+		mat:                map[string]*unityMaterial{},
+		matToGUID:          map[int]string{},
+		boneByTransform:    map[*unity.Transform]*mqo.Bone{},
+		bindPositions:      map[*mqo.Bone]*geom.Vector3{},
+		worldTransforms:    map[*unity.Transform]*geom.Matrix4{},
+		animatedTransforms: map[*unity.Transform]bool{},
+		activeAnimated:     map[*unity.Transform]bool{},
+		animatedObjects:    map[*unity.Transform]*mqo.Object{},
+		lodRenderers:       map[unity.Element]*unityLODLevel{},
+		lightmaps:          map[int]image.Image{},
+		materialImages:     map[string]image.Image{},
+		prefabScenes:       map[string]*unity.Scene{},
+		treeTemplates:      map[string]*terrainTreeTemplate{},
 	}
 
 	s := state.ConvertScale
 	transform := geom.NewScaleMatrix4(s, s, s)
+	state.rootTransform = transform
 	for _, o := range secne.Objects {
 		state.convertObject(o, 0, transform, true)
 	}
 
+	if len(state.bones) > 0 {
+		for i, b := range state.bones {
+			if pos, ok := state.bindPositions[b]; ok {
+				b.Pos.Vector3 = *pos
+				continue
+			}
+			tr := state.boneTransforms[i]
+			m := state.worldTransforms[tr]
+			if m == nil {
+				m = transform.Mul(tr.GetWorldMatrix())
+			}
+			b.Pos.Vector3 = *m.ApplyTo(&geom.Vector3{})
+		}
+		mqo.GetBonePlugin(state.dst).SetBones(state.bones)
+	}
+	state.convertAnimations()
+	state.setLODs()
+
 	if len(state.dst.Materials) == 0 {
 		state.dst.Materials = append(state.dst.Materials, &mqo.Material{Name: "dummy", Color: geom.Vector4{X: 1, Y: 1, Z: 1, W: 1}})
 	}
 
+	if state.lightmapErr != nil {
+		return state.dst, fmt.Errorf("can not bake lightmaps: %w", state.lightmapErr)
+	}
 	return state.dst, nil
 }
 
 func (c *unityToMqoState) convertObject(o *unity.GameObject, d int, parentTransform *geom.Matrix4, active bool) {
 	dst := c.dst
 	obj := mqo.NewObject(o.Name)
-	active = active && o.IsActive != 0
+	tr := o.GetTransform()
+	// Objects activated by animations are converted as active.
+	active = active && (o.IsActive != 0 || c.activeAnimated[tr])
 	dst.Objects = append(dst.Objects, obj)
 	obj.UID = len(dst.Objects)
 	obj.Depth = d
 	obj.Visible = active
 
-	tr := o.GetTransform()
 	if tr == nil {
 		return
 	}
+	c.loadAnimations(o, tr)
 	obj.Translation = geom.NewVector3(tr.LocalPosition.X, tr.LocalPosition.Y, -tr.LocalPosition.Z).Scale(c.ConvertScale)
 	obj.Scale = &tr.LocalScale
 	obj.SetRotation(geom.NewQuaternion(-tr.LocalRotation.X, -tr.LocalRotation.Y, tr.LocalRotation.Z, tr.LocalRotation.W))
 
 	transform := parentTransform.Mul(tr.GetMatrix())
 
+	c.worldTransforms[tr] = transform
+	if c.animatedTransforms[tr] || c.activeAnimated[tr] {
+		// The pivot of the node animation.
+		c.animatedObjects[tr] = obj
+		obj.InternalTransform = unscaledTransform(transform)
+	}
+
+	var lodGroup *unity.LODGroup
+	if o.GetComponent(&lodGroup) && lodGroup.Enabled != 0 {
+		c.registerLODGroup(o, lodGroup)
+	}
+
 	var meshFilter *unity.MeshFilter
 	var meshRenderer *unity.MeshRenderer
+	var skinnedMeshRenderer *unity.SkinnedMeshRenderer
 	if o.GetComponent(&meshFilter) && o.GetComponent(&meshRenderer) && meshFilter.Mesh.IsValid() {
-		var materials []int
-		for _, materialRef := range meshRenderer.Materials {
-			matGUID := materialRef.GUID
-			if m, ok := c.mat[matGUID]; ok {
-				materials = append(materials, m.index)
-				continue
-			}
-			mat := struct {
-				index   int
-				uvScale *geom.Vector2
-			}{len(dst.Materials), nil}
-			c.matToGUID[len(dst.Materials)] = matGUID
-			materials = append(materials, mat.index)
-			m := &mqo.Material{Name: matGUID, Color: geom.Vector4{X: 1, Y: 1, Z: 1, W: 1}, Diffuse: 0.8}
-			material, err := unity.LoadMaterial(o.Scene.Assets, matGUID)
-			if matGUID == "0000000000000000f000000000000000" {
-				m.Name = "UnityDefaultMaterial"
-			}
-			if err == nil {
-				if c := material.GetColorProperty("_Color"); c != nil {
-					m.Color = geom.Vector4{X: c.R, Y: c.G, Z: c.B, W: c.A}
-				}
-				if c := material.GetColorProperty("_EmissionColor"); c != nil {
-					emmision := &geom.Vector3{X: c.R, Y: c.G, Z: c.B}
-					if emmision.Len() > 0 {
-						m.EmissionColor = emmision
-					}
-				}
-				m.Name = material.Name
-
-				if t := material.GetTextureProperty("_MainTex"); t != nil && t.Texture.IsValid() {
-					texAsset := c.src.Assets.GetAsset(t.Texture.GUID)
-					if c.SaveTexrure && texAsset != nil {
-						m.Texture, err = c.saveTexrure(c.src.Assets, texAsset)
-						if err != nil {
-							log.Println(err)
-						}
-					}
-					mat.uvScale = &t.Scale
-				}
-				if t := material.GetTextureProperty("_BumpMap"); t != nil && t.Texture.IsValid() {
-					texAsset := c.src.Assets.GetAsset(t.Texture.GUID)
-					if c.SaveTexrure && texAsset != nil {
-						m.BumpTexture, err = c.saveTexrure(c.src.Assets, texAsset)
-						if err != nil {
-							log.Println(err)
-						}
-					}
+		materials := c.convertMaterials(o, meshRenderer.Materials)
+		meshObjectIndex := len(c.dst.Objects)
+		visible := active && meshRenderer.Enabled != 0 && c.addLODObject(meshRenderer, obj)
+		c.convertMesh(o, obj, meshFilter.Mesh, materials, transform, nil, visible)
+		if c.BakeLightmap && c.SaveTexrure {
+			// Imported FBX meshes are added as child objects with their lightmap UVs.
+			for _, mo := range c.dst.Objects[meshObjectIndex-1:] {
+				if _, ok := mo.Extra["lightmapUVs"]; mo == obj || ok {
+					c.bakeLightmap(o, meshRenderer, meshFilter.Mesh, mo)
 				}
 			}
-			dst.Materials = append(dst.Materials, m)
-			c.mat[matGUID] = mat
 		}
-
-		meshObjectIndex := len(dst.Objects)
-		if vs, faces, uvs, name := unity.GetBuiltinMesh(meshFilter.Mesh); name != "" {
-			meshObjectIndex--
-			mat := 0
-			if len(materials) > 0 {
-				mat = materials[0]
-			}
-			obj.Name += "(" + name + ")"
-			AddGeometry(obj, transform, mat, vs, faces, uvs)
-		} else {
-			err := c.importMesh(meshFilter.Mesh, obj, materials, transform)
-			if err != nil {
-				log.Println("Can not import mesh: ", obj.Name, err)
+	} else if o.GetComponent(&skinnedMeshRenderer) && skinnedMeshRenderer.Mesh.IsValid() {
+		materials := c.convertMaterials(o, skinnedMeshRenderer.Materials)
+		root := o.Scene.GetTransform(skinnedMeshRenderer.RootBone, skinnedMeshRenderer.PrefabInstance)
+		bones := make([]*mqo.Bone, len(skinnedMeshRenderer.Bones))
+		for i, ref := range skinnedMeshRenderer.Bones {
+			if boneTr := o.Scene.GetTransform(ref, skinnedMeshRenderer.PrefabInstance); boneTr != nil {
+				bones[i] = c.getBone(boneTr, root)
 			}
 		}
-		for meshObjectIndex < len(dst.Objects) {
-			obj := dst.Objects[meshObjectIndex]
-			obj.Visible = active && meshRenderer.Enabled != 0
-			for _, face := range obj.Faces {
-				scale := c.mat[c.matToGUID[face.Material]].uvScale
-				if scale != nil {
-					for i := range face.UVs {
-						face.UVs[i].X *= scale.X
-						face.UVs[i].Y *= scale.Y
-					}
-				}
-			}
-			meshObjectIndex++
-		}
+		meshObjectIndex := len(c.dst.Objects)
+		visible := active && skinnedMeshRenderer.Enabled != 0 && c.addLODObject(skinnedMeshRenderer, obj)
+		c.convertMesh(o, obj, skinnedMeshRenderer.Mesh, materials, transform, bones, visible)
+		c.applyBlendShapeWeights(c.dst.Objects[meshObjectIndex-1:], skinnedMeshRenderer.BlendShapeWeights)
+	}
+
+	var terrain *unity.Terrain
+	if o.GetComponent(&terrain) {
+		c.convertTerrain(obj, terrain, transform, active)
 	}
 
 	var light *unity.Light
-	if o.GetComponent(&light) {
-		t := "spot"
-		if light.Type == 1 {
-			t = "directional"
-		} else if light.Type == 2 {
-			t = "point"
-		}
-		c := light.Color.Array()
-		obj.Extra["light"] = map[string]interface{}{
-			"type":           t,
-			"color":          c[0:3],
-			"intensity":      light.Intensity,
-			"range":          light.Range,
-			"outerConeAngle": light.SpotAngle,
-			"innerConeAngle": light.InnerSpotAngle,
-		}
-		obj.InternalTransform = transform
+	if o.GetComponent(&light) && light.Enabled != 0 && active {
+		c.convertLight(o, obj, light, transform)
+	}
+
+	var camera *unity.Camera
+	if o.GetComponent(&camera) && camera.Enabled != 0 && active {
+		c.convertCamera(obj, camera, transform)
 	}
 
 	if c.ConvertPhysics {
@@ -217,6 +235,150 @@ func (c *unityToMqoState) convertObject(o *unity.GameObject, d int, parentTransf
 	}
 }
 
+func (c *unityToMqoState) convertMaterials(o *unity.GameObject, materialRefs []*unity.Ref) []int {
+	dst := c.dst
+	var materials []int
+	for _, materialRef := range materialRefs {
+		matGUID := materialRef.GUID
+		if m, ok := c.mat[matGUID]; ok {
+			materials = append(materials, m.index)
+			continue
+		}
+		mat := &unityMaterial{index: len(dst.Materials)}
+		c.matToGUID[len(dst.Materials)] = matGUID
+		materials = append(materials, mat.index)
+		m := &mqo.Material{Name: matGUID, Color: geom.Vector4{X: 1, Y: 1, Z: 1, W: 1}, Diffuse: 0.8}
+		material, err := unity.LoadMaterial(o.Scene.Assets, matGUID)
+		if matGUID == "0000000000000000f000000000000000" {
+			m.Name = "UnityDefaultMaterial"
+		}
+		if err == nil {
+			m = c.convertMaterial(material, matGUID, mat)
+		}
+		dst.Materials = append(dst.Materials, m)
+		c.mat[matGUID] = mat
+	}
+	return materials
+}
+
+func (c *unityToMqoState) convertMesh(o *unity.GameObject, obj *mqo.Object, mesh *unity.Ref, materials []int, transform *geom.Matrix4, bones []*mqo.Bone, visible bool) {
+	dst := c.dst
+	meshObjectIndex := len(dst.Objects)
+	if vs, faces, uvs, name := unity.GetBuiltinMesh(mesh); name != "" {
+		meshObjectIndex--
+		mat := 0
+		if len(materials) > 0 {
+			mat = materials[0]
+		}
+		obj.Name += "(" + name + ")"
+		AddGeometry(obj, transform, mat, vs, faces, uvs)
+	} else if nativeMesh, err := c.loadNativeMesh(o, mesh); nativeMesh != nil || err != nil {
+		meshObjectIndex--
+		if err == nil {
+			err = c.addNativeMesh(obj, nativeMesh, materials, transform, bones)
+		}
+		if err != nil {
+			log.Println("Can not import mesh: ", obj.Name, err)
+		}
+	} else {
+		err := c.importMesh(mesh, obj, materials, transform, bones)
+		if err != nil {
+			log.Println("Can not import mesh: ", obj.Name, err)
+		}
+	}
+	for meshObjectIndex < len(dst.Objects) {
+		obj := dst.Objects[meshObjectIndex]
+		obj.Visible = obj.Visible && visible
+		for _, face := range obj.Faces {
+			mat := c.mat[c.matToGUID[face.Material]]
+			if mat != nil && mat.uvScale != nil {
+				for i := range face.UVs {
+					// Unity: origin is bottom-left
+					face.UVs[i].X = face.UVs[i].X*mat.uvScale.X + mat.uvOffset.X
+					face.UVs[i].Y = 1 - (1-face.UVs[i].Y)*mat.uvScale.Y - mat.uvOffset.Y
+				}
+			}
+		}
+		meshObjectIndex++
+	}
+}
+
+// getBone returns a bone for the transform. Ancestors under the root bone are also converted to bones.
+func (c *unityToMqoState) getBone(tr *unity.Transform, root *unity.Transform) *mqo.Bone {
+	if b, ok := c.boneByTransform[tr]; ok {
+		return b
+	}
+	parentID := 0
+	if parent := tr.GetParent(); parent != nil && tr != root {
+		if b, ok := c.boneByTransform[parent]; ok {
+			parentID = b.ID
+		} else if isDescendantTransform(parent, root) {
+			parentID = c.getBone(parent, root).ID
+		}
+	}
+	name := ""
+	if o := tr.GetGameObject(); o != nil {
+		name = o.Name
+	}
+	b := &mqo.Bone{
+		ID:     len(c.bones) + 1,
+		Name:   name,
+		Parent: parentID,
+	}
+	c.bones = append(c.bones, b)
+	c.boneTransforms = append(c.boneTransforms, tr)
+	c.boneByTransform[tr] = b
+	return b
+}
+
+func transformPath(tr *unity.Transform) string {
+	var names []string
+	for ; tr != nil; tr = tr.GetParent() {
+		name := ""
+		if o := tr.GetGameObject(); o != nil {
+			name = o.Name
+		}
+		names = append([]string{name}, names...)
+	}
+	return strings.Join(names, "/")
+}
+
+func isDescendantTransform(tr *unity.Transform, root *unity.Transform) bool {
+	if root == nil {
+		return false
+	}
+	for ; tr != nil; tr = tr.GetParent() {
+		if tr == root {
+			return true
+		}
+	}
+	return false
+}
+
+// applyBlendShapeWeights sets m_BlendShapeWeights (0-100) to the morph target objects as the default weights.
+// objs are the objects converted for the renderer. The weights are in the order of the blend shapes of the mesh.
+// The base mesh is not modified.
+func (c *unityToMqoState) applyBlendShapeWeights(objs []*mqo.Object, weights []float32) {
+	var names []string
+	targets := map[string]*mqo.Object{}
+	for _, o := range objs {
+		name, ok := o.Extra["blendShapeName"].(string)
+		if !ok {
+			continue
+		}
+		if _, exists := targets[name]; !exists {
+			names = append(names, name)
+		}
+		// The last shape of the blend shape is the full weight. In-between shapes are ignored.
+		targets[name] = o
+	}
+	for i, name := range names {
+		if i < len(weights) && weights[i] != 0 {
+			targets[name].Extra["morphWeight"] = weights[i] / 100
+		}
+	}
+}
+
 func (c *unityToMqoState) convertRigidBody(o *unity.GameObject, transform *geom.Matrix4, obj *mqo.Object) {
 	var shapes []*mqo.PhysicsShape
 	scale := c.ConvertScale
@@ -324,7 +486,129 @@ func (c *unityToMqoState) saveTexrure(assets unity.Assets, texAsset *unity.Asset
 	return texName, err
 }
 
-func (c *unityToMqoState) importMesh(mesh *unity.Ref, obj *mqo.Object, materials []int, transform *geom.Matrix4) error {
+func (c *unityToMqoState) loadNativeMesh(o *unity.GameObject, mesh *unity.Ref) (*unity.Mesh, error) {
+	if m, ok := o.Scene.GetElement2(mesh, o.PrefabInstance).(*unity.Mesh); ok {
+		return m, nil
+	}
+	asset := c.src.Assets.GetAsset(mesh.GUID)
+	if asset != nil && (strings.HasSuffix(asset.Path, ".asset") || strings.HasSuffix(asset.Path, ".mesh")) {
+		return unity.LoadMesh(c.src.Assets, mesh)
+	}
+	return nil, nil
+}
+
+func (c *unityToMqoState) addNativeMesh(obj *mqo.Object, mesh *unity.Mesh, materials []int, transform *geom.Matrix4, bones []*mqo.Bone) error {
+	indices, err := mesh.GetIndices()
+	if err != nil {
+		return err
+	}
+	positions, err := mesh.GetVertexAttribute(unity.VertexChannelPosition)
+	if err != nil {
+		return err
+	}
+	normals, _ := mesh.GetVertexAttribute(unity.VertexChannelNormal)
+	colors, _ := mesh.GetVertexAttribute(unity.VertexChannelColor)
+	uvs, _ := mesh.GetVertexAttribute(unity.VertexChannelTexCoord0)
+	log.Println("Import mesh:", mesh.Name, len(positions))
+
+	obj.Name += "(Mesh)"
+	voffset := len(obj.Vertexes)
+	for _, p := range positions {
+		obj.Vertexes = append(obj.Vertexes, transform.ApplyTo(&geom.Vector3{X: p[0], Y: p[1], Z: -p[2]}))
+	}
+	if len(colors) == len(positions) && voffset == 0 {
+		for _, col := range colors {
+			v := geom.Vector4{X: 1, Y: 1, Z: 1, W: 1}
+			v.X, v.Y, v.Z = col[0], col[1], col[2]
+			if len(col) > 3 {
+				v.W = col[3]
+			}
+			obj.VertexColors = append(obj.VertexColors, v)
+		}
+	}
+	normalTransform := transform.Clone()
+	normalTransform[12], normalTransform[13], normalTransform[14] = 0, 0, 0
+	normalTransform = normalTransform.Inverse().Transposed()
+	for n := range mesh.SubMeshes {
+		mat := 0
+		if n < len(materials) {
+			mat = materials[n]
+		} else if len(materials) > 0 {
+			mat = materials[len(materials)-1]
+		}
+	faceLoop:
+		for _, f := range mesh.GetSubMeshFaces(indices, n) {
+			face := &mqo.Face{Material: mat}
+			// Unity: left-handed
+			for i := len(f) - 1; i >= 0; i-- {
+				vi := f[i]
+				if vi >= len(positions) {
+					continue faceLoop
+				}
+				face.Verts = append(face.Verts, vi+voffset)
+				if len(uvs) == len(positions) && len(uvs[vi]) >= 2 {
+					face.UVs = append(face.UVs, geom.Vector2{X: uvs[vi][0], Y: 1 - uvs[vi][1]})
+				}
+				if len(normals) == len(positions) {
+					n := &geom.Vector3{X: normals[vi][0], Y: normals[vi][1], Z: -normals[vi][2]}
+					face.Normals = append(face.Normals, normalTransform.ApplyTo(n).Normalize())
+				}
+			}
+			obj.Faces = append(obj.Faces, face)
+		}
+	}
+
+	if len(bones) > 0 && len(mesh.BindPose) == len(bones) {
+		// Rest pose of the bones: mesh transform * inverse(bind pose)
+		flip := geom.NewScaleMatrix4(1, 1, -1)
+		for i, b := range bones {
+			if b != nil {
+				bindPose := flip.Mul(mesh.BindPose[i].Matrix()).Mul(flip)
+				c.bindPositions[b] = transform.Mul(bindPose.Inverse()).ApplyTo(&geom.Vector3{})
+			}
+		}
+	}
+	if len(bones) > 0 {
+		boneIndices, weights, err := mesh.GetBoneWeights()
+		if err != nil {
+			log.Println("Can not read bone weights: ", obj.Name, err)
+		}
+		for v := range weights {
+			for i, w := range weights[v] {
+				if b := boneIndices[v][i]; w > 0 && b < len(bones) && bones[b] != nil {
+					bones[b].SetVertexWeight(obj.UID, v+voffset+1, w*100)
+				}
+			}
+		}
+	}
+
+	shapes := mesh.GetBlendShapes()
+	if len(shapes) > 0 {
+		morphPlugin := mqo.GetMorphPlugin(c.dst)
+		var morphTargets mqo.MorphTargetList
+		morphPlugin.MorphSet.Targets = append(morphPlugin.MorphSet.Targets, &morphTargets)
+		morphTargets.Base = obj.Name
+		for _, shape := range shapes {
+			o := obj.Clone()
+			o.Name = shape.Name
+			for i, idx := range shape.Indices {
+				if idx < len(positions) {
+					p := positions[idx]
+					d := shape.Deltas[i]
+					o.Vertexes[voffset+idx] = transform.ApplyTo(&geom.Vector3{X: p[0] + d.X, Y: p[1] + d.Y, Z: -p[2] - d.Z})
+				}
+			}
+			c.dst.Objects = append(c.dst.Objects, o)
+			o.UID = len(c.dst.Objects)
+			o.Depth = obj.Depth + 1
+			o.Visible = false
+			morphTargets.Target = append(morphTargets.Target, &mqo.MorphTarget{Name: o.Name})
+		}
+	}
+	return nil
+}
+
+func (c *unityToMqoState) importMesh(mesh *unity.Ref, obj *mqo.Object, materials []int, transform *geom.Matrix4, bones []*mqo.Bone) error {
 	asset := c.src.Assets.GetAsset(mesh.GUID)
 	if asset == nil {
 		return fmt.Errorf("asset not found %s", mesh.GUID)
@@ -334,6 +618,9 @@ func (c *unityToMqoState) importMesh(mesh *unity.Ref, obj *mqo.Object, materials
 		return err
 	}
 	log.Println("Import mesh:", asset, meta.GetRecycleNameByFileID(mesh.FileID))
+	if c.BakeLightmap && meta.ModelImporter != nil && meta.ModelImporter.Meshes.GenerateSecondaryUV != 0 {
+		log.Println("WARN: Lightmap UVs generated by Unity are not supported. UVs in the FBX are used: ", asset.Path)
+	}
 
 	if c.lastFbxID != mesh.GUID { // TODO
 		if !strings.HasSuffix(asset.Path, ".fbx") {
@@ -354,6 +641,20 @@ func (c *unityToMqoState) importMesh(mesh *unity.Ref, obj *mqo.Object, materials
 	}
 	doc := c.lastFbx
 
+	var boneMap map[string]*mqo.Bone
+	if bones != nil {
+		// Bone names are not unique. Bones are matched by the path of the transforms.
+		boneMap = map[string]*mqo.Bone{}
+		for tr, b := range c.boneByTransform {
+			for _, bone := range bones {
+				if bone == b {
+					boneMap[transformPath(tr)] = b
+					break
+				}
+			}
+		}
+	}
+
 	obj.Name += "(FBX)"
 	objectIdx := len(c.dst.Objects)
 	scale := doc.GlobalSettings.GetProperty("UnitScaleFactor").ToFloat32(1) * 0.01
@@ -362,8 +663,11 @@ func (c *unityToMqoState) importMesh(mesh *unity.Ref, obj *mqo.Object, materials
 		TargetModelName:  meta.GetRecycleNameByFileID(mesh.FileID),
 		MaterialOverride: materials,
 		RootTransform:    transform.Mul(geom.NewScaleMatrix4(-scale, scale, -scale)),
+		DisableBone:      bones == nil,
+		BoneMap:          boneMap,
+		LightmapUVs:      c.BakeLightmap,
 	}).ConvertTo(c.dst, doc)
-	if len(c.dst.Objects) == objectIdx+1 {
+	if len(c.dst.Objects) == objectIdx+1 && bones == nil {
 		c.dst.Objects[objectIdx].Extra["sharedGeometryKey"] = mesh.GUID + fmt.Sprint(mesh.FileID)
 		c.dst.Objects[objectIdx].InternalTransform = transform
 	}
@@ -0,0 +1,119 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/binzume/modelconv/fbx"
+	"github.com/binzume/modelconv/geom"
+	"github.com/binzume/modelconv/mqo"
+	"github.com/binzume/modelconv/unity"
+)
+
+func TestFindBoneByPathDuplicatedNames(t *testing.T) {
+	root := fbx.NewModel("RootNode", "Null")
+	armature := fbx.NewModel("Armature", "Null")
+	armature.Parent = root
+	left := fbx.NewModel("LeftArm", "LimbNode")
+	left.Parent = armature
+	right := fbx.NewModel("RightArm", "LimbNode")
+	right.Parent = armature
+	leftHand := fbx.NewModel("Hand", "LimbNode")
+	leftHand.Parent = left
+	rightHand := fbx.NewModel("Hand", "LimbNode")
+	rightHand.Parent = right
+
+	if p := fbxModelPath(rightHand, root); p != "Armature/RightArm/Hand" {
+		t.Fatal("path: ", p)
+	}
+
+	leftBone := &mqo.Bone{ID: 1, Name: "Hand"}
+	rightBone := &mqo.Bone{ID: 2, Name: "Hand"}
+	bones := map[string]*mqo.Bone{
+		"Scene/Character/Armature/LeftArm/Hand":  leftBone,
+		"Scene/Character/Armature/RightArm/Hand": rightBone,
+	}
+	if b := findBoneByPath(bones, fbxModelPath(leftHand, root)); b != leftBone {
+		t.Error("left hand: ", b)
+	}
+	if b := findBoneByPath(bones, fbxModelPath(rightHand, root)); b != rightBone {
+		t.Error("right hand: ", b)
+	}
+	if b := findBoneByPath(bones, "Hand"); b != nil {
+		t.Error("ambiguous bone should not be matched: ", b)
+	}
+	if b := findBoneByPath(bones, "Armature/Hand"); b != nil {
+		t.Error("unknown bone: ", b)
+	}
+}
+
+func TestApplyBlendShapeWeights(t *testing.T) {
+	doc := mqo.NewDocument()
+	doc.Materials = []*mqo.Material{{Name: "mat", Color: geom.Vector4{X: 1, Y: 1, Z: 1, W: 1}}}
+	base := mqo.NewObject("body")
+	base.Vertexes = []*geom.Vector3{{X: 0}, {X: 1}, {Y: 1}}
+	base.Faces = []*mqo.Face{{Verts: []int{0, 1, 2}}}
+	newTarget := func(name, blendShape string) *mqo.Object {
+		target := base.Clone()
+		target.Name = name
+		target.Vertexes[0].Z = 1
+		target.Visible = false
+		target.Extra["blendShapeName"] = blendShape
+		return target
+	}
+	// "Smile" has an in-between shape.
+	blink, smileHalf, smile := newTarget("blink", "Blink"), newTarget("smile_half", "Smile"), newTarget("smile", "Smile")
+	other := newTarget("smile", "Smile") // the object of the other renderer
+	doc.Objects = append(doc.Objects, base, blink, smileHalf, smile, other)
+	mqo.GetMorphPlugin(doc).MorphSet.Targets = []*mqo.MorphTargetList{{Base: "body", Target: []*mqo.MorphTarget{{Name: "blink"}, {Name: "smile_half"}, {Name: "smile"}}}}
+
+	state := &unityToMqoState{dst: doc}
+	state.applyBlendShapeWeights([]*mqo.Object{base, blink, smileHalf, smile}, []float32{0, 50})
+
+	if base.Vertexes[0].Z != 0 {
+		t.Error("base mesh should not be modified: ", base.Vertexes[0])
+	}
+	if w := smile.Extra["morphWeight"]; w != float32(0.5) {
+		t.Error("morph weight: ", w)
+	}
+	for _, o := range []*mqo.Object{blink, smileHalf, other} {
+		if w, ok := o.Extra["morphWeight"]; ok {
+			t.Error("unexpected morph weight: ", o.Name, w)
+		}
+	}
+	doc.Objects = doc.Objects[:4]
+
+	gltfdoc, err := NewMQOToGLTFConverter(nil).Convert(doc, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gltfdoc.Meshes) != 1 || len(gltfdoc.Meshes[0].Weights) != 3 || gltfdoc.Meshes[0].Weights[2] != 0.5 {
+		t.Error("mesh weights: ", gltfdoc.Meshes)
+	}
+}
+
+func TestAddNativeMeshNormalsAndBindPose(t *testing.T) {
+	mesh := unity.NewMesh("tri", map[int][][]float32{
+		unity.VertexChannelPosition: {{0, 0, 0}, {1, 0, 0}, {0, 1, 0}},
+		unity.VertexChannelNormal:   {{0.6, 0.8, 0}, {0.6, 0.8, 0}, {0.6, 0.8, 0}},
+	}, [][]int{{0, 1, 2}})
+	// The bone was at (0, 1, 2) in Unity coordinates when the mesh was bound.
+	mesh.SetBones([]*geom.Matrix4{geom.NewTranslateMatrix4(0, -1, -2)}, []string{"bone"}, "bone")
+
+	state := &unityToMqoState{dst: mqo.NewDocument(), bindPositions: map[*mqo.Bone]*geom.Vector3{}}
+	obj := mqo.NewObject("obj")
+	state.dst.Objects = append(state.dst.Objects, obj)
+	bone := &mqo.Bone{ID: 1, Name: "bone"}
+	transform := geom.NewScaleMatrix4(2, 1, 1)
+	if err := state.addNativeMesh(obj, mesh, []int{0}, transform, []*mqo.Bone{bone}); err != nil {
+		t.Fatal(err)
+	}
+
+	// inverse transpose of scale(2, 1, 1): (0.3, 0.8, 0)
+	expected := geom.NewVector3(0.3, 0.8, 0).Normalize()
+	if n := obj.Faces[0].Normals[0]; n.Sub(expected).Len() > 1e-5 {
+		t.Error("normal: ", n, expected)
+	}
+	if p := state.bindPositions[bone]; p == nil || p.Sub(geom.NewVector3(0, 1, -2)).Len() > 1e-5 {
+		t.Error("bind position: ", p)
+	}
+}
@@ -0,0 +1,353 @@
+package converter
+
+import (
+	"log"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/binzume/modelconv/geom"
+	"github.com/binzume/modelconv/mqo"
+	"github.com/binzume/modelconv/unity"
+)
+
+type unityAnimation struct {
+	clip *unity.AnimationClip
+	root *unity.Transform
+}
+
+type unityTransformCurves struct {
+	position, rotation, euler, scale, active *unity.AnimationCurve
+}
+
+// loadAnimations loads clips of the Animator or Animation component and marks the animated transforms.
+func (c *unityToMqoState) loadAnimations(o *unity.GameObject, tr *unity.Transform) {
+	var clipRefs []*unity.Ref
+	var animator *unity.Animator
+	var animation *unity.Animation
+	if o.GetComponent(&animator) && animator.Enabled != 0 && animator.Controller.IsValid() {
+		refs, err := unity.GetAnimatorClips(o.Scene.Assets, animator.Controller)
+		if err != nil {
+			log.Println("Can not load animator controller:", o.Name, err)
+		}
+		clipRefs = append(clipRefs, refs...)
+	}
+	if o.GetComponent(&animation) && animation.Enabled != 0 {
+		if animation.Animation.IsValid() {
+			clipRefs = append(clipRefs, animation.Animation)
+		}
+		for _, ref := range animation.Animations {
+			if ref.IsValid() && (animation.Animation == nil || *ref != *animation.Animation) {
+				clipRefs = append(clipRefs, ref)
+			}
+		}
+	}
+
+	for _, ref := range clipRefs {
+		clip, err := unity.LoadAnimationClip(o.Scene.Assets, ref)
+		if err != nil {
+			log.Println("Can not load animation clip:", err)
+			continue
+		}
+		c.animations = append(c.animations, &unityAnimation{clip: clip, root: tr})
+		for _, b := range clip.GetBindings() {
+			target := findTransformByPath(tr, b.Path)
+			if target == nil {
+				continue
+			}
+			if b.ClassID == 1 && b.Attribute == "m_IsActive" {
+				c.activeAnimated[target] = true
+			} else if b.Attribute == "" {
+				c.animatedTransforms[target] = true
+			}
+		}
+	}
+}
+
+func findTransformByPath(root *unity.Transform, path string) *unity.Transform {
+	tr := root
+	if path == "" {
+		return tr
+	}
+	for _, name := range strings.Split(path, "/") {
+		var found *unity.Transform
+		for _, child := range tr.GetChildren() {
+			if o := child.GetGameObject(); o != nil && o.Name == name {
+				found = child
+				break
+			}
+		}
+		if found == nil {
+			return nil
+		}
+		tr = found
+	}
+	return tr
+}
+
+// hasNodeContent reports whether the object or its descendants have meshes, lights or cameras.
+func (c *unityToMqoState) hasNodeContent(obj *mqo.Object) bool {
+	for i := obj.UID - 1; i >= 0 && i < len(c.dst.Objects); i++ {
+		o := c.dst.Objects[i]
+		if i >= obj.UID && o.Depth <= obj.Depth {
+			break
+		}
+		if len(o.Faces) > 0 || o.Extra["light"] != nil || o.Extra["camera"] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// convertAnimations converts clips to Keyframer motions. Keyframes are relative to the rest pose of the bones and the objects.
+func (c *unityToMqoState) convertAnimations() {
+	for _, anim := range c.animations {
+		motion := c.convertAnimationClip(anim.clip, anim.root)
+		if len(motion.Bones) > 0 || len(motion.Objects) > 0 || len(motion.Morphs) > 0 {
+			kp := mqo.GetKeyframerPlugin(c.dst)
+			kp.Motions = append(kp.Motions, motion)
+		}
+	}
+}
+
+func (c *unityToMqoState) convertAnimationClip(clip *unity.AnimationClip, root *unity.Transform) *mqo.Motion {
+	fps := clip.GetSampleRate()
+	motion := &mqo.Motion{Name: clip.Name, FrameRate: fps}
+
+	var transforms []*unity.Transform
+	curves := map[*unity.Transform]*unityTransformCurves{}
+	getCurves := func(path string) *unityTransformCurves {
+		tr := findTransformByPath(root, path)
+		if tr == nil {
+			return &unityTransformCurves{}
+		}
+		if curves[tr] == nil {
+			curves[tr] = &unityTransformCurves{}
+			transforms = append(transforms, tr)
+		}
+		return curves[tr]
+	}
+	var morphPaths []string
+	morphCurves := map[string]map[string]*unity.AnimationCurve{}
+
+	for _, b := range clip.PositionCurves {
+		getCurves(b.Path).position = &b.Curve
+	}
+	for _, b := range clip.RotationCurves {
+		getCurves(b.Path).rotation = &b.Curve
+	}
+	for _, b := range clip.EulerCurves {
+		getCurves(b.Path).euler = &b.Curve
+	}
+	for _, b := range clip.ScaleCurves {
+		getCurves(b.Path).scale = &b.Curve
+	}
+	for _, b := range clip.FloatCurves {
+		if b.ClassID == 1 && b.Attribute == "m_IsActive" {
+			getCurves(b.Path).active = &b.Curve
+		} else if b.ClassID == 137 && strings.HasPrefix(b.Attribute, "blendShape.") {
+			if morphCurves[b.Path] == nil {
+				morphCurves[b.Path] = map[string]*unity.AnimationCurve{}
+				morphPaths = append(morphPaths, b.Path)
+			}
+			morphCurves[b.Path][strings.TrimPrefix(b.Attribute, "blendShape.")] = &b.Curve
+		}
+	}
+
+	for _, tr := range transforms {
+		bone := c.boneByTransform[tr]
+		if bone != nil {
+			motion.Bones = append(motion.Bones, c.convertTransformCurves(bone.Name, tr, curves[tr], fps))
+		}
+		// Objects under the bones are animated only if they have contents. e.g. props in the hand.
+		if obj := c.animatedObjects[tr]; obj != nil && (bone == nil || c.hasNodeContent(obj)) {
+			bm := c.convertTransformCurves(obj.Name, tr, curves[tr], fps)
+			motion.Objects = append(motion.Objects, &mqo.ObjectMotion{ObjectID: obj.UID, BoneMotion: *bm})
+		}
+	}
+
+	for _, path := range morphPaths {
+		var names []string
+		var frameCurves []*unity.AnimationCurve
+		for name, curve := range morphCurves[path] {
+			names = append(names, name)
+			frameCurves = append(frameCurves, curve)
+		}
+		sort.Strings(names)
+		frames := curveFrames(fps, frameCurves...)
+		for _, name := range names {
+			curve := morphCurves[path][name]
+			mm := &mqo.MorphMotion{Name: name}
+			for _, f := range frames {
+				// Unity: 0-100
+				v, _ := curve.Evaluate(float32(f) / fps)
+				in, out := curve.Slopes(float32(f) / fps)
+				in[0], out[0] = in[0]/100, out[0]/100
+				mm.Keys = append(mm.Keys, &mqo.MorphKeyframe{Frame: f, Value: v[0] / 100, In: &in[0], Out: &out[0]})
+			}
+			motion.Morphs = append(motion.Morphs, mm)
+		}
+	}
+	return motion
+}
+
+// curveFrames returns frames of the keys of the curves.
+func curveFrames(fps float32, curves ...*unity.AnimationCurve) []int {
+	var frames []int
+	for _, curve := range curves {
+		if curve == nil {
+			continue
+		}
+		for _, k := range curve.Keys {
+			frames = append(frames, int(math.Round(float64(k.Time*fps))))
+		}
+	}
+	return uniqueFrames(frames)
+}
+
+func uniqueFrames(frames []int) []int {
+	sort.Ints(frames)
+	var result []int
+	for i, f := range frames {
+		if i == 0 || f != frames[i-1] {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+func (c *unityToMqoState) convertTransformCurves(name string, tr *unity.Transform, curves *unityTransformCurves, fps float32) *mqo.BoneMotion {
+	frames := curveFrames(fps, curves.position, curves.rotation, curves.euler, curves.scale, curves.active)
+	if f := curveFrames(fps, curves.euler); len(f) > 0 {
+		// Euler angles are not linear in quaternion space. Sample every frame.
+		for i := f[0]; i <= f[len(f)-1]; i++ {
+			frames = append(frames, i)
+		}
+	}
+	for _, f := range curveFrames(fps, curves.active) {
+		if f > 0 {
+			frames = append(frames, f-1) // Step: keep the previous state until the frame before the key.
+		}
+	}
+	frames = uniqueFrames(frames)
+
+	parentMat := c.rootTransform
+	if parent := tr.GetParent(); parent != nil {
+		if m, ok := c.worldTransforms[parent]; ok {
+			parentMat = m
+		} else {
+			parentMat = c.rootTransform.Mul(parent.GetWorldMatrix())
+		}
+	}
+	linear := parentMat.Clone()
+	linear[12], linear[13], linear[14] = 0, 0, 0
+	_, parentRot, _ := linear.Decompose()
+	parentRotInv := parentRot.Inverse()
+
+	toMqoVec := func(v unity.CurveValue) *geom.Vector3 {
+		return linear.ApplyTo(&geom.Vector3{X: v[0], Y: v[1], Z: -v[2]})
+	}
+	toMqoRot := func(v unity.CurveValue) *geom.Quaternion {
+		return geom.NewQuaternion(-v[0], -v[1], v[2], v[3])
+	}
+	p0 := tr.LocalPosition
+	restRot := toMqoRot(unity.CurveValue{tr.LocalRotation.X, tr.LocalRotation.Y, tr.LocalRotation.Z, tr.LocalRotation.W})
+	restRotInv := restRot.Inverse()
+	// rotation relative to the rest pose in the world aligned bone space.
+	relativeRot := func(q *geom.Quaternion) *geom.Quaternion {
+		return parentRot.Mul(q).Mul(restRotInv).Mul(parentRotInv)
+	}
+	eulerOrder := unityRotationOrder(curves.euler)
+	eulerRot := func(t float32) *geom.Quaternion {
+		v, _ := curves.euler.Evaluate(t)
+		e := geom.NewEuler(v[0], v[1], v[2], eulerOrder)
+		e.Vector3 = *e.Vector3.Scale(math.Pi / 180)
+		q := e.ToQuaternion()
+		return toMqoRot(unity.CurveValue{q.X, q.Y, q.Z, q.W})
+	}
+	relativeScale := func(v, s0 float32) float32 {
+		if s0 == 0 {
+			return v
+		}
+		return v / s0
+	}
+
+	bm := &mqo.BoneMotion{Name: name}
+	for _, f := range frames {
+		t := float32(f) / fps
+		k := &mqo.BoneKeyframe{Frame: f, In: &mqo.BoneKeyTangent{}, Out: &mqo.BoneKeyTangent{}}
+		if curves.position != nil {
+			v, _ := curves.position.Evaluate(t)
+			in, out := curves.position.Slopes(t)
+			mv := toMqoVec(unity.CurveValue{v[0] - p0.X, v[1] - p0.Y, v[2] - p0.Z})
+			k.MvX, k.MvY, k.MvZ = mv.X, mv.Y, mv.Z
+			k.In.Mv.Vector3, k.Out.Mv.Vector3 = *toMqoVec(in), *toMqoVec(out)
+		}
+
+		rot := &geom.Quaternion{W: 1}
+		var rotIn, rotOut *geom.Quaternion
+		if curves.rotation != nil {
+			v, _ := curves.rotation.Evaluate(t)
+			in, out := curves.rotation.Slopes(t)
+			rot, rotIn, rotOut = relativeRot(toMqoRot(v)), relativeRot(toMqoRot(in)), relativeRot(toMqoRot(out))
+		} else if curves.euler != nil {
+			const h = 0.001
+			q, q0, q1 := eulerRot(t), eulerRot(t-h), eulerRot(t+h)
+			if q0.Dot(q) < 0 {
+				q0 = q0.Scale(-1)
+			}
+			if q1.Dot(q) < 0 {
+				q1 = q1.Scale(-1)
+			}
+			rot, rotIn, rotOut = relativeRot(q), relativeRot(q.Sub(q0).Scale(1/h)), relativeRot(q1.Sub(q).Scale(1/h))
+		}
+		k.SetRotation(rot)
+		if rotIn != nil {
+			if k.GetRotation().Dot(rot) < 0 {
+				rotIn, rotOut = rotIn.Scale(-1), rotOut.Scale(-1)
+			}
+			k.In.SetRotation(rotIn)
+			k.Out.SetRotation(rotOut)
+		}
+
+		if curves.scale != nil || curves.active != nil {
+			s0 := tr.LocalScale
+			sc := &geom.Vector3{X: 1, Y: 1, Z: 1}
+			scIn, scOut := &geom.Vector3{}, &geom.Vector3{}
+			if curves.scale != nil {
+				v, _ := curves.scale.Evaluate(t)
+				in, out := curves.scale.Slopes(t)
+				sc = &geom.Vector3{X: relativeScale(v[0], s0.X), Y: relativeScale(v[1], s0.Y), Z: relativeScale(v[2], s0.Z)}
+				scIn = &geom.Vector3{X: relativeScale(in[0], s0.X), Y: relativeScale(in[1], s0.Y), Z: relativeScale(in[2], s0.Z)}
+				scOut = &geom.Vector3{X: relativeScale(out[0], s0.X), Y: relativeScale(out[1], s0.Y), Z: relativeScale(out[2], s0.Z)}
+			}
+			if curves.active != nil {
+				// glTF has no visibility. Inactive objects are scaled to zero.
+				if v, _ := curves.active.Evaluate(t); v[0] < 0.5 {
+					sc, scIn, scOut = &geom.Vector3{}, &geom.Vector3{}, &geom.Vector3{}
+				}
+			}
+			k.Scale = &mqo.Vector3Attr{Vector3: *sc}
+			k.In.Sc = &mqo.Vector3Attr{Vector3: *scIn}
+			k.Out.Sc = &mqo.Vector3Attr{Vector3: *scOut}
+		}
+		bm.Keys = append(bm.Keys, k)
+	}
+	return bm
+}
+
+// unityRotationOrder converts m_RotationOrder (order of the rotations applied) to geom.RotationOrder.
+func unityRotationOrder(curve *unity.AnimationCurve) geom.RotationOrder {
+	if curve == nil {
+		return geom.RotationOrderYXZ
+	}
+	switch curve.RotationOrder {
+	case 0: // XYZ
+		return geom.RotationOrderZYX
+	case 3: // YXZ
+		return geom.RotationOrderZXY
+	case 5: // ZYX
+		return geom.RotationOrderXYZ
+	}
+	return geom.RotationOrderYXZ // ZXY (default)
+}
@@ -0,0 +1,195 @@
+package converter
+
+import (
+	"math"
+	"testing"
+
+	"github.com/binzume/modelconv/geom"
+	"github.com/binzume/modelconv/mqo"
+	"github.com/binzume/modelconv/unity"
+)
+
+const testAnimationScene = testSceneHeader + `--- !u!1 &100
+GameObject:
+  m_Component:
+  - component: {fileID: 101}
+  - component: {fileID: 102}
+  m_Name: Prop
+  m_IsActive: 1
+--- !u!4 &101
+Transform:
+  m_GameObject: {fileID: 100}
+  m_LocalRotation: {x: 0, y: 0.70710677, z: 0, w: 0.70710677}
+  m_LocalPosition: {x: 1, y: 2, z: 3}
+  m_LocalScale: {x: 1, y: 1, z: 1}
+  m_Children:
+  - {fileID: 201}
+  m_Father: {fileID: 0}
+--- !u!111 &102
+Animation:
+  m_GameObject: {fileID: 100}
+  m_Enabled: 1
+  m_Animation: {fileID: 7400000, guid: 0123456789abcdef0123456789abcdef, type: 2}
+  m_Animations: []
+--- !u!1 &200
+GameObject:
+  m_Component:
+  - component: {fileID: 201}
+  m_Name: Lid
+  m_IsActive: 1
+--- !u!4 &201
+Transform:
+  m_GameObject: {fileID: 200}
+  m_LocalRotation: {x: 0, y: 0, z: 0, w: 1}
+  m_LocalPosition: {x: 0, y: 1, z: 0}
+  m_LocalScale: {x: 1, y: 1, z: 1}
+  m_Children: []
+  m_Father: {fileID: 101}
+`
+
+const testAnimationClip = testSceneHeader + `--- !u!74 &7400000
+AnimationClip:
+  m_Name: Open
+  m_RotationCurves:
+  - curve:
+      m_Curve:
+      - time: 0
+        value: {x: 0, y: 0.70710677, z: 0, w: 0.70710677}
+        inSlope: {x: 0, y: 0, z: 0, w: 0}
+        outSlope: {x: 0, y: 0, z: 0, w: 0}
+      - time: 1
+        value: {x: 0, y: 1, z: 0, w: 0}
+        inSlope: {x: 0, y: 1, z: 0, w: 0}
+        outSlope: {x: 0, y: 0, z: 0, w: 0}
+    path:
+  m_PositionCurves:
+  - curve:
+      m_Curve:
+      - time: 0
+        value: {x: 0, y: 1, z: 0}
+        inSlope: {x: 0, y: 0, z: 0}
+        outSlope: {x: 1, y: 0, z: 2}
+      - time: 1
+        value: {x: 1, y: 1, z: 2}
+        inSlope: {x: 1, y: 0, z: 2}
+        outSlope: {x: 0, y: 0, z: 0}
+    path: Lid
+  m_EulerCurves:
+  - curve:
+      m_Curve:
+      - time: 0
+        value: {x: 30, y: 0, z: 60}
+        inSlope: {x: 0, y: 0, z: 0}
+        outSlope: {x: 0, y: 0, z: 0}
+      m_RotationOrder: 0
+    path: Lid
+  m_SampleRate: 30
+`
+
+func nearlyEqualRotation(a, b *geom.Quaternion) bool {
+	if a.Dot(b) < 0 {
+		b = b.Scale(-1)
+	}
+	return nearlyEqual(a.X, b.X) && nearlyEqual(a.Y, b.Y) && nearlyEqual(a.Z, b.Z) && nearlyEqual(a.W, b.W)
+}
+
+func TestConvertAnimationClip(t *testing.T) {
+	dir := t.TempDir()
+	writeTestAsset(t, dir, "Assets/Open.anim", "0123456789abcdef0123456789abcdef", testAnimationClip)
+	writeTestAsset(t, dir, "Assets/Test.unity", "fedcba9876543210fedcba9876543210", testAnimationScene)
+	assets, err := unity.OpenProject(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := unity.LoadScene(assets, "Assets/Test.unity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := NewUnityToMQOConverter(&UnityToMQOOption{ConvertScale: 1}).Convert(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mqo.GetBonePlugin(doc).Bones()) != 0 {
+		t.Error("animated objects are converted to bones: ", len(mqo.GetBonePlugin(doc).Bones()))
+	}
+	kp := mqo.FindKeyframerPlugin(doc)
+	if kp == nil || len(kp.Motions) != 1 || len(kp.Motions[0].Objects) != 2 {
+		t.Fatal("no object motions")
+	}
+	prop, lid := findTestObject(t, doc, "Prop"), findTestObject(t, doc, "Lid")
+	motions := map[int]*mqo.ObjectMotion{}
+	for _, om := range kp.Motions[0].Objects {
+		motions[om.ObjectID] = om
+	}
+	if motions[prop.UID] == nil || motions[lid.UID] == nil {
+		t.Fatal("invalid object ids: ", kp.Motions[0].Objects[0].ObjectID, kp.Motions[0].Objects[1].ObjectID)
+	}
+	if p := lid.InternalTransform.ApplyTo(&geom.Vector3{}); !nearlyEqual(p.X, 1) || !nearlyEqual(p.Y, 3) || !nearlyEqual(p.Z, -3) {
+		t.Error("invalid pivot: ", p)
+	}
+
+	const s2 = 0.70710677
+	// Rotation relative to the rest pose: Unity +90deg around Y is -90deg in MQO coordinates.
+	propKeys := motions[prop.UID].Keys
+	if len(propKeys) != 2 || propKeys[1].Frame != 30 {
+		t.Fatal("invalid keys: ", len(propKeys))
+	}
+	if r := propKeys[0].GetRotation(); !nearlyEqualRotation(r, &geom.Quaternion{W: 1}) {
+		t.Error("rest rotation: ", r)
+	}
+	r := propKeys[1].GetRotation()
+	if !nearlyEqualRotation(r, geom.NewQuaternion(0, -s2, 0, s2)) {
+		t.Error("rotation: ", r)
+	}
+	if in := propKeys[1].In.GetRotation(); !nearlyEqualRotation(in, geom.NewQuaternion(0, -s2, 0, s2)) || in.Dot(r) < 0 {
+		t.Error("rotation tangent: ", in)
+	}
+
+	// Translation in the parent space with flipped Z: (1,0,-2) rotated by the parent.
+	lidKeys := motions[lid.UID].Keys
+	if len(lidKeys) != 2 {
+		t.Fatal("invalid keys: ", len(lidKeys))
+	}
+	if mv := lidKeys[1].GetTranslation(); !nearlyEqual(mv.X, 2) || !nearlyEqual(mv.Y, 0) || !nearlyEqual(mv.Z, 1) {
+		t.Error("translation: ", mv)
+	}
+	if in := lidKeys[1].In.Mv; !nearlyEqual(in.X, 2) || !nearlyEqual(in.Y, 0) || !nearlyEqual(in.Z, 1) {
+		t.Error("translation tangent: ", in)
+	}
+	if out := lidKeys[0].Out.Mv; !nearlyEqual(out.X, 2) || !nearlyEqual(out.Z, 1) {
+		t.Error("translation tangent: ", out)
+	}
+
+	// m_RotationOrder 0: X, Y and Z are applied in this order.
+	sin15, cos15 := float32(math.Sin(math.Pi/12)), float32(math.Cos(math.Pi/12))
+	qx, qz := geom.NewQuaternion(sin15, 0, 0, cos15), geom.NewQuaternion(0, 0, 0.5, float32(math.Sqrt(3)/2))
+	q := qz.Mul(qx)
+	parentRot := geom.NewQuaternion(0, -s2, 0, s2)
+	expected := parentRot.Mul(geom.NewQuaternion(-q.X, -q.Y, q.Z, q.W)).Mul(parentRot.Inverse())
+	for _, k := range lidKeys {
+		if r := k.GetRotation(); !nearlyEqualRotation(r, expected) {
+			t.Error("euler rotation: ", k.Frame, r, expected)
+		}
+	}
+
+	gltfdoc, err := NewMQOToGLTFConverter(&MQOToGLTFOption{Scale: 1}).Convert(doc, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	propNode, lidNode := gltfdoc.Nodes[prop.UID-1], gltfdoc.Nodes[lid.UID-1]
+	if tr := propNode.Translation; !nearlyEqual(tr[0], 1) || !nearlyEqual(tr[1], 2) || !nearlyEqual(tr[2], -3) {
+		t.Error("prop node: ", tr)
+	}
+	if tr := lidNode.Translation; !nearlyEqual(tr[0], 0) || !nearlyEqual(tr[1], 1) || !nearlyEqual(tr[2], 0) {
+		t.Error("lid node: ", tr)
+	}
+	if len(gltfdoc.Animations) != 1 || len(gltfdoc.Animations[0].Channels) != 3 || len(gltfdoc.Skins) != 0 {
+		t.Fatal("invalid animation")
+	}
+	for _, ch := range gltfdoc.Animations[0].Channels {
+		if n := *ch.Target.Node; n != uint32(prop.UID-1) && n != uint32(lid.UID-1) {
+			t.Error("invalid target: ", n)
+		}
+	}
+}
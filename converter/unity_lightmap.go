@@ -0,0 +1,321 @@
+package converter
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/binzume/modelconv/geom"
+	"github.com/binzume/modelconv/mqo"
+	"github.com/binzume/modelconv/unity"
+)
+
+// Baked texture resolution per lightmap texel.
+const lightmapTexelScale = 4
+const maxLightmapTextureSize = 2048
+
+// bakeLightmap bakes albedo * lightmap into the texture in lightmap UV space and replaces materials of the object with unlit materials.
+func (c *unityToMqoState) bakeLightmap(o *unity.GameObject, renderer *unity.MeshRenderer, mesh *unity.Ref, obj *mqo.Object) {
+	index, scaleOffset, ok := renderer.GetLightmap()
+	if !ok || len(obj.Faces) == 0 {
+		return
+	}
+	lightmap := c.loadLightmap(index)
+	if lightmap == nil {
+		return
+	}
+	lightmapUVs := c.getLightmapUVs(o, mesh, obj)
+	if lightmapUVs == nil {
+		log.Println("Lightmap UVs not found: ", obj.Name)
+		return
+	}
+
+	lb := lightmap.Bounds()
+	w := int(geom.Clamp(float32(math.Ceil(float64(scaleOffset.X*float32(lb.Dx()))))*lightmapTexelScale, 16, maxLightmapTextureSize))
+	h := int(geom.Clamp(float32(math.Ceil(float64(scaleOffset.Y*float32(lb.Dy()))))*lightmapTexelScale, 16, maxLightmapTextureSize))
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	covered := make([]bool, w*h)
+
+	materials := map[int]int{}
+	for n, face := range obj.Faces {
+		uv2 := lightmapUVs[n]
+		if len(uv2) != len(face.Verts) || len(face.Verts) < 3 {
+			continue
+		}
+		src := c.dst.Materials[face.Material]
+		albedo := c.loadMaterialImage(src)
+		uvTransform := []float32{1, 1, 0, 0}
+		if src.Ex2 != nil {
+			if t := src.Ex2.ColorParam("UVTransform"); len(t) == 4 {
+				uvTransform = t
+			}
+		}
+		// Unity: linear lighting
+		baseColor := [4]float32{srgbToLinear(src.Color.X), srgbToLinear(src.Color.Y), srgbToLinear(src.Color.Z), src.Color.W}
+
+		pos := make([]geom.Vector2, len(uv2))
+		for i, uv := range uv2 {
+			pos[i] = geom.Vector2{X: uv.X * float32(w), Y: (1 - uv.Y) * float32(h)}
+		}
+		for i := 1; i+1 < len(face.Verts); i++ {
+			tri := [3]int{0, i, i + 1}
+			rasterizeTriangle(pos[tri[0]], pos[tri[1]], pos[tri[2]], w, h, func(x, y int, b [3]float32) {
+				var lm, uv geom.Vector2
+				for j, k := range tri {
+					lm.X += uv2[k].X * b[j]
+					lm.Y += uv2[k].Y * b[j]
+					if len(face.UVs) == len(face.Verts) {
+						uv.X += face.UVs[k].X * b[j]
+						uv.Y += face.UVs[k].Y * b[j]
+					}
+				}
+				light := sampleLightmap(lightmap, lm.X*scaleOffset.X+scaleOffset.Z, lm.Y*scaleOffset.Y+scaleOffset.W)
+				col := baseColor
+				if albedo != nil {
+					// mqo: origin is top-left
+					s := sampleRepeat(albedo, uv.X*uvTransform[0]+uvTransform[2], 1-(uv.Y*uvTransform[1]+uvTransform[3]))
+					col = [4]float32{col[0] * srgbToLinear(s[0]), col[1] * srgbToLinear(s[1]), col[2] * srgbToLinear(s[2]), col[3] * s[3]}
+				}
+				dst.SetNRGBA(x, y, color.NRGBA{
+					R: toUint8(linearToSrgb(col[0] * light[0])),
+					G: toUint8(linearToSrgb(col[1] * light[1])),
+					B: toUint8(linearToSrgb(col[2] * light[2])),
+					A: toUint8(col[3]),
+				})
+				covered[y*w+x] = true
+			})
+		}
+
+		if _, ok := materials[face.Material]; !ok {
+			materials[face.Material] = -1
+		}
+		face.UVs = make([]geom.Vector2, len(uv2))
+		for i, uv := range uv2 {
+			face.UVs[i] = geom.Vector2{X: uv.X, Y: 1 - uv.Y}
+		}
+	}
+	dilateImage(dst, covered, 4)
+
+	texture, err := c.saveImage(fmt.Sprintf("%s_lightmap_%d.png", c.src.GUID, obj.UID), dst)
+	if err != nil {
+		log.Println("Can not save lightmap: ", obj.Name, err)
+	}
+	for _, face := range obj.Faces {
+		index, ok := materials[face.Material]
+		if !ok {
+			continue
+		}
+		if index < 0 {
+			index = len(c.dst.Materials)
+			c.dst.Materials = append(c.dst.Materials, newLightmapMaterial(c.dst.Materials[face.Material], obj.Name, texture))
+			materials[face.Material] = index
+		}
+		face.Material = index
+	}
+}
+
+func newLightmapMaterial(src *mqo.Material, name, texture string) *mqo.Material {
+	m := &mqo.Material{Name: src.Name + "_" + name, Color: geom.Vector4{X: 1, Y: 1, Z: 1, W: 1}, Diffuse: 0.8, Shader: mqo.ShaderConstant, Texture: texture, DoubleSided: src.DoubleSided}
+	ex := mqo.NewMaterialEx2(mqo.ShaderNameGlTF)
+	ex.ShaderType = mqo.ShaderTypeHLSL
+	ex.ShaderParams["Extensions.Unlit"] = true
+	if src.Ex2 != nil {
+		for _, p := range []string{"AlphaMode", "AlphaCutOff"} {
+			if v, ok := src.Ex2.ShaderParams[p]; ok {
+				ex.ShaderParams[p] = v
+			}
+		}
+	}
+	m.Ex2 = ex
+	return m
+}
+
+func (c *unityToMqoState) loadLightmap(index int) image.Image {
+	if img, ok := c.lightmaps[index]; ok {
+		return img
+	}
+	c.lightmaps[index] = nil
+	if c.lightmapSettings == nil {
+		settings, err := unity.LoadLightmapSettings(c.src.Assets, c.src.GUID)
+		if err != nil {
+			c.setLightmapError(err)
+			return nil
+		}
+		c.lightmapSettings = settings
+	}
+	asset, err := c.lightmapSettings.GetLightmap(c.src.Assets, index)
+	if err != nil {
+		c.setLightmapError(err)
+		return nil
+	}
+	r, err := c.src.Assets.Open(asset.Path)
+	if err != nil {
+		log.Println("Can not load lightmap: ", asset.Path, err)
+		return nil
+	}
+	defer r.Close()
+	img, err := decodeImage(r, asset.Path)
+	if err != nil {
+		log.Println("Can not load lightmap: ", asset.Path, err)
+		return nil
+	}
+	c.lightmaps[index] = img
+	return img
+}
+
+// setLightmapError records the first error of the lightmap resolution. Convert() fails with it instead of exporting the objects without lightmaps silently.
+func (c *unityToMqoState) setLightmapError(err error) {
+	log.Println("ERROR: Can not resolve lightmap: ", err)
+	if c.lightmapErr == nil {
+		c.lightmapErr = err
+	}
+}
+
+// getLightmapUVs returns the lightmap UVs (UV2 or UV1) of the faces. UVs of FBX meshes are read by FBXToMQOConverter. The origin of UVs is bottom-left.
+func (c *unityToMqoState) getLightmapUVs(o *unity.GameObject, mesh *unity.Ref, obj *mqo.Object) [][]geom.Vector2 {
+	if faceUVs, ok := obj.Extra["lightmapUVs"].([][]geom.Vector2); ok && len(faceUVs) == len(obj.Faces) {
+		return faceUVs
+	}
+	var faceUVs [][]geom.Vector2
+	if _, _, uvs, name := unity.GetBuiltinMesh(mesh); name != "" {
+		for _, f := range uvs {
+			var uv2 []geom.Vector2
+			for _, uv := range f {
+				uv2 = append(uv2, geom.Vector2{X: uv.X, Y: 1 - uv.Y})
+			}
+			faceUVs = append(faceUVs, uv2)
+		}
+	} else if nativeMesh, _ := c.loadNativeMesh(o, mesh); nativeMesh != nil {
+		uvs, _ := nativeMesh.GetVertexAttribute(unity.VertexChannelTexCoord1)
+		if len(uvs) == 0 {
+			uvs, _ = nativeMesh.GetVertexAttribute(unity.VertexChannelTexCoord0)
+		}
+		for _, f := range obj.Faces {
+			var uv2 []geom.Vector2
+			for _, v := range f.Verts {
+				if v < len(uvs) && len(uvs[v]) >= 2 {
+					uv2 = append(uv2, geom.Vector2{X: uvs[v][0], Y: uvs[v][1]})
+				}
+			}
+			faceUVs = append(faceUVs, uv2)
+		}
+	}
+	if len(faceUVs) != len(obj.Faces) {
+		return nil
+	}
+	return faceUVs
+}
+
+func (c *unityToMqoState) loadMaterialImage(mat *mqo.Material) image.Image {
+	if mat.Texture == "" {
+		return nil
+	}
+	if img, ok := c.materialImages[mat.Texture]; ok {
+		return img
+	}
+	c.materialImages[mat.Texture] = nil
+	path := filepath.Join(filepath.Dir(c.src.Assets.GetSourcePath()), mat.Texture)
+	r, err := os.Open(path)
+	if err != nil {
+		log.Println("Can not load texture: ", path, err)
+		return nil
+	}
+	defer r.Close()
+	img, err := decodeImage(r, path)
+	if err != nil {
+		log.Println("Can not load texture: ", path, err)
+		return nil
+	}
+	c.materialImages[mat.Texture] = img
+	return img
+}
+
+// sampleLightmap samples the lightmap with bilinear filtering. The origin of UVs is bottom-left.
+func sampleLightmap(img image.Image, u, v float32) [3]float32 {
+	b := img.Bounds()
+	fx := geom.Clamp(u*float32(b.Dx())-0.5, 0, float32(b.Dx()-1))
+	fy := geom.Clamp((1-v)*float32(b.Dy())-0.5, 0, float32(b.Dy()-1))
+	x0, y0 := int(fx), int(fy)
+	x1, y1 := x0+1, y0+1
+	if x1 >= b.Dx() {
+		x1 = x0
+	}
+	if y1 >= b.Dy() {
+		y1 = y0
+	}
+	at := func(x, y int) [4]float32 {
+		if hdr, ok := img.(*unity.EXRImage); ok {
+			return hdr.FloatAt(b.Min.X+x, b.Min.Y+y)
+		}
+		c := color.NRGBA64Model.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA64)
+		return [4]float32{srgbToLinear(float32(c.R) / 0xffff), srgbToLinear(float32(c.G) / 0xffff), srgbToLinear(float32(c.B) / 0xffff), 1}
+	}
+	tx, ty := fx-float32(x0), fy-float32(y0)
+	c00, c10, c01, c11 := at(x0, y0), at(x1, y0), at(x0, y1), at(x1, y1)
+	var r [3]float32
+	for i := range r {
+		r[i] = (c00[i]*(1-tx)+c10[i]*tx)*(1-ty) + (c01[i]*(1-tx)+c11[i]*tx)*ty
+	}
+	return r
+}
+
+// rasterizeTriangle calls f for the pixels whose center is in the triangle with barycentric coordinates.
+func rasterizeTriangle(p0, p1, p2 geom.Vector2, w, h int, f func(x, y int, b [3]float32)) {
+	area := (p1.X-p0.X)*(p2.Y-p0.Y) - (p2.X-p0.X)*(p1.Y-p0.Y)
+	if area == 0 {
+		return
+	}
+	minX := int(geom.Clamp(float32(math.Floor(float64(geom.Min(p0.X, geom.Min(p1.X, p2.X))))), 0, float32(w-1)))
+	maxX := int(geom.Clamp(float32(math.Ceil(float64(geom.Max(p0.X, geom.Max(p1.X, p2.X))))), 0, float32(w-1)))
+	minY := int(geom.Clamp(float32(math.Floor(float64(geom.Min(p0.Y, geom.Min(p1.Y, p2.Y))))), 0, float32(h-1)))
+	maxY := int(geom.Clamp(float32(math.Ceil(float64(geom.Max(p0.Y, geom.Max(p1.Y, p2.Y))))), 0, float32(h-1)))
+	const eps = -1e-4
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			px, py := float32(x)+0.5, float32(y)+0.5
+			b0 := ((p1.X-px)*(p2.Y-py) - (p2.X-px)*(p1.Y-py)) / area
+			b1 := ((p2.X-px)*(p0.Y-py) - (p0.X-px)*(p2.Y-py)) / area
+			b2 := 1 - b0 - b1
+			if b0 >= eps && b1 >= eps && b2 >= eps {
+				f(x, y, [3]float32{b0, b1, b2})
+			}
+		}
+	}
+}
+
+// dilateImage fills uncovered pixels with the neighbors to avoid seams. Returns the covered pixels after dilation.
+func dilateImage(img *image.NRGBA, covered []bool, iterations int) []bool {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	for n := 0; n < iterations; n++ {
+		next := append([]bool{}, covered...)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				if covered[y*w+x] {
+					continue
+				}
+				for _, d := range [][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+					nx, ny := x+d[0], y+d[1]
+					if nx >= 0 && ny >= 0 && nx < w && ny < h && covered[ny*w+nx] {
+						img.SetNRGBA(x, y, img.NRGBAAt(nx, ny))
+						next[y*w+x] = true
+						break
+					}
+				}
+			}
+		}
+		covered = next
+	}
+	return covered
+}
+
+func linearToSrgb(v float32) float32 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return float32(1.055*math.Pow(float64(v), 1/2.4) - 0.055)
+}
@@ -0,0 +1,274 @@
+package converter
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/binzume/modelconv/geom"
+	"github.com/binzume/modelconv/mqo"
+	"github.com/binzume/modelconv/unity"
+)
+
+// glTF shader alpha modes (Metasequoia)
+const (
+	gltfShaderAlphaOpaque = 1
+	gltfShaderAlphaMask   = 2
+	gltfShaderAlphaBlend  = 3
+)
+
+type unityMaterial struct {
+	index    int
+	uvScale  *geom.Vector2
+	uvOffset *geom.Vector2
+}
+
+// convertMaterial translates Standard/URP/HDRP material properties to the glTF shader of Metasequoia.
+func (c *unityToMqoState) convertMaterial(material *unity.Material, guid string, mat *unityMaterial) *mqo.Material {
+	shader := material.GetShaderName()
+	m := &mqo.Material{Name: material.Name, Color: geom.Vector4{X: 1, Y: 1, Z: 1, W: 1}, Diffuse: 0.8, Shader: mqo.ShaderLambert}
+	ex := mqo.NewMaterialEx2(mqo.ShaderNameGlTF)
+	ex.ShaderType = mqo.ShaderTypeHLSL
+	m.Ex2 = ex
+
+	getFloat := func(def float32, names ...string) float32 {
+		for _, name := range names {
+			if v, ok := material.GetFloatProperty(name); ok {
+				return v
+			}
+		}
+		return def
+	}
+	hasFloat := func(name string) bool {
+		_, ok := material.GetFloatProperty(name)
+		return ok
+	}
+	getColor := func(names ...string) *unity.Color {
+		for _, name := range names {
+			if c := material.GetColorProperty(name); c != nil {
+				return c
+			}
+		}
+		return nil
+	}
+	getTexture := func(names ...string) *unity.TextureEnv {
+		for _, name := range names {
+			if t := material.GetTextureProperty(name); t != nil && t.Texture.IsValid() {
+				return t
+			}
+		}
+		return nil
+	}
+
+	// Base color
+	if col := getColor("_BaseColor", "_Color"); col != nil {
+		m.Color = geom.Vector4{X: col.R, Y: col.G, Z: col.B, W: col.A}
+	}
+	mainTex := getTexture("_BaseMap", "_BaseColorMap", "_MainTex")
+	if mainTex != nil {
+		m.Texture = c.saveTextureRef(mainTex.Texture)
+		scale, offset := mainTex.Scale, mainTex.Offset
+		if c.TextureTransform {
+			if scale != (geom.Vector2{X: 1, Y: 1}) || offset != (geom.Vector2{}) {
+				// Unity: origin is bottom-left
+				ex.ShaderParams["UVTransform"] = []float32{scale.X, scale.Y, offset.X, 1 - scale.Y - offset.Y} // scale, offset
+			}
+		} else {
+			mat.uvScale = &scale
+			mat.uvOffset = &offset
+		}
+	}
+
+	unlit := strings.Contains(shader, "Unlit")
+	ex.ShaderParams["Extensions.Unlit"] = unlit
+	if unlit {
+		m.Shader = mqo.ShaderConstant
+	}
+
+	// Metallic / Smoothness
+	specularSetup := strings.Contains(shader, "Specular") || hasFloat("_WorkflowMode") && getFloat(1, "_WorkflowMode") == 0
+	metallic := getFloat(0, "_Metallic")
+	smoothness := getFloat(0.5, "_Smoothness", "_Glossiness")
+	if specularSetup {
+		metallic = 0
+		if col := getColor("_SpecColor"); col != nil {
+			ex.ShaderParams["Extensions.SpecularExt"] = true
+			ex.ShaderParams["Extensions.SpecularColorFactor"] = []float32{col.R, col.G, col.B, 1}
+		}
+	}
+	roughness := 1 - smoothness
+	if unlit {
+		metallic, roughness = 0, 1
+	}
+
+	glossTex := getTexture("_MetallicGlossMap")
+	if specularSetup {
+		glossTex = getTexture("_SpecGlossMap")
+	}
+	maskTex := getTexture("_MaskMap") // HDRP: R:metallic G:occlusion A:smoothness
+	if !unlit && (glossTex != nil || maskTex != nil) && c.SaveTexrure {
+		var smoothnessTex *unity.TextureEnv
+		scale := getFloat(1, "_GlossMapScale")
+		if hasFloat("_Smoothness") {
+			scale = getFloat(1, "_Smoothness") // URP
+		}
+		if getFloat(0, "_SmoothnessTextureChannel") == 1 && mainTex != nil {
+			smoothnessTex = mainTex
+		}
+		var packed string
+		var err error
+		if maskTex != nil {
+			remapMin, remapMax := getFloat(0, "_SmoothnessRemapMin"), getFloat(1, "_SmoothnessRemapMax")
+			packed, err = c.packMetallicRoughness(guid, maskTex, nil, remapMin, remapMax, true)
+			if err == nil {
+				ex.ShaderMapping["Occlusion"] = packed
+			}
+		} else {
+			packed, err = c.packMetallicRoughness(guid, glossTex, smoothnessTex, 0, scale, false)
+		}
+		if err != nil {
+			log.Println("Can not convert metallic texture:", err)
+		} else {
+			ex.ShaderMapping["MetallicRoughness"] = packed
+			if !specularSetup {
+				metallic = 1
+			}
+			roughness = 1
+		}
+	}
+	ex.ShaderParams["Metallic"] = metallic
+	ex.ShaderParams["Roughness"] = roughness
+	m.Specular = metallic
+
+	// Occlusion
+	if t := getTexture("_OcclusionMap"); t != nil && !unlit {
+		ex.ShaderMapping["Occlusion"] = c.saveTextureRef(t.Texture)
+		ex.ShaderParams["OcclusionStrength"] = getFloat(1, "_OcclusionStrength")
+	}
+
+	// Normal
+	if t := getTexture("_BumpMap", "_NormalMap"); t != nil && !unlit {
+		m.BumpTexture = c.saveTextureRef(t.Texture)
+		ex.ShaderParams["NormalScale"] = getFloat(1, "_BumpScale", "_NormalScale")
+	}
+
+	// Emission
+	hdrp := strings.HasPrefix(shader, "HDRP") || getColor("_EmissiveColor") != nil
+	if !unlit && (material.HasKeyword("_EMISSION") || hdrp) {
+		if col := getColor("_EmissionColor", "_EmissiveColor"); col != nil {
+			emission := &geom.Vector3{X: col.R, Y: col.G, Z: col.B}
+			if emission.Len() > 0 {
+				m.EmissionColor = emission
+				if t := getTexture("_EmissionMap", "_EmissiveColorMap"); t != nil {
+					ex.ShaderMapping["Emissive"] = c.saveTextureRef(t.Texture)
+				}
+			}
+		}
+	}
+
+	// Alpha
+	alphaMode := gltfShaderAlphaOpaque
+	if strings.HasSuffix(shader, "Cutout") {
+		alphaMode = gltfShaderAlphaMask
+	} else if strings.HasSuffix(shader, "Transparent") {
+		alphaMode = gltfShaderAlphaBlend
+	}
+	if hasFloat("_Mode") && !hasFloat("_Surface") {
+		// Standard: Opaque, Cutout, Fade, Transparent
+		switch getFloat(0, "_Mode") {
+		case 1:
+			alphaMode = gltfShaderAlphaMask
+		case 2, 3:
+			alphaMode = gltfShaderAlphaBlend
+		}
+	}
+	if getFloat(0, "_Surface", "_SurfaceType") == 1 {
+		alphaMode = gltfShaderAlphaBlend
+	}
+	if alphaMode == gltfShaderAlphaOpaque && getFloat(0, "_AlphaClip", "_AlphaCutoffEnable") == 1 {
+		alphaMode = gltfShaderAlphaMask
+	}
+	ex.ShaderParams["AlphaMode"] = alphaMode
+	ex.ShaderParams["AlphaCutOff"] = getFloat(0.5, "_Cutoff", "_AlphaCutoff")
+	if alphaMode == gltfShaderAlphaOpaque {
+		m.Color.W = 1
+	}
+
+	// Cull: 0=Off
+	m.DoubleSided = hasFloat("_Cull") && getFloat(2, "_Cull") == 0 || getFloat(0, "_DoubleSidedEnable") == 1
+	return m
+}
+
+func (c *unityToMqoState) saveTextureRef(ref *unity.Ref) string {
+	texAsset := c.src.Assets.GetAsset(ref.GUID)
+	if !c.SaveTexrure || texAsset == nil {
+		return ""
+	}
+	name, err := c.saveTexrure(c.src.Assets, texAsset)
+	if err != nil {
+		log.Println(err)
+	}
+	return name
+}
+
+func (c *unityToMqoState) loadTexture(ref *unity.Ref) (image.Image, error) {
+	texAsset := c.src.Assets.GetAsset(ref.GUID)
+	if texAsset == nil {
+		return nil, os.ErrNotExist
+	}
+	r, err := c.src.Assets.Open(texAsset.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return decodeImage(r, texAsset.Path)
+}
+
+// packMetallicRoughness converts Unity metallic(R) and smoothness(A) texture to glTF occlusion(R), roughness(G) and metallic(B) texture.
+func (c *unityToMqoState) packMetallicRoughness(guid string, metallicTex, smoothnessTex *unity.TextureEnv, smoothMin, smoothMax float32, occlusion bool) (string, error) {
+	metallicImg, err := c.loadTexture(metallicTex.Texture)
+	if err != nil {
+		return "", err
+	}
+	smoothnessImg := metallicImg
+	if smoothnessTex != nil {
+		smoothnessImg, err = c.loadTexture(smoothnessTex.Texture)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	b := metallicImg.Bounds()
+	sb := smoothnessImg.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			mc := color.NRGBA64Model.Convert(metallicImg.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA64)
+			sc := color.NRGBA64Model.Convert(smoothnessImg.At(sb.Min.X+x*sb.Dx()/b.Dx(), sb.Min.Y+y*sb.Dy()/b.Dy())).(color.NRGBA64)
+			smoothness := smoothMin + float32(sc.A)/0xffff*(smoothMax-smoothMin)
+			ao := uint8(255)
+			if occlusion {
+				ao = uint8(mc.G >> 8)
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{R: ao, G: uint8(geom.Clamp(1-smoothness, 0, 1) * 255), B: uint8(mc.R >> 8), A: 255})
+		}
+	}
+
+	return c.saveImage(guid+"_metallicRoughness.png", dst)
+}
+
+// saveImage writes the generated image as png to the saved_textures directory.
+func (c *unityToMqoState) saveImage(name string, img image.Image) (string, error) {
+	texDir := filepath.Join(filepath.Dir(c.src.Assets.GetSourcePath()), "saved_textures")
+	_ = os.Mkdir(texDir, 0755)
+	w, err := os.Create(filepath.Join(texDir, name))
+	if err != nil {
+		return "", err
+	}
+	defer w.Close()
+	return "saved_textures/" + name, png.Encode(w, img)
+}
@@ -0,0 +1,313 @@
+package converter
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/binzume/modelconv/mqo"
+	"github.com/binzume/modelconv/unity"
+)
+
+const (
+	testMetallicGUID = "11111111111111111111111111111111"
+	testAlbedoGUID   = "22222222222222222222222222222222"
+	testMaskGUID     = "33333333333333333333333333333333"
+)
+
+const testMaterialHeader = `%YAML 1.1
+%TAG !u! tag:unity3d.com,2011:
+--- !u!21 &2100000
+Material:
+  serializedVersion: 6
+`
+
+// Standard: metallic(R) and smoothness(A) of _MetallicGlossMap, Cutout.
+const testStandardMaterial = testMaterialHeader + `  m_Name: Standard
+  m_Shader: {fileID: 46, guid: 0000000000000000f000000000000000, type: 0}
+  m_ShaderKeywords: _ALPHATEST_ON _METALLICGLOSSMAP
+  m_SavedProperties:
+    serializedVersion: 3
+    m_TexEnvs:
+    - _MainTex:
+        m_Texture: {fileID: 2800000, guid: 22222222222222222222222222222222, type: 3}
+        m_Scale: {x: 2, y: 3}
+        m_Offset: {x: 0.25, y: 0.5}
+    - _MetallicGlossMap:
+        m_Texture: {fileID: 2800000, guid: 11111111111111111111111111111111, type: 3}
+        m_Scale: {x: 1, y: 1}
+        m_Offset: {x: 0, y: 0}
+    m_Floats:
+    - _Mode: 1
+    - _Cutoff: 0.25
+    - _GlossMapScale: 0.5
+    - _Metallic: 0
+    m_Colors:
+    - _Color: {r: 1, g: 0.5, b: 0.25, a: 0.5}
+`
+
+// Standard: smoothness from the albedo alpha, Transparent.
+const testStandardAlbedoSmoothnessMaterial = testMaterialHeader + `  m_Name: StandardAlbedo
+  m_Shader: {fileID: 46, guid: 0000000000000000f000000000000000, type: 0}
+  m_SavedProperties:
+    serializedVersion: 3
+    m_TexEnvs:
+    - _MainTex:
+        m_Texture: {fileID: 2800000, guid: 22222222222222222222222222222222, type: 3}
+        m_Scale: {x: 1, y: 1}
+        m_Offset: {x: 0, y: 0}
+    - _MetallicGlossMap:
+        m_Texture: {fileID: 2800000, guid: 11111111111111111111111111111111, type: 3}
+        m_Scale: {x: 1, y: 1}
+        m_Offset: {x: 0, y: 0}
+    m_Floats:
+    - _Mode: 3
+    - _GlossMapScale: 1
+    - _SmoothnessTextureChannel: 1
+    m_Colors:
+    - _Color: {r: 1, g: 1, b: 1, a: 0.5}
+`
+
+// URP/Lit: _Smoothness scales the smoothness of the texture, alpha clipping.
+const testURPMaterial = testMaterialHeader + `  m_Name: URP
+  m_Shader: {fileID: 4800000, guid: 933532a4fcc9baf4fa0491de14d08ed7, type: 3}
+  m_SavedProperties:
+    serializedVersion: 3
+    m_TexEnvs:
+    - _BaseMap:
+        m_Texture: {fileID: 2800000, guid: 22222222222222222222222222222222, type: 3}
+        m_Scale: {x: 1, y: 1}
+        m_Offset: {x: 0, y: 0}
+    - _MetallicGlossMap:
+        m_Texture: {fileID: 2800000, guid: 11111111111111111111111111111111, type: 3}
+        m_Scale: {x: 1, y: 1}
+        m_Offset: {x: 0, y: 0}
+    m_Floats:
+    - _Surface: 0
+    - _AlphaClip: 1
+    - _Cutoff: 0.75
+    - _Smoothness: 0.5
+    - _WorkflowMode: 1
+    - _Cull: 0
+    m_Colors:
+    - _BaseColor: {r: 0.5, g: 0.5, b: 0.5, a: 1}
+`
+
+// URP/Lit: transparent surface. _AlphaClip is ignored.
+const testURPTransparentMaterial = testMaterialHeader + `  m_Name: URPTransparent
+  m_Shader: {fileID: 4800000, guid: 933532a4fcc9baf4fa0491de14d08ed7, type: 3}
+  m_SavedProperties:
+    serializedVersion: 3
+    m_Floats:
+    - _Surface: 1
+    - _AlphaClip: 1
+    - _Smoothness: 0.25
+    - _Metallic: 0.5
+    m_Colors:
+    - _BaseColor: {r: 1, g: 1, b: 1, a: 0.5}
+`
+
+// HDRP/Lit: _MaskMap (R: metallic, G: occlusion, A: smoothness) with the smoothness remapping.
+const testHDRPMaterial = testMaterialHeader + `  m_Name: HDRP
+  m_Shader: {fileID: 4800000, guid: 6e4ae4064600d784cac1e41a9e6f2e59, type: 3}
+  m_SavedProperties:
+    serializedVersion: 3
+    m_TexEnvs:
+    - _BaseColorMap:
+        m_Texture: {fileID: 2800000, guid: 22222222222222222222222222222222, type: 3}
+        m_Scale: {x: 1, y: 1}
+        m_Offset: {x: 0, y: 0}
+    - _MaskMap:
+        m_Texture: {fileID: 2800000, guid: 33333333333333333333333333333333, type: 3}
+        m_Scale: {x: 1, y: 1}
+        m_Offset: {x: 0, y: 0}
+    m_Floats:
+    - _SmoothnessRemapMin: 0.2
+    - _SmoothnessRemapMax: 0.6
+    - _SurfaceType: 0
+    - _AlphaCutoffEnable: 1
+    - _AlphaCutoff: 0.5
+    - _DoubleSidedEnable: 1
+    m_Colors:
+    - _BaseColor: {r: 1, g: 1, b: 1, a: 1}
+`
+
+func writeTestTexture(t *testing.T, dir, path, guid string, c color.NRGBA) {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	for i := 0; i < len(img.Pix); i += 4 {
+		copy(img.Pix[i:], []uint8{c.R, c.G, c.B, c.A})
+	}
+	writeTestPNG(t, filepath.Join(dir, path), img)
+	if err := os.WriteFile(filepath.Join(dir, path)+".meta", []byte("fileFormatVersion: 2\nguid: "+guid+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConvertUnityMaterial(t *testing.T) {
+	dir := t.TempDir()
+	materials := map[string]string{
+		"Standard":       testStandardMaterial,
+		"StandardAlbedo": testStandardAlbedoSmoothnessMaterial,
+		"URP":            testURPMaterial,
+		"URPTransparent": testURPTransparentMaterial,
+		"HDRP":           testHDRPMaterial,
+	}
+	guids := map[string]string{}
+	i := 0
+	for name, content := range materials {
+		i++
+		guids[name] = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaa0" + string(rune('0'+i))
+		writeTestAsset(t, dir, "Assets/"+name+".mat", guids[name], content)
+	}
+	writeTestTexture(t, dir, "Assets/Metallic.png", testMetallicGUID, color.NRGBA{R: 200, G: 10, B: 20, A: 204})
+	writeTestTexture(t, dir, "Assets/Albedo.png", testAlbedoGUID, color.NRGBA{R: 255, G: 255, B: 255, A: 51})
+	writeTestTexture(t, dir, "Assets/Mask.png", testMaskGUID, color.NRGBA{R: 100, G: 50, B: 0, A: 255})
+
+	assets, err := unity.OpenProject(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer assets.Close()
+
+	convert := func(t *testing.T, name string, textureTransform bool) (*unityMaterial, *mqoMaterialResult) {
+		t.Helper()
+		material, err := unity.LoadMaterial(assets, guids[name])
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := &unityToMqoState{
+			UnityToMQOOption: UnityToMQOOption{SaveTexrure: true, TextureTransform: textureTransform},
+			src:              &unity.Scene{Assets: assets},
+		}
+		mat := &unityMaterial{}
+		m := c.convertMaterial(material, guids[name], mat)
+		return mat, &mqoMaterialResult{m, dir}
+	}
+
+	t.Run("Standard", func(t *testing.T) {
+		_, r := convert(t, "Standard", true)
+		m := r.mat
+		if m.Color.W != 0.5 || m.Color.Y != 0.5 {
+			t.Error("color: ", m.Color)
+		}
+		if m.Texture != "saved_textures/"+testAlbedoGUID+"_Albedo.png" {
+			t.Error("texture: ", m.Texture)
+		}
+		// Unity UV origin is bottom-left. offsetY = 1 - scaleY - offsetY
+		if uv := m.Ex2.ColorParam("UVTransform"); len(uv) != 4 || uv[0] != 2 || uv[1] != 3 || uv[2] != 0.25 || uv[3] != -2.5 {
+			t.Error("UVTransform: ", uv)
+		}
+		if m.Ex2.IntParam("AlphaMode") != gltfShaderAlphaMask || !nearlyEqual(float32(m.Ex2.FloatParam("AlphaCutOff")), 0.25) {
+			t.Error("alpha: ", m.Ex2.ShaderParams["AlphaMode"], m.Ex2.ShaderParams["AlphaCutOff"])
+		}
+		// Factors are 1 because the texture has the values.
+		if m.Ex2.FloatParam("Metallic") != 1 || m.Ex2.FloatParam("Roughness") != 1 {
+			t.Error("factors: ", m.Ex2.ShaderParams["Metallic"], m.Ex2.ShaderParams["Roughness"])
+		}
+		// roughness = 1 - smoothness(0.8) * _GlossMapScale(0.5)
+		r.checkPixel(t, m.Ex2.Mapping("MetallicRoughness"), color.NRGBA{R: 255, G: 153, B: 200, A: 255})
+		if m.Ex2.Mapping("Occlusion") != "" {
+			t.Error("occlusion: ", m.Ex2.Mapping("Occlusion"))
+		}
+	})
+
+	t.Run("StandardUVScale", func(t *testing.T) {
+		// Without TextureTransform, the tiling is applied to the UVs by the caller.
+		mat, r := convert(t, "Standard", false)
+		if r.mat.Ex2.ColorParam("UVTransform") != nil {
+			t.Error("UVTransform: ", r.mat.Ex2.ColorParam("UVTransform"))
+		}
+		if mat.uvScale == nil || mat.uvScale.Y != 3 || mat.uvOffset == nil || mat.uvOffset.X != 0.25 {
+			t.Error("uv: ", mat.uvScale, mat.uvOffset)
+		}
+	})
+
+	t.Run("StandardAlbedoSmoothness", func(t *testing.T) {
+		_, r := convert(t, "StandardAlbedo", true)
+		if r.mat.Ex2.IntParam("AlphaMode") != gltfShaderAlphaBlend {
+			t.Error("alpha: ", r.mat.Ex2.ShaderParams["AlphaMode"])
+		}
+		// smoothness from the albedo alpha (0.2)
+		r.checkPixel(t, r.mat.Ex2.Mapping("MetallicRoughness"), color.NRGBA{R: 255, G: 204, B: 200, A: 255})
+	})
+
+	t.Run("URP", func(t *testing.T) {
+		_, r := convert(t, "URP", true)
+		m := r.mat
+		if m.Texture != "saved_textures/"+testAlbedoGUID+"_Albedo.png" || m.Color.X != 0.5 {
+			t.Error("base: ", m.Texture, m.Color)
+		}
+		if m.Ex2.IntParam("AlphaMode") != gltfShaderAlphaMask || !nearlyEqual(float32(m.Ex2.FloatParam("AlphaCutOff")), 0.75) {
+			t.Error("alpha: ", m.Ex2.ShaderParams["AlphaMode"], m.Ex2.ShaderParams["AlphaCutOff"])
+		}
+		if !m.DoubleSided {
+			t.Error("cull off")
+		}
+		// _Smoothness scales the smoothness of the texture. roughness = 1 - 0.8 * 0.5
+		r.checkPixel(t, m.Ex2.Mapping("MetallicRoughness"), color.NRGBA{R: 255, G: 153, B: 200, A: 255})
+	})
+
+	t.Run("URPTransparent", func(t *testing.T) {
+		_, r := convert(t, "URPTransparent", true)
+		m := r.mat
+		if m.Ex2.IntParam("AlphaMode") != gltfShaderAlphaBlend || m.Color.W != 0.5 {
+			t.Error("alpha: ", m.Ex2.ShaderParams["AlphaMode"], m.Color.W)
+		}
+		if !nearlyEqual(float32(m.Ex2.FloatParam("Metallic")), 0.5) || !nearlyEqual(float32(m.Ex2.FloatParam("Roughness")), 0.75) {
+			t.Error("factors: ", m.Ex2.ShaderParams["Metallic"], m.Ex2.ShaderParams["Roughness"])
+		}
+		if m.Ex2.Mapping("MetallicRoughness") != "" {
+			t.Error("texture: ", m.Ex2.Mapping("MetallicRoughness"))
+		}
+	})
+
+	t.Run("HDRP", func(t *testing.T) {
+		_, r := convert(t, "HDRP", true)
+		m := r.mat
+		if m.Texture != "saved_textures/"+testAlbedoGUID+"_Albedo.png" {
+			t.Error("texture: ", m.Texture)
+		}
+		if m.Ex2.IntParam("AlphaMode") != gltfShaderAlphaMask || !nearlyEqual(float32(m.Ex2.FloatParam("AlphaCutOff")), 0.5) {
+			t.Error("alpha: ", m.Ex2.ShaderParams["AlphaMode"], m.Ex2.ShaderParams["AlphaCutOff"])
+		}
+		if !m.DoubleSided {
+			t.Error("double sided")
+		}
+		// The mask map is used as the occlusion texture. roughness = 1 - (0.2 + 1.0 * (0.6 - 0.2))
+		packed := m.Ex2.Mapping("MetallicRoughness")
+		if m.Ex2.Mapping("Occlusion") != packed {
+			t.Error("occlusion: ", m.Ex2.Mapping("Occlusion"), packed)
+		}
+		r.checkPixel(t, packed, color.NRGBA{R: 50, G: 102, B: 100, A: 255})
+	})
+}
+
+type mqoMaterialResult struct {
+	mat *mqo.Material
+	dir string
+}
+
+// checkPixel checks the generated texture. Values may differ by 1 because of the rounding.
+func (r *mqoMaterialResult) checkPixel(t *testing.T, texture string, expected color.NRGBA) {
+	t.Helper()
+	if texture == "" {
+		t.Fatal("no texture")
+	}
+	f, err := os.Open(filepath.Join(r.dir, texture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := color.NRGBAModel.Convert(img.At(0, 0)).(color.NRGBA)
+	diff := func(a, b uint8) bool { return absInt(int(a)-int(b)) > 1 }
+	if diff(c.R, expected.R) || diff(c.G, expected.G) || diff(c.B, expected.B) || c.A != expected.A {
+		t.Error("pixel: ", texture, c, "expected: ", expected)
+	}
+}
@@ -0,0 +1,199 @@
+package converter
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/binzume/modelconv/geom"
+	"github.com/binzume/modelconv/mqo"
+	"github.com/binzume/modelconv/unity"
+)
+
+const defaultScreenAspectRatio = 16.0 / 9
+
+type unityLODGroup struct {
+	name     string
+	objects  [][]*mqo.Object // Renderers of each LOD
+	coverage []float32
+}
+
+type unityLODLevel struct {
+	group *unityLODGroup
+	level int
+}
+
+// unscaledTransform removes scale from the transform. Lights and cameras should not be scaled.
+func unscaledTransform(transform *geom.Matrix4) *geom.Matrix4 {
+	t, r, _ := transform.Decompose()
+	return geom.NewTRSMatrix4(t, r, &geom.Vector3{X: 1, Y: 1, Z: 1})
+}
+
+// convertLight converts the light to KHR_lights_punctual parameters.
+func (c *unityToMqoState) convertLight(o *unity.GameObject, obj *mqo.Object, light *unity.Light, transform *geom.Matrix4) {
+	var t string
+	switch light.Type {
+	case unity.LightTypeSpot:
+		t = "spot"
+	case unity.LightTypeDirectional:
+		t = "directional"
+	case unity.LightTypePoint:
+		t = "point"
+	default:
+		return // Area lights are not supported.
+	}
+
+	// Unity: sRGB color
+	col := [3]float32{srgbToLinear(light.Color.R), srgbToLinear(light.Color.G), srgbToLinear(light.Color.B)}
+	if light.UseColorTemperature != 0 && light.ColorTemperature > 0 {
+		k := colorTemperatureToRGB(light.ColorTemperature)
+		col[0], col[1], col[2] = col[0]*k[0], col[1]*k[1], col[2]*k[2]
+	}
+
+	// glTF: candela (point, spot) or lux (directional).
+	intensity := light.Intensity
+	if !isHDRPLight(o) {
+		// Lambert BRDF of built-in and URP doesn't have 1/PI.
+		intensity *= math.Pi
+	}
+
+	param := map[string]interface{}{
+		"type":      t,
+		"color":     col[:],
+		"intensity": intensity,
+	}
+	if light.Type != unity.LightTypeDirectional && light.Range > 0 {
+		param["range"] = light.Range
+	}
+	if light.Type == unity.LightTypeSpot {
+		// Unity: full angle in degrees
+		outer := light.SpotAngle / 2 * math.Pi / 180
+		inner := geom.Clamp(light.InnerSpotAngle/2*math.Pi/180, 0, outer*0.999)
+		param["spot"] = map[string]interface{}{
+			"outerConeAngle": outer,
+			"innerConeAngle": inner,
+		}
+	}
+	obj.Extra["light"] = param
+	obj.InternalTransform = unscaledTransform(transform)
+}
+
+// isHDRPLight returns true if the light has HDAdditionalLightData. Intensity of the HDRP lights is in physical units.
+func isHDRPLight(o *unity.GameObject) bool {
+	var monoBehaviours []*unity.MonoBehaviour
+	o.GetComponents(&monoBehaviours)
+	for _, m := range monoBehaviours {
+		if _, ok := m.RawData["m_PointlightHDType"]; ok {
+			return true
+		}
+		if _, ok := m.RawData["m_LightUnit"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *unityToMqoState) convertCamera(obj *mqo.Object, camera *unity.Camera, transform *geom.Matrix4) {
+	param := map[string]interface{}{
+		"znear": camera.NearClipPlane,
+		"zfar":  camera.FarClipPlane,
+	}
+	screenAspect := c.ScreenAspectRatio
+	if screenAspect <= 0 {
+		screenAspect = defaultScreenAspectRatio
+	}
+	if camera.Orthographic != 0 {
+		// Unity: half height
+		param["type"] = "orthographic"
+		param["xmag"] = camera.OrthographicSize * camera.GetAspectRatio(screenAspect)
+		param["ymag"] = camera.OrthographicSize
+	} else {
+		param["type"] = "perspective"
+		param["yfov"] = camera.GetFieldOfView() * math.Pi / 180
+	}
+	obj.Extra["camera"] = param
+	obj.InternalTransform = unscaledTransform(transform)
+}
+
+func (c *unityToMqoState) registerLODGroup(o *unity.GameObject, lodGroup *unity.LODGroup) {
+	g := &unityLODGroup{name: o.Name, objects: make([][]*mqo.Object, len(lodGroup.LODs))}
+	for i, lod := range lodGroup.LODs {
+		g.coverage = append(g.coverage, lod.ScreenRelativeHeight)
+		for _, r := range lod.Renderers {
+			renderer := o.Scene.GetElement2(r.Renderer, lodGroup.PrefabInstance)
+			if _, exists := c.lodRenderers[renderer]; renderer != nil && !exists {
+				c.lodRenderers[renderer] = &unityLODLevel{group: g, level: i}
+			}
+		}
+	}
+	c.lodGroups = append(c.lodGroups, g)
+}
+
+// addLODObject returns false if the renderer should be hidden.
+func (c *unityToMqoState) addLODObject(renderer unity.Element, obj *mqo.Object) bool {
+	l := c.lodRenderers[renderer]
+	if l == nil {
+		return true
+	}
+	l.group.objects[l.level] = append(l.group.objects[l.level], obj)
+	return l.level == 0 || !c.HighestLODOnly
+}
+
+// setLODs links lower LOD objects to the highest LOD object. (MSFT_lod)
+// Multiple renderers in a LOD are grouped under an empty object.
+func (c *unityToMqoState) setLODs() {
+	if c.HighestLODOnly {
+		return
+	}
+	for _, g := range c.lodGroups {
+		var levels []*mqo.Object
+		var coverage []float32
+		for i, objs := range g.objects {
+			if len(objs) == 0 {
+				continue // Use the first LOD if LOD0 is empty.
+			}
+			obj := objs[0]
+			if len(objs) > 1 {
+				obj = mqo.NewObject(fmt.Sprintf("%s_LOD%d", g.name, i))
+				obj.Extra["lodMembers"] = objs
+				c.dst.Objects = append(c.dst.Objects, obj)
+			}
+			levels = append(levels, obj)
+			coverage = append(coverage, g.coverage[i])
+		}
+		if len(levels) > 1 {
+			base := levels[0]
+			base.Extra["lods"] = levels[1:]
+			base.Extra["lodScreenCoverage"] = coverage
+		}
+	}
+}
+
+func srgbToLinear(v float32) float32 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return float32(math.Pow(float64(v+0.055)/1.055, 2.4))
+}
+
+// colorTemperatureToRGB returns linear RGB of the black body. (1000K - 40000K)
+func colorTemperatureToRGB(kelvin float32) [3]float32 {
+	t := float64(geom.Clamp(kelvin, 1000, 40000)) / 100
+	var r, g, b float64
+	if t <= 66 {
+		r = 255
+		g = 99.4708025861*math.Log(t) - 161.1195681661
+	} else {
+		r = 329.698727446 * math.Pow(t-60, -0.1332047592)
+		g = 288.1221695283 * math.Pow(t-60, -0.0755148492)
+	}
+	if t >= 66 {
+		b = 255
+	} else if t > 19 {
+		b = 138.5177312231*math.Log(t-10) - 305.0447927307
+	}
+	return [3]float32{
+		srgbToLinear(geom.Clamp(float32(r/255), 0, 1)),
+		srgbToLinear(geom.Clamp(float32(g/255), 0, 1)),
+		srgbToLinear(geom.Clamp(float32(b/255), 0, 1)),
+	}
+}
@@ -0,0 +1,358 @@
+package converter
+
+import (
+	"math"
+	"testing"
+
+	"github.com/binzume/modelconv/mqo"
+	"github.com/binzume/modelconv/unity"
+)
+
+const testSceneHeader = `%YAML 1.1
+%TAG !u! tag:unity3d.com,2011:
+`
+
+const testLightCameraScene = testSceneHeader + `--- !u!1 &100
+GameObject:
+  m_Component:
+  - component: {fileID: 101}
+  - component: {fileID: 102}
+  m_Name: Spot
+  m_IsActive: 1
+--- !u!4 &101
+Transform:
+  m_GameObject: {fileID: 100}
+  m_LocalRotation: {x: 0, y: 0, z: 0, w: 1}
+  m_LocalPosition: {x: 0, y: 3, z: 0}
+  m_LocalScale: {x: 2, y: 2, z: 2}
+  m_Children: []
+  m_Father: {fileID: 0}
+--- !u!108 &102
+Light:
+  m_GameObject: {fileID: 100}
+  m_Enabled: 1
+  m_Type: 0
+  m_Color: {r: 1, g: 0.5, b: 0, a: 1}
+  m_Intensity: 2
+  m_Range: 10
+  m_SpotAngle: 60
+  m_InnerSpotAngle: 30
+--- !u!1 &200
+GameObject:
+  m_Component:
+  - component: {fileID: 201}
+  - component: {fileID: 202}
+  m_Name: Sun
+  m_IsActive: 1
+--- !u!4 &201
+Transform:
+  m_GameObject: {fileID: 200}
+  m_LocalRotation: {x: 0, y: 0, z: 0, w: 1}
+  m_LocalPosition: {x: 0, y: 0, z: 0}
+  m_LocalScale: {x: 1, y: 1, z: 1}
+  m_Children: []
+  m_Father: {fileID: 0}
+--- !u!108 &202
+Light:
+  m_GameObject: {fileID: 200}
+  m_Enabled: 1
+  m_Type: 1
+  m_Color: {r: 1, g: 1, b: 1, a: 1}
+  m_Intensity: 1
+  m_Range: 10
+--- !u!1 &300
+GameObject:
+  m_Component:
+  - component: {fileID: 301}
+  - component: {fileID: 302}
+  m_Name: OrthoCamera
+  m_IsActive: 1
+--- !u!4 &301
+Transform:
+  m_GameObject: {fileID: 300}
+  m_LocalRotation: {x: 0, y: 0, z: 0, w: 1}
+  m_LocalPosition: {x: 0, y: 1, z: -10}
+  m_LocalScale: {x: 1, y: 1, z: 1}
+  m_Children: []
+  m_Father: {fileID: 0}
+--- !u!20 &302
+Camera:
+  m_GameObject: {fileID: 300}
+  m_Enabled: 1
+  m_NormalizedViewPortRect:
+    serializedVersion: 2
+    x: 0
+    y: 0
+    width: 0.5
+    height: 1
+  near clip plane: 0.3
+  far clip plane: 1000
+  field of view: 60
+  orthographic: 1
+  orthographic size: 5
+--- !u!1 &400
+GameObject:
+  m_Component:
+  - component: {fileID: 401}
+  - component: {fileID: 402}
+  m_Name: Camera
+  m_IsActive: 1
+--- !u!4 &401
+Transform:
+  m_GameObject: {fileID: 400}
+  m_LocalRotation: {x: 0, y: 0, z: 0, w: 1}
+  m_LocalPosition: {x: 0, y: 0, z: 0}
+  m_LocalScale: {x: 1, y: 1, z: 1}
+  m_Children: []
+  m_Father: {fileID: 0}
+--- !u!20 &402
+Camera:
+  m_GameObject: {fileID: 400}
+  m_Enabled: 1
+  near clip plane: 0.1
+  far clip plane: 100
+  field of view: 45
+  orthographic: 0
+  orthographic size: 5
+`
+
+func convertTestScene(t *testing.T, scene string, option *UnityToMQOOption) *mqo.Document {
+	t.Helper()
+	dir := t.TempDir()
+	writeTestAsset(t, dir, "Assets/Test.unity", "fedcba9876543210fedcba9876543210", scene)
+	assets, err := unity.OpenProject(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := unity.LoadScene(assets, "Assets/Test.unity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := NewUnityToMQOConverter(option).Convert(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func findTestObject(t *testing.T, doc *mqo.Document, name string) *mqo.Object {
+	t.Helper()
+	for _, obj := range doc.Objects {
+		if obj.Name == name {
+			return obj
+		}
+	}
+	t.Fatal("object not found: ", name)
+	return nil
+}
+
+func nearlyEqual(a, b float32) bool {
+	return math.Abs(float64(a-b)) < 1e-4
+}
+
+func TestConvertLight(t *testing.T) {
+	doc := convertTestScene(t, testLightCameraScene, &UnityToMQOOption{ConvertScale: 1})
+
+	spot := findTestObject(t, doc, "Spot")
+	param, ok := spot.Extra["light"].(map[string]interface{})
+	if !ok {
+		t.Fatal("no light: ", spot.Extra)
+	}
+	col := param["color"].([]float32)
+	if param["type"] != "spot" || !nearlyEqual(col[0], 1) || !nearlyEqual(col[1], srgbToLinear(0.5)) || col[2] != 0 {
+		t.Error("spot light: ", param)
+	}
+	// built-in pipeline: intensity * PI
+	if !nearlyEqual(param["intensity"].(float32), 2*math.Pi) || param["range"] != float32(10) {
+		t.Error("spot intensity: ", param)
+	}
+	cone := param["spot"].(map[string]interface{})
+	if !nearlyEqual(cone["outerConeAngle"].(float32), math.Pi/6) || !nearlyEqual(cone["innerConeAngle"].(float32), math.Pi/12) {
+		t.Error("spot cone: ", cone)
+	}
+	// Scale is removed from the light transform.
+	if _, _, s := spot.InternalTransform.Decompose(); !nearlyEqual(s.X, 1) || !nearlyEqual(s.Y, 1) {
+		t.Error("light scale: ", s)
+	}
+
+	sun := findTestObject(t, doc, "Sun")
+	param = sun.Extra["light"].(map[string]interface{})
+	if _, hasRange := param["range"]; param["type"] != "directional" || hasRange {
+		t.Error("directional light: ", param)
+	}
+}
+
+func TestConvertCamera(t *testing.T) {
+	doc := convertTestScene(t, testLightCameraScene, &UnityToMQOOption{ConvertScale: 1, ScreenAspectRatio: 2})
+
+	ortho := findTestObject(t, doc, "OrthoCamera").Extra["camera"].(map[string]interface{})
+	// aspect: 2 * 0.5 / 1
+	if ortho["type"] != "orthographic" || ortho["xmag"] != float32(5) || ortho["ymag"] != float32(5) || ortho["znear"] != float32(0.3) {
+		t.Error("orthographic camera: ", ortho)
+	}
+
+	perspective := findTestObject(t, doc, "Camera").Extra["camera"].(map[string]interface{})
+	if perspective["type"] != "perspective" || !nearlyEqual(perspective["yfov"].(float32), math.Pi/4) || perspective["zfar"] != float32(100) {
+		t.Error("perspective camera: ", perspective)
+	}
+
+	doc = convertTestScene(t, testLightCameraScene, &UnityToMQOOption{ConvertScale: 1})
+	ortho = findTestObject(t, doc, "OrthoCamera").Extra["camera"].(map[string]interface{})
+	if !nearlyEqual(ortho["xmag"].(float32), 5*16.0/9*0.5) {
+		t.Error("default aspect ratio: ", ortho)
+	}
+}
+
+const testLODScene = testSceneHeader + `--- !u!1 &400
+GameObject:
+  m_Component:
+  - component: {fileID: 401}
+  - component: {fileID: 402}
+  m_Name: LODs
+  m_IsActive: 1
+--- !u!4 &401
+Transform:
+  m_GameObject: {fileID: 400}
+  m_LocalRotation: {x: 0, y: 0, z: 0, w: 1}
+  m_LocalPosition: {x: 0, y: 0, z: 0}
+  m_LocalScale: {x: 1, y: 1, z: 1}
+  m_Children:
+  - {fileID: 411}
+  - {fileID: 421}
+  - {fileID: 431}
+  m_Father: {fileID: 0}
+--- !u!205 &402
+LODGroup:
+  m_GameObject: {fileID: 400}
+  m_Enabled: 1
+  m_LODs:
+  - screenRelativeHeight: 0.5
+    renderers:
+    - renderer: {fileID: 433}
+  - screenRelativeHeight: 0.1
+    renderers:
+    - renderer: {fileID: 413}
+    - renderer: {fileID: 423}
+--- !u!1 &410
+GameObject:
+  m_Component:
+  - component: {fileID: 411}
+  - component: {fileID: 412}
+  - component: {fileID: 413}
+  m_Name: A
+  m_IsActive: 1
+--- !u!4 &411
+Transform:
+  m_GameObject: {fileID: 410}
+  m_LocalRotation: {x: 0, y: 0, z: 0, w: 1}
+  m_LocalPosition: {x: 1, y: 0, z: 0}
+  m_LocalScale: {x: 1, y: 1, z: 1}
+  m_Children: []
+  m_Father: {fileID: 401}
+--- !u!33 &412
+MeshFilter:
+  m_GameObject: {fileID: 410}
+  m_Mesh: {fileID: 10202, guid: 0000000000000000e000000000000000, type: 0}
+--- !u!23 &413
+MeshRenderer:
+  m_GameObject: {fileID: 410}
+  m_Enabled: 1
+  m_Materials:
+  - {fileID: 10303, guid: 0000000000000000f000000000000000, type: 0}
+--- !u!1 &420
+GameObject:
+  m_Component:
+  - component: {fileID: 421}
+  - component: {fileID: 422}
+  - component: {fileID: 423}
+  m_Name: B
+  m_IsActive: 1
+--- !u!4 &421
+Transform:
+  m_GameObject: {fileID: 420}
+  m_LocalRotation: {x: 0, y: 0, z: 0, w: 1}
+  m_LocalPosition: {x: 2, y: 0, z: 0}
+  m_LocalScale: {x: 1, y: 1, z: 1}
+  m_Children: []
+  m_Father: {fileID: 401}
+--- !u!33 &422
+MeshFilter:
+  m_GameObject: {fileID: 420}
+  m_Mesh: {fileID: 10202, guid: 0000000000000000e000000000000000, type: 0}
+--- !u!23 &423
+MeshRenderer:
+  m_GameObject: {fileID: 420}
+  m_Enabled: 1
+  m_Materials:
+  - {fileID: 10303, guid: 0000000000000000f000000000000000, type: 0}
+--- !u!1 &430
+GameObject:
+  m_Component:
+  - component: {fileID: 431}
+  - component: {fileID: 432}
+  - component: {fileID: 433}
+  m_Name: C
+  m_IsActive: 1
+--- !u!4 &431
+Transform:
+  m_GameObject: {fileID: 430}
+  m_LocalRotation: {x: 0, y: 0, z: 0, w: 1}
+  m_LocalPosition: {x: 0, y: 0, z: 0}
+  m_LocalScale: {x: 1, y: 1, z: 1}
+  m_Children: []
+  m_Father: {fileID: 401}
+--- !u!33 &432
+MeshFilter:
+  m_GameObject: {fileID: 430}
+  m_Mesh: {fileID: 10202, guid: 0000000000000000e000000000000000, type: 0}
+--- !u!23 &433
+MeshRenderer:
+  m_GameObject: {fileID: 430}
+  m_Enabled: 1
+  m_Materials:
+  - {fileID: 10303, guid: 0000000000000000f000000000000000, type: 0}
+`
+
+func TestConvertLODGroupWithMultipleRenderers(t *testing.T) {
+	doc := convertTestScene(t, testLODScene, &UnityToMQOOption{ConvertScale: 1})
+	a, b, c := findTestObject(t, doc, "A(Cube)"), findTestObject(t, doc, "B(Cube)"), findTestObject(t, doc, "C(Cube)")
+	if !a.Visible || !b.Visible || !c.Visible {
+		t.Fatal("renderers should be visible: ", a.Visible, b.Visible, c.Visible)
+	}
+	group := findTestObject(t, doc, "LODs_LOD1")
+	if members, _ := group.Extra["lodMembers"].([]*mqo.Object); len(members) != 2 || members[0] != a || members[1] != b {
+		t.Fatal("lod members: ", group.Extra)
+	}
+	if lods, _ := c.Extra["lods"].([]*mqo.Object); len(lods) != 1 || lods[0] != group {
+		t.Fatal("lods: ", c.Extra)
+	}
+
+	gltfdoc, err := NewMQOToGLTFConverter(nil).Convert(doc, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeByName := map[string]uint32{}
+	for i, n := range gltfdoc.Nodes {
+		nodeByName[n.Name] = uint32(i)
+	}
+	lod, ok := gltfdoc.Nodes[nodeByName["C(Cube)"]].Extensions["MSFT_lod"].(map[string]interface{})
+	if !ok || len(lod["ids"].([]uint32)) != 1 || lod["ids"].([]uint32)[0] != nodeByName["LODs_LOD1"] {
+		t.Fatal("MSFT_lod: ", gltfdoc.Nodes[nodeByName["C(Cube)"]].Extensions)
+	}
+	children := gltfdoc.Nodes[nodeByName["LODs_LOD1"]].Children
+	if len(children) != 2 || children[0] != nodeByName["A(Cube)"] || children[1] != nodeByName["B(Cube)"] {
+		t.Error("LOD1 group children: ", children)
+	}
+	for _, n := range gltfdoc.Scenes[0].Nodes {
+		if n == nodeByName["A(Cube)"] || n == nodeByName["LODs_LOD1"] {
+			t.Error("lower LOD nodes should not be in the scene: ", gltfdoc.Nodes[n].Name)
+		}
+	}
+	for _, n := range gltfdoc.Nodes {
+		for _, child := range n.Children {
+			if child == nodeByName["A(Cube)"] && n.Name != "LODs_LOD1" {
+				t.Error("LOD member is also a child of ", n.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,411 @@
+package converter
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"math"
+	"math/rand"
+	"strings"
+
+	"github.com/binzume/modelconv/fbx"
+	"github.com/binzume/modelconv/geom"
+	"github.com/binzume/modelconv/mqo"
+	"github.com/binzume/modelconv/unity"
+)
+
+const defaultTerrainBaseMapResolution = 1024
+
+type terrainTreeTemplate struct {
+	objects   []*mqo.Object
+	transform *geom.Matrix4
+}
+
+// convertTerrain generates a mesh from the heightmap. Rotation and scale of the terrain are ignored as in Unity.
+func (c *unityToMqoState) convertTerrain(obj *mqo.Object, terrain *unity.Terrain, transform *geom.Matrix4, visible bool) {
+	if !terrain.TerrainData.IsValid() {
+		return
+	}
+	data, err := unity.LoadTerrainData(c.src.Assets, terrain.TerrainData)
+	if err != nil {
+		log.Println("Can not load terrain: ", obj.Name, err)
+		return
+	}
+	heights, err := data.GetHeights()
+	if err != nil {
+		log.Println("Can not load terrain: ", obj.Name, err)
+		return
+	}
+	origin := transform.ApplyTo(&geom.Vector3{})
+	s := c.ConvertScale
+	terrainTransform := geom.NewTranslateMatrix4(origin.X, origin.Y, origin.Z).Mul(geom.NewScaleMatrix4(s, s, s))
+
+	obj.Name += "(Terrain)"
+	obj.Visible = obj.Visible && visible && terrain.Enabled != 0
+	mat := c.convertTerrainMaterial(terrain.TerrainData.GUID, data)
+	c.addTerrainMesh(obj, data, heights, terrainTransform, mat)
+
+	if terrain.DrawTreesAndFoliage != 0 {
+		c.convertTrees(obj, data, terrainTransform, visible)
+		c.convertDetails(obj, data, heights, terrainTransform, visible)
+	}
+}
+
+func (c *unityToMqoState) addTerrainMesh(obj *mqo.Object, data *unity.TerrainData, heights []float32, transform *geom.Matrix4, mat int) {
+	res := data.GetResolution()
+	size := data.GetSize()
+
+	// Decimate the grid to TerrainResolution
+	step := 1
+	if c.TerrainResolution > 1 && res > c.TerrainResolution {
+		step = (res + c.TerrainResolution - 3) / (c.TerrainResolution - 1)
+	}
+	var grid []int
+	for i := 0; i < res-1; i += step {
+		grid = append(grid, i)
+	}
+	grid = append(grid, res-1)
+	n := len(grid)
+
+	height := func(x, z int) float32 {
+		x = int(geom.Clamp(float32(x), 0, float32(res-1)))
+		z = int(geom.Clamp(float32(z), 0, float32(res-1)))
+		return heights[z*res+x] * size.Y
+	}
+	cell := float32(step) / float32(res-1)
+	voffset := len(obj.Vertexes)
+	normals := make([]*geom.Vector3, 0, n*n)
+	for _, iz := range grid {
+		for _, ix := range grid {
+			x, z := float32(ix)/float32(res-1)*size.X, float32(iz)/float32(res-1)*size.Z
+			obj.Vertexes = append(obj.Vertexes, transform.ApplyTo(&geom.Vector3{X: x, Y: height(ix, iz), Z: -z}))
+			dx := (height(ix+step, iz) - height(ix-step, iz)) / (2 * cell * size.X)
+			dz := (height(ix, iz+step) - height(ix, iz-step)) / (2 * cell * size.Z)
+			// Unity: left-handed
+			normals = append(normals, (&geom.Vector3{X: -dx, Y: 1, Z: dz}).Normalize())
+		}
+	}
+
+	uv := func(v int) geom.Vector2 {
+		// Unity: origin is bottom-left
+		return geom.Vector2{X: float32(grid[v%n]) / float32(res-1), Y: 1 - float32(grid[v/n])/float32(res-1)}
+	}
+	for z := 0; z < n-1; z++ {
+		for x := 0; x < n-1; x++ {
+			v0, v1, v2, v3 := z*n+x, (z+1)*n+x, (z+1)*n+x+1, z*n+x+1
+			for _, tri := range [][]int{{v0, v1, v2}, {v0, v2, v3}} {
+				face := &mqo.Face{Material: mat}
+				for _, v := range tri {
+					face.Verts = append(face.Verts, v+voffset)
+					face.UVs = append(face.UVs, uv(v))
+					face.Normals = append(face.Normals, normals[v])
+				}
+				obj.Faces = append(obj.Faces, face)
+			}
+		}
+	}
+}
+
+func (c *unityToMqoState) convertTerrainMaterial(guid string, data *unity.TerrainData) int {
+	key := guid + "_terrain"
+	if m, ok := c.mat[key]; ok {
+		return m.index
+	}
+	mat := &unityMaterial{index: len(c.dst.Materials)}
+	c.mat[key] = mat
+	c.matToGUID[mat.index] = key
+
+	m := &mqo.Material{Name: data.Name, Color: geom.Vector4{X: 1, Y: 1, Z: 1, W: 1}, Diffuse: 0.8, Shader: mqo.ShaderLambert}
+	ex := mqo.NewMaterialEx2(mqo.ShaderNameGlTF)
+	ex.ShaderType = mqo.ShaderTypeHLSL
+	ex.ShaderParams["Extensions.Unlit"] = false
+	ex.ShaderParams["Metallic"] = float32(0)
+	ex.ShaderParams["Roughness"] = float32(1)
+	m.Ex2 = ex
+	if c.SaveTexrure {
+		diffuse, normal, err := c.bakeTerrainTextures(data)
+		if err == nil {
+			m.Texture, err = c.saveImage(guid+"_terrain.png", diffuse)
+		}
+		if err == nil && normal != nil {
+			m.BumpTexture, err = c.saveImage(guid+"_terrain_normal.png", normal)
+		}
+		if err != nil {
+			log.Println("Can not bake terrain texture:", err)
+		}
+	}
+	c.dst.Materials = append(c.dst.Materials, m)
+	return mat.index
+}
+
+// bakeTerrainTextures blends diffuse and normal textures of the terrain layers by splat alphamaps.
+func (c *unityToMqoState) bakeTerrainTextures(data *unity.TerrainData) (image.Image, image.Image, error) {
+	alphamaps, err := data.GetAlphamaps()
+	if err != nil {
+		return nil, nil, err
+	}
+	layers := data.GetLayers(c.src.Assets)
+	if len(layers) == 0 {
+		return nil, nil, fmt.Errorf("no terrain layers: %s", data.Name)
+	}
+	diffuseImages := make([]image.Image, len(layers))
+	normalImages := make([]image.Image, len(layers))
+	hasNormal := false
+	for i, layer := range layers {
+		if layer.DiffuseTexture.IsValid() {
+			if diffuseImages[i], err = c.loadTexture(layer.DiffuseTexture); err != nil {
+				log.Println("Can not load terrain texture:", layer.Name, err)
+			}
+		}
+		if layer.NormalMapTexture.IsValid() {
+			if normalImages[i], err = c.loadTexture(layer.NormalMapTexture); err != nil {
+				log.Println("Can not load terrain texture:", layer.Name, err)
+			}
+			hasNormal = hasNormal || normalImages[i] != nil
+		}
+	}
+
+	size := data.GetSize()
+	res := data.SplatDatabase.BaseMapResolution
+	if res <= 0 {
+		res = defaultTerrainBaseMapResolution
+	}
+	diffuse := image.NewNRGBA(image.Rect(0, 0, res, res))
+	var normal *image.NRGBA
+	if hasNormal {
+		normal = image.NewNRGBA(image.Rect(0, 0, res, res))
+	}
+	for y := 0; y < res; y++ {
+		for x := 0; x < res; x++ {
+			// Unity: origin is bottom-left
+			u, v := (float32(x)+0.5)/float32(res), 1-(float32(y)+0.5)/float32(res)
+			var col [3]float32
+			var nrm geom.Vector3
+			var total float32
+			for i, layer := range layers {
+				w := splatWeight(alphamaps, i, u, v)
+				if w <= 0 {
+					continue
+				}
+				total += w
+				tileSize := layer.TileSize
+				if tileSize.X == 0 || tileSize.Y == 0 {
+					tileSize = geom.Vector2{X: 1, Y: 1}
+				}
+				tu := (u*size.X + layer.TileOffset.X) / tileSize.X
+				tv := (v*size.Z + layer.TileOffset.Y) / tileSize.Y
+				if img := diffuseImages[i]; img != nil {
+					s := sampleRepeat(img, tu, tv)
+					col[0], col[1], col[2] = col[0]+s[0]*w, col[1]+s[1]*w, col[2]+s[2]*w
+				} else {
+					col[0], col[1], col[2] = col[0]+w, col[1]+w, col[2]+w
+				}
+				n := &geom.Vector3{X: 0, Y: 0, Z: 1}
+				if img := normalImages[i]; img != nil {
+					s := sampleRepeat(img, tu, tv)
+					scale := layer.NormalScale
+					n = &geom.Vector3{X: (s[0]*2 - 1) * scale, Y: (s[1]*2 - 1) * scale, Z: s[2]*2 - 1}
+				}
+				nrm = *nrm.Add(n.Scale(w))
+			}
+			if total > 0 {
+				col[0], col[1], col[2] = col[0]/total, col[1]/total, col[2]/total
+			}
+			diffuse.SetNRGBA(x, y, color.NRGBA{R: toUint8(col[0]), G: toUint8(col[1]), B: toUint8(col[2]), A: 255})
+			if normal != nil {
+				if nrm.Len() == 0 {
+					nrm = geom.Vector3{X: 0, Y: 0, Z: 1}
+				}
+				n := nrm.Normalize()
+				normal.SetNRGBA(x, y, color.NRGBA{R: toUint8(n.X*0.5 + 0.5), G: toUint8(n.Y*0.5 + 0.5), B: toUint8(n.Z*0.5 + 0.5), A: 255})
+			}
+		}
+	}
+	if normal == nil {
+		return diffuse, nil, nil
+	}
+	return diffuse, normal, nil
+}
+
+// splatWeight returns the weight of the layer. RGBA channels of the alphamaps are weights of 4 layers.
+func splatWeight(alphamaps []*image.NRGBA, layer int, u, v float32) float32 {
+	if len(alphamaps) == 0 {
+		if layer == 0 {
+			return 1
+		}
+		return 0
+	}
+	if layer/4 >= len(alphamaps) {
+		return 0
+	}
+	img := alphamaps[layer/4]
+	b := img.Bounds()
+	x := b.Min.X + int(geom.Clamp(u*float32(b.Dx()), 0, float32(b.Dx()-1)))
+	y := b.Min.Y + int(geom.Clamp((1-v)*float32(b.Dy()), 0, float32(b.Dy()-1)))
+	// Note: RGB of the transparent pixels are lost in img.At().
+	c := img.NRGBAAt(x, y)
+	return float32([]uint8{c.R, c.G, c.B, c.A}[layer%4]) / 0xff
+}
+
+// sampleRepeat samples the texture with repeat wrapping. (nearest)
+func sampleRepeat(img image.Image, u, v float32) [4]float32 {
+	b := img.Bounds()
+	u, v = u-float32(math.Floor(float64(u))), v-float32(math.Floor(float64(v)))
+	x := b.Min.X + int(geom.Clamp(u*float32(b.Dx()), 0, float32(b.Dx()-1)))
+	y := b.Min.Y + int(geom.Clamp((1-v)*float32(b.Dy()), 0, float32(b.Dy()-1)))
+	c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+	return [4]float32{float32(c.R) / 0xffff, float32(c.G) / 0xffff, float32(c.B) / 0xffff, float32(c.A) / 0xffff}
+}
+
+func toUint8(v float32) uint8 {
+	return uint8(geom.Clamp(v, 0, 1)*255 + 0.5)
+}
+
+// convertTrees places tree prototypes at the tree instances.
+func (c *unityToMqoState) convertTrees(obj *mqo.Object, data *unity.TerrainData, transform *geom.Matrix4, active bool) {
+	size := data.GetSize()
+	prototypes := data.DetailDatabase.TreePrototypes
+	for _, tree := range data.DetailDatabase.TreeInstances {
+		if tree.Index < 0 || tree.Index >= len(prototypes) || !prototypes[tree.Index].Prefab.IsValid() {
+			continue
+		}
+		prefab := prototypes[tree.Index].Prefab
+		asset := c.src.Assets.GetAsset(prefab.GUID)
+		if asset == nil {
+			continue
+		}
+		p := tree.Position
+		m := transform.Mul(geom.NewTranslateMatrix4(p.X*size.X, p.Y*size.Y, -p.Z*size.Z)).
+			Mul(terrainInstanceMatrix(tree.Rotation, tree.WidthScale, tree.HeightScale))
+		c.placeTerrainModel(obj, prefab, asset, m, active)
+	}
+}
+
+// convertDetails places the mesh detail prototypes at random positions in the detail cells. Grass textures are not supported.
+func (c *unityToMqoState) convertDetails(obj *mqo.Object, data *unity.TerrainData, heights []float32, transform *geom.Matrix4, active bool) {
+	size := data.GetSize()
+	for i, prototype := range data.DetailDatabase.DetailPrototypes {
+		if prototype.UsePrototypeMesh == 0 || !prototype.Prototype.IsValid() {
+			log.Println("Terrain grass textures are not supported: ", obj.Name)
+			continue
+		}
+		asset := c.src.Assets.GetAsset(prototype.Prototype.GUID)
+		if asset == nil {
+			continue
+		}
+		counts, res, err := data.GetDetailCounts(i)
+		if err != nil {
+			log.Println("Can not load terrain details: ", obj.Name, err)
+			continue
+		}
+		// Positions are not same as Unity, but stable for each conversion.
+		rnd := rand.New(rand.NewSource(int64(i)))
+		for cell, n := range counts {
+			for j := 0; j < n; j++ {
+				u := (float32(cell%res) + rnd.Float32()) / float32(res)
+				v := (float32(cell/res) + rnd.Float32()) / float32(res)
+				w := prototype.MinWidth + (prototype.MaxWidth-prototype.MinWidth)*rnd.Float32()
+				h := prototype.MinHeight + (prototype.MaxHeight-prototype.MinHeight)*rnd.Float32()
+				m := transform.Mul(geom.NewTranslateMatrix4(u*size.X, terrainHeight(heights, data.GetResolution(), u, v)*size.Y, -v*size.Z)).
+					Mul(terrainInstanceMatrix(rnd.Float32()*math.Pi*2, w, h))
+				c.placeTerrainModel(obj, prototype.Prototype, asset, m, active)
+			}
+		}
+	}
+}
+
+// terrainInstanceMatrix returns the matrix of the tree or the detail. rotation is in radians around Y axis.
+func terrainInstanceMatrix(rotation, width, height float32) *geom.Matrix4 {
+	sin, cos := math.Sincos(float64(rotation) / 2)
+	return geom.NewRotationMatrix4FromQuaternion(geom.NewQuaternion(0, -float32(sin), 0, float32(cos))).
+		Mul(geom.NewScaleMatrix4(width, height, width))
+}
+
+// terrainHeight returns the bilinear interpolated height at the normalized position.
+func terrainHeight(heights []float32, res int, u, v float32) float32 {
+	x, z := geom.Clamp(u, 0, 1)*float32(res-1), geom.Clamp(v, 0, 1)*float32(res-1)
+	x0, z0 := int(x), int(z)
+	x1, z1 := x0+1, z0+1
+	if x1 >= res {
+		x1 = x0
+	}
+	if z1 >= res {
+		z1 = z0
+	}
+	fx, fz := x-float32(x0), z-float32(z0)
+	h0 := heights[z0*res+x0]*(1-fx) + heights[z0*res+x1]*fx
+	h1 := heights[z1*res+x0]*(1-fx) + heights[z1*res+x1]*fx
+	return h0*(1-fz) + h1*fz
+}
+
+// placeTerrainModel places the prefab or the model of the tree or the detail.
+func (c *unityToMqoState) placeTerrainModel(obj *mqo.Object, ref *unity.Ref, asset *unity.Asset, transform *geom.Matrix4, active bool) {
+	if strings.HasSuffix(asset.Path, ".prefab") {
+		scene, ok := c.prefabScenes[ref.GUID]
+		if !ok {
+			var err error
+			scene, err = unity.LoadSceneAsset(c.src.Assets, asset)
+			if err != nil {
+				log.Println("Can not load prefab: ", asset.Path, err)
+			}
+			c.prefabScenes[ref.GUID] = scene
+		}
+		if scene != nil {
+			for _, o := range scene.Objects {
+				c.convertObject(o, obj.Depth+1, transform, active)
+			}
+		}
+	} else if err := c.addTerrainModel(obj, ref, asset, transform, active); err != nil {
+		log.Println("Can not load model: ", asset.Path, err)
+	}
+}
+
+// addTerrainModel converts the model once and clones it for the other instances.
+func (c *unityToMqoState) addTerrainModel(obj *mqo.Object, ref *unity.Ref, asset *unity.Asset, transform *geom.Matrix4, active bool) error {
+	if t, ok := c.treeTemplates[ref.GUID]; ok {
+		if t == nil {
+			return nil
+		}
+		m := transform.Mul(t.transform.Inverse())
+		for _, src := range t.objects {
+			o := src.Clone()
+			o.ApplyTransform(m)
+			c.dst.Objects = append(c.dst.Objects, o)
+			o.UID = len(c.dst.Objects)
+		}
+		return nil
+	}
+	c.treeTemplates[ref.GUID] = nil
+	if !strings.HasSuffix(asset.Path, ".fbx") {
+		return fmt.Errorf("not supported: %s", asset.Path)
+	}
+	r, err := c.src.Assets.Open(asset.Path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	doc, err := fbx.Parse(r)
+	if err != nil {
+		return err
+	}
+
+	objectIdx := len(c.dst.Objects)
+	scale := doc.GlobalSettings.GetProperty("UnitScaleFactor").ToFloat32(1) * 0.01
+	_, err = NewFBXToMQOConverter(&FBXToMQOOption{
+		ObjectDepth:   obj.Depth + 1,
+		RootTransform: transform.Mul(geom.NewScaleMatrix4(-scale, scale, -scale)),
+		DisableBone:   true,
+	}).ConvertTo(c.dst, doc)
+	if err != nil {
+		return err
+	}
+	t := &terrainTreeTemplate{objects: append([]*mqo.Object{}, c.dst.Objects[objectIdx:]...), transform: transform}
+	for i, o := range t.objects {
+		o.Visible = o.Visible && active
+		o.Extra["sharedGeometryKey"] = fmt.Sprint(ref.GUID, "_tree", i)
+		o.InternalTransform = transform
+	}
+	c.treeTemplates[ref.GUID] = t
+	return nil
+}
@@ -0,0 +1,210 @@
+package converter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/binzume/modelconv/geom"
+	"github.com/binzume/modelconv/unity"
+)
+
+const testTerrainScene = `%YAML 1.1
+%TAG !u! tag:unity3d.com,2011:
+--- !u!1 &100
+GameObject:
+  m_Component:
+  - component: {fileID: 101}
+  - component: {fileID: 102}
+  m_Name: Terrain
+  m_IsActive: 1
+--- !u!4 &101
+Transform:
+  m_GameObject: {fileID: 100}
+  m_LocalRotation: {x: 0, y: 0, z: 0, w: 1}
+  m_LocalPosition: {x: 1, y: 2, z: 3}
+  m_LocalScale: {x: 1, y: 1, z: 1}
+  m_Children: []
+  m_Father: {fileID: 0}
+--- !u!218 &102
+Terrain:
+  m_GameObject: {fileID: 100}
+  m_Enabled: 1
+  m_TerrainData: {fileID: 15600000, guid: 0123456789abcdef0123456789abcdef, type: 2}
+  m_DrawHeightmap: 1
+  m_DrawTreesAndFoliage: 0
+`
+
+const testTerrainData = `%YAML 1.1
+%TAG !u! tag:unity3d.com,2011:
+--- !u!156 &15600000
+TerrainData:
+  m_Name: TestTerrain
+  m_SplatDatabase:
+    m_TerrainLayers: []
+    m_AlphaTextures: []
+    m_AlphamapResolution: 2
+    m_BaseMapResolution: 16
+  m_DetailDatabase:
+    m_DetailPrototypes: []
+    m_TreeInstances: []
+    m_TreePrototypes: []
+  m_Heightmap:
+    m_Heights: 0000ff3f00000000fe7f0000000000000000
+    m_Resolution: 3
+    m_Scale: {x: 5, y: 100, z: 10}
+`
+
+func writeTestAsset(t *testing.T, dir, path, guid, content string) {
+	t.Helper()
+	path = filepath.Join(dir, path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+".meta", []byte("fileFormatVersion: 2\nguid: "+guid+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConvertTerrain(t *testing.T) {
+	dir := t.TempDir()
+	writeTestAsset(t, dir, "Assets/Test.unity", "fedcba9876543210fedcba9876543210", testTerrainScene)
+	writeTestAsset(t, dir, "Assets/Terrain.asset", "0123456789abcdef0123456789abcdef", testTerrainData)
+
+	assets, err := unity.OpenProject(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scene, err := unity.LoadScene(assets, "Assets/Test.unity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := NewUnityToMQOConverter(&UnityToMQOOption{ConvertScale: 1}).Convert(scene)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(doc.Objects) != 1 {
+		t.Fatal("objects: ", len(doc.Objects))
+	}
+	obj := doc.Objects[0]
+	if obj.Name != "Terrain(Terrain)" || len(obj.Vertexes) != 9 || len(obj.Faces) != 8 {
+		t.Fatal("terrain: ", obj.Name, len(obj.Vertexes), len(obj.Faces))
+	}
+	// size: 10 x 200 x 20, origin: (1, 2, -3)
+	if v := obj.Vertexes[4]; v.X != 6 || v.Y != 202 || v.Z != -13 {
+		t.Error("center vertex: ", v)
+	}
+	if v := obj.Vertexes[1]; v.X != 6 || v.Y < 101 || v.Y > 103 || v.Z != -3 {
+		t.Error("edge vertex: ", v)
+	}
+	if f := obj.Faces[0]; len(f.UVs) != 3 || f.UVs[0].X != 0 || f.UVs[0].Y != 1 || len(f.Normals) != 3 {
+		t.Error("face: ", f.UVs, f.Normals)
+	}
+	mat := doc.Materials[obj.Faces[0].Material]
+	if mat.Name != "TestTerrain" || mat.GetShaderName() != "glTF" {
+		t.Error("material: ", mat.Name, mat.GetShaderName())
+	}
+}
+
+const testTerrainDetailData = `%YAML 1.1
+%TAG !u! tag:unity3d.com,2011:
+--- !u!156 &15600000
+TerrainData:
+  m_Name: TestTerrain
+  m_SplatDatabase:
+    m_TerrainLayers: []
+    m_AlphaTextures: []
+    m_AlphamapResolution: 2
+    m_BaseMapResolution: 16
+  m_DetailDatabase:
+    m_DetailPrototypes:
+    - prototype: {fileID: 100, guid: 00112233445566778899aabbccddeeff, type: 3}
+      prototypeTexture: {fileID: 0}
+      minWidth: 1
+      maxWidth: 2
+      minHeight: 1
+      maxHeight: 2
+      usePrototypeMesh: 1
+    - prototype: {fileID: 0}
+      prototypeTexture: {fileID: 2800000, guid: 00112233445566778899aabbccddeeff, type: 3}
+      usePrototypeMesh: 0
+    m_Patches:
+    - layerIndices: 0001
+      numberOfObjects: 0100000201010101
+    m_PatchCount: 1
+    m_PatchSamples: 2
+    m_TreeInstances: []
+    m_TreePrototypes: []
+  m_Heightmap:
+    m_Heights: 0000ff3f00000000fe7f0000000000000000
+    m_Resolution: 3
+    m_Scale: {x: 5, y: 100, z: 10}
+`
+
+const testTerrainDetailPrefab = `%YAML 1.1
+%TAG !u! tag:unity3d.com,2011:
+--- !u!1 &100
+GameObject:
+  m_Component:
+  - component: {fileID: 101}
+  - component: {fileID: 102}
+  m_Name: Rock
+  m_IsActive: 1
+--- !u!4 &101
+Transform:
+  m_GameObject: {fileID: 100}
+  m_LocalRotation: {x: 0, y: 0, z: 0, w: 1}
+  m_LocalPosition: {x: 0, y: 0, z: 0}
+  m_LocalScale: {x: 1, y: 1, z: 1}
+  m_Children: []
+  m_Father: {fileID: 0}
+--- !u!108 &102
+Light:
+  m_GameObject: {fileID: 100}
+  m_Enabled: 1
+  m_Type: 2
+  m_Color: {r: 1, g: 1, b: 1, a: 1}
+  m_Intensity: 1
+  m_Range: 1
+`
+
+func TestConvertTerrainDetails(t *testing.T) {
+	dir := t.TempDir()
+	writeTestAsset(t, dir, "Assets/Test.unity", "fedcba9876543210fedcba9876543210", strings.Replace(testTerrainScene, "m_DrawTreesAndFoliage: 0", "m_DrawTreesAndFoliage: 1", 1))
+	writeTestAsset(t, dir, "Assets/Terrain.asset", "0123456789abcdef0123456789abcdef", testTerrainDetailData)
+	writeTestAsset(t, dir, "Assets/Rock.prefab", "00112233445566778899aabbccddeeff", testTerrainDetailPrefab)
+
+	assets, err := unity.OpenProject(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scene, err := unity.LoadScene(assets, "Assets/Test.unity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := NewUnityToMQOConverter(&UnityToMQOOption{ConvertScale: 1}).Convert(scene)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 1 instance in the cell (0, 0) and 2 instances in the cell (1, 1). The grass texture is ignored.
+	if len(doc.Objects) != 4 {
+		t.Fatal("objects: ", len(doc.Objects))
+	}
+	// size: 10 x 200 x 20, origin: (1, 2, -3)
+	for i, obj := range doc.Objects[1:] {
+		p := obj.InternalTransform.ApplyTo(&geom.Vector3{})
+		minX, maxZ := float32(1), float32(-3)
+		if i > 0 {
+			minX, maxZ = 6, -13
+		}
+		if obj.Name != "Rock" || obj.Depth != 1 || p.X < minX || p.X > minX+5 || p.Z > maxZ || p.Z < maxZ-10 || p.Y < 2 || p.Y > 202 {
+			t.Error("detail: ", obj.Name, obj.Depth, p)
+		}
+	}
+}
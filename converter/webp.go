@@ -0,0 +1,629 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/draw"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/qmuntal/gltf"
+
+	_ "golang.org/x/image/webp"
+)
+
+const webpExtension = "EXT_texture_webp"
+
+// Lossless WebP (VP8L) encoder.
+// Transforms: subtract green and predictor. Entropy coding: LZ77 and a single group of prefix codes (no color cache).
+
+const (
+	vp8lMaxSize        = 1 << 14
+	vp8lPredictorBits  = 4 // 16x16 tiles
+	vp8lMaxLength      = 4096
+	vp8lWindowSize     = 1 << 18
+	vp8lHashBits       = 16
+	vp8lMaxChain       = 32
+	vp8lMinLength      = 3
+	vp8lNumLengthCodes = 24
+	vp8lNumDistCodes   = 40
+)
+
+var vp8lCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// vp8lDistanceMap is the 2D neighborhood of the distance codes 1-120. (yOffset<<4 | 8-xOffset)
+var vp8lDistanceMap = [120]uint8{
+	0x18, 0x07, 0x17, 0x19, 0x28, 0x06, 0x27, 0x29, 0x16, 0x1a,
+	0x26, 0x2a, 0x38, 0x05, 0x37, 0x39, 0x15, 0x1b, 0x36, 0x3a,
+	0x25, 0x2b, 0x48, 0x04, 0x47, 0x49, 0x14, 0x1c, 0x35, 0x3b,
+	0x46, 0x4a, 0x24, 0x2c, 0x58, 0x45, 0x4b, 0x34, 0x3c, 0x03,
+	0x57, 0x59, 0x13, 0x1d, 0x56, 0x5a, 0x23, 0x2d, 0x44, 0x4c,
+	0x55, 0x5b, 0x33, 0x3d, 0x68, 0x02, 0x67, 0x69, 0x12, 0x1e,
+	0x66, 0x6a, 0x22, 0x2e, 0x54, 0x5c, 0x43, 0x4d, 0x65, 0x6b,
+	0x32, 0x3e, 0x78, 0x01, 0x77, 0x79, 0x53, 0x5d, 0x11, 0x1f,
+	0x64, 0x6c, 0x42, 0x4e, 0x76, 0x7a, 0x21, 0x2f, 0x75, 0x7b,
+	0x31, 0x3f, 0x63, 0x6d, 0x52, 0x5e, 0x00, 0x74, 0x7c, 0x41,
+	0x4f, 0x10, 0x20, 0x62, 0x6e, 0x30, 0x73, 0x7d, 0x51, 0x5f,
+	0x40, 0x72, 0x7e, 0x61, 0x6f, 0x50, 0x71, 0x7f, 0x60, 0x70,
+}
+
+type vp8lBitWriter struct {
+	buf  []byte
+	acc  uint64
+	nacc uint
+}
+
+func (w *vp8lBitWriter) write(v uint32, n uint) {
+	w.acc |= uint64(v) << w.nacc
+	w.nacc += n
+	for w.nacc >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nacc -= 8
+	}
+}
+
+func (w *vp8lBitWriter) bytes() []byte {
+	if w.nacc > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nacc = 0, 0
+	}
+	return w.buf
+}
+
+// encodeWebPLossless encodes the image as a lossless WebP file.
+func encodeWebPLossless(img image.Image) ([]byte, error) {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > vp8lMaxSize || height > vp8lMaxSize {
+		return nil, errors.New("webp: unsupported image size")
+	}
+	src, ok := img.(*image.NRGBA)
+	if !ok || src.Stride != width*4 || src.Rect.Min != (image.Point{}) {
+		src = image.NewNRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	}
+	pix := make([]byte, len(src.Pix))
+	copy(pix, src.Pix)
+	hasAlpha := uint32(0)
+	for i := 3; i < len(pix); i += 4 {
+		if pix[i] != 255 {
+			hasAlpha = 1
+			break
+		}
+	}
+
+	w := &vp8lBitWriter{}
+	w.write(0x2f, 8)
+	w.write(uint32(width-1), 14)
+	w.write(uint32(height-1), 14)
+	w.write(hasAlpha, 1)
+	w.write(0, 3) // version
+
+	// Subtract green transform.
+	w.write(1, 1)
+	w.write(2, 2)
+	for p := 0; p < len(pix); p += 4 {
+		pix[p+0] -= pix[p+1]
+		pix[p+2] -= pix[p+1]
+	}
+
+	// Predictor transform.
+	w.write(1, 1)
+	w.write(0, 2)
+	w.write(vp8lPredictorBits-2, 3)
+	modes, tilesW, tilesH := vp8lPredict(pix, width, height)
+	vp8lWriteImage(w, modes, tilesW, tilesH, false)
+	w.write(0, 1) // end of transforms
+
+	argb := make([]uint32, width*height)
+	for i := range argb {
+		argb[i] = uint32(pix[i*4+3])<<24 | uint32(pix[i*4])<<16 | uint32(pix[i*4+1])<<8 | uint32(pix[i*4+2])
+	}
+	vp8lWriteImage(w, argb, width, height, true)
+
+	data := w.bytes()
+	var out bytes.Buffer
+	size := len(data) + len(data)&1
+	out.WriteString("RIFF")
+	binary.Write(&out, binary.LittleEndian, uint32(4+8+size))
+	out.WriteString("WEBPVP8L")
+	binary.Write(&out, binary.LittleEndian, uint32(len(data)))
+	out.Write(data)
+	if len(data)&1 != 0 {
+		out.WriteByte(0)
+	}
+	return out.Bytes(), nil
+}
+
+// vp8lPredict replaces the pixels with the residuals of the best predictor for each tile and returns the predictor modes.
+func vp8lPredict(pix []byte, width, height int) ([]uint32, int, int) {
+	tileSize := 1 << vp8lPredictorBits
+	tilesW, tilesH := (width+tileSize-1)/tileSize, (height+tileSize-1)/tileSize
+	modes := make([]uint32, tilesW*tilesH)
+	residuals := make([]byte, len(pix))
+
+	for ty := 0; ty < tilesH; ty++ {
+		for tx := 0; tx < tilesW; tx++ {
+			bestMode, bestCost := 0, -1
+			for mode := 0; mode < 14; mode++ {
+				cost := 0
+				for y := ty * tileSize; y < height && y < (ty+1)*tileSize; y++ {
+					for x := tx * tileSize; x < width && x < (tx+1)*tileSize; x++ {
+						p := (y*width + x) * 4
+						pred := vp8lPrediction(pix, width, x, y, mode)
+						for c := 0; c < 4; c++ {
+							d := int(int8(pix[p+c] - pred[c]))
+							if d < 0 {
+								d = -d
+							}
+							cost += d
+						}
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					bestMode, bestCost = mode, cost
+				}
+			}
+			modes[ty*tilesW+tx] = 0xff000000 | uint32(bestMode)<<8
+			for y := ty * tileSize; y < height && y < (ty+1)*tileSize; y++ {
+				for x := tx * tileSize; x < width && x < (tx+1)*tileSize; x++ {
+					p := (y*width + x) * 4
+					pred := vp8lPrediction(pix, width, x, y, bestMode)
+					for c := 0; c < 4; c++ {
+						residuals[p+c] = pix[p+c] - pred[c]
+					}
+				}
+			}
+		}
+	}
+	copy(pix, residuals)
+	return modes, tilesW, tilesH
+}
+
+// vp8lPrediction returns the predicted RGBA of the pixel. The first row and column use the fixed predictors.
+func vp8lPrediction(pix []byte, width, x, y, mode int) [4]uint8 {
+	p := (y*width + x) * 4
+	if y == 0 {
+		if x == 0 {
+			return [4]uint8{0, 0, 0, 255}
+		}
+		mode = 1
+	} else if x == 0 {
+		mode = 2
+	}
+	at := func(q int) [4]uint8 { return [4]uint8{pix[q], pix[q+1], pix[q+2], pix[q+3]} }
+	top := p - width*4
+	if mode == 1 {
+		return at(p - 4)
+	} else if mode == 2 {
+		return at(top)
+	}
+	// TR of the rightmost pixel is the leftmost pixel of the current row.
+	L, T, TR, TL := at(p-4), at(top), at(top+4), at(top-4)
+	avg := func(a, b [4]uint8) (r [4]uint8) {
+		for c := range r {
+			r[c] = uint8((int(a[c]) + int(b[c])) / 2)
+		}
+		return
+	}
+	clamp := func(v int) uint8 {
+		if v < 0 {
+			return 0
+		} else if v > 255 {
+			return 255
+		}
+		return uint8(v)
+	}
+	switch mode {
+	case 0:
+		return [4]uint8{0, 0, 0, 255}
+	case 3:
+		return TR
+	case 4:
+		return TL
+	case 5:
+		return avg(avg(L, TR), T)
+	case 6:
+		return avg(L, TL)
+	case 7:
+		return avg(L, T)
+	case 8:
+		return avg(TL, T)
+	case 9:
+		return avg(T, TR)
+	case 10:
+		return avg(avg(L, TL), avg(T, TR))
+	case 11:
+		var pl, pt int
+		for c := 0; c < 4; c++ {
+			pl += absInt(int(TL[c]) - int(T[c]))
+			pt += absInt(int(TL[c]) - int(L[c]))
+		}
+		if pl < pt {
+			return L
+		}
+		return T
+	case 12:
+		var r [4]uint8
+		for c := range r {
+			r[c] = clamp(int(L[c]) + int(T[c]) - int(TL[c]))
+		}
+		return r
+	default:
+		a := avg(L, T)
+		var r [4]uint8
+		for c := range r {
+			r[c] = clamp(int(a[c]) + (int(a[c])-int(TL[c]))/2)
+		}
+		return r
+	}
+}
+
+// vp8lToken is a literal pixel (length == 0) or a backward reference.
+type vp8lToken struct {
+	argb     uint32
+	length   int
+	distCode int
+}
+
+// vp8lPrefix returns the prefix code and the extra bits of the LZ77 length or distance.
+func vp8lPrefix(v int) (prefix int, extraBits uint, extra uint32) {
+	n := uint32(v - 1)
+	if n < 4 {
+		return int(n), 0, 0
+	}
+	h := uint(bits.Len32(n) - 1)
+	second := n >> (h - 1) & 1
+	return int(2*h + uint(second)), h - 1, n & (1<<(h-1) - 1)
+}
+
+func vp8lBackwardReferences(argb []uint32, width int) []vp8lToken {
+	distCodes := map[int]int{}
+	for i := len(vp8lDistanceMap) - 1; i >= 0; i-- {
+		d := int(vp8lDistanceMap[i]>>4)*width + 8 - int(vp8lDistanceMap[i]&0xf)
+		if d >= 1 {
+			distCodes[d] = i + 1
+		}
+	}
+	hash := func(i int) uint32 {
+		return (argb[i]*0x1e35a7bd ^ argb[i+1]*0x9e3779b1) >> (32 - vp8lHashBits)
+	}
+	head := make([]int32, 1<<vp8lHashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	chain := make([]int32, len(argb))
+	insert := func(i int) {
+		if i+1 < len(argb) {
+			h := hash(i)
+			chain[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+	matchLength := func(i, j int) int {
+		n := 0
+		for i+n < len(argb) && n < vp8lMaxLength && argb[i+n] == argb[j+n] {
+			n++
+		}
+		return n
+	}
+
+	var tokens []vp8lToken
+	for i := 0; i < len(argb); {
+		bestLen, bestDist := 0, 0
+		// Try the left and top pixels first.
+		for _, d := range []int{1, width} {
+			if d <= i {
+				if l := matchLength(i, i-d); l > bestLen {
+					bestLen, bestDist = l, d
+				}
+			}
+		}
+		if i+1 < len(argb) {
+			for j, n := int(head[hash(i)]), 0; j >= 0 && i-j <= vp8lWindowSize && n < vp8lMaxChain; j, n = int(chain[j]), n+1 {
+				if l := matchLength(i, j); l > bestLen {
+					bestLen, bestDist = l, i-j
+				}
+			}
+		}
+		if bestLen < vp8lMinLength {
+			tokens = append(tokens, vp8lToken{argb: argb[i]})
+			insert(i)
+			i++
+			continue
+		}
+		code, ok := distCodes[bestDist]
+		if !ok {
+			code = bestDist + len(vp8lDistanceMap)
+		}
+		tokens = append(tokens, vp8lToken{length: bestLen, distCode: code})
+		for k := 0; k < bestLen; k++ {
+			insert(i + k)
+		}
+		i += bestLen
+	}
+	return tokens
+}
+
+// vp8lWriteImage writes the entropy-coded image. The main image has the meta prefix codes flag.
+func vp8lWriteImage(w *vp8lBitWriter, argb []uint32, width, height int, main bool) {
+	w.write(0, 1) // no color cache
+	if main {
+		w.write(0, 1) // no meta prefix codes
+	}
+	tokens := vp8lBackwardReferences(argb, width)
+
+	freqs := [5][]int{
+		make([]int, 256+vp8lNumLengthCodes),
+		make([]int, 256),
+		make([]int, 256),
+		make([]int, 256),
+		make([]int, vp8lNumDistCodes),
+	}
+	for _, t := range tokens {
+		if t.length == 0 {
+			freqs[0][t.argb>>8&0xff]++
+			freqs[1][t.argb>>16&0xff]++
+			freqs[2][t.argb&0xff]++
+			freqs[3][t.argb>>24]++
+		} else {
+			p, _, _ := vp8lPrefix(t.length)
+			freqs[0][256+p]++
+			p, _, _ = vp8lPrefix(t.distCode)
+			freqs[4][p]++
+		}
+	}
+	var codes [5]*vp8lHuffmanCode
+	for i, f := range freqs {
+		codes[i] = newVP8LHuffmanCode(f, 15)
+		codes[i].writeTo(w)
+	}
+
+	for _, t := range tokens {
+		if t.length == 0 {
+			codes[0].writeSymbol(w, int(t.argb>>8&0xff))
+			codes[1].writeSymbol(w, int(t.argb>>16&0xff))
+			codes[2].writeSymbol(w, int(t.argb&0xff))
+			codes[3].writeSymbol(w, int(t.argb>>24))
+		} else {
+			p, n, extra := vp8lPrefix(t.length)
+			codes[0].writeSymbol(w, 256+p)
+			w.write(extra, n)
+			p, n, extra = vp8lPrefix(t.distCode)
+			codes[4].writeSymbol(w, p)
+			w.write(extra, n)
+		}
+	}
+}
+
+type vp8lHuffmanCode struct {
+	lengths []uint8
+	codes   []uint16 // bit reversed
+	symbols []int    // used symbols
+}
+
+// newVP8LHuffmanCode builds a length-limited canonical Huffman code.
+func newVP8LHuffmanCode(freq []int, maxLength int) *vp8lHuffmanCode {
+	h := &vp8lHuffmanCode{lengths: make([]uint8, len(freq)), codes: make([]uint16, len(freq))}
+	for s, f := range freq {
+		if f > 0 {
+			h.symbols = append(h.symbols, s)
+		}
+	}
+	if len(h.symbols) <= 1 {
+		if len(h.symbols) == 0 {
+			h.symbols = []int{0}
+		}
+		h.lengths[h.symbols[0]] = 1 // zero bits are written for the symbol.
+		return h
+	}
+
+	f := make([]int, len(freq))
+	copy(f, freq)
+	for !h.buildLengths(f, maxLength) {
+		for s := range f {
+			if f[s] > 0 {
+				f[s] = (f[s] + 1) / 2
+			}
+		}
+	}
+
+	var count [16]int
+	for _, s := range h.symbols {
+		count[h.lengths[s]]++
+	}
+	var next [16]int
+	code := 0
+	for l := 1; l < 16; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	for _, s := range h.symbols {
+		l := h.lengths[s]
+		c := next[l]
+		next[l]++
+		h.codes[s] = uint16(bits.Reverse16(uint16(c)) >> (16 - l))
+	}
+	return h
+}
+
+// buildLengths sets the code lengths of the Huffman tree. Returns false if the length exceeds the limit.
+func (h *vp8lHuffmanCode) buildLengths(freq []int, maxLength int) bool {
+	type node struct {
+		weight      int
+		symbol      int // -1 for internal nodes
+		left, right int
+	}
+	nodes := make([]node, 0, len(h.symbols)*2)
+	for _, s := range h.symbols {
+		nodes = append(nodes, node{weight: freq[s], symbol: s})
+	}
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].weight < nodes[j].weight })
+
+	// Two queues: leaves (sorted) and internal nodes (created in the increasing order of weights).
+	leaf, internal := 0, len(nodes)
+	pop := func() int {
+		if leaf < len(h.symbols) && (internal >= len(nodes) || nodes[leaf].weight <= nodes[internal].weight) {
+			leaf++
+			return leaf - 1
+		}
+		internal++
+		return internal - 1
+	}
+	for n := len(h.symbols); n > 1; n-- {
+		a, b := pop(), pop()
+		nodes = append(nodes, node{weight: nodes[a].weight + nodes[b].weight, symbol: -1, left: a, right: b})
+	}
+
+	var walk func(i, depth int) bool
+	walk = func(i, depth int) bool {
+		if nodes[i].symbol >= 0 {
+			h.lengths[nodes[i].symbol] = uint8(depth)
+			return depth <= maxLength
+		}
+		return walk(nodes[i].left, depth+1) && walk(nodes[i].right, depth+1)
+	}
+	return walk(len(nodes)-1, 0)
+}
+
+func (h *vp8lHuffmanCode) writeSymbol(w *vp8lBitWriter, s int) {
+	if len(h.symbols) > 1 {
+		w.write(uint32(h.codes[s]), uint(h.lengths[s]))
+	}
+}
+
+// writeTo writes the code lengths as a simple code or a normal code.
+func (h *vp8lHuffmanCode) writeTo(w *vp8lBitWriter) {
+	if len(h.symbols) <= 2 && h.symbols[len(h.symbols)-1] < 256 {
+		w.write(1, 1)
+		w.write(uint32(len(h.symbols)-1), 1)
+		if h.symbols[0] < 2 {
+			w.write(0, 1)
+			w.write(uint32(h.symbols[0]), 1)
+		} else {
+			w.write(1, 1)
+			w.write(uint32(h.symbols[0]), 8)
+		}
+		if len(h.symbols) == 2 {
+			w.write(uint32(h.symbols[1]), 8)
+		}
+		return
+	}
+	w.write(0, 1)
+
+	// Run-length encode the code lengths. 16: repeat the previous length, 17, 18: repeat zero.
+	type rle struct {
+		code  int
+		extra uint32
+	}
+	var tokens []rle
+	for i := 0; i < len(h.lengths); {
+		l := h.lengths[i]
+		n := 1
+		for i+n < len(h.lengths) && h.lengths[i+n] == l {
+			n++
+		}
+		i += n
+		if l == 0 {
+			for n > 0 {
+				if n >= 11 {
+					r := minInt(n, 138)
+					tokens = append(tokens, rle{18, uint32(r - 11)})
+					n -= r
+				} else if n >= 3 {
+					tokens = append(tokens, rle{17, uint32(n - 3)})
+					n = 0
+				} else {
+					tokens = append(tokens, rle{0, 0})
+					n--
+				}
+			}
+			continue
+		}
+		tokens = append(tokens, rle{int(l), 0})
+		n--
+		for n > 0 {
+			if n >= 3 {
+				r := minInt(n, 6)
+				tokens = append(tokens, rle{16, uint32(r - 3)})
+				n -= r
+			} else {
+				tokens = append(tokens, rle{int(l), 0})
+				n--
+			}
+		}
+	}
+
+	freq := make([]int, 19)
+	for _, t := range tokens {
+		freq[t.code]++
+	}
+	lengthCode := newVP8LHuffmanCode(freq, 7)
+	numCodes := 19
+	for numCodes > 4 && lengthCode.lengths[vp8lCodeLengthOrder[numCodes-1]] == 0 {
+		numCodes--
+	}
+	w.write(uint32(numCodes-4), 4)
+	for _, s := range vp8lCodeLengthOrder[:numCodes] {
+		w.write(uint32(lengthCode.lengths[s]), 3)
+	}
+	w.write(0, 1) // max_symbol is the alphabet size
+	for _, t := range tokens {
+		lengthCode.writeSymbol(w, t.code)
+		switch t.code {
+		case 16:
+			w.write(t.extra, 2)
+		case 17:
+			w.write(t.extra, 3)
+		case 18:
+			w.write(t.extra, 7)
+		}
+	}
+}
+
+// textureSource returns the image index of the texture including EXT_texture_webp.
+func textureSource(tex *gltf.Texture) *uint32 {
+	if tex.Source != nil {
+		return tex.Source
+	}
+	switch ext := tex.Extensions[webpExtension].(type) {
+	case map[string]interface{}:
+		return extensionIndex(ext["source"])
+	case json.RawMessage:
+		// Extensions in the loaded files.
+		var v struct {
+			Source *uint32 `json:"source"`
+		}
+		if err := json.Unmarshal(ext, &v); err == nil {
+			return v.Source
+		}
+	}
+	return nil
+}
+
+// extensionIndex returns the index in the extension. Numbers decoded from JSON are float64.
+func extensionIndex(v interface{}) *uint32 {
+	var index uint32
+	switch v := v.(type) {
+	case uint32:
+		index = v
+	case int:
+		if v < 0 {
+			return nil
+		}
+		index = uint32(v)
+	case float64:
+		if v < 0 || v != math.Trunc(v) || v > math.MaxUint32 {
+			return nil
+		}
+		index = uint32(v)
+	default:
+		return nil
+	}
+	return &index
+}
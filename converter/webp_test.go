@@ -0,0 +1,74 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/qmuntal/gltf"
+	"golang.org/x/image/webp"
+)
+
+func TestEncodeWebPLossless(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 70, 45))
+	for y := 0; y < 45; y++ {
+		for x := 0; x < 70; x++ {
+			// Gradients, repeated patterns and noise.
+			n := uint8((x*7919 + y*104729) >> 3)
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 3), uint8(y*5) ^ n&3, uint8((x / 8 % 2) * 200), uint8(255 - x - y)})
+		}
+	}
+
+	data, err := encodeWebPLossless(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := webp.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Bounds() != img.Bounds() {
+		t.Fatalf("bounds: %v", decoded.Bounds())
+	}
+	for y := 0; y < 45; y++ {
+		for x := 0; x < 70; x++ {
+			c := color.NRGBAModel.Convert(decoded.At(x, y)).(color.NRGBA)
+			if c != img.NRGBAAt(x, y) {
+				t.Fatalf("pixel (%d,%d) = %v, want %v", x, y, c, img.NRGBAAt(x, y))
+			}
+		}
+	}
+}
+
+func TestTextureSource(t *testing.T) {
+	var loaded gltf.Texture
+	if err := json.Unmarshal([]byte(`{"extensions":{"EXT_texture_webp":{"source":2}}}`), &loaded); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		tex  *gltf.Texture
+		want int
+	}{
+		{"source", &gltf.Texture{Source: gltf.Index(1)}, 1},
+		{"uint32", &gltf.Texture{Extensions: gltf.Extensions{webpExtension: map[string]interface{}{"source": uint32(3)}}}, 3},
+		{"float64", &gltf.Texture{Extensions: gltf.Extensions{webpExtension: map[string]interface{}{"source": float64(4)}}}, 4},
+		{"fraction", &gltf.Texture{Extensions: gltf.Extensions{webpExtension: map[string]interface{}{"source": 1.5}}}, -1},
+		{"negative", &gltf.Texture{Extensions: gltf.Extensions{webpExtension: map[string]interface{}{"source": -1.0}}}, -1},
+		{"string", &gltf.Texture{Extensions: gltf.Extensions{webpExtension: map[string]interface{}{"source": "1"}}}, -1},
+		{"loaded", &loaded, 2},
+		{"none", &gltf.Texture{}, -1},
+	}
+	for _, tt := range tests {
+		src := textureSource(tt.tex)
+		if tt.want < 0 {
+			if src != nil {
+				t.Errorf("%s: %v", tt.name, *src)
+			}
+		} else if src == nil || *src != uint32(tt.want) {
+			t.Errorf("%s: %v", tt.name, src)
+		}
+	}
+}
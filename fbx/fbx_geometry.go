@@ -154,6 +154,16 @@ func (g *Geometry) GetLayerElementUV() *LayerElement {
 	return g.GetLayerElement("LayerElementUV", "UV", "UVIndex")
 }
 
+// GetLayerElementUVAt returns the UV set of the index. (e.g. 1: the second UV set for lightmaps)
+func (g *Geometry) GetLayerElementUVAt(index int) *LayerElement {
+	for _, node := range g.GetChildren() {
+		if node.Name == "LayerElementUV" && node.Attr(0).ToInt(0) == index {
+			return &LayerElement{node, node.FindChild("UV"), node.FindChild("UVIndex")}
+		}
+	}
+	return &LayerElement{}
+}
+
 func (g *Geometry) GetLayerElementMaterial() *LayerElement {
 	return g.GetLayerElement("LayerElementMaterial", "Materials", "Materials") // Materials as index?
 }
@@ -21,6 +21,16 @@ func Max(v1 Element, v2 Element) Element {
 	return v2
 }
 
+func Clamp(v, min, max Element) Element {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
 func IsInTriangle(p, a, b, c *Vector3) bool {
 	ab, bc, ca := b.Sub(a), c.Sub(b), a.Sub(c)
 	c1, c2, c3 := ab.Cross(p.Sub(a)), bc.Cross(p.Sub(b)), ca.Cross(p.Sub(c))
@@ -1,11 +1,15 @@
 package gltfutil
 
 import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/binzume/modelconv/geom"
@@ -46,10 +50,13 @@ func RemoveExtension(doc *gltf.Document, extension string) {
 	delete(doc.Extensions, extension)
 }
 
+// ToSingleFile embeds external images and buffers into the first buffer. Identical images share a single image.
 func ToSingleFile(doc *gltf.Document, srcDir string) error {
 	for _, b := range doc.Buffers {
 		b.URI = ""
 	}
+	views := map[[sha256.Size]byte]uint32{}
+	saved := 0
 	for _, m := range doc.Images {
 		if m.BufferView == nil && m.URI != "" {
 			path, _ := filepath.Rel(srcDir, m.URI)
@@ -67,17 +74,207 @@ func ToSingleFile(doc *gltf.Document, srcDir string) error {
 			if m.MimeType == "" {
 				if strings.HasSuffix(strings.ToLower(m.URI), ".png") {
 					m.MimeType = "image/png"
+				} else if strings.HasSuffix(strings.ToLower(m.URI), ".webp") {
+					m.MimeType = "image/webp"
 				} else {
 					m.MimeType = "image/jpeg"
 				}
 			}
-			m.BufferView = gltf.Index(modeler.WriteBufferView(doc, gltf.TargetNone, buf))
+			sum := sha256.Sum256(buf)
+			if v, ok := views[sum]; ok {
+				m.BufferView = gltf.Index(v)
+				saved += len(buf)
+			} else {
+				m.BufferView = gltf.Index(modeler.WriteBufferView(doc, gltf.TargetNone, buf))
+				views[sum] = *m.BufferView
+			}
 			m.URI = ""
 		}
 	}
+	if n, bytes := MergeDuplicateImages(doc); n > 0 {
+		log.Printf("Texture dedup: %d images shared (%d bytes saved)", n, saved+bytes)
+	}
 	return nil
 }
 
+// MergeDuplicateImages removes images which have the same content as another image and updates the texture sources.
+// BufferViews only used by the removed images are removed from the buffers.
+// Returns the number of removed images and the removed bytes.
+func MergeDuplicateImages(doc *gltf.Document) (int, int) {
+	first := map[[sha256.Size]byte]uint32{}
+	indices := make([]uint32, len(doc.Images))
+	unused := map[uint32]bool{}
+	var images []*gltf.Image
+	for i, img := range doc.Images {
+		var key [sha256.Size]byte
+		if img.BufferView != nil {
+			data := imageData(doc, *img.BufferView)
+			if data == nil {
+				key = sha256.Sum256([]byte(fmt.Sprint("bufferView:", *img.BufferView)))
+			} else {
+				key = sha256.Sum256(data)
+			}
+		} else {
+			key = sha256.Sum256([]byte("uri:" + img.URI))
+		}
+		if idx, ok := first[key]; ok {
+			indices[i] = idx
+			if img.BufferView != nil {
+				unused[*img.BufferView] = true
+			}
+			continue
+		}
+		indices[i] = uint32(len(images))
+		first[key] = indices[i]
+		images = append(images, img)
+	}
+	removed := len(doc.Images) - len(images)
+	if removed == 0 {
+		return 0, 0
+	}
+	doc.Images = images
+	for _, tex := range doc.Textures {
+		if tex.Source != nil {
+			tex.Source = gltf.Index(indices[*tex.Source])
+		}
+		for name, ext := range tex.Extensions {
+			tex.Extensions[name] = remapExtensionSource(ext, indices)
+		}
+	}
+	return removed, removeBufferViews(doc, unused)
+}
+
+type byteRange struct {
+	offset, size uint32
+}
+
+// removeBufferViews removes the bufferViews which are not referenced by the images and the accessors, and compacts the buffers.
+// Returns the removed bytes.
+func removeBufferViews(doc *gltf.Document, unused map[uint32]bool) int {
+	refs := func(f func(view *uint32)) {
+		for _, img := range doc.Images {
+			if img.BufferView != nil {
+				f(img.BufferView)
+			}
+		}
+		for _, acr := range doc.Accessors {
+			if acr.BufferView != nil {
+				f(acr.BufferView)
+			}
+			if acr.Sparse != nil {
+				f(&acr.Sparse.Indices.BufferView)
+				f(&acr.Sparse.Values.BufferView)
+			}
+		}
+	}
+	refs(func(view *uint32) { delete(unused, *view) })
+	if len(unused) == 0 {
+		return 0
+	}
+
+	// The shifts are multiples of 4 to keep the alignment of the following views.
+	removedBytes := 0
+	shift := make([][]byteRange, len(doc.Buffers))
+	for i, bv := range doc.BufferViews {
+		if !unused[uint32(i)] {
+			continue
+		}
+		size := bv.ByteLength &^ 3
+		if int(bv.Buffer) >= len(doc.Buffers) || size == 0 || int(bv.ByteOffset+bv.ByteLength) > len(doc.Buffers[bv.Buffer].Data) {
+			continue
+		}
+		for j, other := range doc.BufferViews {
+			if !unused[uint32(j)] && other.Buffer == bv.Buffer && other.ByteOffset < bv.ByteOffset+size && bv.ByteOffset < other.ByteOffset+other.ByteLength {
+				size = 0 // Overlaps with the used view.
+				break
+			}
+		}
+		if size > 0 {
+			shift[bv.Buffer] = append(shift[bv.Buffer], byteRange{bv.ByteOffset, size})
+		}
+	}
+	for b, ranges := range shift {
+		if len(ranges) == 0 {
+			continue
+		}
+		sort.Slice(ranges, func(i, j int) bool { return ranges[i].offset < ranges[j].offset })
+		buffer := doc.Buffers[b]
+		data := make([]byte, 0, len(buffer.Data))
+		pos := uint32(0)
+		for _, r := range ranges {
+			data = append(data, buffer.Data[pos:r.offset]...)
+			pos = r.offset + r.size
+			removedBytes += int(r.size)
+		}
+		buffer.Data = append(data, buffer.Data[pos:]...)
+		buffer.ByteLength = uint32(len(buffer.Data))
+		for i, bv := range doc.BufferViews {
+			if int(bv.Buffer) != b || unused[uint32(i)] {
+				continue
+			}
+			offset := bv.ByteOffset
+			for _, r := range ranges {
+				if r.offset < offset {
+					bv.ByteOffset -= r.size
+				}
+			}
+		}
+	}
+
+	indices := make([]uint32, len(doc.BufferViews))
+	var views []*gltf.BufferView
+	for i, bv := range doc.BufferViews {
+		indices[i] = uint32(len(views))
+		if !unused[uint32(i)] {
+			views = append(views, bv)
+		}
+	}
+	doc.BufferViews = views
+	refs(func(view *uint32) { *view = indices[*view] })
+	return removedBytes
+}
+
+func imageData(doc *gltf.Document, view uint32) []byte {
+	if int(view) >= len(doc.BufferViews) {
+		return nil
+	}
+	bv := doc.BufferViews[view]
+	if int(bv.Buffer) >= len(doc.Buffers) {
+		return nil
+	}
+	data := doc.Buffers[bv.Buffer].Data
+	if int(bv.ByteOffset+bv.ByteLength) > len(data) {
+		return nil
+	}
+	return data[bv.ByteOffset : bv.ByteOffset+bv.ByteLength]
+}
+
+// remapExtensionSource updates the "source" property of the texture extensions. (EXT_texture_webp, KHR_texture_basisu, etc.)
+func remapExtensionSource(ext interface{}, indices []uint32) interface{} {
+	var v map[string]interface{}
+	switch e := ext.(type) {
+	case map[string]interface{}:
+		v = e
+	case json.RawMessage:
+		if err := json.Unmarshal(e, &v); err != nil {
+			return ext
+		}
+	default:
+		return ext
+	}
+	switch s := v["source"].(type) {
+	case float64:
+		if int(s) < len(indices) {
+			v["source"] = indices[int(s)]
+		}
+	case uint32:
+		if int(s) < len(indices) {
+			v["source"] = indices[s]
+		}
+	}
+	return v
+}
+
 func ApplyTransform(doc *gltf.Document, transformMat *geom.Matrix4) {
 	if transformMat == nil {
 		return
@@ -0,0 +1,70 @@
+package gltfutil
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/qmuntal/gltf"
+	"github.com/qmuntal/gltf/modeler"
+)
+
+func encodedSize(t *testing.T, doc *gltf.Document) int {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := gltf.NewEncoder(&buf).Encode(doc); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Len()
+}
+
+func TestMergeDuplicateImages(t *testing.T) {
+	doc := gltf.NewDocument()
+	doc.Buffers = append(doc.Buffers, &gltf.Buffer{})
+	image := bytes.Repeat([]byte{1, 2, 3}, 1000)
+	for i := 0; i < 3; i++ {
+		data := image
+		if i == 1 {
+			data = []byte("other image")
+		}
+		if _, err := modeler.WriteImage(doc, "image", "image/png", bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	positions := [][3]float32{{1, 2, 3}, {4, 5, 6}}
+	pos := modeler.WritePosition(doc, positions)
+	doc.Buffers[0].ByteLength = uint32(len(doc.Buffers[0].Data))
+	doc.Textures = []*gltf.Texture{
+		{Source: gltf.Index(0)},
+		{Source: gltf.Index(1)},
+		{Extensions: gltf.Extensions{"EXT_texture_webp": map[string]interface{}{"source": float64(2)}}},
+	}
+	before := encodedSize(t, doc)
+
+	removed, removedBytes := MergeDuplicateImages(doc)
+
+	if removed != 1 || len(doc.Images) != 2 {
+		t.Fatalf("removed: %d images: %d", removed, len(doc.Images))
+	}
+	if removedBytes < len(image)-3 {
+		t.Errorf("removed bytes: %d", removedBytes)
+	}
+	if after := encodedSize(t, doc); after > before-len(image)+3 {
+		t.Errorf("size: %d -> %d", before, after)
+	}
+	if len(doc.BufferViews) != 3 {
+		t.Errorf("buffer views: %d", len(doc.BufferViews))
+	}
+	if *doc.Textures[1].Source != 1 || doc.Textures[2].Extensions["EXT_texture_webp"].(map[string]interface{})["source"] != uint32(0) {
+		t.Error("texture sources are not updated")
+	}
+	if !bytes.Equal(imageData(doc, *doc.Images[0].BufferView), image) || string(imageData(doc, *doc.Images[1].BufferView)) != "other image" {
+		t.Error("image data is broken")
+	}
+	read, err := modeler.ReadPosition(doc, doc.Accessors[pos], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 2 || read[0] != positions[0] || read[1] != positions[1] {
+		t.Error("accessor data is broken", read)
+	}
+}
@@ -2,6 +2,8 @@ package mmd
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/binzume/modelconv/geom"
 )
@@ -25,6 +27,8 @@ type Document struct {
 	Morphs    []*Morph
 	Bodies    []*RigidBody
 	Joints    []*Joint
+
+	DisplayGroups []*DisplayGroup
 }
 
 func NewDocument() *Document {
@@ -77,8 +81,11 @@ type Material struct {
 }
 
 const (
-	MaterialFlagDoubleSided uint8 = 1
-	MaterialFlagCastShadow  uint8 = 2
+	MaterialFlagDoubleSided   uint8 = 1
+	MaterialFlagCastShadow    uint8 = 2
+	MaterialFlagSelfShadowMap uint8 = 4
+	MaterialFlagReceiveShadow uint8 = 8
+	MaterialFlagDrawEdge      uint8 = 16
 )
 
 type Link struct {
@@ -218,6 +225,23 @@ type Joint struct {
 	AngulerSpring geom.Vector3
 }
 
+type DisplayTarget struct {
+	Type   uint8 // 0: bone, 1: morph
+	Target int
+}
+
+type DisplayGroup struct {
+	Name    string
+	NameEn  string
+	Flags   uint8 // 1: special frame
+	Targets []*DisplayTarget
+}
+
+const (
+	DisplayTargetBone  uint8 = 0
+	DisplayTargetMorph uint8 = 1
+)
+
 const (
 	AttrStringEncoding int = iota
 	AttrExtUV
@@ -244,5 +268,10 @@ func Save(doc *Document, path string) error {
 	if err != nil {
 		return err
 	}
+	defer w.Close()
+
+	if strings.ToLower(filepath.Ext(path)) == ".pmd" {
+		return WritePMD(doc, w)
+	}
 	return WritePMX(doc, w)
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"path/filepath"
 	"strings"
 
 	"golang.org/x/text/encoding/japanese"
@@ -14,6 +15,9 @@ import (
 type PMDParser struct {
 	baseParser // TODO
 	header     *Header
+
+	materialToons []int
+	toonTextures  []string
 }
 
 // NewPMDParser returns new parser.
@@ -21,6 +25,15 @@ func NewPMDParser(r io.Reader) *PMDParser {
 	return &PMDParser{baseParser: baseParser{r: r}}
 }
 
+// PMDDefaultToonTextures is shared toon textures. (toon01.bmp ... toon10.bmp)
+var PMDDefaultToonTextures = func() []string {
+	var toons []string
+	for i := 1; i <= 10; i++ {
+		toons = append(toons, fmt.Sprintf("toon%02d.bmp", i))
+	}
+	return toons
+}()
+
 func (p *PMDParser) readString(len int) string {
 	b := make([]byte, len)
 	_ = p.read(b)
@@ -28,6 +41,30 @@ func (p *PMDParser) readString(len int) string {
 	return string(utf8Data)
 }
 
+// readCount returns io.EOF if optional section is not exists.
+func (p *PMDParser) readCount(sz byte) (int, error) {
+	var err error
+	var n int
+	switch sz {
+	case 1:
+		var v uint8
+		err = p.read(&v)
+		n = int(v)
+	case 2:
+		var v uint16
+		err = p.read(&v)
+		n = int(v)
+	default:
+		var v uint32
+		err = p.read(&v)
+		n = int(v)
+	}
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
 func (p *PMDParser) readHeader() error {
 	h := p.header
 	if h == nil {
@@ -52,10 +89,22 @@ func (p *PMDParser) readVertex() *Vertex {
 	v.Bones = []int{p.readVInt(2), p.readVInt(2)}
 	w := float32(p.readUint8()) / 100
 	v.BoneWeights = []float32{w, 1 - w}
-	v.EdgeScale = float32(p.readUint8())
+	if p.readUint8() == 0 {
+		v.EdgeScale = 1
+	}
 	return &v
 }
 
+func (p *PMDParser) textureIndex(model *Document, name string) int {
+	for i, t := range model.Textures {
+		if t == name {
+			return i
+		}
+	}
+	model.Textures = append(model.Textures, name)
+	return len(model.Textures) - 1
+}
+
 func (p *PMDParser) readMaterial(model *Document, i int) *Material {
 	var m Material
 	m.Name = fmt.Sprintf("mat%d", i+1)
@@ -63,20 +112,38 @@ func (p *PMDParser) readMaterial(model *Document, i int) *Material {
 	p.read(&m.Specularity)
 	p.read(&m.Specular)
 	p.read(&m.AColor)
-	m.Toon = int(p.readUint8())
-	m.EdgeScale = float32(p.readUint8())
+	p.materialToons = append(p.materialToons, int(p.readUint8())) // resolved after reading toon textures.
+	if p.readUint8() != 0 {
+		m.Flags |= MaterialFlagDrawEdge
+		m.EdgeColor = Vector4{X: 0, Y: 0, Z: 0, W: 1}
+		m.EdgeScale = 1
+	}
 	m.Count = p.readInt()
 
-	tex := strings.SplitN(p.readString(20), "*", 2)
-	if tex[0] != "" {
-		m.TextureID = len(model.Textures)
-		model.Textures = append(model.Textures, tex...)
-	} else {
-		m.TextureID = -1
+	m.TextureID = -1
+	m.EnvID = -1
+	for _, tex := range strings.Split(p.readString(20), "*") {
+		if tex == "" {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(tex)) {
+		case ".sph":
+			m.EnvID = p.textureIndex(model, tex)
+			m.EnvMode = 1
+		case ".spa":
+			m.EnvID = p.textureIndex(model, tex)
+			m.EnvMode = 2
+		default:
+			m.TextureID = p.textureIndex(model, tex)
+		}
 	}
 
 	if m.Color.W < 1 {
-		m.Flags = MaterialFlagDoubleSided
+		m.Flags |= MaterialFlagDoubleSided
+	}
+	if m.Color.W != 0.98 {
+		// MMD disables self shadow if alpha == 0.98
+		m.Flags |= MaterialFlagCastShadow | MaterialFlagSelfShadowMap | MaterialFlagReceiveShadow
 	}
 	return &m
 }
@@ -89,17 +156,52 @@ func (p *PMDParser) readBone() *Bone {
 	if b.TailID == 0 {
 		b.TailID = -1
 	}
-	p.readUint8()
-	p.readUint16()
+	typ := p.readUint8()
+	ikParent := p.readVInt(2)
 	p.read(&b.Pos)
+
+	b.Flags = BoneFlagRotatable | BoneFlagVisible | BoneFlagEnabled
+	if b.TailID >= 0 {
+		b.Flags |= BoneFlagTailIndex
+	}
+	switch typ {
+	case 1, 2: // rotate+move, IK
+		b.Flags |= BoneFlagTranslatable
+	case 5: // rotation influenced
+		b.Flags |= BoneFlagInheritRotation
+		b.InheritParentID = ikParent
+		b.InheritParentInfluence = 1
+	case 6, 7: // IK target, invisible
+		b.Flags &^= BoneFlagVisible
+	}
 	return &b
 }
 
+func (p *PMDParser) readIK(model *Document) {
+	b := model.Bones[p.readUint16()]
+	b.Flags |= BoneFlagEnableIK
+	b.IK.TargetID = p.readVInt(2)
+	ln := int(p.readUint8())
+	b.IK.Loop = int(p.readUint16())
+	b.IK.LimitRad = p.readFloat() * 4
+	for i := 0; i < ln; i++ {
+		l := &Link{TargetID: p.readVInt(2)}
+		if l.TargetID >= 0 && l.TargetID < len(model.Bones) && strings.Contains(model.Bones[l.TargetID].Name, "ひざ") {
+			// Knees are implicitly limited in MMD.
+			l.HasLimit = true
+			l.LimitMin = Vector3{X: -3.14159265, Y: 0, Z: 0}
+			l.LimitMax = Vector3{X: -0.00872665, Y: 0, Z: 0}
+		}
+		b.IK.Links = append(b.IK.Links, l)
+	}
+}
+
 func (p *PMDParser) readMorph() *Morph {
 	var m Morph
 	m.Name = p.readString(20)
 	vn := p.readInt()
 	p.read(&m.PanelType)
+	m.MorphType = 1
 	for i := 0; i < vn; i++ {
 		var mv MorphVertex
 		mv.Target = p.readVInt(4)
@@ -109,6 +211,159 @@ func (p *PMDParser) readMorph() *Morph {
 	return &m
 }
 
+func (p *PMDParser) readRigidBody(model *Document) *RigidBody {
+	d := &RigidBody{}
+	d.Name = p.readString(20)
+	d.Bone = p.readVInt(2)
+	d.Group = int(p.readUint8())
+	d.GroupTarget = p.readVInt(2)
+	p.read(&d.Shape)
+
+	p.read(&d.Size)
+	p.read(&d.Position)
+	p.read(&d.Rotation)
+
+	p.read(&d.Mass)
+	p.read(&d.LinearDamping)
+	p.read(&d.AngularDamping)
+	p.read(&d.Restitution)
+	p.read(&d.Friction)
+
+	p.read(&d.Mode)
+
+	// PMD: relative to the bone (or the first bone).
+	bone := d.Bone
+	if bone < 0 || bone >= len(model.Bones) {
+		bone = 0
+	}
+	if bone < len(model.Bones) {
+		d.Position = *d.Position.Add(&model.Bones[bone].Pos)
+	}
+	return d
+}
+
+func (p *PMDParser) readJoint() *Joint {
+	j := &Joint{}
+	j.Name = p.readString(20)
+	j.Body1 = p.readInt()
+	j.Body2 = p.readInt()
+
+	p.read(&j.Position)
+	p.read(&j.Rotation)
+
+	p.read(&j.PositionMin)
+	p.read(&j.PositionMax)
+	p.read(&j.RotationMin)
+	p.read(&j.RotationMax)
+
+	p.read(&j.LinerSpring)
+	p.read(&j.AngulerSpring)
+	return j
+}
+
+func (p *PMDParser) resolveToon(model *Document) {
+	toons := p.toonTextures
+	if toons == nil {
+		toons = PMDDefaultToonTextures
+	}
+	for i, m := range model.Materials {
+		t := p.materialToons[i]
+		if t >= len(toons) || toons[t] == "" {
+			m.ToonType = 0
+			m.Toon = -1
+		} else if toons[t] == PMDDefaultToonTextures[t] {
+			m.ToonType = 1
+			m.Toon = t
+		} else {
+			m.ToonType = 0
+			m.Toon = p.textureIndex(model, toons[t])
+		}
+	}
+}
+
+// readExtensions reads optional sections after morphs.
+func (p *PMDParser) readExtensions(model *Document, morphCount int) error {
+	// Display groups
+	n, err := p.readCount(1)
+	if err != nil {
+		return err
+	}
+	morphGroup := &DisplayGroup{Name: "表情", NameEn: "Exp", Flags: 1}
+	for i := 0; i < n; i++ {
+		if morph := int(p.readUint16()) - 1; morph >= 0 {
+			morphGroup.Targets = append(morphGroup.Targets, &DisplayTarget{Type: DisplayTargetMorph, Target: morph})
+		}
+	}
+	rootGroup := &DisplayGroup{Name: "Root", NameEn: "Root", Flags: 1}
+	if len(model.Bones) > 0 {
+		rootGroup.Targets = append(rootGroup.Targets, &DisplayTarget{Type: DisplayTargetBone, Target: 0})
+	}
+	model.DisplayGroups = append(model.DisplayGroups, rootGroup, morphGroup)
+
+	n = int(p.readUint8())
+	boneGroups := make([]*DisplayGroup, n)
+	for i := 0; i < n; i++ {
+		boneGroups[i] = &DisplayGroup{Name: strings.TrimRight(p.readString(50), "\r\n")}
+	}
+	model.DisplayGroups = append(model.DisplayGroups, boneGroups...)
+	n = p.readInt()
+	for i := 0; i < n; i++ {
+		bone := p.readVInt(2)
+		group := int(p.readUint8()) - 1
+		if group >= 0 && group < len(boneGroups) {
+			boneGroups[group].Targets = append(boneGroups[group].Targets, &DisplayTarget{Type: DisplayTargetBone, Target: bone})
+		}
+	}
+
+	// English names
+	hasEnglish, err := p.readCount(1)
+	if err != nil {
+		return err
+	}
+	if hasEnglish != 0 {
+		model.NameEn = p.readString(20)
+		model.CommentEn = p.readString(256)
+		for _, b := range model.Bones {
+			b.NameEn = p.readString(20)
+		}
+		for i := 0; i < morphCount-1; i++ {
+			model.Morphs[i].NameEn = p.readString(20)
+		}
+		for _, g := range boneGroups {
+			g.NameEn = strings.TrimRight(p.readString(50), "\r\n")
+		}
+	}
+
+	// Toon textures
+	b := make([]byte, 100*len(PMDDefaultToonTextures))
+	if err := p.read(b); err != nil {
+		return io.EOF
+	}
+	tr := p.r
+	p.r = bytes.NewReader(b)
+	for range PMDDefaultToonTextures {
+		p.toonTextures = append(p.toonTextures, p.readString(100))
+	}
+	p.r = tr
+
+	// Physics
+	n, err = p.readCount(4)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		model.Bodies = append(model.Bodies, p.readRigidBody(model))
+	}
+	n, err = p.readCount(4)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		model.Joints = append(model.Joints, p.readJoint())
+	}
+	return p.err
+}
+
 // Parse model data.
 func (p *PMDParser) Parse() (*Document, error) {
 	var model Document
@@ -155,28 +410,29 @@ func (p *PMDParser) Parse() (*Document, error) {
 	// IK
 	n = int(p.readUint16())
 	for i := 0; i < n; i++ {
-		b := model.Bones[p.readUint16()]
-		b.IK.TargetID = p.readVInt(2)
-		ln := int(p.readUint8())
-		b.IK.Loop = int(p.readUint16())
-		p.readFloat()
-		for i := 0; i < ln; i++ {
-			b.IK.Links = append(b.IK.Links, &Link{TargetID: p.readVInt(2)})
-		}
+		p.readIK(&model)
 	}
 
 	// Morph
-	n = int(p.readUint16())
-	if n > 0 {
+	morphCount := int(p.readUint16())
+	if morphCount > 0 {
 		base := p.readMorph()
-		model.Morphs = make([]*Morph, n-1)
-		for i := 0; i < n-1; i++ {
+		model.Morphs = make([]*Morph, morphCount-1)
+		for i := 0; i < morphCount-1; i++ {
 			model.Morphs[i] = p.readMorph()
 			for _, v := range model.Morphs[i].Vertex {
 				v.Target = base.Vertex[v.Target].Target
 			}
 		}
 	}
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	if err := p.readExtensions(&model, morphCount); err != nil && err != io.EOF {
+		return nil, err
+	}
+	p.resolveToon(&model)
 
 	return &model, nil
 }
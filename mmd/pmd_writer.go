@@ -0,0 +1,460 @@
+package mmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+)
+
+// PMDWriter is writer for .pmd data
+type PMDWriter struct {
+	baseWriter
+
+	morphs    []*Morph // vertex morphs (flattened)
+	morphBase []int
+	toons     []string
+}
+
+func (w *PMDWriter) Write(doc *Document) error {
+	if len(doc.Vertexes) > 0xffff {
+		return fmt.Errorf("too many vertexes for PMD: %v", len(doc.Vertexes))
+	}
+	if len(doc.Bones) > 0xffff {
+		return fmt.Errorf("too many bones for PMD: %v", len(doc.Bones))
+	}
+	w.prepareMorphs(doc)
+	w.prepareToons(doc)
+
+	// header
+	w.write([]byte("Pmd"))
+	w.writeFloat(1.0)
+	w.writeString(doc.Name, 20)
+	w.writeString(doc.Comment, 256)
+
+	// vertexes
+	w.writeInt(len(doc.Vertexes))
+	for _, v := range doc.Vertexes {
+		w.writeVertex(v)
+	}
+
+	// faces
+	w.writeInt(len(doc.Faces) * 3)
+	for _, f := range doc.Faces {
+		w.writeUint16(uint16(f.Verts[0]))
+		w.writeUint16(uint16(f.Verts[1]))
+		w.writeUint16(uint16(f.Verts[2]))
+	}
+
+	// materials
+	w.writeInt(len(doc.Materials))
+	for _, m := range doc.Materials {
+		w.writeMaterial(doc, m)
+	}
+
+	// bones
+	ikParents := map[int]int{}
+	var ikBones []int
+	for i, b := range doc.Bones {
+		if b.Flags&BoneFlagEnableIK != 0 {
+			ikBones = append(ikBones, i)
+			for _, l := range b.IK.Links {
+				ikParents[l.TargetID] = i
+			}
+		}
+	}
+	w.writeUint16(uint16(len(doc.Bones)))
+	for i, b := range doc.Bones {
+		w.writeBone(b, i, ikParents)
+	}
+
+	// IK
+	w.writeUint16(uint16(len(ikBones)))
+	for _, i := range ikBones {
+		b := doc.Bones[i]
+		w.writeVInt(2, i)
+		w.writeVInt(2, b.IK.TargetID)
+		w.writeUint8(uint8(len(b.IK.Links)))
+		w.writeUint16(uint16(b.IK.Loop))
+		w.writeFloat(b.IK.LimitRad / 4)
+		for _, l := range b.IK.Links {
+			w.writeVInt(2, l.TargetID)
+		}
+	}
+
+	// morphs
+	morphIndex := w.writeMorphs(doc)
+
+	// display groups
+	var morphDisp []int
+	var boneGroups []*DisplayGroup
+	for _, g := range doc.DisplayGroups {
+		if g.Flags != 0 {
+			for _, t := range g.Targets {
+				if t.Type == DisplayTargetMorph && morphIndex[t.Target] > 0 {
+					morphDisp = append(morphDisp, morphIndex[t.Target])
+				}
+			}
+		} else if len(boneGroups) < 0xff {
+			boneGroups = append(boneGroups, g)
+		}
+	}
+	if len(morphDisp) > 0xff {
+		morphDisp = morphDisp[:0xff]
+	}
+	w.writeUint8(uint8(len(morphDisp)))
+	for _, m := range morphDisp {
+		w.writeUint16(uint16(m))
+	}
+	w.writeUint8(uint8(len(boneGroups)))
+	boneDispCount := 0
+	for _, g := range boneGroups {
+		w.writeString(g.Name+"\n", 50)
+		for _, t := range g.Targets {
+			if t.Type == DisplayTargetBone {
+				boneDispCount++
+			}
+		}
+	}
+	w.writeInt(boneDispCount)
+	for gi, g := range boneGroups {
+		for _, t := range g.Targets {
+			if t.Type == DisplayTargetBone {
+				w.writeVInt(2, t.Target)
+				w.writeUint8(uint8(gi + 1))
+			}
+		}
+	}
+
+	// English names
+	w.writeUint8(1)
+	w.writeString(doc.NameEn, 20)
+	w.writeString(doc.CommentEn, 256)
+	for _, b := range doc.Bones {
+		w.writeString(b.NameEn, 20)
+	}
+	for _, m := range w.morphs {
+		w.writeString(m.NameEn, 20)
+	}
+	for _, g := range boneGroups {
+		w.writeString(g.NameEn+"\n", 50)
+	}
+
+	// toon textures
+	for _, t := range w.toons {
+		w.writeString(t, 100)
+	}
+
+	// physics
+	w.writeInt(len(doc.Bodies))
+	for _, b := range doc.Bodies {
+		w.writeBody(doc, b)
+	}
+	w.writeInt(len(doc.Joints))
+	for _, j := range doc.Joints {
+		w.writeJoint(j)
+	}
+	return nil
+}
+
+// writeString writes fixed length Shift_JIS string.
+func (w *PMDWriter) writeString(s string, n int) {
+	b, _ := encoding.ReplaceUnsupported(japanese.ShiftJIS.NewEncoder()).Bytes([]byte(s))
+	l := 0
+	for l < len(b) {
+		sz := 1
+		if (b[l] >= 0x81 && b[l] <= 0x9f) || (b[l] >= 0xe0 && b[l] <= 0xfc) {
+			sz = 2
+		}
+		if l+sz > n {
+			break
+		}
+		l += sz
+	}
+	buf := make([]byte, n)
+	copy(buf, b[:l])
+	w.write(buf)
+}
+
+func (w *PMDWriter) writeVertex(v *Vertex) {
+	w.write(&v.Pos)
+	w.write(&v.Normal)
+	w.write(&v.UV)
+
+	// PMD supports only 2 bones.
+	type bw struct {
+		bone   int
+		weight float32
+	}
+	var weights []bw
+	for i, b := range v.Bones {
+		if b >= 0 && i < len(v.BoneWeights) {
+			weights = append(weights, bw{b, v.BoneWeights[i]})
+		}
+	}
+	sort.SliceStable(weights, func(i, j int) bool { return weights[i].weight > weights[j].weight })
+	for len(weights) < 2 {
+		weights = append(weights, bw{0, 0})
+	}
+	weight := float32(1)
+	if total := weights[0].weight + weights[1].weight; total > 0 {
+		weight = weights[0].weight / total
+	}
+	w.writeVInt(2, weights[0].bone)
+	w.writeVInt(2, weights[1].bone)
+	w.writeUint8(uint8(weight*100 + 0.5))
+	if v.EdgeScale > 0 {
+		w.writeUint8(0)
+	} else {
+		w.writeUint8(1)
+	}
+}
+
+func (w *PMDWriter) prepareToons(doc *Document) {
+	w.toons = append([]string{}, PMDDefaultToonTextures...)
+	used := map[int]bool{}
+	for _, m := range doc.Materials {
+		if m.ToonType == 1 && m.Toon >= 0 {
+			used[m.Toon] = true
+		}
+	}
+	slot := len(w.toons) - 1
+	for _, m := range doc.Materials {
+		if m.ToonType != 0 || m.Toon < 0 || m.Toon >= len(doc.Textures) {
+			continue
+		}
+		name := doc.Textures[m.Toon]
+		if w.toonIndex(doc, m) >= 0 {
+			continue
+		}
+		for slot >= 0 && used[slot] {
+			slot--
+		}
+		if slot < 0 {
+			break
+		}
+		w.toons[slot] = name
+		used[slot] = true
+	}
+}
+
+func (w *PMDWriter) toonIndex(doc *Document, m *Material) int {
+	if m.ToonType == 1 {
+		if m.Toon >= 0 && m.Toon < len(w.toons) {
+			return m.Toon
+		}
+		return -1
+	}
+	if m.Toon < 0 || m.Toon >= len(doc.Textures) {
+		return -1
+	}
+	for i, t := range w.toons {
+		if t == doc.Textures[m.Toon] {
+			return i
+		}
+	}
+	return -1
+}
+
+func (w *PMDWriter) writeMaterial(doc *Document, m *Material) {
+	w.write(&m.Color)
+	w.write(&m.Specularity)
+	w.write(&m.Specular)
+	w.write(&m.AColor)
+	if toon := w.toonIndex(doc, m); toon >= 0 {
+		w.writeUint8(uint8(toon))
+	} else {
+		w.writeUint8(0xff)
+	}
+	if m.Flags&MaterialFlagDrawEdge != 0 {
+		w.writeUint8(1)
+	} else {
+		w.writeUint8(0)
+	}
+	w.writeInt(m.Count)
+
+	tex := ""
+	if m.TextureID >= 0 && m.TextureID < len(doc.Textures) {
+		tex = doc.Textures[m.TextureID]
+	}
+	if m.EnvID >= 0 && m.EnvID < len(doc.Textures) && m.EnvMode != 0 {
+		if tex != "" {
+			tex += "*"
+		}
+		tex += doc.Textures[m.EnvID]
+	}
+	w.writeString(tex, 20)
+}
+
+func (w *PMDWriter) writeBone(b *Bone, index int, ikParents map[int]int) {
+	var typ uint8
+	ikParent := 0
+	if ik, ok := ikParents[index]; ok {
+		typ = 4
+		ikParent = ik
+	}
+	if b.Flags&BoneFlagTranslatable != 0 {
+		typ = 1
+	}
+	if b.Flags&BoneFlagInheritRotation != 0 && b.InheritParentID >= 0 {
+		typ = 5
+		ikParent = b.InheritParentID
+	}
+	if b.Flags&BoneFlagEnableIK != 0 {
+		typ = 2
+	}
+	if b.Flags&BoneFlagVisible == 0 {
+		typ = 7
+	}
+
+	tail := b.TailID
+	if b.Flags&BoneFlagTailIndex == 0 || tail < 0 {
+		tail = 0
+	}
+
+	w.writeString(b.Name, 20)
+	w.writeVInt(2, b.ParentID)
+	w.writeVInt(2, tail)
+	w.writeUint8(typ)
+	w.writeVInt(2, ikParent)
+	w.write(&b.Pos)
+}
+
+// prepareMorphs flattens group morphs into vertex morphs.
+func (w *PMDWriter) prepareMorphs(doc *Document) {
+	var flatten func(m *Morph, weight float32, offsets map[int]Vector3, depth int)
+	flatten = func(m *Morph, weight float32, offsets map[int]Vector3, depth int) {
+		for _, v := range m.Vertex {
+			o := offsets[v.Target]
+			offsets[v.Target] = *o.Add(v.Offset.Scale(weight))
+		}
+		if depth > 8 {
+			return
+		}
+		for _, g := range m.Group {
+			if g.Target >= 0 && g.Target < len(doc.Morphs) {
+				flatten(doc.Morphs[g.Target], weight*g.Weight, offsets, depth+1)
+			}
+		}
+	}
+
+	baseIndex := map[int]int{}
+	for _, m := range doc.Morphs {
+		if m.MorphType != 0 && m.MorphType != 1 {
+			w.morphs = append(w.morphs, nil)
+			continue
+		}
+		offsets := map[int]Vector3{}
+		flatten(m, 1, offsets, 0)
+		var targets []int
+		for t := range offsets {
+			targets = append(targets, t)
+		}
+		sort.Ints(targets)
+		morph := &Morph{Name: m.Name, NameEn: m.NameEn, PanelType: m.PanelType, MorphType: 1}
+		for _, t := range targets {
+			if _, ok := baseIndex[t]; !ok {
+				baseIndex[t] = len(w.morphBase)
+				w.morphBase = append(w.morphBase, t)
+			}
+			morph.Vertex = append(morph.Vertex, &MorphVertex{Target: baseIndex[t], Offset: offsets[t]})
+		}
+		if len(morph.Vertex) == 0 {
+			w.morphs = append(w.morphs, nil)
+			continue
+		}
+		if morph.PanelType == 0 || morph.PanelType > 4 {
+			morph.PanelType = 4
+		}
+		w.morphs = append(w.morphs, morph)
+	}
+}
+
+// writeMorphs writes vertex morphs and returns PMD morph indices.
+func (w *PMDWriter) writeMorphs(doc *Document) map[int]int {
+	morphIndex := map[int]int{}
+	var morphs []*Morph
+	for i, m := range w.morphs {
+		if m != nil {
+			morphs = append(morphs, m)
+			morphIndex[i] = len(morphs)
+		}
+	}
+	w.morphs = morphs
+	if len(morphs) == 0 {
+		w.writeUint16(0)
+		return morphIndex
+	}
+
+	w.writeUint16(uint16(len(morphs) + 1))
+	w.writeString("base", 20)
+	w.writeInt(len(w.morphBase))
+	w.writeUint8(0)
+	for _, v := range w.morphBase {
+		w.writeInt(v)
+		w.write(&doc.Vertexes[v].Pos)
+	}
+	for _, m := range morphs {
+		w.writeString(m.Name, 20)
+		w.writeInt(len(m.Vertex))
+		w.writeUint8(m.PanelType)
+		for _, v := range m.Vertex {
+			w.writeInt(v.Target)
+			w.write(&v.Offset)
+		}
+	}
+	return morphIndex
+}
+
+func (w *PMDWriter) writeBody(doc *Document, b *RigidBody) {
+	bone := b.Bone
+	if bone < 0 || bone >= len(doc.Bones) {
+		bone = 0
+	}
+	pos := b.Position
+	if bone < len(doc.Bones) {
+		pos = *pos.Sub(&doc.Bones[bone].Pos)
+	}
+
+	w.writeString(b.Name, 20)
+	w.writeVInt(2, b.Bone)
+	w.writeUint8(uint8(b.Group))
+	w.writeVInt(2, b.GroupTarget)
+	w.write(&b.Shape)
+
+	w.write(&b.Size)
+	w.write(&pos)
+	w.write(&b.Rotation)
+
+	w.write(&b.Mass)
+	w.write(&b.LinearDamping)
+	w.write(&b.AngularDamping)
+	w.write(&b.Restitution)
+	w.write(&b.Friction)
+
+	w.write(&b.Mode)
+}
+
+func (w *PMDWriter) writeJoint(j *Joint) {
+	w.writeString(j.Name, 20)
+	w.writeInt(j.Body1)
+	w.writeInt(j.Body2)
+
+	w.write(&j.Position)
+	w.write(&j.Rotation)
+
+	w.write(&j.PositionMin)
+	w.write(&j.PositionMax)
+	w.write(&j.RotationMin)
+	w.write(&j.RotationMax)
+
+	w.write(&j.LinerSpring)
+	w.write(&j.AngulerSpring)
+}
+
+// WritePMD writes .pmd data
+func WritePMD(doc *Document, w io.Writer) error {
+	return (&PMDWriter{baseWriter: baseWriter{w}}).Write(doc)
+}
@@ -0,0 +1,81 @@
+package mmd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWritePMD(t *testing.T) {
+	doc := NewDocument()
+	doc.Name = "テスト"
+	doc.NameEn = "test"
+	doc.Textures = []string{"tex.png", "env.sph", "mytoon.bmp"}
+	doc.Vertexes = []*Vertex{
+		{Pos: Vector3{X: 0, Y: 0, Z: 0}, Bones: []int{0}, BoneWeights: []float32{1}, EdgeScale: 1},
+		{Pos: Vector3{X: 1, Y: 0, Z: 0}, Bones: []int{0, 1}, BoneWeights: []float32{0.25, 0.75}, EdgeScale: 1},
+		{Pos: Vector3{X: 1, Y: 1, Z: 0}, Bones: []int{1}, BoneWeights: []float32{1}},
+	}
+	doc.Faces = []*Face{{Verts: [3]int{0, 1, 2}}}
+	doc.Materials = []*Material{
+		{Name: "mat1", Color: Vector4{X: 1, Y: 1, Z: 1, W: 1}, TextureID: 0, EnvID: 1, EnvMode: 1, ToonType: 0, Toon: 2, Count: 3, Flags: MaterialFlagDrawEdge},
+	}
+	doc.Bones = []*Bone{
+		{Name: "センター", NameEn: "center", ParentID: -1, TailID: 1, Flags: BoneFlagTailIndex | BoneFlagVisible | BoneFlagTranslatable},
+		{Name: "bone1", ParentID: 0, TailID: -1, Pos: Vector3{X: 0, Y: 1, Z: 0}, Flags: BoneFlagVisible},
+	}
+	doc.Morphs = []*Morph{
+		{Name: "morph1", NameEn: "m1", PanelType: 2, MorphType: 1, Vertex: []*MorphVertex{{Target: 2, Offset: Vector3{X: 0, Y: 0.5, Z: 0}}}},
+		{Name: "group1", PanelType: 4, MorphType: 0, Group: []*MorphGroup{{Target: 0, Weight: 0.5}}},
+	}
+	doc.DisplayGroups = []*DisplayGroup{
+		{Name: "表情", Flags: 1, Targets: []*DisplayTarget{{Type: DisplayTargetMorph, Target: 1}}},
+		{Name: "体", NameEn: "body", Targets: []*DisplayTarget{{Type: DisplayTargetBone, Target: 1}}},
+	}
+	doc.Bodies = []*RigidBody{{Name: "body1", Bone: 1, Position: Vector3{X: 0, Y: 2, Z: 0}, Mode: 1}}
+	doc.Joints = []*Joint{{Name: "joint1", Body1: 0, Body2: 0}}
+
+	var buf bytes.Buffer
+	if err := WritePMD(doc, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Name != doc.Name || result.NameEn != doc.NameEn {
+		t.Error("name: ", result.Name, result.NameEn)
+	}
+	if len(result.Vertexes) != 3 || result.Vertexes[1].Bones[0] != 1 || result.Vertexes[1].BoneWeights[0] != 0.75 {
+		t.Error("vertexes: ", result.Vertexes[1])
+	}
+	if result.Vertexes[2].EdgeScale != 0 {
+		t.Error("edge: ", result.Vertexes[2].EdgeScale)
+	}
+	m := result.Materials[0]
+	if result.Textures[m.TextureID] != "tex.png" || result.Textures[m.EnvID] != "env.sph" || m.EnvMode != 1 {
+		t.Error("texture: ", m.TextureID, m.EnvID, result.Textures)
+	}
+	if m.ToonType != 0 || result.Textures[m.Toon] != "mytoon.bmp" || m.Flags&MaterialFlagDrawEdge == 0 {
+		t.Error("toon: ", m.ToonType, m.Toon)
+	}
+	if len(result.Bones) != 2 || result.Bones[0].NameEn != "center" || result.Bones[0].Flags&BoneFlagTranslatable == 0 {
+		t.Error("bones: ", result.Bones)
+	}
+	if len(result.Morphs) != 2 || result.Morphs[1].Name != "group1" || result.Morphs[1].Vertex[0].Offset.Y != 0.25 {
+		t.Error("morphs: ", result.Morphs)
+	}
+	if result.Morphs[0].NameEn != "m1" || result.Morphs[0].Vertex[0].Target != 2 {
+		t.Error("morphs: ", result.Morphs[0])
+	}
+	if len(result.DisplayGroups) != 3 || result.DisplayGroups[1].Targets[0].Target != 1 || result.DisplayGroups[2].NameEn != "body" {
+		t.Error("display groups: ", result.DisplayGroups)
+	}
+	if len(result.Bodies) != 1 || result.Bodies[0].Position.Y != 2 || result.Bodies[0].Mode != 1 {
+		t.Error("bodies: ", result.Bodies)
+	}
+	if len(result.Joints) != 1 || result.Joints[0].Name != "joint1" {
+		t.Error("joints: ", result.Joints)
+	}
+}
@@ -262,31 +262,22 @@ func (p *PMXParser) readMorph() *Morph {
 	return &m
 }
 
-func (p *PMXParser) readDisplayGroup() {
-	// TODO
-	type DisplayTarget struct {
-		Type   uint8
-		Target int
-	}
-	d := struct {
-		Name   string
-		NameEn string
-		Flags  uint8
-		Target []DisplayTarget
-	}{}
+func (p *PMXParser) readDisplayGroup() *DisplayGroup {
+	d := &DisplayGroup{}
 	d.Name = p.readText()
 	d.NameEn = p.readText()
 	d.Flags = p.readUint8()
 	n := p.readInt()
 	for i := 0; i < n; i++ {
-		t := DisplayTarget{Type: p.readUint8()}
-		if t.Type == 0 {
+		t := &DisplayTarget{Type: p.readUint8()}
+		if t.Type == DisplayTargetBone {
 			t.Target = p.readIndex(AttrBoneIndexSz)
 		} else {
 			t.Target = p.readIndex(AttrMorphIndexSz)
 		}
-		d.Target = append(d.Target, t)
+		d.Targets = append(d.Targets, t)
 	}
+	return d
 }
 
 func (p *PMXParser) readRigidBody() *RigidBody {
@@ -387,7 +378,7 @@ func (p *PMXParser) Parse() (*Document, error) {
 
 	gn := p.readInt()
 	for i := 0; i < gn; i++ {
-		p.readDisplayGroup() // TODO
+		pmx.DisplayGroups = append(pmx.DisplayGroups, p.readDisplayGroup())
 	}
 
 	rb := p.readInt()
@@ -119,8 +119,11 @@ func (w *PMXWriter) Write(doc *Document) error {
 		w.writeMorph(m)
 	}
 
-	// TODO
-	w.writeInt(0)
+	// display groups
+	w.writeInt(len(doc.DisplayGroups))
+	for _, d := range doc.DisplayGroups {
+		w.writeDisplayGroup(d)
+	}
 
 	w.writeInt(len(doc.Bodies))
 	for _, b := range doc.Bodies {
@@ -341,6 +344,21 @@ func (w *PMXWriter) writeMorph(m *Morph) {
 	}
 }
 
+func (w *PMXWriter) writeDisplayGroup(d *DisplayGroup) {
+	w.writeText(d.Name)
+	w.writeText(d.NameEn)
+	w.writeUint8(d.Flags)
+	w.writeInt(len(d.Targets))
+	for _, t := range d.Targets {
+		w.writeUint8(t.Type)
+		if t.Type == DisplayTargetBone {
+			w.writeIndex(AttrBoneIndexSz, t.Target)
+		} else {
+			w.writeIndex(AttrMorphIndexSz, t.Target)
+		}
+	}
+}
+
 func (w *PMXWriter) writeBody(b *RigidBody) {
 	w.writeText(b.Name)
 	w.writeText(b.NameEn)
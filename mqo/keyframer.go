@@ -0,0 +1,291 @@
+package mqo
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/binzume/modelconv/geom"
+)
+
+const DefaultMotionFrameRate = 30
+
+// KeyframerPlugin holds the motions of the document.
+// The motion data of Metasequoia's Keyframer plugin (.mqx and .mkm) is not documented, so it is not read or written.
+// Use ReadMotions() / WriteMotions() to save the motions as a separate file in modelconv's own format (.mqmotion).
+type KeyframerPlugin struct {
+	Motions []*Motion
+}
+
+type Motion struct {
+	Name      string  `xml:"name,attr"`
+	FrameRate float32 `xml:"fps,attr"`
+
+	Bones   []*BoneMotion   `xml:"Bone"`
+	Objects []*ObjectMotion `xml:"Object"`
+	Morphs  []*MorphMotion  `xml:"Morph"`
+}
+
+type BoneMotion struct {
+	Name string          `xml:"name,attr"`
+	Keys []*BoneKeyframe `xml:"K"`
+}
+
+// BoneKeyframe is a pose relative to the rest pose. Angles are in degrees.
+type BoneKeyframe struct {
+	Frame int `xml:"f,attr"`
+
+	MvX float32 `xml:"mvX,attr"`
+	MvY float32 `xml:"mvY,attr"`
+	MvZ float32 `xml:"mvZ,attr"`
+
+	RotH float32 `xml:"rotH,attr"`
+	RotP float32 `xml:"rotP,attr"`
+	RotB float32 `xml:"rotB,attr"`
+
+	// Optional scale relative to the rest pose.
+	Scale *Vector3Attr `xml:"sc,attr,omitempty"`
+
+	// Optional tangents (per second) for cubic spline interpolation.
+	In  *BoneKeyTangent `xml:"In,omitempty"`
+	Out *BoneKeyTangent `xml:"Out,omitempty"`
+}
+
+// BoneKeyTangent is a derivative of the keyframe. Rotation is a derivative of the quaternion returned by GetRotation().
+type BoneKeyTangent struct {
+	Mv Vector3Attr  `xml:"mv,attr"`
+	QX float32      `xml:"qX,attr"`
+	QY float32      `xml:"qY,attr"`
+	QZ float32      `xml:"qZ,attr"`
+	QW float32      `xml:"qW,attr"`
+	Sc *Vector3Attr `xml:"sc,attr,omitempty"`
+}
+
+// ObjectMotion animates the object node without bones. ObjectID is the UID of the object.
+// Keyframes are relative to the rest pose in the world aligned space like BoneMotion.
+type ObjectMotion struct {
+	ObjectID int `xml:"objectId,attr"`
+	BoneMotion
+}
+
+type MorphMotion struct {
+	Name string           `xml:"name,attr"`
+	Keys []*MorphKeyframe `xml:"K"`
+}
+
+type MorphKeyframe struct {
+	Frame int     `xml:"f,attr"`
+	Value float32 `xml:"v,attr"`
+
+	// Optional tangents (per second) for cubic spline interpolation.
+	In  *float32 `xml:"in,attr,omitempty"`
+	Out *float32 `xml:"out,attr,omitempty"`
+}
+
+// MotionFileExt is the extension of the motion file. Keyframer's .mkm is not used because the format is not compatible.
+const MotionFileExt = ".mqmotion"
+
+// motionDoc is the root element of the motion file. This is modelconv's own format and not compatible with Metasequoia Keyframer.
+type motionDoc struct {
+	XMLName xml.Name  `xml:"ModelconvMotion"`
+	Motions []*Motion `xml:"Motion"`
+}
+
+func FindKeyframerPlugin(mqo *Document) *KeyframerPlugin {
+	for _, p := range mqo.Plugins {
+		if kp, ok := p.(*KeyframerPlugin); ok {
+			return kp
+		}
+	}
+	return nil
+}
+
+func GetKeyframerPlugin(mqo *Document) *KeyframerPlugin {
+	if kp := FindKeyframerPlugin(mqo); kp != nil {
+		return kp
+	}
+	kp := &KeyframerPlugin{}
+	mqo.Plugins = append(mqo.Plugins, kp)
+	return kp
+}
+
+func (p *KeyframerPlugin) PreSerialize(mqo *Document) {
+	for _, m := range p.Motions {
+		m.Sort()
+	}
+}
+
+func (p *KeyframerPlugin) PostDeserialize(mqo *Document) {
+}
+
+func (p *KeyframerPlugin) ApplyTransform(transform *Matrix4) {
+	for _, m := range p.Motions {
+		m.ApplyTransform(transform)
+	}
+}
+
+// ApplyTransform transforms translations and rotations of all keyframes.
+func (m *Motion) ApplyTransform(transform *Matrix4) {
+	rsmat := transform.Clone()
+	rsmat[12], rsmat[13], rsmat[14] = 0, 0, 0 // remove translate
+	_, r, s := rsmat.Decompose()
+	if s.X*s.Y*s.Z < 0 {
+		// mirror transform can not be represented as a rotation.
+		rsmat = rsmat.Mul(geom.NewScaleMatrix4(-1, -1, -1))
+		_, r, _ = rsmat.Decompose()
+	}
+	inv := r.Inverse()
+	origin := transform.ApplyTo(&Vector3{})
+	for _, b := range m.transformMotions() {
+		for _, k := range b.Keys {
+			mv := transform.ApplyTo(&Vector3{X: k.MvX, Y: k.MvY, Z: k.MvZ}).Sub(origin)
+			k.MvX, k.MvY, k.MvZ = mv.X, mv.Y, mv.Z
+			q := r.Mul(k.GetRotation()).Mul(inv)
+			k.SetRotation(q)
+			flip := k.GetRotation().Dot(q) < 0
+			for _, t := range []*BoneKeyTangent{k.In, k.Out} {
+				if t == nil {
+					continue
+				}
+				t.Mv.Vector3 = *transform.ApplyTo(&t.Mv.Vector3).Sub(origin)
+				t.SetRotation(r.Mul(t.GetRotation()).Mul(inv))
+				if flip {
+					t.SetRotation(t.GetRotation().Scale(-1))
+				}
+			}
+		}
+	}
+}
+
+func (k *BoneKeyframe) GetRotation() *geom.Quaternion {
+	return (&geom.EulerAngles{Vector3: *geom.NewVector3(k.RotP, k.RotH, k.RotB).Scale(math.Pi / 180), Order: geom.RotationOrderYXZ}).ToQuaternion()
+}
+
+func (k *BoneKeyframe) SetRotation(q *geom.Quaternion) {
+	r := geom.NewEulerFromQuaternion(q, geom.RotationOrderYXZ).Vector3.Scale(180 / math.Pi)
+	k.RotP, k.RotH, k.RotB = r.X, r.Y, r.Z
+}
+
+func (k *BoneKeyframe) GetTranslation() *Vector3 {
+	return &Vector3{X: k.MvX, Y: k.MvY, Z: k.MvZ}
+}
+
+func (k *BoneKeyframe) GetScale() *Vector3 {
+	if k.Scale == nil {
+		return &Vector3{X: 1, Y: 1, Z: 1}
+	}
+	return &Vector3{X: k.Scale.X, Y: k.Scale.Y, Z: k.Scale.Z}
+}
+
+func (t *BoneKeyTangent) GetRotation() *geom.Quaternion {
+	return geom.NewQuaternion(t.QX, t.QY, t.QZ, t.QW)
+}
+
+func (t *BoneKeyTangent) SetRotation(q *geom.Quaternion) {
+	t.QX, t.QY, t.QZ, t.QW = q.X, q.Y, q.Z, q.W
+}
+
+// transformMotions returns the motions of the bones and the objects.
+func (m *Motion) transformMotions() []*BoneMotion {
+	motions := append([]*BoneMotion{}, m.Bones...)
+	for _, o := range m.Objects {
+		motions = append(motions, &o.BoneMotion)
+	}
+	return motions
+}
+
+// Sort keyframes by frame.
+func (m *Motion) Sort() {
+	for _, b := range m.transformMotions() {
+		sort.SliceStable(b.Keys, func(i, j int) bool { return b.Keys[i].Frame < b.Keys[j].Frame })
+	}
+	for _, b := range m.Morphs {
+		sort.SliceStable(b.Keys, func(i, j int) bool { return b.Keys[i].Frame < b.Keys[j].Frame })
+	}
+}
+
+func (m *Motion) GetFrameRate() float32 {
+	if m.FrameRate <= 0 {
+		return DefaultMotionFrameRate
+	}
+	return m.FrameRate
+}
+
+// ReadMotions reads motions written by WriteMotions().
+func ReadMotions(r io.Reader) ([]*Motion, error) {
+	var doc motionDoc
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("unsupported motion file (Metasequoia Keyframer format is not supported): %w", err)
+	}
+	for _, m := range doc.Motions {
+		m.Sort()
+	}
+	return doc.Motions, nil
+}
+
+func WriteMotions(motions []*Motion, w io.Writer) error {
+	for _, m := range motions {
+		m.Sort()
+	}
+	xmlBuf, err := xml.MarshalIndent(&motionDoc{Motions: motions}, "", "    ")
+	if err != nil {
+		return err
+	}
+	w.Write([]byte(xml.Header))
+	_, err = w.Write(xmlBuf)
+	return err
+}
+
+func LoadMotions(path string) ([]*Motion, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ReadMotions(r)
+}
+
+func SaveMotions(motions []*Motion, path string) error {
+	w, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	return WriteMotions(motions, w)
+}
+
+// PoseMotion returns the pose of the bones (PoseSet) as a motion which has a single keyframe.
+// PoseSet can hold only one pose, so this can be used to export the pose when the document has no motions.
+// Returns nil if all bones are in the rest pose.
+func (p *BonePlugin) PoseMotion(name string) *Motion {
+	boneByID := map[int]*Bone{}
+	for _, b := range p.Bones() {
+		boneByID[b.ID] = b
+	}
+	motion := &Motion{Name: name}
+	for _, pose := range p.PoseSet.BonePoses {
+		boneName := pose.Name
+		if b := boneByID[pose.ID]; boneName == "" && b != nil {
+			boneName = b.Name
+		}
+		if boneName == "" {
+			continue
+		}
+		k := &BoneKeyframe{MvX: pose.MvX, MvY: pose.MvY, MvZ: pose.MvZ, RotH: pose.RotH, RotP: pose.RotP, RotB: pose.RotB}
+		// zero scale means not specified.
+		if sc := (Vector3{X: pose.ScP, Y: pose.ScH, Z: pose.ScB}); sc != (Vector3{}) && sc != (Vector3{X: 1, Y: 1, Z: 1}) {
+			k.Scale = &Vector3Attr{sc}
+		}
+		if k.GetTranslation().LenSqr() == 0 && k.RotH == 0 && k.RotP == 0 && k.RotB == 0 && k.Scale == nil {
+			continue
+		}
+		motion.Bones = append(motion.Bones, &BoneMotion{Name: boneName, Keys: []*BoneKeyframe{k}})
+	}
+	if len(motion.Bones) == 0 {
+		return nil
+	}
+	return motion
+}
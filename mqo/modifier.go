@@ -0,0 +1,523 @@
+package mqo
+
+import (
+	"math"
+	"strings"
+
+	"github.com/binzume/modelconv/geom"
+)
+
+const (
+	MirrorNone     = 0
+	MirrorSeparate = 1
+	MirrorConnect  = 2
+
+	MirrorAxisX = 1
+	MirrorAxisY = 2
+	MirrorAxisZ = 4
+
+	PatchNone         = 0
+	PatchSpline1      = 1
+	PatchSpline2      = 2
+	PatchCatmullClark = 3
+	PatchOpenSubdiv   = 4
+
+	maxPatchLevel = 6
+)
+
+// vertexMix is a new vertex expressed as a weighted sum of the source vertices.
+type vertexMix struct {
+	src     []int
+	weights []float32
+	mirror  *Matrix4 // reflection applied after mixing (optional)
+}
+
+func (m *vertexMix) add(src int, w float32) {
+	for i, s := range m.src {
+		if s == src {
+			m.weights[i] += w
+			return
+		}
+	}
+	m.src = append(m.src, src)
+	m.weights = append(m.weights, w)
+}
+
+func (m *vertexMix) addMix(o *vertexMix, w float32) {
+	for i, s := range o.src {
+		m.add(s, o.weights[i]*w)
+	}
+}
+
+func (m *vertexMix) position(verts []*Vector3) *Vector3 {
+	var p Vector3
+	for i, s := range m.src {
+		p = *p.Add(verts[s].Scale(m.weights[i]))
+	}
+	if m.mirror != nil {
+		return m.mirror.ApplyTo(&p)
+	}
+	return &p
+}
+
+func singleVertex(i int) *vertexMix {
+	return &vertexMix{src: []int{i}, weights: []float32{1}}
+}
+
+// ApplyMirrorAndPatch freezes mirror and subdivision surface settings of all objects.
+// Bone weights, morph targets and per-vertex extra data are updated as well.
+func (doc *Document) ApplyMirrorAndPatch() {
+	doc.FixObjectID()
+	objectByName := map[string]*Object{}
+	for _, obj := range doc.Objects {
+		objectByName[obj.Name] = obj
+	}
+	morphTargets := map[*Object][]*Object{}
+	isTarget := map[*Object]bool{}
+	var morphs []*MorphTargetList
+	for _, p := range doc.Plugins {
+		if mp, ok := p.(*MorphPlugin); ok {
+			morphs = mp.Morphs()
+		}
+	}
+	for _, m := range morphs {
+		base := objectByName[m.Base]
+		if base == nil {
+			continue
+		}
+		for _, t := range m.Target {
+			if o := objectByName[t.Name]; o != nil && len(o.Vertexes) == len(base.Vertexes) {
+				morphTargets[base] = append(morphTargets[base], o)
+				isTarget[o] = true
+			}
+		}
+	}
+
+	transforms := doc.GetWorldTransforms()
+	for _, obj := range doc.Objects {
+		if isTarget[obj] || len(obj.Faces) == 0 {
+			continue
+		}
+		if obj.Mirror != MirrorNone {
+			axis := obj.MirrorAxis
+			if axis == 0 {
+				axis = MirrorAxisX
+			}
+			for _, a := range []int{MirrorAxisX, MirrorAxisY, MirrorAxisZ} {
+				if axis&a != 0 {
+					mixes := obj.mirror(a, transforms[obj])
+					doc.remapVertexes(obj, morphTargets[obj], mixes)
+				}
+			}
+		}
+		if obj.Patch != PatchNone {
+			for i := 0; i < obj.patchLevel(); i++ {
+				mixes := obj.subdivide()
+				doc.remapVertexes(obj, morphTargets[obj], mixes)
+			}
+		}
+		for _, o := range append(morphTargets[obj], obj) {
+			o.Mirror, o.MirrorAxis, o.MirrorDis = MirrorNone, 0, 0
+			o.Patch, o.PatchSegment = PatchNone, 0
+		}
+	}
+}
+
+// patchLevel returns the number of Catmull-Clark iterations.
+// Spline patches are approximated by subdividing until the edges are split into PatchSegment.
+func (o *Object) patchLevel() int {
+	level := o.PatchSegment
+	if o.Patch == PatchSpline1 || o.Patch == PatchSpline2 {
+		level = int(math.Ceil(math.Log2(float64(o.PatchSegment))))
+	}
+	if level < 1 {
+		level = 1
+	}
+	if level > maxPatchLevel {
+		level = maxPatchLevel
+	}
+	return level
+}
+
+func (o *Object) mirror(axis int, transform *Matrix4) []*vertexMix {
+	var sx, sy, sz float32 = 1, 1, 1
+	var localAxis int
+	switch axis {
+	case MirrorAxisX:
+		sx, localAxis = -1, 0
+	case MirrorAxisY:
+		sy, localAxis = -1, 1
+	case MirrorAxisZ:
+		sz, localAxis = -1, 2
+	}
+	inv := transform.Inverse()
+	reflect := transform.Mul(geom.NewScaleMatrix4(sx, sy, sz)).Mul(inv)
+	rsmat := reflect.Clone()
+	rsmat[12], rsmat[13], rsmat[14] = 0, 0, 0
+	normalTransform := rsmat.Inverse().Transposed()
+
+	var dis float32 = 1e-5
+	if o.Mirror == MirrorConnect && o.MirrorDis > dis {
+		dis = o.MirrorDis
+	}
+
+	n := len(o.Vertexes)
+	var mixes []*vertexMix
+	for i := 0; i < n; i++ {
+		mixes = append(mixes, singleVertex(i))
+	}
+	mirrored := make([]int, n)
+	for i, v := range o.Vertexes {
+		l := inv.ApplyTo(v)
+		if o.Mirror == MirrorConnect && math.Abs(float64([]float32{l.X, l.Y, l.Z}[localAxis])) <= float64(dis) {
+			mirrored[i] = i // weld
+			continue
+		}
+		mirrored[i] = len(mixes)
+		m := singleVertex(i)
+		m.mirror = reflect
+		mixes = append(mixes, m)
+	}
+
+	faces := o.Faces
+	for _, f := range faces {
+		welded := true
+		mf := &Face{Material: f.Material, Verts: make([]int, len(f.Verts))}
+		for i, v := range f.Verts {
+			mf.Verts[i] = mirrored[v]
+			welded = welded && mirrored[v] == v
+		}
+		if welded {
+			continue
+		}
+		if len(f.UVs) > 0 {
+			mf.UVs = append([]Vector2{}, f.UVs...)
+		}
+		if len(f.Normals) > 0 {
+			mf.Normals = make([]*Vector3, len(f.Normals))
+			for i, nv := range f.Normals {
+				if nv != nil {
+					mf.Normals[i] = normalTransform.ApplyTo(nv).Normalize()
+				}
+			}
+		}
+		if len(f.Creases) > 0 {
+			mf.Creases = append([]float32{}, f.Creases...)
+		}
+		mf.Flip()
+		o.Faces = append(o.Faces, mf)
+	}
+	return mixes
+}
+
+type subdivEdge struct {
+	v      [2]int
+	faces  []int
+	index  int
+	crease float32
+}
+
+func (e *subdivEdge) sharp() bool {
+	return len(e.faces) != 2 || e.crease >= 1
+}
+
+// subdivide applies one Catmull-Clark iteration. UVs and normals are interpolated linearly.
+// Edges with crease >= 1 are treated as sharp edges and the crease value is decremented for child edges.
+func (o *Object) subdivide() []*vertexMix {
+	n := len(o.Vertexes)
+	var mixes []*vertexMix
+	for i := 0; i < n; i++ {
+		mixes = append(mixes, &vertexMix{})
+	}
+
+	edges := map[[2]int]*subdivEdge{}
+	var edgeList []*subdivEdge
+	edgeKey := func(a, b int) [2]int {
+		if a > b {
+			a, b = b, a
+		}
+		return [2]int{a, b}
+	}
+	facePoints := make([]int, len(o.Faces))
+	for fi, f := range o.Faces {
+		if len(f.Verts) < 3 {
+			continue
+		}
+		fp := &vertexMix{}
+		for _, v := range f.Verts {
+			fp.add(v, 1/float32(len(f.Verts)))
+		}
+		facePoints[fi] = len(mixes)
+		mixes = append(mixes, fp)
+		for i, v := range f.Verts {
+			k := edgeKey(v, f.Verts[(i+1)%len(f.Verts)])
+			e := edges[k]
+			if e == nil {
+				e = &subdivEdge{v: k}
+				edges[k] = e
+				edgeList = append(edgeList, e)
+			}
+			e.faces = append(e.faces, fi)
+			if len(f.Creases) == len(f.Verts) && f.Creases[i] > e.crease {
+				e.crease = f.Creases[i]
+			}
+		}
+	}
+
+	vertFaces := make([][]int, n)
+	vertEdges := make([][]*subdivEdge, n)
+	for fi, f := range o.Faces {
+		if len(f.Verts) < 3 {
+			continue
+		}
+		for _, v := range f.Verts {
+			vertFaces[v] = append(vertFaces[v], fi)
+		}
+	}
+	for _, e := range edgeList {
+		em := &vertexMix{}
+		if !e.sharp() {
+			em.add(e.v[0], 0.25)
+			em.add(e.v[1], 0.25)
+			em.addMix(mixes[facePoints[e.faces[0]]], 0.25)
+			em.addMix(mixes[facePoints[e.faces[1]]], 0.25)
+		} else {
+			em.add(e.v[0], 0.5)
+			em.add(e.v[1], 0.5)
+		}
+		e.index = len(mixes)
+		mixes = append(mixes, em)
+		vertEdges[e.v[0]] = append(vertEdges[e.v[0]], e)
+		vertEdges[e.v[1]] = append(vertEdges[e.v[1]], e)
+	}
+
+	for v := 0; v < n; v++ {
+		m := mixes[v]
+		var boundary []*subdivEdge
+		for _, e := range vertEdges[v] {
+			if e.sharp() {
+				boundary = append(boundary, e)
+			}
+		}
+		valence := len(vertEdges[v])
+		if valence == 0 || len(boundary) > 2 || len(boundary) == 1 {
+			m.add(v, 1) // isolated, corner or dart vertex
+		} else if len(boundary) == 2 {
+			m.add(v, 0.75)
+			for _, e := range boundary {
+				m.add(e.v[0]+e.v[1]-v, 0.125)
+			}
+		} else {
+			// (F + 2R + (n-3)P) / n
+			nf := float32(valence)
+			for _, fi := range vertFaces[v] {
+				m.addMix(mixes[facePoints[fi]], 1/float32(len(vertFaces[v]))/nf)
+			}
+			for _, e := range vertEdges[v] {
+				m.add(e.v[0], 1/nf/nf)
+				m.add(e.v[1], 1/nf/nf)
+			}
+			m.add(v, (nf-3)/nf)
+		}
+	}
+
+	var faces []*Face
+	for fi, f := range o.Faces {
+		sz := len(f.Verts)
+		if sz < 3 {
+			faces = append(faces, f)
+			continue
+		}
+		for i, v := range f.Verts {
+			next, prev := (i+1)%sz, (i+sz-1)%sz
+			nf := &Face{
+				Material: f.Material,
+				Verts: []int{
+					v,
+					edges[edgeKey(v, f.Verts[next])].index,
+					facePoints[fi],
+					edges[edgeKey(f.Verts[prev], v)].index,
+				},
+			}
+			if len(f.UVs) == sz {
+				var center Vector2
+				for _, uv := range f.UVs {
+					center = *center.Add(uv.Scale(1 / float32(sz)))
+				}
+				nf.UVs = []Vector2{
+					f.UVs[i],
+					*f.UVs[i].Add(&f.UVs[next]).Scale(0.5),
+					center,
+					*f.UVs[prev].Add(&f.UVs[i]).Scale(0.5),
+				}
+			}
+			if len(f.Normals) == sz && f.Normals[i] != nil && f.Normals[next] != nil && f.Normals[prev] != nil {
+				var center Vector3
+				for _, nv := range f.Normals {
+					if nv != nil {
+						center = *center.Add(nv)
+					}
+				}
+				nf.Normals = []*Vector3{
+					f.Normals[i],
+					f.Normals[i].Add(f.Normals[next]).Normalize(),
+					center.Normalize(),
+					f.Normals[prev].Add(f.Normals[i]).Normalize(),
+				}
+			}
+			if len(f.Creases) == sz {
+				nf.Creases = []float32{f.Creases[i] - 1, 0, 0, f.Creases[prev] - 1}
+				for j, c := range nf.Creases {
+					if c < 0 {
+						nf.Creases[j] = 0
+					}
+				}
+			}
+			faces = append(faces, nf)
+		}
+	}
+	o.Faces = faces
+	return mixes
+}
+
+// remapVertexes replaces vertexes of obj (and its morph targets) with mixed vertexes.
+func (doc *Document) remapVertexes(obj *Object, targets []*Object, mixes []*vertexMix) {
+	n := len(obj.Vertexes)
+	// Bone weights are looked up by the vertex UIDs before the vertexes are replaced.
+	var bones []*Bone
+	for _, p := range doc.Plugins {
+		if bp, ok := p.(*BonePlugin); ok {
+			bones = bp.Bones()
+		}
+	}
+	boneByName := map[string]*Bone{}
+	for _, b := range bones {
+		boneByName[b.Name] = b
+	}
+	weights := make([]map[*Bone]float32, n)
+	for _, b := range bones {
+		for _, bw := range b.Weights {
+			if bw.ObjectID != obj.UID {
+				continue
+			}
+			for _, vw := range bw.Vertexes {
+				v := obj.GetVertexIndexByID(vw.VertexID)
+				if v < 0 || v >= n {
+					continue
+				}
+				if weights[v] == nil {
+					weights[v] = map[*Bone]float32{}
+				}
+				weights[v][b] += vw.Weight
+			}
+		}
+	}
+
+	for _, o := range append(targets, obj) {
+		verts := make([]*Vector3, len(mixes))
+		for i, m := range mixes {
+			verts[i] = m.position(o.Vertexes)
+		}
+		for k, v := range o.Extra {
+			if values, ok := v.([]float32); ok && len(values) == n {
+				mixed := make([]float32, len(mixes))
+				for i, m := range mixes {
+					for j, s := range m.src {
+						mixed[i] += values[s] * m.weights[j]
+					}
+				}
+				o.Extra[k] = mixed
+			}
+		}
+		if len(o.VertexColors) == n {
+			colors := make([]Vector4, len(mixes))
+			for i, m := range mixes {
+				for j, s := range m.src {
+					colors[i] = *colors[i].Add(o.VertexColors[s].Scale(m.weights[j]))
+				}
+			}
+			o.VertexColors = colors
+		}
+		if len(o.VertexWeights) == n {
+			weights := make([]float32, len(mixes))
+			for i, m := range mixes {
+				for j, s := range m.src {
+					weights[i] += o.VertexWeights[s] * m.weights[j]
+				}
+			}
+			o.VertexWeights = weights
+		}
+		o.Vertexes = verts
+		o.VertexByUID = map[int]int{}
+		if o != obj {
+			o.Faces = make([]*Face, len(obj.Faces))
+			for i, f := range obj.Faces {
+				nf := *f
+				nf.Verts = append([]int{}, f.Verts...)
+				nf.UVs = append([]Vector2{}, f.UVs...)
+				nf.Normals = append([]*Vector3{}, f.Normals...)
+				o.Faces[i] = &nf
+			}
+		}
+	}
+
+	if len(bones) == 0 {
+		return
+	}
+	newWeights := map[*Bone]*BoneWeight2{}
+	for i, m := range mixes {
+		mixed := map[*Bone]float32{}
+		for j, s := range m.src {
+			for b, w := range weights[s] {
+				if m.mirror != nil {
+					if mb := boneByName[mirrorBoneName(b.Name)]; mb != nil {
+						b = mb
+					}
+				}
+				mixed[b] += w * m.weights[j]
+			}
+		}
+		for _, b := range bones {
+			if w := mixed[b]; w > 1e-4 {
+				if newWeights[b] == nil {
+					newWeights[b] = &BoneWeight2{ObjectID: obj.UID}
+				}
+				newWeights[b].Vertexes = append(newWeights[b].Vertexes, &VertexWeight{VertexID: i + 1, Weight: w})
+			}
+		}
+	}
+	for _, b := range bones {
+		var ws []*BoneWeight2
+		for _, bw := range b.Weights {
+			if bw.ObjectID != obj.UID {
+				ws = append(ws, bw)
+			}
+		}
+		if nw := newWeights[b]; nw != nil {
+			ws = append(ws, nw)
+		}
+		b.Weights = ws
+		if b.weightMap != nil {
+			delete(b.weightMap, obj.UID)
+			if nw := newWeights[b]; nw != nil {
+				b.weightMap[obj.UID] = nw
+			}
+		}
+	}
+}
+
+var mirrorBoneNamePairs = [][2]string{
+	{"左", "右"}, {"_L", "_R"}, {".L", ".R"}, {"_l", "_r"}, {".l", ".r"}, {"Left", "Right"}, {"left", "right"},
+}
+
+// mirrorBoneName returns the name of the symmetric bone (e.g. 左腕 => 右腕).
+func mirrorBoneName(name string) string {
+	for _, p := range mirrorBoneNamePairs {
+		if strings.Contains(name, p[0]) {
+			return strings.Replace(name, p[0], p[1], 1)
+		} else if strings.Contains(name, p[1]) {
+			return strings.Replace(name, p[1], p[0], 1)
+		}
+	}
+	return name
+}
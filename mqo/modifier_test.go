@@ -0,0 +1,98 @@
+package mqo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestApplyMirror(t *testing.T) {
+	doc := NewDocument()
+	obj := NewObject("obj1")
+	obj.Mirror = MirrorConnect
+	obj.MirrorDis = 0.01
+	obj.Vertexes = []*Vector3{{X: 0, Y: 0, Z: 0}, {X: 1, Y: 0, Z: 0}, {X: 1, Y: 1, Z: 0}}
+	obj.Faces = []*Face{{Verts: []int{0, 1, 2}, UVs: []Vector2{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}}}}
+	doc.Objects = append(doc.Objects, obj)
+
+	bones := GetBonePlugin(doc)
+	left := &Bone{ID: 1, Name: "左腕"}
+	right := &Bone{ID: 2, Name: "右腕"}
+	left.SetVertexWeight(1, 2, 100)
+	bones.SetBones([]*Bone{left, right})
+
+	doc.ApplyMirrorAndPatch()
+
+	if len(obj.Vertexes) != 5 || len(obj.Faces) != 2 {
+		t.Fatal("mirror: ", len(obj.Vertexes), len(obj.Faces))
+	}
+	if obj.Vertexes[3].X != -1 || obj.Mirror != MirrorNone {
+		t.Error("mirrored vertex: ", obj.Vertexes[3])
+	}
+	if f := obj.Faces[1]; f.Verts[0] != 4 || f.Verts[2] != 0 || f.UVs[0].Y != 1 {
+		t.Error("mirrored face: ", f.Verts, f.UVs)
+	}
+	if len(right.Weights) != 1 || right.Weights[0].Vertexes[0].VertexID != 4 {
+		t.Error("mirrored weights: ", right.Weights)
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	doc := NewDocument()
+	obj := NewObject("cube")
+	obj.Patch = PatchCatmullClark
+	obj.PatchSegment = 1
+	for i := 0; i < 8; i++ {
+		obj.Vertexes = append(obj.Vertexes, &Vector3{X: float32(i&1)*2 - 1, Y: float32(i>>1&1)*2 - 1, Z: float32(i>>2&1)*2 - 1})
+	}
+	for _, f := range [][]int{{0, 2, 3, 1}, {4, 5, 7, 6}, {0, 1, 5, 4}, {2, 6, 7, 3}, {0, 4, 6, 2}, {1, 3, 7, 5}} {
+		obj.Faces = append(obj.Faces, &Face{Verts: f})
+	}
+	target := obj.Clone()
+	target.Name = "cube_morph"
+	for _, v := range target.Vertexes {
+		v.Y += 1
+	}
+	doc.Objects = append(doc.Objects, obj, target)
+	GetMorphPlugin(doc).MorphSet.Targets = []*MorphTargetList{{Base: "cube", Target: []*MorphTarget{{Name: "cube_morph"}}}}
+
+	doc.ApplyMirrorAndPatch()
+
+	if len(obj.Vertexes) != 26 || len(obj.Faces) != 24 {
+		t.Fatal("subdivide: ", len(obj.Vertexes), len(obj.Faces))
+	}
+	// corner: (F + 2R + (n-3)P) / n = 5/9
+	if v := obj.Vertexes[0]; math.Abs(float64(v.X)+5.0/9) > 1e-5 || math.Abs(float64(v.Y)+5.0/9) > 1e-5 {
+		t.Error("corner: ", v)
+	}
+	if len(target.Vertexes) != 26 || len(target.Faces) != 24 || math.Abs(float64(target.Vertexes[0].Y-obj.Vertexes[0].Y-1)) > 1e-5 {
+		t.Error("morph target: ", len(target.Vertexes), target.Vertexes[0])
+	}
+}
+
+func TestApplyMirrorVertexUIDs(t *testing.T) {
+	doc := NewDocument()
+	obj := NewObject("obj1")
+	obj.Mirror = MirrorSeparate
+	obj.Vertexes = []*Vector3{{X: 1, Y: 0, Z: 0}, {X: 2, Y: 0, Z: 0}, {X: 2, Y: 1, Z: 0}}
+	obj.VertexByUID = map[int]int{10: 0, 20: 1, 30: 2}
+	obj.Faces = []*Face{{Verts: []int{0, 1, 2}}}
+	doc.Objects = append(doc.Objects, obj)
+
+	bones := GetBonePlugin(doc)
+	left := &Bone{ID: 1, Name: "左腕"}
+	right := &Bone{ID: 2, Name: "右腕"}
+	left.SetVertexWeight(1, 30, 100)
+	bones.SetBones([]*Bone{left, right})
+
+	doc.ApplyMirrorAndPatch()
+
+	if len(obj.Vertexes) != 6 {
+		t.Fatal("mirror: ", len(obj.Vertexes))
+	}
+	if len(left.Weights) != 1 || len(left.Weights[0].Vertexes) != 1 || left.Weights[0].Vertexes[0].VertexID != 3 {
+		t.Error("weights: ", left.Weights)
+	}
+	if len(right.Weights) != 1 || len(right.Weights[0].Vertexes) != 1 || right.Weights[0].Vertexes[0].VertexID != 6 {
+		t.Error("mirrored weights: ", right.Weights)
+	}
+}
@@ -120,6 +120,9 @@ type Material struct {
 
 	Shader int
 	Ex2    *MaterialEx2
+
+	// Internal use
+	Extra map[string]interface{}
 }
 
 const (
@@ -232,6 +235,7 @@ type Face struct {
 	Material int
 	UVs      []Vector2
 	Normals  []*Vector3
+	Creases  []float32 // edge(Verts[i], Verts[i+1]) crease value
 }
 
 func (f *Face) Flip() {
@@ -244,6 +248,13 @@ func (f *Face) Flip() {
 	for i, j := 0, len(f.Normals)-1; i < j; i, j = i+1, j-1 {
 		f.Normals[i], f.Normals[j] = f.Normals[j], f.Normals[i]
 	}
+	if n := len(f.Creases); n > 0 {
+		creases := make([]float32, n)
+		for i := range creases {
+			creases[i] = f.Creases[(n*2-2-i)%n]
+		}
+		f.Creases = creases
+	}
 }
 
 type Object struct {
@@ -260,6 +271,7 @@ type Object struct {
 	Patch        int
 	PatchSegment int
 	Mirror       int
+	MirrorAxis   int
 	MirrorDis    float32
 
 	Scale       *Vector3
@@ -268,7 +280,9 @@ type Object struct {
 
 	Color *Vector3
 
-	VertexByUID map[int]int
+	VertexByUID   map[int]int
+	VertexColors  []Vector4 // optional
+	VertexWeights []float32 // optional
 
 	// Internal use
 	Extra             map[string]interface{}
@@ -314,11 +328,27 @@ func (o *Object) Clone() *Object {
 	}
 	cp.Faces = make([]*Face, len(o.Faces))
 	for i, v := range o.Faces {
-		d := &Face{Material: v.Material, Verts: make([]int, len(v.Verts)), UVs: make([]Vector2, len(v.UVs))}
+		d := &Face{UID: v.UID, Material: v.Material, Verts: make([]int, len(v.Verts)), UVs: make([]Vector2, len(v.UVs))}
 		copy(d.Verts, v.Verts)
 		copy(d.UVs, v.UVs)
+		if v.Normals != nil {
+			d.Normals = append([]*Vector3{}, v.Normals...)
+		}
+		if v.Creases != nil {
+			d.Creases = append([]float32{}, v.Creases...)
+		}
 		cp.Faces[i] = d
 	}
+	if o.VertexColors != nil {
+		cp.VertexColors = append([]Vector4{}, o.VertexColors...)
+	}
+	if o.VertexWeights != nil {
+		cp.VertexWeights = append([]float32{}, o.VertexWeights...)
+	}
+	cp.Extra = make(map[string]interface{}, len(o.Extra))
+	for k, v := range o.Extra {
+		cp.Extra[k] = v
+	}
 	return &cp
 }
 
@@ -332,6 +362,24 @@ func (o *Object) GetVertexIndexByID(uid int) int {
 	return -1
 }
 
+// ColorFromABGR converts a packed vertex color (A<<24|B<<16|G<<8|R) to RGBA.
+func ColorFromABGR(c uint32) Vector4 {
+	return Vector4{
+		X: float32(c&0xff) / 255,
+		Y: float32(c>>8&0xff) / 255,
+		Z: float32(c>>16&0xff) / 255,
+		W: float32(c>>24&0xff) / 255,
+	}
+}
+
+// ColorToABGR converts RGBA to a packed vertex color.
+func ColorToABGR(c *Vector4) uint32 {
+	f := func(v float32, shift uint) uint32 {
+		return uint32(geom.Clamp(v, 0, 1)*255+0.5) << shift
+	}
+	return f(c.X, 0) | f(c.Y, 8) | f(c.Z, 16) | f(c.W, 24)
+}
+
 type Plugin interface {
 	PreSerialize(mqo *Document)
 	PostDeserialize(mqo *Document)
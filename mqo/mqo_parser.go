@@ -149,6 +149,15 @@ func (p *Parser) procArray(init, elem func(n int), name string) {
 	p.skip("}")
 }
 
+// procIndexed reads "index value..." lines in a block.
+func (p *Parser) procIndexed(elem func(i int)) {
+	p.skip("{")
+	for tok := p.s.Scan(); tok != scanner.EOF && p.s.TokenText() != "}"; tok = p.s.Scan() {
+		i, _ := strconv.Atoi(p.s.TokenText())
+		elem(i)
+	}
+}
+
 func (p *Parser) procObj(handlers map[string]func(), name string) {
 	p.skip("{")
 	for tok := p.s.Scan(); tok != scanner.EOF; tok = p.s.Scan() {
@@ -258,6 +267,7 @@ func (p *Parser) readObject() *Object {
 		"patch":       func() { o.Patch = p.readInt() },
 		"segment":     func() { o.PatchSegment = p.readInt() },
 		"mirror":      func() { o.Mirror = p.readInt() },
+		"mirror_axis": func() { o.MirrorAxis = p.readInt() },
 		"mirror_dis":  func() { o.MirrorDis = p.readFloat() },
 		"scale":       func() { o.Scale = &Vector3{X: p.readFloat(), Y: p.readFloat(), Z: p.readFloat()} },
 		"rotation":    func() { o.Rotation = &Vector3{Y: p.readFloat(), X: p.readFloat(), Z: p.readFloat()} },
@@ -304,8 +314,9 @@ func (p *Parser) readObject() *Object {
 						}
 					},
 					"CRS": func() {
+						f.Creases = make([]float32, vn)
 						for i := 0; i < vn; i++ {
-							p.readFloat()
+							f.Creases[i] = p.readFloat()
 						}
 					},
 					"UID": func() { f.UID = p.readInt() },
@@ -321,6 +332,27 @@ func (p *Parser) readObject() *Object {
 					}
 					p.skip("}")
 				},
+				"weit": func() {
+					o.VertexWeights = make([]float32, len(o.Vertexes))
+					p.procIndexed(func(i int) {
+						w := p.readFloat()
+						if i >= 0 && i < len(o.VertexWeights) {
+							o.VertexWeights[i] = w
+						}
+					})
+				},
+				"color": func() {
+					o.VertexColors = make([]Vector4, len(o.Vertexes))
+					for i := range o.VertexColors {
+						o.VertexColors[i] = Vector4{X: 1, Y: 1, Z: 1, W: 1}
+					}
+					p.procIndexed(func(i int) {
+						c := ColorFromABGR(uint32(p.readInt()))
+						if i >= 0 && i < len(o.VertexColors) {
+							o.VertexColors[i] = c
+						}
+					})
+				},
 			}, "vertexattr")
 		},
 	}, fmt.Sprintf("Object %v\n", o.Name))
@@ -0,0 +1,160 @@
+package mqo
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/binzume/modelconv/geom"
+)
+
+func TestWriteMQOVertexAttr(t *testing.T) {
+	doc := NewDocument()
+	doc.Materials = []*Material{{Name: "mat1", Color: Vector4{X: 1, Y: 1, Z: 1, W: 1}}}
+	obj := NewObject("obj1")
+	obj.Vertexes = []*Vector3{{X: 0, Y: 0, Z: 0}, {X: 1, Y: 0, Z: 0}, {X: 1, Y: 1, Z: 0}}
+	obj.VertexByUID = map[int]int{10: 0, 11: 1, 12: 2}
+	obj.VertexColors = []Vector4{{X: 1, Y: 0, Z: 0, W: 1}, {X: 0, Y: 1, Z: 0, W: 1}, {X: 0, Y: 0, Z: 1, W: 0.5}}
+	obj.VertexWeights = []float32{0, 0.5, 1}
+	obj.Faces = []*Face{{UID: 3, Verts: []int{0, 1, 2}, Creases: []float32{1, 0, 2}}}
+	doc.Objects = append(doc.Objects, obj)
+
+	var buf bytes.Buffer
+	if err := NewWriter("").WriteMQO(doc, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := NewParser(&buf, "").Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := result.Objects[0]
+	if o.VertexByUID[12] != 2 {
+		t.Error("uid: ", o.VertexByUID)
+	}
+	if len(o.VertexColors) != 3 || o.VertexColors[1].Y != 1 || o.VertexColors[2].W < 0.49 || o.VertexColors[2].W > 0.51 {
+		t.Error("color: ", o.VertexColors)
+	}
+	if len(o.VertexWeights) != 3 || o.VertexWeights[1] != 0.5 || o.VertexWeights[2] != 1 {
+		t.Error("weit: ", o.VertexWeights)
+	}
+	if f := o.Faces[0]; f.UID != 3 || len(f.Creases) != 3 || f.Creases[2] != 2 {
+		t.Error("face: ", f.UID, f.Creases)
+	}
+}
+
+func TestWriteMQOMaterialEx2Order(t *testing.T) {
+	doc := NewDocument()
+	ex := &MaterialEx2{ShaderType: "hlsl", ShaderName: "pmd",
+		ShaderParams:  map[string]interface{}{"Edge": true, "SharedToon": 3, "EdgeSize": 1.5},
+		ShaderMapping: map[string]string{"Toon": "toon.bmp", "Sphere": "sphere.spa", "Base": "a.png"},
+	}
+	doc.Materials = []*Material{{Name: "mat1", Color: Vector4{X: 1, Y: 1, Z: 1, W: 1}, Ex2: ex}}
+
+	var first []byte
+	for i := 0; i < 10; i++ {
+		var buf bytes.Buffer
+		if err := NewWriter("").WriteMQO(doc, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if first == nil {
+			first = buf.Bytes()
+		} else if !bytes.Equal(first, buf.Bytes()) {
+			t.Fatal("output is not deterministic")
+		}
+	}
+	base, sphere, toon := bytes.Index(first, []byte(`"Base"`)), bytes.Index(first, []byte(`"Sphere"`)), bytes.Index(first, []byte(`"Toon"`))
+	if base < 0 || !(base < sphere && sphere < toon) {
+		t.Error("shadermapping is not sorted: ", string(first))
+	}
+
+	result, err := NewParser(bytes.NewReader(first), "").Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ex := result.Materials[0].Ex2; ex.IntParam("SharedToon") != 3 || ex.Mapping("Sphere") != "sphere.spa" {
+		t.Error("ex2: ", ex.ShaderParams, ex.ShaderMapping)
+	}
+}
+
+func TestKeyframer(t *testing.T) {
+	doc := NewDocument()
+	k := &BoneKeyframe{Frame: 10, MvX: 1}
+	k.SetRotation(geom.NewEuler(0, 0.5, 0, geom.RotationOrderXYZ).ToQuaternion())
+	k.Scale = &Vector3Attr{Vector3{X: 1, Y: 2, Z: 1}}
+	k.Out = &BoneKeyTangent{Mv: Vector3Attr{Vector3{X: 1}}, QW: 0.5}
+	motion := &Motion{Name: "test",
+		Bones:  []*BoneMotion{{Name: "bone1", Keys: []*BoneKeyframe{k, {Frame: 0}}}},
+		Morphs: []*MorphMotion{{Name: "morph1", Keys: []*MorphKeyframe{{Frame: 5, Value: 0.5}}}},
+	}
+	GetKeyframerPlugin(doc).Motions = append(GetKeyframerPlugin(doc).Motions, motion)
+
+	var buf bytes.Buffer
+	if err := WriteMQX(doc, &buf, "test.mqo"); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("Motion")) {
+		t.Error("motions should not be written to .mqx: ", buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteMotions(FindKeyframerPlugin(doc).Motions, &buf); err != nil {
+		t.Fatal(err)
+	}
+	motions, err := ReadMotions(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(motions) != 1 {
+		t.Fatal("motions: ", motions)
+	}
+	m := motions[0]
+	if len(m.Bones[0].Keys) != 2 || m.Bones[0].Keys[1].Frame != 10 || m.Morphs[0].Keys[0].Value != 0.5 {
+		t.Error("motion: ", m.Bones[0].Keys, m.Morphs[0].Keys)
+	}
+	if k := m.Bones[0].Keys[1]; k.GetScale().Y != 2 || k.In != nil || k.Out == nil || k.Out.Mv.X != 1 || k.Out.QW != 0.5 {
+		t.Error("scale and tangent: ", k.Scale, k.In, k.Out)
+	}
+	if k := m.Bones[0].Keys[0]; k.Scale != nil || k.GetScale().Y != 1 {
+		t.Error("default scale: ", k.Scale)
+	}
+
+	// rotate 180 degrees around Y
+	m.ApplyTransform(geom.NewScaleMatrix4(-2, 2, -2))
+	k = m.Bones[0].Keys[1]
+	if k.MvX != -2 || math.Abs(float64(k.RotH-(0.5*180/math.Pi))) > 1e-3 || k.Out.Mv.X != -2 {
+		t.Error("transform: ", k)
+	}
+}
+
+func TestReadMotionsUnsupported(t *testing.T) {
+	_, err := ReadMotions(bytes.NewReader([]byte(`<?xml version="1.0" ?><Keyframer><Motion/></Keyframer>`)))
+	if err == nil {
+		t.Error("unknown format should be an error")
+	}
+}
+
+func TestPoseMotion(t *testing.T) {
+	bp := &BonePlugin{}
+	bp.SetBones([]*Bone{{ID: 1, Name: "root"}, {ID: 2, Name: "arm"}, {ID: 3, Name: "hand"}})
+	bp.PoseSet.BonePoses = []*BonePose{
+		{ID: 1},
+		{ID: 2, RotB: 30, ScB: 1, ScH: 1, ScP: 1},
+		{Name: "hand", MvY: 2, ScP: 2, ScH: 1, ScB: 1},
+	}
+	m := bp.PoseMotion("Pose")
+	if m == nil || len(m.Bones) != 2 {
+		t.Fatal("pose: ", m)
+	}
+	if b := m.Bones[0]; b.Name != "arm" || len(b.Keys) != 1 || b.Keys[0].RotB != 30 || b.Keys[0].Scale != nil {
+		t.Error("arm: ", b.Name, b.Keys[0])
+	}
+	if b := m.Bones[1]; b.Name != "hand" || b.Keys[0].MvY != 2 || b.Keys[0].GetScale().X != 2 {
+		t.Error("hand: ", b.Name, b.Keys[0])
+	}
+
+	bp.PoseSet.BonePoses = []*BonePose{{ID: 1}, {ID: 2}}
+	if m := bp.PoseMotion("Pose"); m != nil {
+		t.Error("rest pose: ", m)
+	}
+}
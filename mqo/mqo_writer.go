@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -85,6 +86,9 @@ func (writer *Writer) WriteMQO(mqo *Document, ww io.Writer) error {
 		fmt.Fprintf(w, " col(%.3f %.3f %.3f %.3f) dif(%.3f) amb(%.3f) emi(%.3f) spc(%.3f) power(%.2f)",
 			mat.Color.X, mat.Color.Y, mat.Color.Z, mat.Color.W,
 			mat.Diffuse, mat.Ambient, mat.Emission, mat.Specular, mat.Power)
+		if mat.EmissionColor != nil {
+			fmt.Fprintf(w, " emi_col(%.3f %.3f %.3f)", mat.EmissionColor.X, mat.EmissionColor.Y, mat.EmissionColor.Z)
+		}
 		if mat.Texture != "" {
 			fmt.Fprintf(w, " tex(\"%v\")", strings.Replace(mat.Texture, "\\", "/", -1))
 		}
@@ -113,7 +117,8 @@ func (writer *Writer) WriteMQO(mqo *Document, ww io.Writer) error {
 			fmt.Fprintf(w, "\t\tshadertype \"%v\"\n", mat.Ex2.ShaderType)
 			fmt.Fprintf(w, "\t\tshadername \"%v\"\n", mat.Ex2.ShaderName)
 			fmt.Fprintf(w, "\t\tshaderparam %v {\n", len(mat.Ex2.ShaderParams))
-			for name, v := range mat.Ex2.ShaderParams {
+			for _, name := range sortedKeys(mat.Ex2.ShaderParams) {
+				v := mat.Ex2.ShaderParams[name]
 				typ := "int"
 				if b, ok := v.(bool); ok {
 					typ = "bool"
@@ -122,10 +127,28 @@ func (writer *Writer) WriteMQO(mqo *Document, ww io.Writer) error {
 					typ = "float"
 				} else if _, ok := v.(float32); ok {
 					typ = "float"
+				} else if c, ok := v.([]float32); ok && len(c) == 4 {
+					typ = "color"
+					v = fmt.Sprintf("%v %v %v %v", c[0], c[1], c[2], c[3])
+				} else if str, ok := v.(string); ok {
+					typ = "string"
+					v = fmt.Sprintf("\"%v\"", str)
 				}
 				fmt.Fprintf(w, "\t\t\t%v %v %v\n", name, typ, v)
 			}
 			w.WriteString("\t\t}\n")
+			if len(mat.Ex2.ShaderMapping) > 0 {
+				fmt.Fprintf(w, "\t\tshadermapping %v {\n", len(mat.Ex2.ShaderMapping))
+				names := make([]string, 0, len(mat.Ex2.ShaderMapping))
+				for name := range mat.Ex2.ShaderMapping {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					fmt.Fprintf(w, "\t\t\t\"%v\" \"%v\"\n", name, strings.Replace(mat.Ex2.ShaderMapping[name], "\\", "/", -1))
+				}
+				w.WriteString("\t\t}\n")
+			}
 			w.WriteString("\t}\n")
 		}
 		w.WriteString("}\n")
@@ -156,6 +179,9 @@ func (writer *Writer) WriteMQO(mqo *Document, ww io.Writer) error {
 		fmt.Fprintf(w, "\tfacet %v\n", obj.Facet)
 		if obj.Mirror != 0 || obj.MirrorDis != 0 {
 			fmt.Fprintf(w, "\tmirror %d\n", obj.Mirror)
+			if obj.MirrorAxis != 0 {
+				fmt.Fprintf(w, "\tmirror_axis %d\n", obj.MirrorAxis)
+			}
 			fmt.Fprintf(w, "\tmirror_dis %f\n", obj.MirrorDis)
 		}
 		if obj.Patch > 0 {
@@ -172,20 +198,38 @@ func (writer *Writer) WriteMQO(mqo *Document, ww io.Writer) error {
 		}
 		w.WriteString("\t}\n")
 
-		if len(obj.VertexByUID) > 0 {
+		if len(obj.VertexByUID) > 0 || obj.VertexWeights != nil || obj.VertexColors != nil {
 			w.WriteString("\tvertexattr {\n")
-			w.WriteString("\t\tuid {\n")
-			uids := make([]int, len(obj.Vertexes))
-			for uid, v := range obj.VertexByUID {
-				uids[v] = uid
+			if len(obj.VertexByUID) > 0 {
+				w.WriteString("\t\tuid {\n")
+				uids := make([]int, len(obj.Vertexes))
+				for uid, v := range obj.VertexByUID {
+					uids[v] = uid
+				}
+				for i, uid := range uids {
+					if uid == 0 {
+						uid = i + 1
+					}
+					fmt.Fprintf(w, "\t\t\t%d\n", uid)
+				}
+				w.WriteString("\t\t}\n")
 			}
-			for i, uid := range uids {
-				if uid == 0 {
-					uid = i + 1
+			if obj.VertexWeights != nil {
+				w.WriteString("\t\tweit {\n")
+				for i, wt := range obj.VertexWeights {
+					if wt != 0 {
+						fmt.Fprintf(w, "\t\t\t%d %v\n", i, wt)
+					}
 				}
-				fmt.Fprintf(w, "\t\t\t%d\n", uid)
+				w.WriteString("\t\t}\n")
+			}
+			if obj.VertexColors != nil {
+				w.WriteString("\t\tcolor {\n")
+				for i, c := range obj.VertexColors {
+					fmt.Fprintf(w, "\t\t\t%d %d\n", i, ColorToABGR(&c))
+				}
+				w.WriteString("\t\t}\n")
 			}
-			w.WriteString("\t\t}\n")
 			w.WriteString("\t}\n")
 		}
 
@@ -224,6 +268,16 @@ func (writer *Writer) WriteMQO(mqo *Document, ww io.Writer) error {
 				}
 				w.WriteString(")")
 			}
+			if len(f.Creases) == len(f.Verts) {
+				w.WriteString(" CRS(")
+				for i, c := range f.Creases {
+					if i != 0 {
+						fmt.Fprint(w, " ")
+					}
+					fmt.Fprint(w, c)
+				}
+				w.WriteString(")")
+			}
 			w.WriteString("\n")
 		}
 		w.WriteString("\t}\n")
@@ -278,3 +332,12 @@ func Save(doc *Document, path string) error {
 	doc.FixNames()
 	return NewWriter(path).WriteMQO(doc, w)
 }
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -3,6 +3,7 @@ package mqo
 import (
 	"encoding/xml"
 	"io"
+	"log"
 )
 
 type MQXDoc struct {
@@ -13,9 +14,16 @@ type MQXDoc struct {
 }
 
 func WriteMQX(mqo *Document, w io.Writer, mqoName string) error {
-	mqx := &MQXDoc{IncludedBy: mqoName, Plugins: mqo.GetPlugins()}
-	for _, p := range mqx.Plugins {
+	mqx := &MQXDoc{IncludedBy: mqoName}
+	for _, p := range mqo.GetPlugins() {
+		if kp, ok := p.(*KeyframerPlugin); ok {
+			if len(kp.Motions) > 0 {
+				log.Println("Motions are not saved in .mqx. Save them as " + MotionFileExt + ".")
+			}
+			continue
+		}
 		p.PreSerialize(mqo)
+		mqx.Plugins = append(mqx.Plugins, p)
 	}
 
 	xmlBuf, _ := xml.MarshalIndent(mqx, "", "    ")
@@ -26,7 +26,7 @@ func (s *Scene) GetElement2(ref *Ref, prefabInstance *Ref) Element {
 	}
 	if ref.GUID != "" && ref.GUID != s.GUID && prefabInstance.IsValid() {
 		if prefab, ok := s.Elements[prefabInstance.FileID].(*PrefabInstance); ok {
-			return prefab.PrefabScene.GetElement(ref)
+			return prefab.PrefabScene.findElement(ref)
 		}
 		return nil
 	}
@@ -41,10 +41,8 @@ func (s *Scene) GetGameObject(ref *Ref) *GameObject {
 func (s *Scene) GetTransform(ref *Ref, prefabInstance *Ref) *Transform {
 	if t, ok := s.GetElement2(ref, prefabInstance).(*Transform); ok {
 		// stripped.
-		if !t.GameObject.IsValid() && t.CorrespondingSourceObject.IsValid() {
-			if t2, ok := t.Scene.GetElement2(t.CorrespondingSourceObject, t.PrefabInstance).(*Transform); ok {
-				return t2
-			}
+		if t2, ok := t.Scene.resolveStripped(t).(*Transform); ok {
+			return t2
 		}
 		return t
 	}
@@ -53,8 +51,8 @@ func (s *Scene) GetTransform(ref *Ref, prefabInstance *Ref) *Transform {
 
 type Ref struct {
 	FileID int64  `yaml:"fileID"`
-	GUID   string `yaml:"guid"`
-	Type   int    `yaml:"type"`
+	GUID   string `yaml:"guid,omitempty"`
+	Type   int    `yaml:"type,omitempty"`
 }
 
 type Element interface{}
@@ -68,24 +66,41 @@ type GameObject struct {
 	IsActive  int    `yaml:"m_IsActive"`
 	TagString string `yaml:"m_TagString"`
 
-	Components []*struct {
-		Ref Ref `yaml:"component"`
-	} `yaml:"m_Component"`
+	Components []*ComponentRef `yaml:"m_Component"`
 
-	CorrespondingSourceObject *Ref `yaml:"m_CorrespondingSourceObject"`
-	PrefabInstance            *Ref `yaml:"m_PrefabInstance"`
+	CorrespondingSourceObject *Ref `yaml:"m_CorrespondingSourceObject,omitempty"`
+	PrefabInstance            *Ref `yaml:"m_PrefabInstance,omitempty"`
 
 	Scene *Scene `yaml:"-"`
+
+	// Components added by PrefabInstance
+	addedComponents []Component
+}
+
+type ComponentRef struct {
+	Ref Ref `yaml:"component"`
 }
 
 func (o *GameObject) init(scene *Scene) {
 	o.Scene = scene
 }
 
+func (o *GameObject) allComponents() []Element {
+	var components []Element
+	for _, c := range o.Components {
+		if component := o.Scene.GetElement2(&c.Ref, o.PrefabInstance); component != nil {
+			components = append(components, component)
+		}
+	}
+	for _, c := range o.addedComponents {
+		components = append(components, c)
+	}
+	return components
+}
+
 func (o *GameObject) GetComponent(target interface{}) bool {
 	typ := reflect.TypeOf(target).Elem()
-	for _, c := range o.Components {
-		component := o.Scene.GetElement2(&c.Ref, o.PrefabInstance)
+	for _, component := range o.allComponents() {
 		if reflect.TypeOf(component) == typ {
 			reflect.ValueOf(target).Elem().Set(reflect.ValueOf(component))
 			return true
@@ -97,8 +112,7 @@ func (o *GameObject) GetComponent(target interface{}) bool {
 func (o *GameObject) GetComponents(target interface{}) {
 	typ := reflect.TypeOf(target).Elem().Elem()
 	value := reflect.ValueOf(target).Elem()
-	for _, c := range o.Components {
-		component := o.Scene.GetElement2(&c.Ref, o.PrefabInstance)
+	for _, component := range o.allComponents() {
 		if reflect.TypeOf(component) == typ {
 			value.Set(reflect.Append(value, reflect.ValueOf(component)))
 		}
@@ -106,26 +120,27 @@ func (o *GameObject) GetComponents(target interface{}) {
 }
 
 func (o *GameObject) GetTransform() *Transform {
-	for _, c := range o.Components {
-		if t, ok := o.Scene.GetElement2(&c.Ref, o.PrefabInstance).(*Transform); ok {
+	for _, component := range o.allComponents() {
+		if t, ok := component.(*Transform); ok {
 			return t
 		}
 	}
 	return nil
 }
 
-type PrefabInstance struct {
-	Modification struct {
-		Modifications []struct {
-			Target          *Ref        `yaml:"target"`
-			PropertyPath    string      `yaml:"propertyPath"`
-			Value           interface{} `yaml:"value"`
-			ObjectReference *Ref        `yaml:"objectReference"`
-		} `yaml:"m_Modifications"`
-		TransformParent   *Ref          `yaml:"m_TransformParent"`
-		RemovedComponents []interface{} `yaml:"m_RemovedComponents"`
-	} `yaml:"m_Modification"`
-
-	SourcePrefab *Ref   `yaml:"m_SourcePrefab"`
-	PrefabScene  *Scene `yaml:"-"`
+func (o *GameObject) removeComponent(component Component) {
+	components := o.Components[:0]
+	for _, c := range o.Components {
+		if o.Scene.GetElement2(&c.Ref, o.PrefabInstance) != component {
+			components = append(components, c)
+		}
+	}
+	o.Components = components
+	added := o.addedComponents[:0]
+	for _, c := range o.addedComponents {
+		if c != component {
+			added = append(added, c)
+		}
+	}
+	o.addedComponents = added
 }
@@ -0,0 +1,284 @@
+package unity
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Animator struct {
+	BaseComponent `yaml:",inline"`
+	Enabled       int `yaml:"m_Enabled"`
+
+	Avatar     *Ref `yaml:"m_Avatar"`
+	Controller *Ref `yaml:"m_Controller"`
+}
+
+// Animation is a legacy animation component.
+type Animation struct {
+	BaseComponent `yaml:",inline"`
+	Enabled       int `yaml:"m_Enabled"`
+
+	Animation         *Ref   `yaml:"m_Animation"`
+	Animations        []*Ref `yaml:"m_Animations"`
+	PlayAutomatically int    `yaml:"m_PlayAutomatically"`
+}
+
+type AnimationClip struct {
+	Name   string `yaml:"m_Name"`
+	Legacy int    `yaml:"m_Legacy"`
+
+	RotationCurves []*CurveBinding `yaml:"m_RotationCurves"`
+	EulerCurves    []*CurveBinding `yaml:"m_EulerCurves"`
+	PositionCurves []*CurveBinding `yaml:"m_PositionCurves"`
+	ScaleCurves    []*CurveBinding `yaml:"m_ScaleCurves"`
+	FloatCurves    []*CurveBinding `yaml:"m_FloatCurves"`
+
+	SampleRate float32 `yaml:"m_SampleRate"`
+	WrapMode   int     `yaml:"m_WrapMode"`
+	Settings   struct {
+		StartTime float32 `yaml:"m_StartTime"`
+		StopTime  float32 `yaml:"m_StopTime"`
+		LoopTime  int     `yaml:"m_LoopTime"`
+	} `yaml:"m_AnimationClipSettings"`
+}
+
+// CurveBinding is an animation curve bound to the property of the object at the path.
+type CurveBinding struct {
+	Curve     AnimationCurve `yaml:"curve"`
+	Attribute string         `yaml:"attribute"`
+	Path      string         `yaml:"path"`
+	ClassID   int            `yaml:"classID"`
+	Script    *Ref           `yaml:"script"`
+}
+
+type AnimationCurve struct {
+	Keys          []*Keyframe `yaml:"m_Curve"`
+	PreInfinity   int         `yaml:"m_PreInfinity"`
+	PostInfinity  int         `yaml:"m_PostInfinity"`
+	RotationOrder int         `yaml:"m_RotationOrder"`
+}
+
+// Keyframe of the Hermite curve. Weighted tangents are not supported.
+type Keyframe struct {
+	Time         float32    `yaml:"time"`
+	Value        CurveValue `yaml:"value"`
+	InSlope      CurveValue `yaml:"inSlope"`
+	OutSlope     CurveValue `yaml:"outSlope"`
+	TangentMode  int        `yaml:"tangentMode"`
+	WeightedMode int        `yaml:"weightedMode"`
+}
+
+// CurveValue is a float, Vector3 or Quaternion. Slopes of the constant curves are Infinity.
+type CurveValue [4]float32
+
+func (v *CurveValue) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	toFloat := func(v interface{}) (float32, error) {
+		f, err := strconv.ParseFloat(strings.TrimSpace(fmt.Sprint(v)), 32)
+		return float32(f), err
+	}
+	var scalar interface{}
+	if err := unmarshal(&scalar); err != nil {
+		return err
+	}
+	var err error
+	if _, ok := scalar.(map[interface{}]interface{}); !ok {
+		v[0], err = toFloat(scalar)
+		return err
+	}
+	// Note: "y" is a bool in YAML 1.1. Use struct to decode keys as strings.
+	var vec struct{ X, Y, Z, W interface{} }
+	if err := unmarshal(&vec); err != nil {
+		return err
+	}
+	for i, e := range []interface{}{vec.X, vec.Y, vec.Z, vec.W} {
+		if e != nil {
+			if v[i], err = toFloat(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Evaluate returns the value and the derivative of the curve at the time.
+func (c *AnimationCurve) Evaluate(t float32) (value, slope CurveValue) {
+	keys := c.Keys
+	if len(keys) == 0 {
+		return
+	}
+	i := sort.Search(len(keys), func(i int) bool { return keys[i].Time > t })
+	if i == 0 {
+		return keys[0].Value, CurveValue{}
+	} else if i == len(keys) {
+		return keys[i-1].Value, CurveValue{}
+	}
+	k0, k1 := keys[i-1], keys[i]
+	dt := k1.Time - k0.Time
+	s := (t - k0.Time) / dt
+	for j := range value {
+		m0, m1 := k0.OutSlope[j], k1.InSlope[j]
+		if math.IsInf(float64(m0), 0) || math.IsInf(float64(m1), 0) {
+			value[j] = k0.Value[j] // constant
+			continue
+		}
+		p0, p1 := k0.Value[j], k1.Value[j]
+		m0, m1 = m0*dt, m1*dt
+		s2, s3 := s*s, s*s*s
+		value[j] = (2*s3-3*s2+1)*p0 + (s3-2*s2+s)*m0 + (-2*s3+3*s2)*p1 + (s3-s2)*m1
+		slope[j] = ((6*s2-6*s)*p0 + (3*s2-4*s+1)*m0 + (-6*s2+6*s)*p1 + (3*s2-2*s)*m1) / dt
+	}
+	return
+}
+
+// Slopes returns the in and out slopes at the time. Infinite slopes are replaced with 0.
+func (c *AnimationCurve) Slopes(t float32) (in, out CurveValue) {
+	for _, k := range c.Keys {
+		if k.Time == t {
+			for j := range in {
+				if !math.IsInf(float64(k.InSlope[j]), 0) {
+					in[j] = k.InSlope[j]
+				}
+				if !math.IsInf(float64(k.OutSlope[j]), 0) {
+					out[j] = k.OutSlope[j]
+				}
+			}
+			return
+		}
+	}
+	_, in = c.Evaluate(t)
+	return in, in
+}
+
+// GetBindings returns all curve bindings of the clip.
+func (c *AnimationClip) GetBindings() []*CurveBinding {
+	var bindings []*CurveBinding
+	for _, curves := range [][]*CurveBinding{c.PositionCurves, c.RotationCurves, c.EulerCurves, c.ScaleCurves, c.FloatCurves} {
+		bindings = append(bindings, curves...)
+	}
+	return bindings
+}
+
+func (c *AnimationClip) GetSampleRate() float32 {
+	if c.SampleRate <= 0 {
+		return 60
+	}
+	return c.SampleRate
+}
+
+func loadYAMLAsset(assets Assets, guid string) ([]*YAMLDoc, error) {
+	asset := assets.GetAsset(guid)
+	if asset == nil {
+		return nil, fmt.Errorf("Asset not found: %s", guid)
+	}
+	if !strings.HasSuffix(asset.Path, ".anim") && !strings.HasSuffix(asset.Path, ".controller") && !strings.HasSuffix(asset.Path, ".overrideController") {
+		return nil, fmt.Errorf("not supported: %s", asset.Path)
+	}
+	r, err := assets.Open(asset.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ParseYamlDocuments(b), nil
+}
+
+func LoadAnimationClip(assets Assets, ref *Ref) (*AnimationClip, error) {
+	docs, err := loadYAMLAsset(assets, ref.GUID)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		if doc.Tag != "tag:unity3d.com,2011:74" || doc.refID != strconv.FormatInt(ref.FileID, 10) {
+			continue
+		}
+		var clip struct {
+			AnimationClip AnimationClip `yaml:"AnimationClip"`
+		}
+		err = doc.Decode(&clip)
+		if err != nil {
+			return nil, err
+		}
+		return &clip.AnimationClip, nil
+	}
+	return nil, fmt.Errorf("AnimationClip not found: %v", ref)
+}
+
+// GetAnimatorClips returns the animation clips used in the AnimatorController or AnimatorOverrideController.
+func GetAnimatorClips(assets Assets, controller *Ref) ([]*Ref, error) {
+	docs, err := loadYAMLAsset(assets, controller.GUID)
+	if err != nil {
+		return nil, err
+	}
+	var clips []*Ref
+	seen := map[Ref]bool{}
+	add := func(ref *Ref) {
+		if ref.IsValid() && ref.GUID != "" && ref.GUID != controller.GUID && !seen[Ref{FileID: ref.FileID, GUID: ref.GUID}] {
+			seen[Ref{FileID: ref.FileID, GUID: ref.GUID}] = true
+			clips = append(clips, ref)
+		}
+	}
+	for _, doc := range docs {
+		switch doc.Tag {
+		case "tag:unity3d.com,2011:1102":
+			var state struct {
+				AnimatorState struct {
+					Motion *Ref `yaml:"m_Motion"`
+				} `yaml:"AnimatorState"`
+			}
+			if err := doc.Decode(&state); err == nil {
+				add(state.AnimatorState.Motion)
+			}
+		case "tag:unity3d.com,2011:206":
+			var tree struct {
+				BlendTree struct {
+					Childs []struct {
+						Motion *Ref `yaml:"m_Motion"`
+					} `yaml:"m_Childs"`
+				} `yaml:"BlendTree"`
+			}
+			if err := doc.Decode(&tree); err == nil {
+				for _, c := range tree.BlendTree.Childs {
+					add(c.Motion)
+				}
+			}
+		case "tag:unity3d.com,2011:221":
+			var override struct {
+				AnimatorOverrideController struct {
+					Controller *Ref `yaml:"m_Controller"`
+					Clips      []struct {
+						OriginalClip *Ref `yaml:"m_OriginalClip"`
+						OverrideClip *Ref `yaml:"m_OverrideClip"`
+					} `yaml:"m_Clips"`
+				} `yaml:"AnimatorOverrideController"`
+			}
+			if err := doc.Decode(&override); err != nil || !override.AnimatorOverrideController.Controller.IsValid() {
+				continue
+			}
+			overrides := map[Ref]*Ref{}
+			for _, c := range override.AnimatorOverrideController.Clips {
+				if c.OriginalClip.IsValid() && c.OverrideClip.IsValid() {
+					overrides[Ref{FileID: c.OriginalClip.FileID, GUID: c.OriginalClip.GUID}] = c.OverrideClip
+				}
+			}
+			base, err := GetAnimatorClips(assets, override.AnimatorOverrideController.Controller)
+			if err != nil {
+				return nil, err
+			}
+			for _, clip := range base {
+				if o, ok := overrides[Ref{FileID: clip.FileID, GUID: clip.GUID}]; ok {
+					clip = o
+				}
+				add(clip)
+			}
+		}
+	}
+	return clips, nil
+}
@@ -0,0 +1,89 @@
+package unity
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDecodeAnimationClip(t *testing.T) {
+	yaml := `%YAML 1.1
+%TAG !u! tag:unity3d.com,2011:
+--- !u!74 &7400000
+AnimationClip:
+  m_Name: Open
+  m_PositionCurves:
+  - curve:
+      serializedVersion: 2
+      m_Curve:
+      - serializedVersion: 3
+        time: 0
+        value: {x: 0, y: 0, z: 0}
+        inSlope: {x: 0, y: 0, z: 0}
+        outSlope: {x: 0, y: 0, z: 0}
+        tangentMode: 0
+      - serializedVersion: 3
+        time: 1
+        value: {x: 2, y: 1, z: 0}
+        inSlope: {x: 0, y: 0, z: 0}
+        outSlope: {x: 0, y: 0, z: 0}
+        tangentMode: 0
+      m_PreInfinity: 2
+      m_PostInfinity: 2
+      m_RotationOrder: 4
+    path: Door
+  m_FloatCurves:
+  - curve:
+      serializedVersion: 2
+      m_Curve:
+      - serializedVersion: 3
+        time: 0
+        value: 1
+        inSlope: Infinity
+        outSlope: Infinity
+        tangentMode: 103
+      - serializedVersion: 3
+        time: 0.5
+        value: 0
+        inSlope: Infinity
+        outSlope: Infinity
+        tangentMode: 103
+    attribute: m_IsActive
+    path: Door/Light
+    classID: 1
+    script: {fileID: 0}
+  m_SampleRate: 30
+`
+	docs := ParseYamlDocuments([]byte(yaml))
+	if len(docs) != 1 {
+		t.Fatal("invalid yaml", len(docs))
+	}
+	var d struct {
+		AnimationClip *AnimationClip `yaml:"AnimationClip"`
+	}
+	if err := docs[0].Decode(&d); err != nil {
+		t.Fatal(err)
+	}
+	clip := d.AnimationClip
+	if clip.Name != "Open" || clip.GetSampleRate() != 30 || len(clip.GetBindings()) != 2 {
+		t.Fatal("invalid clip", clip)
+	}
+
+	pos := &clip.PositionCurves[0].Curve
+	if v, slope := pos.Evaluate(0.5); v[0] != 1 || slope[0] != 3 {
+		t.Error("invalid position", v, slope)
+	}
+	if v, _ := pos.Evaluate(2); v[0] != 2 || v[1] != 1 {
+		t.Error("invalid position", v)
+	}
+
+	active := &clip.FloatCurves[0].Curve
+	if !math.IsInf(float64(active.Keys[0].OutSlope[0]), 1) {
+		t.Error("invalid slope", active.Keys[0].OutSlope)
+	}
+	if v, _ := active.Evaluate(0.4); v[0] != 1 {
+		t.Error("invalid constant curve", v)
+	}
+	if in, out := active.Slopes(0.5); in[0] != 0 || out[0] != 0 {
+		t.Error("invalid slopes", in, out)
+	}
+}
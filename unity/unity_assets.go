@@ -1,9 +1,6 @@
 package unity
 
 import (
-	"archive/tar"
-	"compress/gzip"
-	"io"
 	"io/fs"
 	"io/ioutil"
 	"log"
@@ -31,11 +28,14 @@ type Asset struct {
 type MetaFile struct {
 	FileFormatVersion    int                    `yaml:"fileFormatVersion"`
 	GUID                 string                 `yaml:"guid"`
-	NativeFormatImporter map[string]interface{} `yaml:"NativeFormatImporter"`
-	TextureImporter      map[string]interface{} `yaml:"TextureImporter"`
+	NativeFormatImporter map[string]interface{} `yaml:"NativeFormatImporter,omitempty"`
+	TextureImporter      map[string]interface{} `yaml:"TextureImporter,omitempty"`
 	ModelImporter        *struct {
 		FileIDToRecycleName map[int64]string `yaml:"fileIDToRecycleName"`
-	} `yaml:"ModelImporter"`
+		Meshes              struct {
+			GenerateSecondaryUV int `yaml:"generateSecondaryUV"`
+		} `yaml:"meshes"`
+	} `yaml:"ModelImporter,omitempty"`
 	RawData map[string]interface{} `yaml:",inline"`
 }
 
@@ -65,15 +65,7 @@ func OpenPackage(packagePath string) (Assets, error) {
 	if stat.IsDir() {
 		return scanPackage(packagePath, false, packagePath)
 	}
-	tmpDir, err := ioutil.TempDir("", "modelconv_assets_")
-	if err != nil {
-		return nil, err
-	}
-	err = extractPackage(packagePath, tmpDir)
-	if err != nil {
-		return nil, err
-	}
-	return scanPackage(tmpDir, true, packagePath)
+	return scanPackageStream(packagePath, packageMemoryThreshold)
 }
 
 type assets struct {
@@ -181,57 +173,6 @@ func scanPackage(packageDir string, tmp bool, originalPath string) (*packageFs,
 	return pkg, nil
 }
 
-func extractPackage(pacakage, dst string) error {
-	r, err := os.Open(pacakage)
-	if err != nil {
-		return err
-	}
-	defer r.Close()
-	// TODO: always tar.gz?
-	gzr, err := gzip.NewReader(r)
-	if err != nil {
-		return err
-	}
-	defer gzr.Close()
-	tr := tar.NewReader(gzr)
-
-	for {
-		header, err := tr.Next()
-		switch {
-
-		case err == io.EOF:
-			return nil
-
-		case err != nil:
-			return err
-
-		case header == nil:
-			continue
-		}
-
-		name := filepath.Join(dst, header.Name)
-
-		switch header.Typeflag {
-		case tar.TypeDir:
-			if _, err := os.Stat(name); err != nil {
-				if err := os.MkdirAll(name, 0755); err != nil {
-					return err
-				}
-			}
-		case tar.TypeReg:
-			f, err := os.Create(name)
-			if err != nil {
-				return err
-			}
-			if _, err := io.Copy(f, tr); err != nil {
-				f.Close()
-				return err
-			}
-			f.Close()
-		}
-	}
-}
-
 type assetsFs struct {
 	assets
 	ProjectDir   string
@@ -1,33 +1,47 @@
 package unity
 
 import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
 const PackagePath = "../testdata/unity/unity2020.unitypackage"
 const ProjectPath = "../testdata/unity/TestProject"
-const ExtractedPackagePath = "../testdata/unity/extracted.generated"
 const SceneAssetPath = "Assets/Scenes/SampleScene.unity"
 
-func TestExtractPackage(t *testing.T) {
+// extractTestPackage extracts the package to the temp dir to test the extracted package dir.
+func extractTestPackage(t *testing.T) string {
+	t.Helper()
 	if _, err := os.Stat(PackagePath); err != nil {
 		t.Skip()
 	}
-
-	_ = os.RemoveAll(ExtractedPackagePath)
-	err := extractPackage(PackagePath, ExtractedPackagePath)
+	dir := t.TempDir()
+	err := walkPackage(PackagePath, func(name string, header *tar.Header, r io.Reader, offset int64) (bool, error) {
+		dst := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return false, err
+		}
+		w, err := os.Create(dst)
+		if err != nil {
+			return false, err
+		}
+		defer w.Close()
+		_, err = io.Copy(w, r)
+		return true, err
+	})
 	if err != nil {
-		t.Error("Cannot extract package.", err)
+		t.Fatal("Cannot extract package.", err)
 	}
+	return dir
 }
 
 func TestOpenPackage(t *testing.T) {
-	if _, err := os.Stat(ExtractedPackagePath); err != nil {
-		t.Skip()
-	}
-
-	assets, err := OpenPackage(ExtractedPackagePath)
+	assets, err := OpenPackage(extractTestPackage(t))
 	if err != nil {
 		t.Fatal("Cannot open package.", err)
 	}
@@ -39,7 +53,7 @@ func TestOpenPackage(t *testing.T) {
 }
 
 func TestOpenProject(t *testing.T) {
-	if _, err := os.Stat(ExtractedPackagePath); err != nil {
+	if _, err := os.Stat(ProjectPath); err != nil {
 		t.Skip()
 	}
 
@@ -55,11 +69,7 @@ func TestOpenProject(t *testing.T) {
 }
 
 func TestLoadScene(t *testing.T) {
-	if _, err := os.Stat(ExtractedPackagePath); err != nil {
-		t.Skip()
-	}
-
-	assets, err := OpenPackage(ExtractedPackagePath)
+	assets, err := OpenPackage(extractTestPackage(t))
 	if err != nil {
 		t.Fatal("Cannot open package.", err)
 	}
@@ -79,3 +89,75 @@ func TestLoadScene(t *testing.T) {
 	}
 	t.Log(transform.GetGameObject() == scene.Objects[0])
 }
+
+func TestOpenPackageStream(t *testing.T) {
+	if _, err := os.Stat(PackagePath); err != nil {
+		t.Skip()
+	}
+
+	assets, err := OpenPackage(PackagePath)
+	if err != nil {
+		t.Fatal("Cannot open package.", err)
+	}
+	defer assets.Close()
+
+	if len(assets.GetAllAssets()) == 0 {
+		t.Fatal("No assets")
+	}
+	if _, err := LoadScene(assets, SceneAssetPath); err != nil {
+		t.Fatal("Cannot open scene.", err)
+	}
+
+	// Large files are extracted to the temp dir only when they are opened.
+	pkg, err := scanPackageStream(PackagePath, 0)
+	if err != nil {
+		t.Fatal("Cannot open package.", err)
+	}
+	if pkg.tempDir != "" {
+		t.Fatal("Files are extracted while the package is indexed.")
+	}
+	r, err := pkg.Open(SceneAssetPath)
+	if err != nil {
+		t.Fatal("Cannot open scene.", err)
+	}
+	if stat, err := r.Stat(); err != nil || stat.Size() == 0 {
+		t.Error("Cannot extract scene.", err)
+	}
+	r.Close()
+	if files, err := os.ReadDir(pkg.tempDir); err != nil || len(files) != 1 {
+		t.Error("Unexpected extracted files.", len(files), err)
+	}
+
+	// Entries before the last opened entry are read from the beginning of the package.
+	mem, err := scanPackageStream(PackagePath, 1<<40)
+	if err != nil {
+		t.Fatal("Cannot open package.", err)
+	}
+	defer mem.Close()
+	all := pkg.GetAllAssets()
+	for i := len(all) - 1; i >= 0; i-- {
+		if all[i].Path == SceneAssetPath {
+			continue
+		}
+		expected, err := fs.ReadFile(mem, all[i].Path)
+		if os.IsNotExist(err) {
+			continue // folder
+		} else if err != nil {
+			t.Fatal("Cannot read asset.", err)
+		}
+		actual, err := fs.ReadFile(pkg, all[i].Path)
+		if err != nil {
+			t.Fatal("Cannot extract asset.", all[i].Path, err)
+		}
+		if !bytes.Equal(expected, actual) {
+			t.Error("Extracted content is different.", all[i].Path)
+		}
+	}
+
+	if err := pkg.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(pkg.tempDir); !os.IsNotExist(err) {
+		t.Error("Temp dir is not removed.", err)
+	}
+}
@@ -2,6 +2,7 @@ package unity
 
 import (
 	"math"
+	"strings"
 
 	"github.com/binzume/modelconv/geom"
 )
@@ -19,9 +20,28 @@ var UnityShaders = map[Ref]string{
 	{FileID: 45, GUID: "0000000000000000f000000000000000"}:      "StandardSpecularSetup",
 	{FileID: 46, GUID: "0000000000000000f000000000000000"}:      "Standard",
 	{FileID: 47, GUID: "0000000000000000f000000000000000"}:      "AutodeskInteractive ",
+	{FileID: 10750, GUID: "0000000000000000f000000000000000"}:   "Unlit/Transparent",
+	{FileID: 10751, GUID: "0000000000000000f000000000000000"}:   "Unlit/Transparent Cutout",
+	{FileID: 10752, GUID: "0000000000000000f000000000000000"}:   "Unlit/Texture",
+	{FileID: 10755, GUID: "0000000000000000f000000000000000"}:   "Unlit/Color",
 	{FileID: 4800000, GUID: "933532a4fcc9baf4fa0491de14d08ed7"}: "URP/Lit ",
 	{FileID: 4800000, GUID: "650dd9526735d5b46b79224bc6e94025"}: "URP/Unlit ",
 	{FileID: 4800000, GUID: "8d2bb70cbf9db8d4da26e15b26e74248"}: "URP/SimpleLit ",
+	{FileID: 4800000, GUID: "6e4ae4064600d784cac1e41a9e6f2e59"}: "HDRP/Lit",
+}
+
+// GetShaderRef returns the reference to the well-known shader. e.g. "Standard", "URP/Lit"
+func GetShaderRef(name string) *Ref {
+	for ref, n := range UnityShaders {
+		if strings.TrimSpace(n) == name {
+			ref := ref
+			if ref.GUID != "0000000000000000f000000000000000" {
+				ref.Type = 3
+			}
+			return &ref
+		}
+	}
+	return nil
 }
 
 func GetBuiltinMesh(ref *Ref) (vs []*geom.Vector3, faces [][]int, uvs [][]geom.Vector2, name string) {
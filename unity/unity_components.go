@@ -1,6 +1,10 @@
 package unity
 
-import "github.com/binzume/modelconv/geom"
+import (
+	"math"
+
+	"github.com/binzume/modelconv/geom"
+)
 
 type Vector2 = geom.Vector2
 type Vector3 = geom.Vector3
@@ -11,11 +15,21 @@ type componentDesc struct {
 	Transform     *Transform     `yaml:"Transform" typeid:"unity3d.com,2011:4"`
 	MonoBehaviour *MonoBehaviour `yaml:"MonoBehaviour" typeid:"unity3d.com,2011:114"`
 	Light         *Light         `yaml:"Light" typeid:"unity3d.com,2011:108"`
+	Camera        *Camera        `yaml:"Camera" typeid:"unity3d.com,2011:20"`
+	LODGroup      *LODGroup      `yaml:"LODGroup" typeid:"unity3d.com,2011:205"`
 
 	// Mesh
 	MeshRenderer *MeshRenderer `yaml:"MeshRenderer" typeid:"unity3d.com,2011:23"`
 	MeshFilter   *MeshFilter   `yaml:"MeshFilter" typeid:"unity3d.com,2011:33"`
 
+	SkinnedMeshRenderer *SkinnedMeshRenderer `yaml:"SkinnedMeshRenderer" typeid:"unity3d.com,2011:137"`
+
+	Terrain *Terrain `yaml:"Terrain" typeid:"unity3d.com,2011:218"`
+
+	// Animation
+	Animator  *Animator  `yaml:"Animator" typeid:"unity3d.com,2011:95"`
+	Animation *Animation `yaml:"Animation" typeid:"unity3d.com,2011:111"`
+
 	// Physics
 	Rigidbody       *Rigidbody       `yaml:"Rigidbody" typeid:"unity3d.com,2011:54"`
 	MeshCollider    *MeshCollider    `yaml:"MeshCollider" typeid:"unity3d.com,2011:64"`
@@ -27,23 +41,28 @@ type componentDesc struct {
 type Component interface {
 	GetGameObject() *GameObject
 	init(*Scene)
+	base() *BaseComponent
 }
 
 type BaseComponent struct {
 	Scene *Scene `yaml:"-"`
 
 	ObjectHideFlags int `yaml:"m_ObjectHideFlags"`
-	PrefabInternal  Ref `yaml:"m_PrefabInternal"`
+	PrefabInternal  Ref `yaml:"m_PrefabInternal,omitempty"`
 	GameObject      Ref `yaml:"m_GameObject"`
 
-	CorrespondingSourceObject *Ref `yaml:"m_CorrespondingSourceObject"`
-	PrefabInstance            *Ref `yaml:"m_PrefabInstance"`
+	CorrespondingSourceObject *Ref `yaml:"m_CorrespondingSourceObject,omitempty"`
+	PrefabInstance            *Ref `yaml:"m_PrefabInstance,omitempty"`
 }
 
 func (c *BaseComponent) init(scene *Scene) {
 	c.Scene = scene
 }
 
+func (c *BaseComponent) base() *BaseComponent {
+	return c
+}
+
 func (c *BaseComponent) GetGameObject() *GameObject {
 	obj, _ := c.Scene.GetElement2(&c.GameObject, c.PrefabInstance).(*GameObject)
 	return obj
@@ -63,6 +82,7 @@ type Transform struct {
 	RootOrder int `yaml:"m_RootOrder"`
 
 	children []*Transform
+	parent   *Transform
 }
 
 func (tr *Transform) GetMatrix() *geom.Matrix4 {
@@ -87,6 +107,7 @@ func (tr *Transform) GetChildren() []*Transform {
 	var children []*Transform
 	for _, c := range tr.Children {
 		if t := tr.Scene.GetTransform(c, tr.PrefabInstance); t != nil {
+			t.parent = tr
 			children = append(children, t)
 		}
 	}
@@ -103,14 +124,26 @@ func (tr *Transform) AddChild(child *Transform) bool {
 			return false
 		}
 	}
+	child.parent = tr
 	tr.children = append(tr.children, child)
 	return true
 }
 
+func (tr *Transform) RemoveChild(child *Transform) {
+	children := tr.GetChildren()[:0]
+	for _, c := range tr.children {
+		if c != child {
+			children = append(children, c)
+		}
+	}
+	tr.children = children
+}
+
 func (tr *Transform) GetParent() *Transform {
-	// TODO: prefab parent
-	t, _ := tr.Scene.GetElement(&tr.Father).(*Transform)
-	return t
+	if tr.parent != nil {
+		return tr.parent
+	}
+	return tr.Scene.GetTransform(&tr.Father, tr.PrefabInstance)
 }
 
 type MonoBehaviour struct {
@@ -139,6 +172,43 @@ type MeshRenderer struct {
 	ReflectionProbeUsage int `yaml:"m_ReflectionProbeUsage"`
 
 	Materials []*Ref `yaml:"m_Materials"`
+
+	LightmapIndex        *int          `yaml:"m_LightmapIndex,omitempty"`
+	LightmapScaleOffset  *geom.Vector4 `yaml:"m_LightmapScaleOffset,omitempty"`
+	LightmapTilingOffset *geom.Vector4 `yaml:"m_LightmapTilingOffset,omitempty"` // Unity 5.x
+}
+
+// GetLightmap returns the lightmap index and the scale(xy) and offset(zw) of the lightmap UVs.
+func (r *MeshRenderer) GetLightmap() (int, *geom.Vector4, bool) {
+	if r.LightmapIndex == nil || *r.LightmapIndex < 0 || *r.LightmapIndex >= 0xfffe {
+		return 0, nil, false
+	}
+	scaleOffset := r.LightmapScaleOffset
+	if scaleOffset == nil {
+		scaleOffset = r.LightmapTilingOffset
+	}
+	if scaleOffset == nil {
+		scaleOffset = &geom.Vector4{X: 1, Y: 1}
+	}
+	return *r.LightmapIndex, scaleOffset, true
+}
+
+type SkinnedMeshRenderer struct {
+	BaseComponent `yaml:",inline"`
+	Enabled       int `yaml:"m_Enabled"`
+
+	CastShadows    int `yaml:"m_CastShadows"`
+	ReceiveShadows int `yaml:"m_ReceiveShadows"`
+
+	Materials []*Ref `yaml:"m_Materials"`
+
+	Mesh                *Ref      `yaml:"m_Mesh"`
+	Bones               []*Ref    `yaml:"m_Bones"`
+	RootBone            *Ref      `yaml:"m_RootBone"`
+	BlendShapeWeights   []float32 `yaml:"m_BlendShapeWeights"`
+	Quality             int       `yaml:"m_Quality"`
+	UpdateWhenOffscreen int       `yaml:"m_UpdateWhenOffscreen"`
+	AABB                *AABB     `yaml:"m_AABB,omitempty"`
 }
 
 type Rigidbody struct {
@@ -188,8 +258,17 @@ type CapsuleCollider struct {
 	Height    float32      `yaml:"m_Height"`
 }
 
+// Light types
+const (
+	LightTypeSpot        = 0
+	LightTypeDirectional = 1
+	LightTypePoint       = 2
+	LightTypeArea        = 3
+)
+
 type Light struct {
 	BaseComponent `yaml:",inline"`
+	Enabled       int `yaml:"m_Enabled"`
 
 	Type           int     `yaml:"m_Type"`
 	Shape          int     `yaml:"m_Shape"`
@@ -207,7 +286,62 @@ type Light struct {
 		Bits int64 `yaml:"m_Bits"`
 	} `yaml:"m_CullingMask"`
 
-	ColorTemperature float32 `yaml:"m_ColorTemperature"`
-	ShadowRadius     float32 `yaml:"m_ShadowRadius"`
-	ShadowAngle      float32 `yaml:"m_ShadowAngle"`
+	ColorTemperature    float32 `yaml:"m_ColorTemperature"`
+	UseColorTemperature int     `yaml:"m_UseColorTemperature"`
+	ShadowRadius        float32 `yaml:"m_ShadowRadius"`
+	ShadowAngle         float32 `yaml:"m_ShadowAngle"`
+}
+
+type Camera struct {
+	BaseComponent `yaml:",inline"`
+	Enabled       int `yaml:"m_Enabled"`
+
+	ProjectionMatrixMode int          `yaml:"m_projectionMatrixMode"` // 2: Physical camera
+	SensorSize           geom.Vector2 `yaml:"m_SensorSize"`
+	FocalLength          float32      `yaml:"m_FocalLength"`
+
+	NearClipPlane    float32 `yaml:"near clip plane"`
+	FarClipPlane     float32 `yaml:"far clip plane"`
+	FieldOfView      float32 `yaml:"field of view"` // vertical, degrees
+	Orthographic     int     `yaml:"orthographic"`
+	OrthographicSize float32 `yaml:"orthographic size"` // half height
+	Depth            float32 `yaml:"m_Depth"`
+
+	ViewportRect struct {
+		X      float32 `yaml:"x"`
+		Y      float32 `yaml:"y"`
+		Width  float32 `yaml:"width"`
+		Height float32 `yaml:"height"`
+	} `yaml:"m_NormalizedViewPortRect"`
+}
+
+// GetAspectRatio returns the aspect ratio (width / height) of the viewport on the screen.
+func (c *Camera) GetAspectRatio(screenAspectRatio float32) float32 {
+	if c.ViewportRect.Width > 0 && c.ViewportRect.Height > 0 {
+		return screenAspectRatio * c.ViewportRect.Width / c.ViewportRect.Height
+	}
+	return screenAspectRatio
+}
+
+// GetFieldOfView returns the vertical field of view in degrees.
+func (c *Camera) GetFieldOfView() float32 {
+	if c.ProjectionMatrixMode == 2 && c.FocalLength > 0 && c.SensorSize.Y > 0 {
+		return float32(2 * math.Atan(float64(c.SensorSize.Y/(2*c.FocalLength))) * 180 / math.Pi)
+	}
+	return c.FieldOfView
+}
+
+type LODGroup struct {
+	BaseComponent `yaml:",inline"`
+	Enabled       int `yaml:"m_Enabled"`
+
+	LODs []*struct {
+		ScreenRelativeHeight float32 `yaml:"screenRelativeHeight"`
+		FadeTransitionWidth  float32 `yaml:"fadeTransitionWidth"`
+		Renderers            []*struct {
+			Renderer *Ref `yaml:"renderer"`
+		} `yaml:"renderers"`
+	} `yaml:"m_LODs"`
+	LocalReferencePoint geom.Vector3 `yaml:"m_LocalReferencePoint"`
+	Size                float32      `yaml:"m_Size"`
 }
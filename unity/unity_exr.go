@@ -0,0 +1,263 @@
+package unity
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+// EXRImage is a HDR image decoded from OpenEXR file. (e.g. lightmaps)
+type EXRImage struct {
+	Rect image.Rectangle
+	Pix  []float32 // RGBA, linear
+}
+
+func (img *EXRImage) ColorModel() color.Model {
+	return color.NRGBA64Model
+}
+
+func (img *EXRImage) Bounds() image.Rectangle {
+	return img.Rect
+}
+
+// At returns the color clamped to [0, 1].
+func (img *EXRImage) At(x, y int) color.Color {
+	c := img.FloatAt(x, y)
+	conv := func(v float32) uint16 {
+		return uint16(math.Max(0, math.Min(1, float64(v)))*0xffff + 0.5)
+	}
+	return color.NRGBA64{conv(c[0]), conv(c[1]), conv(c[2]), conv(c[3])}
+}
+
+func (img *EXRImage) FloatAt(x, y int) [4]float32 {
+	if !(image.Point{x, y}.In(img.Rect)) {
+		return [4]float32{}
+	}
+	i := ((y-img.Rect.Min.Y)*img.Rect.Dx() + (x - img.Rect.Min.X)) * 4
+	return [4]float32{img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3]}
+}
+
+// EXR compressions
+const (
+	exrCompressionNone = 0
+	exrCompressionRLE  = 1
+	exrCompressionZIPS = 2
+	exrCompressionZIP  = 3
+)
+
+// exrCompressionNames are the names of all EXR compressions for error messages.
+var exrCompressionNames = []string{"NONE", "RLE", "ZIPS", "ZIP", "PIZ", "PXR24", "B44", "B44A", "DWAA", "DWAB"}
+
+// ErrUnsupportedEXRCompression is returned for EXR files which are compressed by other than NONE, RLE, ZIPS and ZIP.
+var ErrUnsupportedEXRCompression = errors.New("unsupported EXR compression")
+
+func exrCompressionError(compression byte) error {
+	name := fmt.Sprint(compression)
+	if int(compression) < len(exrCompressionNames) {
+		name = exrCompressionNames[compression]
+	}
+	return fmt.Errorf("%w: %s (only NONE, RLE, ZIPS and ZIP are supported. Re-export the image with ZIP compression)", ErrUnsupportedEXRCompression, name)
+}
+
+type exrChannel struct {
+	name      string
+	pixelType int32 // 0: uint, 1: half, 2: float
+}
+
+// DecodeEXR decodes single-part scanline OpenEXR image. Supported compressions are NONE, RLE, ZIPS and ZIP.
+func DecodeEXR(r io.Reader) (*EXRImage, error) {
+	br := bufio.NewReader(r)
+	var magic, version uint32
+	if err := binary.Read(br, binary.LittleEndian, &magic); err != nil {
+		return nil, err
+	}
+	if magic != 20000630 {
+		return nil, errors.New("not an EXR file")
+	}
+	if err := binary.Read(br, binary.LittleEndian, &version); err != nil {
+		return nil, err
+	}
+	if version&0x1a00 != 0 {
+		return nil, errors.New("tiled, deep or multi-part EXR is not supported")
+	}
+
+	var channels []exrChannel
+	var compression byte
+	var dataWindow [4]int32
+	for {
+		name, err := br.ReadString(0)
+		if err != nil {
+			return nil, err
+		}
+		if name == "\x00" {
+			break
+		}
+		if _, err := br.ReadString(0); err != nil {
+			return nil, err
+		}
+		var size int32
+		if err := binary.Read(br, binary.LittleEndian, &size); err != nil {
+			return nil, err
+		}
+		value := make([]byte, size)
+		if _, err := io.ReadFull(br, value); err != nil {
+			return nil, err
+		}
+		switch name[:len(name)-1] {
+		case "channels":
+			for p := value; len(p) > 0 && p[0] != 0; {
+				i := bytes.IndexByte(p, 0)
+				if i < 0 || len(p) < i+17 {
+					return nil, errors.New("invalid channel list")
+				}
+				channels = append(channels, exrChannel{name: string(p[:i]), pixelType: int32(binary.LittleEndian.Uint32(p[i+1:]))})
+				p = p[i+17:]
+			}
+		case "compression":
+			compression = value[0]
+		case "dataWindow":
+			if err := binary.Read(bytes.NewReader(value), binary.LittleEndian, &dataWindow); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	linesPerBlock := map[byte]int{exrCompressionNone: 1, exrCompressionRLE: 1, exrCompressionZIPS: 1, exrCompressionZIP: 16}[compression]
+	if linesPerBlock == 0 {
+		return nil, exrCompressionError(compression)
+	}
+	w, h := int(dataWindow[2]-dataWindow[0]+1), int(dataWindow[3]-dataWindow[1]+1)
+	if w <= 0 || h <= 0 || len(channels) == 0 {
+		return nil, errors.New("invalid EXR header")
+	}
+	// Skip the offset table. Chunks are read sequentially.
+	if _, err := br.Discard(8 * ((h + linesPerBlock - 1) / linesPerBlock)); err != nil {
+		return nil, err
+	}
+
+	img := &EXRImage{Rect: image.Rect(0, 0, w, h), Pix: make([]float32, w*h*4)}
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 1
+	}
+	dst := map[string]int{"R": 0, "G": 1, "B": 2, "A": 3, "Y": -1}
+	lineSize := 0
+	for _, ch := range channels {
+		if ch.pixelType == 1 {
+			lineSize += w * 2
+		} else {
+			lineSize += w * 4
+		}
+	}
+
+	for block := 0; block < (h+linesPerBlock-1)/linesPerBlock; block++ {
+		var header [2]int32
+		if err := binary.Read(br, binary.LittleEndian, &header); err != nil {
+			return nil, err
+		}
+		data := make([]byte, header[1])
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil, err
+		}
+		y0 := int(header[0] - dataWindow[1])
+		lines := linesPerBlock
+		if y0+lines > h {
+			lines = h - y0
+		}
+		if y0 < 0 || lines <= 0 {
+			return nil, errors.New("invalid EXR chunk")
+		}
+		if len(data) < lineSize*lines {
+			var err error
+			if data, err = exrDecompress(compression, data, lineSize*lines); err != nil {
+				return nil, err
+			}
+		}
+		for l := 0; l < lines; l++ {
+			p := data[l*lineSize:]
+			for _, ch := range channels {
+				c, ok := dst[ch.name]
+				for x := 0; x < w; x++ {
+					var v float32
+					switch ch.pixelType {
+					case 0:
+						v = float32(binary.LittleEndian.Uint32(p))
+						p = p[4:]
+					case 1:
+						v = halfToFloat32(binary.LittleEndian.Uint16(p))
+						p = p[2:]
+					default:
+						v = math.Float32frombits(binary.LittleEndian.Uint32(p))
+						p = p[4:]
+					}
+					if !ok {
+						continue
+					}
+					i := ((y0+l)*w + x) * 4
+					if c < 0 {
+						img.Pix[i], img.Pix[i+1], img.Pix[i+2] = v, v, v // Luminance
+					} else {
+						img.Pix[i+c] = v
+					}
+				}
+			}
+		}
+	}
+	return img, nil
+}
+
+func exrDecompress(compression byte, data []byte, size int) ([]byte, error) {
+	var tmp []byte
+	switch compression {
+	case exrCompressionRLE:
+		for len(data) > 1 {
+			n := int(int8(data[0]))
+			if n < 0 {
+				if len(data) < 1-n {
+					return nil, errors.New("invalid RLE data")
+				}
+				tmp = append(tmp, data[1:1-n]...)
+				data = data[1-n:]
+			} else {
+				tmp = append(tmp, bytes.Repeat(data[1:2], n+1)...)
+				data = data[2:]
+			}
+		}
+	case exrCompressionZIPS, exrCompressionZIP:
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if tmp, err = ioutil.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, exrCompressionError(compression)
+	}
+	if len(tmp) != size {
+		return nil, errors.New("invalid EXR data size")
+	}
+
+	// Predictor
+	for i := 1; i < len(tmp); i++ {
+		tmp[i] = byte(int(tmp[i-1]) + int(tmp[i]) - 128)
+	}
+	// Interleave
+	out := make([]byte, size)
+	half := (size + 1) / 2
+	for i := range out {
+		if i%2 == 0 {
+			out[i] = tmp[i/2]
+		} else {
+			out[i] = tmp[half+i/2]
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,111 @@
+package unity
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func encodeTestEXR(w, h int, compression byte, pixel func(x, y, c int) uint16) []byte {
+	var b bytes.Buffer
+	attr := func(name, typ string, value []byte) {
+		b.WriteString(name + "\x00" + typ + "\x00")
+		binary.Write(&b, binary.LittleEndian, int32(len(value)))
+		b.Write(value)
+	}
+	binary.Write(&b, binary.LittleEndian, []uint32{20000630, 2})
+	var chlist bytes.Buffer
+	for _, name := range []string{"B", "G", "R"} {
+		chlist.WriteString(name + "\x00")
+		binary.Write(&chlist, binary.LittleEndian, []int32{1, 0, 1, 1}) // half
+	}
+	chlist.WriteByte(0)
+	attr("channels", "chlist", chlist.Bytes())
+	attr("compression", "compression", []byte{compression})
+	var window bytes.Buffer
+	binary.Write(&window, binary.LittleEndian, []int32{0, 0, int32(w - 1), int32(h - 1)})
+	attr("dataWindow", "box2i", window.Bytes())
+	attr("displayWindow", "box2i", window.Bytes())
+	b.WriteByte(0)
+
+	lines := 1
+	if compression == exrCompressionZIP {
+		lines = 16
+	}
+	blocks := (h + lines - 1) / lines
+	b.Write(make([]byte, 8*blocks)) // offsets (unused)
+	for block := 0; block < blocks; block++ {
+		var raw bytes.Buffer
+		for y := block * lines; y < h && y < (block+1)*lines; y++ {
+			for c := 2; c >= 0; c-- {
+				for x := 0; x < w; x++ {
+					binary.Write(&raw, binary.LittleEndian, pixel(x, y, c))
+				}
+			}
+		}
+		data := raw.Bytes()
+		if compression == exrCompressionZIP {
+			src := data
+			tmp := make([]byte, len(src))
+			half := (len(src) + 1) / 2
+			for i := range src {
+				if i%2 == 0 {
+					tmp[i/2] = src[i]
+				} else {
+					tmp[half+i/2] = src[i]
+				}
+			}
+			for i := len(tmp) - 1; i > 0; i-- {
+				tmp[i] = byte(int(tmp[i]) - int(tmp[i-1]) + 128)
+			}
+			var z bytes.Buffer
+			zw := zlib.NewWriter(&z)
+			zw.Write(tmp)
+			zw.Close()
+			data = z.Bytes()
+		}
+		binary.Write(&b, binary.LittleEndian, []int32{int32(block * lines), int32(len(data))})
+		b.Write(data)
+	}
+	return b.Bytes()
+}
+
+func TestDecodeEXR(t *testing.T) {
+	// half: 0x3c00=1.0, 0x4000=2.0, 0x3800=0.5
+	pixel := func(x, y, c int) uint16 {
+		if c == 0 {
+			return 0x4000
+		} else if c == 1 && x == y {
+			return 0x3800
+		}
+		return 0
+	}
+	for _, compression := range []byte{exrCompressionNone, exrCompressionZIP} {
+		img, err := DecodeEXR(bytes.NewReader(encodeTestEXR(20, 20, compression, pixel)))
+		if err != nil {
+			t.Fatal(compression, err)
+		}
+		if img.Bounds().Dx() != 20 || img.Bounds().Dy() != 20 {
+			t.Fatal("invalid size", img.Bounds())
+		}
+		if c := img.FloatAt(3, 3); c != [4]float32{2, 0.5, 0, 1} {
+			t.Error("invalid pixel", compression, c)
+		}
+		if c := img.FloatAt(3, 17); c != [4]float32{2, 0, 0, 1} {
+			t.Error("invalid pixel", compression, c)
+		}
+		if r, _, _, _ := img.At(3, 3).RGBA(); r != 0xffff {
+			t.Error("not clamped", r)
+		}
+	}
+}
+
+func TestDecodeEXRUnsupportedCompression(t *testing.T) {
+	_, err := DecodeEXR(bytes.NewReader(encodeTestEXR(4, 4, 4, func(x, y, c int) uint16 { return 0 })))
+	if !errors.Is(err, ErrUnsupportedEXRCompression) || !strings.Contains(err.Error(), "PIZ") {
+		t.Error("PIZ: ", err)
+	}
+}
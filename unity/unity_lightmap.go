@@ -0,0 +1,118 @@
+package unity
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+)
+
+type LightmapData struct {
+	Lightmap    *Ref `yaml:"m_Lightmap"`
+	DirLightmap *Ref `yaml:"m_DirLightmap"`
+	ShadowMask  *Ref `yaml:"m_ShadowMask"`
+}
+
+type LightmapSettings struct {
+	GIWorkflowMode    int             `yaml:"m_GIWorkflowMode"`
+	Lightmaps         []*LightmapData `yaml:"m_Lightmaps"` // Unity 5.x
+	LightmapsMode     int             `yaml:"m_LightmapsMode"`
+	LightingDataAsset *Ref            `yaml:"m_LightingDataAsset"`
+
+	sceneAsset *Asset
+}
+
+// LoadLightmapSettings loads LightmapSettings from the scene file.
+func LoadLightmapSettings(assets Assets, sceneGUID string) (*LightmapSettings, error) {
+	asset := assets.GetAsset(sceneGUID)
+	if asset == nil {
+		return nil, fmt.Errorf("Scene not found: %s", sceneGUID)
+	}
+	r, err := assets.Open(asset.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range ParseYamlDocuments(b) {
+		if doc.Tag != "tag:unity3d.com,2011:157" {
+			continue
+		}
+		var d struct {
+			LightmapSettings *LightmapSettings `yaml:"LightmapSettings"`
+		}
+		if err := doc.Decode(&d); err != nil {
+			return nil, err
+		}
+		if d.LightmapSettings != nil {
+			d.LightmapSettings.sceneAsset = asset
+			return d.LightmapSettings, nil
+		}
+	}
+	return nil, fmt.Errorf("LightmapSettings not found: %s", asset.Path)
+}
+
+// LightingDataAsset is a LightingData.asset serialized as text.
+type LightingDataAsset struct {
+	Name      string          `yaml:"m_Name"`
+	Lightmaps []*LightmapData `yaml:"m_Lightmaps"`
+}
+
+// LoadLightingData loads LightingData.asset. Unity usually saves it as a binary file, which is not supported.
+func LoadLightingData(assets Assets, ref *Ref) (*LightingDataAsset, error) {
+	asset := assets.GetAsset(ref.GUID)
+	if asset == nil {
+		return nil, fmt.Errorf("LightingData not found: %s", ref.GUID)
+	}
+	r, err := assets.Open(asset.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(b, []byte("%YAML")) {
+		return nil, fmt.Errorf("binary LightingData is not supported: %s", asset.Path)
+	}
+	for _, doc := range ParseYamlDocuments(b) {
+		var d struct {
+			LightingDataAsset *LightingDataAsset `yaml:"LightingDataAsset"`
+		}
+		if err := doc.Decode(&d); err != nil {
+			return nil, err
+		}
+		if d.LightingDataAsset != nil {
+			return d.LightingDataAsset, nil
+		}
+	}
+	return nil, fmt.Errorf("LightingDataAsset not found: %s", asset.Path)
+}
+
+// GetLightmap returns the lightmap texture asset. Lightmaps are resolved by m_Lightmaps of LightmapSettings (Unity 5.x) or LightingData.asset.
+func (s *LightmapSettings) GetLightmap(assets Assets, index int) (*Asset, error) {
+	lightmaps := s.Lightmaps
+	if len(lightmaps) == 0 {
+		if !s.LightingDataAsset.IsValid() {
+			return nil, fmt.Errorf("LightingData is not found in the scene: %s", s.sceneAsset.Path)
+		}
+		data, err := LoadLightingData(assets, s.LightingDataAsset)
+		if err != nil {
+			return nil, err
+		}
+		lightmaps = data.Lightmaps
+	}
+	if index < 0 || index >= len(lightmaps) || !lightmaps[index].Lightmap.IsValid() {
+		return nil, fmt.Errorf("lightmap %d is not found in the lighting data (%d lightmaps)", index, len(lightmaps))
+	}
+	asset := assets.GetAsset(lightmaps[index].Lightmap.GUID)
+	if asset == nil {
+		return nil, fmt.Errorf("lightmap texture not found: %s", lightmaps[index].Lightmap.GUID)
+	}
+	return asset, nil
+}
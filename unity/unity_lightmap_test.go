@@ -0,0 +1,54 @@
+package unity
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetLightmap(t *testing.T) {
+	dir := t.TempDir()
+	write := func(path, guid, content string) {
+		path = filepath.Join(dir, path)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path+".meta", []byte("fileFormatVersion: 2\nguid: "+guid+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("Assets/Test/LightingData.asset", "11111111111111111111111111111111", `%YAML 1.1
+%TAG !u! tag:unity3d.com,2011:
+--- !u!1120 &112000000
+LightingDataAsset:
+  m_Name: LightingData
+  m_Lightmaps:
+  - m_Lightmap: {fileID: 2800000, guid: 22222222222222222222222222222222, type: 3}
+    m_DirLightmap: {fileID: 0}
+    m_ShadowMask: {fileID: 0}
+`)
+	write("Assets/Test/Lightmap-0_comp_light.exr", "22222222222222222222222222222222", "")
+	write("Assets/Test/Binary.asset", "33333333333333333333333333333333", "\x00\x00\x00\x00")
+	assets, err := OpenProject(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := &LightmapSettings{LightingDataAsset: &Ref{FileID: 112000000, GUID: "11111111111111111111111111111111"}, sceneAsset: &Asset{Path: "Assets/Test.unity"}}
+	if asset, err := settings.GetLightmap(assets, 0); err != nil || asset.Path != "Assets/Test/Lightmap-0_comp_light.exr" {
+		t.Error("lightmap: ", asset, err)
+	}
+	if _, err := settings.GetLightmap(assets, 1); err == nil {
+		t.Error("lightmap 1 should not be found")
+	}
+
+	settings.LightingDataAsset.GUID = "33333333333333333333333333333333"
+	if _, err := settings.GetLightmap(assets, 0); err == nil {
+		t.Error("binary LightingData should be an error")
+	}
+	settings.LightingDataAsset = nil
+	if _, err := settings.GetLightmap(assets, 0); err == nil {
+		t.Error("lightmap without LightingData should be an error")
+	}
+}
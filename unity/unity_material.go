@@ -3,14 +3,16 @@ package unity
 import (
 	"fmt"
 	"io/ioutil"
+	"strings"
 
 	"github.com/binzume/modelconv/geom"
 )
 
 type Material struct {
-	Name           string `yaml:"m_Name"`
-	Shader         *Ref   `yaml:"m_Shader"`
-	ShaderKeywords string `yaml:"m_ShaderKeywords"`
+	SerializedVersion int    `yaml:"serializedVersion"`
+	Name              string `yaml:"m_Name"`
+	Shader            *Ref   `yaml:"m_Shader"`
+	ShaderKeywords    string `yaml:"m_ShaderKeywords"`
 
 	LightmapFlags            int               `yaml:"m_LightmapFlags"`
 	EnableInstancingVariants int               `yaml:"m_EnableInstancingVariants"`
@@ -20,9 +22,10 @@ type Material struct {
 	DisabledShaderPasses     []string          `yaml:"disabledShaderPasses"`
 
 	SavedProperties struct {
-		TexEnvs []map[string]*TextureEnv `yaml:"m_TexEnvs"`
-		Floats  []map[string]float32     `yaml:"m_Floats"`
-		Colors  []map[string]*Color      `yaml:"m_Colors"`
+		SerializedVersion int                      `yaml:"serializedVersion"`
+		TexEnvs           []map[string]*TextureEnv `yaml:"m_TexEnvs"`
+		Floats            []map[string]float32     `yaml:"m_Floats"`
+		Colors            []map[string]*Color      `yaml:"m_Colors"`
 	} `yaml:"m_SavedProperties"`
 }
 
@@ -70,6 +73,23 @@ func (m *Material) GetFloatProperty(name string) (float32, bool) {
 	return 0, false
 }
 
+// GetShaderName returns name of the builtin or well-known shader.
+func (m *Material) GetShaderName() string {
+	if m.Shader == nil {
+		return ""
+	}
+	return strings.TrimSpace(UnityShaders[Ref{FileID: m.Shader.FileID, GUID: m.Shader.GUID}])
+}
+
+func (m *Material) HasKeyword(keyword string) bool {
+	for _, k := range strings.Fields(m.ShaderKeywords) {
+		if k == keyword {
+			return true
+		}
+	}
+	return false
+}
+
 func LoadMaterial(assets Assets, guid string) (*Material, error) {
 	asset := assets.GetAsset(guid)
 	if asset == nil {
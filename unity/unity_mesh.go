@@ -0,0 +1,559 @@
+package unity
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"math"
+	"strconv"
+
+	"github.com/binzume/modelconv/geom"
+)
+
+// Vertex channels (Unity 2019 or later)
+const (
+	VertexChannelPosition    = 0
+	VertexChannelNormal      = 1
+	VertexChannelTangent     = 2
+	VertexChannelColor       = 3
+	VertexChannelTexCoord0   = 4
+	VertexChannelTexCoord1   = 5
+	VertexChannelBlendWeight = 12
+	VertexChannelBlendIndex  = 13
+)
+
+// channel index remap for Unity 2018 or earlier. (Vertex, Normal, Color, UV0-3, Tangent)
+var legacyVertexChannels = []int{0, 1, 3, 4, 5, 6, 7, 2}
+
+const (
+	MeshTopologyTriangles = 0
+	MeshTopologyQuads     = 2
+)
+
+type Mesh struct {
+	Name              string `yaml:"m_Name"`
+	SerializedVersion int    `yaml:"serializedVersion"`
+
+	SubMeshes        []*SubMesh      `yaml:"m_SubMeshes"`
+	Shapes           BlendShapeData  `yaml:"m_Shapes"`
+	BindPose         []*Matrix4x4    `yaml:"m_BindPose"`
+	BoneNameHashes   string          `yaml:"m_BoneNameHashes"` // hex
+	RootBoneNameHash uint32          `yaml:"m_RootBoneNameHash"`
+	MeshCompression  int             `yaml:"m_MeshCompression"`
+	IndexFormat      int             `yaml:"m_IndexFormat"`
+	IndexBuffer      string          `yaml:"m_IndexBuffer"`
+	Skin             []*BoneWeights4 `yaml:"m_Skin"`
+	VertexData       VertexData      `yaml:"m_VertexData"`
+	LocalAABB        AABB            `yaml:"m_LocalAABB"`
+}
+
+type SubMesh struct {
+	SerializedVersion int  `yaml:"serializedVersion"`
+	FirstByte         int  `yaml:"firstByte"`
+	IndexCount        int  `yaml:"indexCount"`
+	Topology          int  `yaml:"topology"`
+	BaseVertex        int  `yaml:"baseVertex"`
+	FirstVertex       int  `yaml:"firstVertex"`
+	VertexCount       int  `yaml:"vertexCount"`
+	LocalAABB         AABB `yaml:"localAABB"`
+}
+
+type AABB struct {
+	Center Vector3 `yaml:"m_Center"`
+	Extent Vector3 `yaml:"m_Extent"`
+}
+
+type VertexData struct {
+	SerializedVersion int            `yaml:"serializedVersion"`
+	VertexCount       int            `yaml:"m_VertexCount"`
+	Channels          []*ChannelInfo `yaml:"m_Channels"`
+	DataSize          int            `yaml:"m_DataSize"`
+	TypelessData      string         `yaml:"_typelessdata"`
+}
+
+type ChannelInfo struct {
+	Stream    int `yaml:"stream"`
+	Offset    int `yaml:"offset"`
+	Format    int `yaml:"format"`
+	Dimension int `yaml:"dimension"`
+}
+
+type BlendShapeData struct {
+	Vertices    []*BlendShapeVertex  `yaml:"vertices"`
+	Shapes      []*BlendShape        `yaml:"shapes"`
+	Channels    []*BlendShapeChannel `yaml:"channels"`
+	FullWeights string               `yaml:"fullWeights"` // hex
+}
+
+type BlendShapeVertex struct {
+	Vertex  Vector3 `yaml:"vertex"`
+	Normal  Vector3 `yaml:"normal"`
+	Tangent Vector3 `yaml:"tangent"`
+	Index   int     `yaml:"index"`
+}
+
+// BlendShape is a frame of the blend shape channel.
+type BlendShape struct {
+	FirstVertex int `yaml:"firstVertex"`
+	VertexCount int `yaml:"vertexCount"`
+	HasNormals  int `yaml:"hasNormals"`
+	HasTangents int `yaml:"hasTangents"`
+}
+
+type BlendShapeChannel struct {
+	Name       string `yaml:"name"`
+	NameHash   uint32 `yaml:"nameHash"`
+	FrameIndex int    `yaml:"frameIndex"`
+	FrameCount int    `yaml:"frameCount"`
+}
+
+// BoneWeights4 is a skin weight of Unity 2018 or earlier.
+type BoneWeights4 struct {
+	Weight0    float32 `yaml:"weight[0]"`
+	Weight1    float32 `yaml:"weight[1]"`
+	Weight2    float32 `yaml:"weight[2]"`
+	Weight3    float32 `yaml:"weight[3]"`
+	BoneIndex0 int     `yaml:"boneIndex[0]"`
+	BoneIndex1 int     `yaml:"boneIndex[1]"`
+	BoneIndex2 int     `yaml:"boneIndex[2]"`
+	BoneIndex3 int     `yaml:"boneIndex[3]"`
+}
+
+type Matrix4x4 struct {
+	E00 float32 `yaml:"e00"`
+	E01 float32 `yaml:"e01"`
+	E02 float32 `yaml:"e02"`
+	E03 float32 `yaml:"e03"`
+	E10 float32 `yaml:"e10"`
+	E11 float32 `yaml:"e11"`
+	E12 float32 `yaml:"e12"`
+	E13 float32 `yaml:"e13"`
+	E20 float32 `yaml:"e20"`
+	E21 float32 `yaml:"e21"`
+	E22 float32 `yaml:"e22"`
+	E23 float32 `yaml:"e23"`
+	E30 float32 `yaml:"e30"`
+	E31 float32 `yaml:"e31"`
+	E32 float32 `yaml:"e32"`
+	E33 float32 `yaml:"e33"`
+}
+
+func NewMatrix4x4(m *geom.Matrix4) *Matrix4x4 {
+	return &Matrix4x4{
+		m[0], m[4], m[8], m[12],
+		m[1], m[5], m[9], m[13],
+		m[2], m[6], m[10], m[14],
+		m[3], m[7], m[11], m[15],
+	}
+}
+
+func (m *Matrix4x4) Matrix() *geom.Matrix4 {
+	return &geom.Matrix4{
+		m.E00, m.E10, m.E20, m.E30,
+		m.E01, m.E11, m.E21, m.E31,
+		m.E02, m.E12, m.E22, m.E32,
+		m.E03, m.E13, m.E23, m.E33,
+	}
+}
+
+type BlendShapeTarget struct {
+	Name    string
+	Indices []int
+	Deltas  []*Vector3
+}
+
+// GetIndices decodes m_IndexBuffer.
+func (m *Mesh) GetIndices() ([]int, error) {
+	b, err := hex.DecodeString(m.IndexBuffer)
+	if err != nil {
+		return nil, err
+	}
+	var indices []int
+	if m.IndexFormat == 1 {
+		for i := 0; i+4 <= len(b); i += 4 {
+			indices = append(indices, int(binary.LittleEndian.Uint32(b[i:])))
+		}
+	} else {
+		for i := 0; i+2 <= len(b); i += 2 {
+			indices = append(indices, int(binary.LittleEndian.Uint16(b[i:])))
+		}
+	}
+	return indices, nil
+}
+
+// GetSubMeshFaces returns triangles or quads of the sub mesh.
+func (m *Mesh) GetSubMeshFaces(indices []int, n int) [][]int {
+	sub := m.SubMeshes[n]
+	indexSize := 2
+	if m.IndexFormat == 1 {
+		indexSize = 4
+	}
+	faceSize := 3
+	if sub.Topology == MeshTopologyQuads {
+		faceSize = 4
+	} else if sub.Topology != MeshTopologyTriangles {
+		return nil
+	}
+	start := sub.FirstByte / indexSize
+	var faces [][]int
+	for i := start; i+faceSize <= start+sub.IndexCount && i+faceSize <= len(indices); i += faceSize {
+		f := make([]int, faceSize)
+		for j := range f {
+			f[j] = indices[i+j] + sub.BaseVertex
+		}
+		faces = append(faces, f)
+	}
+	return faces
+}
+
+// GetVertexAttribute decodes a channel of m_VertexData. Returns nil if the channel is not exists.
+func (m *Mesh) GetVertexAttribute(channel int) ([][]float32, error) {
+	if m.MeshCompression != 0 {
+		return nil, fmt.Errorf("compressed mesh is not supported")
+	}
+	vd := &m.VertexData
+	legacy := len(vd.Channels) == len(legacyVertexChannels)
+	chIndex := channel
+	if legacy {
+		chIndex = -1
+		for i, c := range legacyVertexChannels {
+			if c == channel {
+				chIndex = i
+			}
+		}
+	}
+	if chIndex < 0 || chIndex >= len(vd.Channels) || vd.Channels[chIndex].Dimension&0xf == 0 {
+		return nil, nil
+	}
+	data, err := hex.DecodeString(vd.TypelessData)
+	if err != nil {
+		return nil, err
+	}
+
+	// stream layout
+	var streamOffset, streamStride []int
+	for _, c := range vd.Channels {
+		for c.Stream >= len(streamStride) {
+			streamStride = append(streamStride, 0)
+		}
+		if c.Dimension&0xf == 0 {
+			continue
+		}
+		end := c.Offset + vertexFormatSize(c.Format)*(c.Dimension&0xf)
+		if end > streamStride[c.Stream] {
+			streamStride[c.Stream] = end
+		}
+	}
+	offset := 0
+	for _, stride := range streamStride {
+		streamOffset = append(streamOffset, offset)
+		offset += stride * vd.VertexCount
+		offset = (offset + 15) &^ 15
+	}
+
+	ch := vd.Channels[chIndex]
+	dim := ch.Dimension & 0xf
+	size := vertexFormatSize(ch.Format)
+	values := make([][]float32, vd.VertexCount)
+	for i := range values {
+		p := streamOffset[ch.Stream] + streamStride[ch.Stream]*i + ch.Offset
+		if p+size*dim > len(data) {
+			return nil, fmt.Errorf("vertex data out of range")
+		}
+		v := make([]float32, dim)
+		for j := range v {
+			v[j] = decodeVertexValue(data[p+size*j:], ch.Format)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// GetBoneWeights returns up to 4 bone indices and weights for each vertex.
+func (m *Mesh) GetBoneWeights() ([][4]int, [][4]float32, error) {
+	if len(m.Skin) > 0 {
+		indices := make([][4]int, len(m.Skin))
+		weights := make([][4]float32, len(m.Skin))
+		for i, s := range m.Skin {
+			indices[i] = [4]int{s.BoneIndex0, s.BoneIndex1, s.BoneIndex2, s.BoneIndex3}
+			weights[i] = [4]float32{s.Weight0, s.Weight1, s.Weight2, s.Weight3}
+		}
+		return indices, weights, nil
+	}
+	bi, err := m.GetVertexAttribute(VertexChannelBlendIndex)
+	if err != nil || bi == nil {
+		return nil, nil, err
+	}
+	bw, err := m.GetVertexAttribute(VertexChannelBlendWeight)
+	if err != nil {
+		return nil, nil, err
+	}
+	indices := make([][4]int, len(bi))
+	weights := make([][4]float32, len(bi))
+	for i := range bi {
+		for j := 0; j < 4 && j < len(bi[i]); j++ {
+			indices[i][j] = int(bi[i][j])
+			if bw == nil {
+				if j == 0 {
+					weights[i][j] = 1
+				}
+			} else if j < len(bw[i]) {
+				weights[i][j] = bw[i][j]
+			} else if j == len(bw[i]) {
+				// last weight is omitted.
+				weights[i][j] = 1
+				for _, w := range bw[i] {
+					weights[i][j] -= w
+				}
+			}
+		}
+	}
+	return indices, weights, nil
+}
+
+// GetBlendShapes returns position deltas of the last frame of each blend shape channel.
+func (m *Mesh) GetBlendShapes() []*BlendShapeTarget {
+	var targets []*BlendShapeTarget
+	for _, ch := range m.Shapes.Channels {
+		t := &BlendShapeTarget{Name: ch.Name}
+		targets = append(targets, t)
+		frame := ch.FrameIndex + ch.FrameCount - 1
+		if ch.FrameCount == 0 || frame >= len(m.Shapes.Shapes) {
+			continue
+		}
+		shape := m.Shapes.Shapes[frame]
+		for i := shape.FirstVertex; i < shape.FirstVertex+shape.VertexCount && i < len(m.Shapes.Vertices); i++ {
+			v := m.Shapes.Vertices[i]
+			t.Indices = append(t.Indices, v.Index)
+			t.Deltas = append(t.Deltas, &Vector3{X: v.Vertex.X, Y: v.Vertex.Y, Z: v.Vertex.Z})
+		}
+	}
+	return targets
+}
+
+// NewMesh encodes the vertex attributes and triangles of the sub meshes. (Unity 2019.3 or later)
+// All attributes are stored as float32 in a single stream except BlendIndex. (uint32)
+func NewMesh(name string, attributes map[int][][]float32, subMeshes [][]int) *Mesh {
+	positions := attributes[VertexChannelPosition]
+	vertexCount := len(positions)
+	channels := make([]*ChannelInfo, VertexChannelBlendIndex+1)
+	stride := 0
+	for ch := range channels {
+		info := &ChannelInfo{}
+		if values := attributes[ch]; vertexCount > 0 && len(values) == vertexCount {
+			info.Offset = stride
+			info.Dimension = len(values[0])
+			if ch == VertexChannelBlendIndex {
+				info.Format = 10
+			}
+			stride += vertexFormatSize(info.Format) * info.Dimension
+		}
+		channels[ch] = info
+	}
+	data := make([]byte, stride*vertexCount)
+	for ch, info := range channels {
+		for i, v := range attributes[ch] {
+			for j := 0; j < info.Dimension && j < len(v); j++ {
+				p := data[stride*i+info.Offset+j*4:]
+				if info.Format == 10 {
+					binary.LittleEndian.PutUint32(p, uint32(v[j]))
+				} else {
+					binary.LittleEndian.PutUint32(p, math.Float32bits(v[j]))
+				}
+			}
+		}
+	}
+
+	mesh := &Mesh{
+		Name:              name,
+		SerializedVersion: 10,
+		VertexData: VertexData{
+			SerializedVersion: 3,
+			VertexCount:       vertexCount,
+			Channels:          channels,
+			DataSize:          len(data),
+			TypelessData:      hex.EncodeToString(data),
+		},
+	}
+	indexSize := 2
+	if vertexCount > 0xffff {
+		mesh.IndexFormat = 1
+		indexSize = 4
+	}
+	var indexBuffer []byte
+	var all []int
+	for _, indices := range subMeshes {
+		sub := &SubMesh{SerializedVersion: 2, FirstByte: len(indexBuffer), IndexCount: len(indices), Topology: MeshTopologyTriangles}
+		for _, index := range indices {
+			var b [4]byte
+			binary.LittleEndian.PutUint32(b[:], uint32(index))
+			indexBuffer = append(indexBuffer, b[:indexSize]...)
+		}
+		if len(indices) > 0 {
+			first, last := indices[0], indices[0]
+			for _, index := range indices {
+				first, last = minInt(first, index), maxInt(last, index)
+			}
+			sub.FirstVertex, sub.VertexCount = first, last-first+1
+		}
+		sub.LocalAABB = newAABB(positions, indices)
+		mesh.SubMeshes = append(mesh.SubMeshes, sub)
+		all = append(all, indices...)
+	}
+	mesh.IndexBuffer = hex.EncodeToString(indexBuffer)
+	mesh.LocalAABB = newAABB(positions, all)
+	return mesh
+}
+
+// AddBlendShape adds a blend shape channel with a frame.
+func (m *Mesh) AddBlendShape(name string, indices []int, deltas []*Vector3) {
+	m.Shapes.Channels = append(m.Shapes.Channels, &BlendShapeChannel{
+		Name:       name,
+		NameHash:   crc32.ChecksumIEEE([]byte(name)),
+		FrameIndex: len(m.Shapes.Shapes),
+		FrameCount: 1,
+	})
+	m.Shapes.Shapes = append(m.Shapes.Shapes, &BlendShape{FirstVertex: len(m.Shapes.Vertices), VertexCount: len(indices)})
+	for i, index := range indices {
+		m.Shapes.Vertices = append(m.Shapes.Vertices, &BlendShapeVertex{Vertex: *deltas[i], Index: index})
+	}
+	var w [4]byte
+	binary.LittleEndian.PutUint32(w[:], math.Float32bits(100))
+	m.Shapes.FullWeights += hex.EncodeToString(w[:])
+}
+
+// SetBones sets the bind poses and the name hashes of the bones.
+func (m *Mesh) SetBones(bindPoses []*geom.Matrix4, names []string, rootName string) {
+	m.BindPose = nil
+	hashes := make([]byte, len(bindPoses)*4)
+	for i, mat := range bindPoses {
+		m.BindPose = append(m.BindPose, NewMatrix4x4(mat))
+		binary.LittleEndian.PutUint32(hashes[i*4:], crc32.ChecksumIEEE([]byte(names[i])))
+	}
+	m.BoneNameHashes = hex.EncodeToString(hashes)
+	m.RootBoneNameHash = crc32.ChecksumIEEE([]byte(rootName))
+}
+
+func newAABB(positions [][]float32, indices []int) AABB {
+	if len(indices) == 0 {
+		return AABB{}
+	}
+	min := geom.Vector3{X: math.MaxFloat32, Y: math.MaxFloat32, Z: math.MaxFloat32}
+	max := geom.Vector3{X: -math.MaxFloat32, Y: -math.MaxFloat32, Z: -math.MaxFloat32}
+	for _, index := range indices {
+		p := positions[index]
+		min = geom.Vector3{X: geom.Min(min.X, p[0]), Y: geom.Min(min.Y, p[1]), Z: geom.Min(min.Z, p[2])}
+		max = geom.Vector3{X: geom.Max(max.X, p[0]), Y: geom.Max(max.Y, p[1]), Z: geom.Max(max.Z, p[2])}
+	}
+	return AABB{Center: *min.Add(&max).Scale(0.5), Extent: *max.Sub(&min).Scale(0.5)}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Format 0,1,2 are compatible with Unity 2018 or earlier. (float, half, byte)
+func vertexFormatSize(format int) int {
+	switch format {
+	case 0, 10, 11:
+		return 4
+	case 1, 4, 5, 8, 9:
+		return 2
+	default:
+		return 1
+	}
+}
+
+func decodeVertexValue(b []byte, format int) float32 {
+	switch format {
+	case 0:
+		return math.Float32frombits(binary.LittleEndian.Uint32(b))
+	case 1:
+		return halfToFloat32(binary.LittleEndian.Uint16(b))
+	case 2:
+		return float32(b[0]) / 255
+	case 3:
+		return float32(math.Max(float64(int8(b[0]))/127, -1))
+	case 4:
+		return float32(binary.LittleEndian.Uint16(b)) / 65535
+	case 5:
+		return float32(math.Max(float64(int16(binary.LittleEndian.Uint16(b)))/32767, -1))
+	case 6:
+		return float32(b[0])
+	case 7:
+		return float32(int8(b[0]))
+	case 8:
+		return float32(binary.LittleEndian.Uint16(b))
+	case 9:
+		return float32(int16(binary.LittleEndian.Uint16(b)))
+	case 10:
+		return float32(binary.LittleEndian.Uint32(b))
+	case 11:
+		return float32(int32(binary.LittleEndian.Uint32(b)))
+	}
+	return 0
+}
+
+func halfToFloat32(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	frac := uint32(h & 0x3ff)
+	switch {
+	case exp == 0 && frac == 0:
+		return math.Float32frombits(sign)
+	case exp == 0:
+		// subnormal
+		v := float32(frac) / 1024 / 16384
+		if sign != 0 {
+			return -v
+		}
+		return v
+	case exp == 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | frac<<13)
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | frac<<13)
+}
+
+// LoadMesh loads Mesh from *.asset file.
+func LoadMesh(assets Assets, ref *Ref) (*Mesh, error) {
+	asset := assets.GetAsset(ref.GUID)
+	if asset == nil {
+		return nil, fmt.Errorf("Mesh not found: %s", ref.GUID)
+	}
+	r, err := assets.Open(asset.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range ParseYamlDocuments(b) {
+		if doc.Tag != "tag:unity3d.com,2011:43" || doc.refID != strconv.FormatInt(ref.FileID, 10) {
+			continue
+		}
+		var mesh struct {
+			Mesh Mesh `yaml:"Mesh"`
+		}
+		err = doc.Decode(&mesh)
+		if err != nil {
+			return nil, err
+		}
+		return &mesh.Mesh, nil
+	}
+	return nil, fmt.Errorf("Mesh not found: %s", asset.Path)
+}
@@ -0,0 +1,129 @@
+package unity
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+func TestDecodeMesh(t *testing.T) {
+	var vb bytes.Buffer
+	positions := [][3]float32{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}}
+	for i, p := range positions {
+		binary.Write(&vb, binary.LittleEndian, p)
+		binary.Write(&vb, binary.LittleEndian, [2]float32{p[0], p[1]})
+		binary.Write(&vb, binary.LittleEndian, [4]uint8{255, 0, 0, uint8(i)})
+	}
+	var ib bytes.Buffer
+	binary.Write(&ib, binary.LittleEndian, []uint16{0, 1, 2, 0, 2, 3})
+
+	yaml := fmt.Sprintf(`%%YAML 1.1
+%%TAG !u! tag:unity3d.com,2011:
+--- !u!43 &4300000
+Mesh:
+  m_Name: quad
+  m_SubMeshes:
+  - serializedVersion: 2
+    firstByte: 0
+    indexCount: 6
+    topology: 0
+    baseVertex: 0
+  m_Shapes:
+    vertices:
+    - vertex: {x: 0, y: 0, z: 1}
+      normal: {x: 0, y: 0, z: 0}
+      tangent: {x: 0, y: 0, z: 0}
+      index: 2
+    shapes:
+    - firstVertex: 0
+      vertexCount: 1
+      hasNormals: 0
+      hasTangents: 0
+    channels:
+    - name: Push
+      nameHash: 0
+      frameIndex: 0
+      frameCount: 1
+    fullWeights: 64000000
+  m_IndexFormat: 0
+  m_IndexBuffer: %s
+  m_VertexData:
+    serializedVersion: 3
+    m_VertexCount: 4
+    m_Channels:
+    - stream: 0
+      offset: 0
+      format: 0
+      dimension: 3
+    - stream: 0
+      offset: 0
+      format: 0
+      dimension: 0
+    - stream: 0
+      offset: 0
+      format: 0
+      dimension: 0
+    - stream: 0
+      offset: 20
+      format: 2
+      dimension: 4
+    - stream: 0
+      offset: 12
+      format: 0
+      dimension: 2
+    m_DataSize: %d
+    _typelessdata: %s
+`, hex.EncodeToString(ib.Bytes()), vb.Len(), hex.EncodeToString(vb.Bytes()))
+
+	docs := ParseYamlDocuments([]byte(yaml))
+	if len(docs) != 1 {
+		t.Fatal("invalid yaml", len(docs))
+	}
+	var d struct {
+		Mesh *Mesh `yaml:"Mesh"`
+	}
+	if err := docs[0].Decode(&d); err != nil {
+		t.Fatal(err)
+	}
+	mesh := d.Mesh
+
+	indices, err := mesh.GetIndices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	faces := mesh.GetSubMeshFaces(indices, 0)
+	if len(faces) != 2 || faces[1][2] != 3 {
+		t.Error("invalid faces", faces)
+	}
+
+	pos, err := mesh.GetVertexAttribute(VertexChannelPosition)
+	if err != nil || len(pos) != 4 || pos[2][0] != 1 || pos[2][1] != 1 {
+		t.Error("invalid positions", pos, err)
+	}
+	uv, _ := mesh.GetVertexAttribute(VertexChannelTexCoord0)
+	if len(uv) != 4 || uv[3][1] != 1 {
+		t.Error("invalid uvs", uv)
+	}
+	col, _ := mesh.GetVertexAttribute(VertexChannelColor)
+	if len(col) != 4 || col[0][0] != 1 || col[3][3] != 3.0/255 {
+		t.Error("invalid colors", col)
+	}
+	if n, _ := mesh.GetVertexAttribute(VertexChannelNormal); n != nil {
+		t.Error("normal should be nil", n)
+	}
+
+	shapes := mesh.GetBlendShapes()
+	if len(shapes) != 1 || shapes[0].Name != "Push" || shapes[0].Indices[0] != 2 || shapes[0].Deltas[0].Z != 1 {
+		t.Error("invalid blend shapes", shapes)
+	}
+}
+
+func TestHalfToFloat32(t *testing.T) {
+	for h, f := range map[uint16]float32{0x3c00: 1, 0xc000: -2, 0x3800: 0.5, 0x0000: 0, 0x0001: 1.0 / (1 << 24)} {
+		if v := halfToFloat32(h); v != f {
+			t.Errorf("halfToFloat32(%x) = %v, expected %v", h, v, f)
+		}
+	}
+}
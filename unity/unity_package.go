@@ -0,0 +1,257 @@
+package unity
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Assets larger than this are not kept in memory. They are extracted to the temp dir when they are opened.
+const packageMemoryThreshold = 1 << 20
+
+type packageEntry struct {
+	info     fs.FileInfo
+	data     []byte // nil if the entry is large
+	offset   int64  // offset of the content in the tar stream
+	tempPath string // extracted file. empty until the entry is opened
+}
+
+// packageStream reads .unitypackage (tar.gz) without extracting all files.
+type packageStream struct {
+	assets
+	PackagePath string
+
+	entries map[string]*packageEntry // guid/asset, guid/asset.meta
+	tempDir string
+	lock    sync.Mutex
+	stream  *packageReader // reused while the large entries are opened in the order of the package
+}
+
+func (a *packageStream) GetSourcePath() string {
+	return a.PackagePath
+}
+
+func (a *packageStream) Open(path string) (fs.File, error) {
+	asset := a.AssetsByPath[path]
+	if asset == nil {
+		return nil, fs.ErrNotExist
+	}
+	return a.openEntry(asset.GUID + "/asset")
+}
+
+func (a *packageStream) GetMetaFile(asset *Asset) (*MetaFile, error) {
+	r, err := a.openEntry(asset.GUID + "/asset.meta")
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var meta MetaFile
+	err = yaml.NewDecoder(r).Decode(&meta)
+	return &meta, err
+}
+
+func (a *packageStream) Close() error {
+	if a.stream != nil {
+		a.stream.Close()
+		a.stream = nil
+	}
+	if a.tempDir != "" {
+		return os.RemoveAll(a.tempDir)
+	}
+	return nil
+}
+
+func (a *packageStream) openEntry(name string) (fs.File, error) {
+	ent := a.entries[name]
+	if ent == nil {
+		return nil, fs.ErrNotExist
+	}
+	if ent.data != nil {
+		return &memFile{Reader: bytes.NewReader(ent.data), info: ent.info}, nil
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if ent.tempPath == "" {
+		if err := a.extractEntry(name, ent); err != nil {
+			return nil, err
+		}
+	}
+	return os.Open(ent.tempPath)
+}
+
+// extractEntry copies the entry to the temp dir. The package is read from the beginning only if the entry is before the last opened entry.
+func (a *packageStream) extractEntry(name string, ent *packageEntry) error {
+	if a.stream == nil || a.stream.pos > ent.offset {
+		if a.stream != nil {
+			a.stream.Close()
+		}
+		s, err := openPackageReader(a.PackagePath)
+		if err != nil {
+			return err
+		}
+		a.stream = s
+	}
+	if _, err := io.CopyN(ioutil.Discard, a.stream, ent.offset-a.stream.pos); err != nil {
+		a.stream.Close()
+		a.stream = nil
+		return err
+	}
+
+	if a.tempDir == "" {
+		tmpDir, err := ioutil.TempDir("", "modelconv_assets_")
+		if err != nil {
+			return err
+		}
+		a.tempDir = tmpDir
+	}
+	tempPath := filepath.Join(a.tempDir, strings.ReplaceAll(name, "/", "_"))
+	w, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	if _, err = io.CopyN(w, a.stream, ent.info.Size()); err != nil {
+		a.stream.Close()
+		a.stream = nil
+		return err
+	}
+	ent.tempPath = tempPath
+	return nil
+}
+
+// scanPackageStream indexes the package in a single pass. Files up to memoryThreshold bytes are kept in memory.
+// Only the offsets of the larger files are recorded, and they are extracted when they are opened.
+func scanPackageStream(packagePath string, memoryThreshold int64) (*packageStream, error) {
+	pkg := &packageStream{
+		assets: assets{
+			Assets:       map[string]*Asset{},
+			AssetsByPath: map[string]*Asset{},
+		},
+		PackagePath: packagePath,
+		entries:     map[string]*packageEntry{},
+	}
+	pathNames := map[string]string{}
+	err := walkPackage(packagePath, func(name string, header *tar.Header, r io.Reader, offset int64) (bool, error) {
+		guid, file := path.Split(name)
+		guid = strings.TrimSuffix(guid, "/")
+		if guid == "" || strings.Contains(guid, "/") {
+			return true, nil
+		}
+		switch file {
+		case "pathname":
+			b, err := ioutil.ReadAll(r)
+			if err != nil {
+				return false, err
+			}
+			// Some versions of Unity write "00" in the second line.
+			pathNames[guid] = strings.TrimSpace(strings.SplitN(string(b), "\n", 2)[0])
+		case "asset", "asset.meta":
+			ent := &packageEntry{info: header.FileInfo(), offset: offset}
+			if header.Size <= memoryThreshold {
+				b, err := ioutil.ReadAll(r)
+				if err != nil {
+					return false, err
+				}
+				ent.data = b
+			}
+			pkg.entries[name] = ent
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for guid, pathName := range pathNames {
+		asset := &Asset{
+			GUID: guid,
+			Path: pathName,
+		}
+		pkg.Assets[guid] = asset
+		pkg.AssetsByPath[pathName] = asset
+	}
+	return pkg, nil
+}
+
+// packageReader reads the uncompressed tar stream of the package and counts the position.
+type packageReader struct {
+	f   *os.File
+	gz  *gzip.Reader
+	pos int64
+}
+
+func openPackageReader(packagePath string) (*packageReader, error) {
+	f, err := os.Open(packagePath)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &packageReader{f: f, gz: gz}, nil
+}
+
+func (r *packageReader) Read(b []byte) (int, error) {
+	n, err := r.gz.Read(b)
+	r.pos += int64(n)
+	return n, err
+}
+
+func (r *packageReader) Close() error {
+	r.gz.Close()
+	return r.f.Close()
+}
+
+// walkPackage calls f for each regular file in the package until f returns false.
+// offset is the position of the content in the uncompressed tar stream.
+func walkPackage(packagePath string, f func(name string, header *tar.Header, r io.Reader, offset int64) (bool, error)) error {
+	r, err := openPackageReader(packagePath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	// tar.Reader reads the headers without buffering, so the position after Next() is the start of the content.
+	tr := tar.NewReader(r)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if cont, err := f(path.Clean(header.Name), header, tr, r.pos); err != nil || !cont {
+			return err
+		}
+	}
+}
+
+type memFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
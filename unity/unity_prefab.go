@@ -0,0 +1,234 @@
+package unity
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type PrefabInstance struct {
+	Modification struct {
+		Modifications      []*PropertyModification `yaml:"m_Modifications"`
+		TransformParent    *Ref                    `yaml:"m_TransformParent"`
+		RemovedComponents  []*Ref                  `yaml:"m_RemovedComponents"`
+		RemovedGameObjects []*Ref                  `yaml:"m_RemovedGameObjects"`
+	} `yaml:"m_Modification"`
+
+	SourcePrefab *Ref   `yaml:"m_SourcePrefab"`
+	PrefabScene  *Scene `yaml:"-"`
+}
+
+type PropertyModification struct {
+	Target          *Ref        `yaml:"target"`
+	PropertyPath    string      `yaml:"propertyPath"`
+	Value           interface{} `yaml:"value"`
+	ObjectReference *Ref        `yaml:"objectReference"`
+}
+
+// findElement finds the element in the scene or nested prefabs.
+func (s *Scene) findElement(ref *Ref) Element {
+	if !ref.IsValid() {
+		return nil
+	}
+	if ref.GUID == "" || ref.GUID == s.GUID {
+		if e, ok := s.Elements[ref.FileID]; ok {
+			return s.resolveStripped(e)
+		}
+		// Objects in nested prefab: fileID = (prefabInstanceID ^ sourceObjectID) & 0x7fffffffffffffff
+		for id, e := range s.Elements {
+			if prefab, ok := e.(*PrefabInstance); ok && prefab.PrefabScene != nil {
+				for _, fileID := range []int64{ref.FileID ^ id, ref.FileID ^ id ^ math.MinInt64} {
+					if e := prefab.PrefabScene.findElement(&Ref{FileID: fileID}); e != nil {
+						return e
+					}
+				}
+			}
+		}
+		return nil
+	}
+	for _, e := range s.Elements {
+		if prefab, ok := e.(*PrefabInstance); ok && prefab.PrefabScene != nil {
+			if e := prefab.PrefabScene.findElement(ref); e != nil {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// resolveStripped returns the source object of the stripped element.
+func (s *Scene) resolveStripped(e Element) Element {
+	var source, prefabInstance *Ref
+	if o, ok := e.(*GameObject); ok && o.Name == "" && len(o.Components) == 0 {
+		source, prefabInstance = o.CorrespondingSourceObject, o.PrefabInstance
+	} else if c, ok := e.(Component); ok && !c.base().GameObject.IsValid() {
+		source, prefabInstance = c.base().CorrespondingSourceObject, c.base().PrefabInstance
+	}
+	if !source.IsValid() || !prefabInstance.IsValid() {
+		return e
+	}
+	if prefab, ok := s.Elements[prefabInstance.FileID].(*PrefabInstance); ok && prefab.PrefabScene != nil {
+		if src := prefab.PrefabScene.findElement(source); src != nil {
+			return src
+		}
+	}
+	return e
+}
+
+func (s *Scene) applyPrefabModifications(prefab *PrefabInstance) {
+	ps := prefab.PrefabScene
+	for _, mod := range prefab.Modification.Modifications {
+		target := ps.findElement(mod.Target)
+		if target == nil {
+			continue
+		}
+		err := applyModification(reflect.ValueOf(target), strings.Split(mod.PropertyPath, "."), mod)
+		if err != nil {
+			log.Println("WARN: Unsupported prefab modification:", mod.PropertyPath, err)
+		}
+	}
+	for _, ref := range prefab.Modification.RemovedComponents {
+		if c, ok := ps.findElement(ref).(Component); ok {
+			if o := c.GetGameObject(); o != nil {
+				o.removeComponent(c)
+			}
+		}
+	}
+	for _, ref := range prefab.Modification.RemovedGameObjects {
+		if o, ok := ps.findElement(ref).(*GameObject); ok {
+			if tr := o.GetTransform(); tr != nil && tr.GetParent() != nil {
+				tr.GetParent().RemoveChild(tr)
+			}
+		}
+	}
+}
+
+// applyModification sets the value to the field specified by propertyPath. (e.g. m_Materials.Array.data[1])
+func applyModification(v reflect.Value, path []string, mod *PropertyModification) error {
+	if len(path) == 0 && v.Kind() == reflect.Interface && v.CanSet() {
+		if mod.ObjectReference.IsValid() {
+			v.Set(reflect.ValueOf(mod.ObjectReference))
+		} else if mod.Value != nil {
+			v.Set(reflect.ValueOf(mod.Value))
+		}
+		return nil
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			if v.Kind() != reflect.Ptr || !v.CanSet() {
+				return nil
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if len(path) == 0 {
+		return setModificationValue(v, mod)
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if f := findYAMLField(v, path[0]); f.IsValid() {
+			return applyModification(f, path[1:], mod)
+		}
+	case reflect.Slice:
+		if path[0] != "Array" || len(path) < 2 {
+			return nil
+		}
+		if path[1] == "size" {
+			n, err := strconv.Atoi(fmt.Sprint(mod.Value))
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid array size: %v", mod.Value)
+			}
+			resized := reflect.MakeSlice(v.Type(), n, n)
+			reflect.Copy(resized, v)
+			v.Set(resized)
+			return nil
+		}
+		if strings.HasPrefix(path[1], "data[") && strings.HasSuffix(path[1], "]") {
+			idx, err := strconv.Atoi(path[1][5 : len(path[1])-1])
+			if err != nil || idx < 0 {
+				return fmt.Errorf("invalid array index: %s", path[1])
+			}
+			if idx >= v.Len() {
+				v.Set(reflect.AppendSlice(v, reflect.MakeSlice(v.Type(), idx-v.Len()+1, idx-v.Len()+1)))
+			}
+			return applyModification(v.Index(idx), path[2:], mod)
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() == reflect.String && v.Type().Elem().Kind() == reflect.Interface && len(path) == 1 && mod.Value != nil {
+			if v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			v.SetMapIndex(reflect.ValueOf(path[0]), reflect.ValueOf(mod.Value))
+		}
+	}
+	return nil
+}
+
+func findYAMLField(v reflect.Value, name string) reflect.Value {
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := strings.Split(field.Tag.Get("yaml"), ",")
+		if field.Anonymous || len(tag) > 1 && tag[1] == "inline" {
+			if f := v.Field(i); f.Kind() == reflect.Struct {
+				if f := findYAMLField(f, name); f.IsValid() {
+					return f
+				}
+			}
+			continue
+		}
+		if tag[0] == "-" || field.PkgPath != "" {
+			continue
+		}
+		if tag[0] == name || tag[0] == "" && strings.ToLower(field.Name) == name {
+			return v.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+func setModificationValue(v reflect.Value, mod *PropertyModification) error {
+	if v.Type() == reflect.TypeOf(Ref{}) {
+		if mod.ObjectReference != nil {
+			v.Set(reflect.ValueOf(*mod.ObjectReference))
+		} else {
+			v.Set(reflect.ValueOf(Ref{}))
+		}
+		return nil
+	}
+	str := fmt.Sprint(mod.Value)
+	if mod.Value == nil {
+		str = ""
+	}
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(str, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(i)
+	case reflect.Bool:
+		v.SetBool(str != "0" && str != "false" && str != "")
+	case reflect.String:
+		v.SetString(str)
+	default:
+		return fmt.Errorf("unsupported type: %v", v.Type())
+	}
+	return nil
+}
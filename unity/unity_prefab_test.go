@@ -0,0 +1,73 @@
+package unity
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyModification(t *testing.T) {
+	tr := &Transform{}
+	renderer := &MeshRenderer{Materials: []*Ref{{FileID: 1}}}
+	obj := &GameObject{Name: "obj", IsActive: 1}
+
+	mods := []struct {
+		target interface{}
+		mod    *PropertyModification
+	}{
+		{tr, &PropertyModification{PropertyPath: "m_LocalPosition.x", Value: 1.5}},
+		{tr, &PropertyModification{PropertyPath: "m_LocalRotation.w", Value: 1}},
+		{tr, &PropertyModification{PropertyPath: "m_RootOrder", Value: 3}},
+		{tr, &PropertyModification{PropertyPath: "m_GameObject", ObjectReference: &Ref{FileID: 10}}},
+		{renderer, &PropertyModification{PropertyPath: "m_Enabled", Value: 0}},
+		{renderer, &PropertyModification{PropertyPath: "m_Materials.Array.size", Value: 2}},
+		{renderer, &PropertyModification{PropertyPath: "m_Materials.Array.data[1]", ObjectReference: &Ref{FileID: 2, GUID: "abc"}}},
+		{obj, &PropertyModification{PropertyPath: "m_IsActive", Value: 0}},
+		{obj, &PropertyModification{PropertyPath: "m_Name", Value: "renamed"}},
+		{obj, &PropertyModification{PropertyPath: "m_Unknown.x", Value: 0}},
+	}
+	for _, m := range mods {
+		if err := applyModification(reflect.ValueOf(m.target), strings.Split(m.mod.PropertyPath, "."), m.mod); err != nil {
+			t.Error(m.mod.PropertyPath, err)
+		}
+	}
+
+	if tr.LocalPosition.X != 1.5 || tr.LocalRotation.W != 1 || tr.RootOrder != 3 || tr.GameObject.FileID != 10 {
+		t.Error("invalid transform", tr)
+	}
+	if renderer.Enabled != 0 || len(renderer.Materials) != 2 || renderer.Materials[1].GUID != "abc" {
+		t.Error("invalid renderer", renderer)
+	}
+	if obj.IsActive != 0 || obj.Name != "renamed" {
+		t.Error("invalid object", obj)
+	}
+}
+
+func TestFindElement(t *testing.T) {
+	nested := NewScene(nil, "nested")
+	nestedObj := &GameObject{Name: "nested"}
+	nested.Elements[100] = nestedObj
+
+	prefab := NewScene(nil, "prefab")
+	prefab.Elements[5] = &PrefabInstance{PrefabScene: nested}
+	prefab.Elements[7] = &GameObject{
+		CorrespondingSourceObject: &Ref{FileID: 100, GUID: "nested"},
+		PrefabInstance:            &Ref{FileID: 5},
+	}
+
+	// stripped
+	if prefab.findElement(&Ref{FileID: 7}) != nestedObj {
+		t.Error("stripped object is not resolved")
+	}
+	// guid of nested prefab
+	if prefab.findElement(&Ref{FileID: 100, GUID: "nested"}) != nestedObj {
+		t.Error("nested object is not found")
+	}
+	// implicit object of nested prefab instance
+	if prefab.findElement(&Ref{FileID: 100 ^ 5, GUID: "prefab"}) != nestedObj {
+		t.Error("nested object is not found by fileID")
+	}
+	if prefab.findElement(&Ref{FileID: 1234}) != nil {
+		t.Error("unexpected element")
+	}
+}
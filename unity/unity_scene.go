@@ -58,6 +58,7 @@ func LoadSceneAsset(assets Assets, sceneAsset *Asset) (*Scene, error) {
 	var objects []*GameObject
 
 	addedChildren := map[Ref][]*Transform{}
+	var sceneComponents []Component
 
 	for _, doc := range ParseYamlDocuments(b) {
 		var element Element
@@ -101,7 +102,7 @@ func LoadSceneAsset(assets Assets, sceneAsset *Asset) (*Scene, error) {
 			if len(s.Objects) > 0 {
 				root := s.Objects[0]
 				tr := root.GetTransform()
-				if tr != nil {
+				if tr != nil && prefab.Modification.TransformParent != nil {
 					tr.Father = *prefab.Modification.TransformParent
 					tr.Father.GUID = scene.GUID
 					for _, c := range root.Components {
@@ -112,78 +113,15 @@ func LoadSceneAsset(assets Assets, sceneAsset *Asset) (*Scene, error) {
 				}
 				objects = append(objects, root)
 			}
-			for _, mod := range prefab.Modification.Modifications {
-				target := s.GetElement(mod.Target)
-				if target == nil {
-					continue
-				}
-				var flaotValue float32
-				if v, ok := mod.Value.(float32); ok {
-					flaotValue = v
-				} else if v, ok := mod.Value.(float64); ok {
-					flaotValue = float32(v)
-				} else if v, ok := mod.Value.(int64); ok {
-					flaotValue = float32(v)
-				} else if v, ok := mod.Value.(int); ok {
-					flaotValue = float32(v)
-				}
-				prop := strings.Split(mod.PropertyPath, ".")
-				typ := reflect.TypeOf(target).Elem()
-				if typ.Kind() != reflect.Struct {
-					continue
-				}
-				for i := 0; i < typ.NumField(); i++ {
-					if y := typ.Field(i).Tag.Get("yaml"); y != "" {
-						if (strings.Split(y, ",")[0]) == prop[0] {
-							field := reflect.ValueOf(target).Elem().Field(i).Addr().Interface()
-							if len(prop) == 3 && prop[1] == "Array" && strings.HasPrefix(prop[2], "data[") {
-								if idx, err := strconv.ParseInt(prop[2][5:len(prop[2])-1], 10, 32); err == nil && int(idx) < reflect.ValueOf(target).Elem().Field(i).Len() {
-									field = reflect.ValueOf(target).Elem().Field(i).Index(int(idx)).Addr().Interface()
-								}
-							}
-							if v, ok := field.(*float32); ok {
-								*v = flaotValue
-							} else if v, ok := field.(*int); ok {
-								*v = int(flaotValue)
-							} else if v, ok := field.(**Ref); ok {
-								*v = mod.ObjectReference
-							} else if v, ok := field.(*string); ok {
-								*v, _ = mod.Value.(string)
-							} else if v, ok := field.(*Vector3); ok && len(prop) == 2 {
-								if prop[1] == "x" {
-									v.X = flaotValue
-								} else if prop[1] == "y" {
-									v.Y = flaotValue
-								} else if prop[1] == "z" {
-									v.Z = flaotValue
-								}
-							} else if v, ok := field.(*Vector4); ok && len(prop) == 2 {
-								if prop[1] == "x" {
-									v.X = flaotValue
-								} else if prop[1] == "y" {
-									v.Y = flaotValue
-								} else if prop[1] == "z" {
-									v.Z = flaotValue
-								} else if prop[1] == "w" {
-									v.W = flaotValue
-								}
-							} else if v, ok := field.(*Color); ok && len(prop) == 2 {
-								if prop[1] == "r" {
-									v.R = flaotValue
-								} else if prop[1] == "g" {
-									v.G = flaotValue
-								} else if prop[1] == "b" {
-									v.B = flaotValue
-								} else if prop[1] == "a" {
-									v.A = flaotValue
-								}
-							} else {
-								log.Println("WARN: Unsupported prefab modification:", mod)
-							}
-							break
-						}
-					}
-				}
+			scene.applyPrefabModifications(prefab)
+		} else if doc.Tag == "tag:unity3d.com,2011:43" {
+			// Embedded mesh (ProBuilder, etc.)
+			var m struct {
+				Mesh *Mesh `yaml:"Mesh"`
+			}
+			err = doc.Decode(&m)
+			if m.Mesh != nil {
+				element = m.Mesh
 			}
 		} else {
 			if fieldid, ok := componentTags[doc.Tag]; ok {
@@ -200,6 +138,9 @@ func LoadSceneAsset(assets Assets, sceneAsset *Asset) (*Scene, error) {
 		}
 		if element != nil && err == nil {
 			scene.Elements[fileId] = element
+			if c, ok := element.(Component); ok {
+				sceneComponents = append(sceneComponents, c)
+			}
 		}
 		// log.Println("obj", a, err)
 	}
@@ -212,6 +153,22 @@ func LoadSceneAsset(assets Assets, sceneAsset *Asset) (*Scene, error) {
 		}
 	}
 
+	// GameObjects and components added to prefab instances.
+	for _, c := range sceneComponents {
+		if o, ok := scene.Elements[c.base().GameObject.FileID].(*GameObject); ok {
+			if src, ok := scene.resolveStripped(o).(*GameObject); ok && src != o {
+				src.addedComponents = append(src.addedComponents, c)
+			}
+		}
+		if tr, ok := c.(*Transform); ok && tr.GameObject.IsValid() && tr.Father.IsValid() {
+			if parent, ok := scene.Elements[tr.Father.FileID].(*Transform); ok {
+				if src, ok := scene.resolveStripped(parent).(*Transform); ok && src != parent {
+					src.AddChild(tr)
+				}
+			}
+		}
+	}
+
 	for pref, children := range addedChildren {
 		parent := scene.GetTransform(&pref, nil)
 		if parent == nil {
@@ -0,0 +1,361 @@
+package unity
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/binzume/modelconv/geom"
+)
+
+type Terrain struct {
+	BaseComponent `yaml:",inline"`
+	Enabled       int `yaml:"m_Enabled"`
+
+	TerrainData         *Ref `yaml:"m_TerrainData"`
+	MaterialTemplate    *Ref `yaml:"m_MaterialTemplate"`
+	DrawHeightmap       int  `yaml:"m_DrawHeightmap"`
+	DrawTreesAndFoliage int  `yaml:"m_DrawTreesAndFoliage"`
+}
+
+type TerrainData struct {
+	Name string `yaml:"m_Name"`
+
+	SplatDatabase struct {
+		TerrainLayers      []*Ref            `yaml:"m_TerrainLayers"`
+		Splats             []*SplatPrototype `yaml:"m_Splats"` // Unity 2018.2 or older
+		AlphaTextures      []*Ref            `yaml:"m_AlphaTextures"`
+		AlphamapResolution int               `yaml:"m_AlphamapResolution"`
+		BaseMapResolution  int               `yaml:"m_BaseMapResolution"`
+	} `yaml:"m_SplatDatabase"`
+
+	DetailDatabase struct {
+		DetailPrototypes []*DetailPrototype `yaml:"m_DetailPrototypes"`
+		TreeInstances    []*TreeInstance    `yaml:"m_TreeInstances"`
+		TreePrototypes   []*TreePrototype   `yaml:"m_TreePrototypes"`
+		Patches          []*DetailPatch     `yaml:"m_Patches"`
+		PatchCount       int                `yaml:"m_PatchCount"`
+		PatchSamples     int                `yaml:"m_PatchSamples"`
+	} `yaml:"m_DetailDatabase"`
+
+	Heightmap struct {
+		Heights    interface{}  `yaml:"m_Heights"`
+		Resolution int          `yaml:"m_Resolution"`
+		Width      int          `yaml:"m_Width"` // Unity 2019.2 or older
+		Scale      geom.Vector3 `yaml:"m_Scale"`
+	} `yaml:"m_Heightmap"`
+
+	// Embedded Texture2D
+	textures map[int64]*Texture2D
+}
+
+type SplatPrototype struct {
+	Texture    *Ref         `yaml:"texture"`
+	NormalMap  *Ref         `yaml:"normalMap"`
+	TileSize   geom.Vector2 `yaml:"tileSize"`
+	TileOffset geom.Vector2 `yaml:"tileOffset"`
+}
+
+type TerrainLayer struct {
+	Name             string       `yaml:"m_Name"`
+	DiffuseTexture   *Ref         `yaml:"m_DiffuseTexture"`
+	NormalMapTexture *Ref         `yaml:"m_NormalMapTexture"`
+	MaskMapTexture   *Ref         `yaml:"m_MaskMapTexture"`
+	TileSize         geom.Vector2 `yaml:"m_TileSize"`
+	TileOffset       geom.Vector2 `yaml:"m_TileOffset"`
+	NormalScale      float32      `yaml:"m_NormalScale"`
+	Metallic         float32      `yaml:"m_Metallic"`
+	Smoothness       float32      `yaml:"m_Smoothness"`
+}
+
+type DetailPrototype struct {
+	Prototype        *Ref    `yaml:"prototype"`
+	PrototypeTexture *Ref    `yaml:"prototypeTexture"`
+	MinWidth         float32 `yaml:"minWidth"`
+	MaxWidth         float32 `yaml:"maxWidth"`
+	MinHeight        float32 `yaml:"minHeight"`
+	MaxHeight        float32 `yaml:"maxHeight"`
+	UsePrototypeMesh int     `yaml:"usePrototypeMesh"`
+}
+
+// DetailPatch has the number of the detail objects of PatchSamples x PatchSamples cells for each layer.
+type DetailPatch struct {
+	LayerIndices    ByteArray `yaml:"layerIndices"`
+	NumberOfObjects ByteArray `yaml:"numberOfObjects"` // layer * samples * samples + z * samples + x
+}
+
+// ByteArray is a byte array serialized as a hex string.
+type ByteArray []byte
+
+func (b *ByteArray) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		data, err := hex.DecodeString(s)
+		*b = data
+		return err
+	}
+	var values []byte
+	err := unmarshal(&values)
+	*b = values
+	return err
+}
+
+type TreePrototype struct {
+	Prefab     *Ref    `yaml:"prefab"`
+	BendFactor float32 `yaml:"bendFactor"`
+}
+
+type TreeInstance struct {
+	Position    geom.Vector3 `yaml:"position"` // normalized (0.0 - 1.0)
+	WidthScale  float32      `yaml:"widthScale"`
+	HeightScale float32      `yaml:"heightScale"`
+	Rotation    float32      `yaml:"rotation"` // radians
+	Index       int          `yaml:"index"`
+}
+
+// Texture2D embedded in the asset file. (e.g. alphamaps of the terrain)
+type Texture2D struct {
+	Name          string `yaml:"m_Name"`
+	Width         int    `yaml:"m_Width"`
+	Height        int    `yaml:"m_Height"`
+	TextureFormat int    `yaml:"m_TextureFormat"`
+	ImageData     string `yaml:"_typelessdata"`
+}
+
+// Texture formats
+const (
+	TextureFormatAlpha8 = 1
+	TextureFormatRGB24  = 3
+	TextureFormatRGBA32 = 4
+	TextureFormatARGB32 = 5
+	TextureFormatBGRA32 = 14
+	TextureFormatR8     = 63
+)
+
+// heightmap value for 1.0
+const terrainMaxHeight = 32766
+
+func (t *TerrainData) GetResolution() int {
+	if t.Heightmap.Resolution > 0 {
+		return t.Heightmap.Resolution
+	}
+	return t.Heightmap.Width
+}
+
+// GetSize returns the size of the terrain.
+func (t *TerrainData) GetSize() *geom.Vector3 {
+	return t.Heightmap.Scale.Scale(float32(t.GetResolution() - 1))
+}
+
+// GetHeights returns normalized heights. (z * resolution + x)
+func (t *TerrainData) GetHeights() ([]float32, error) {
+	n := t.GetResolution() * t.GetResolution()
+	var raw []int
+	switch v := t.Heightmap.Heights.(type) {
+	case string:
+		b, err := hex.DecodeString(v)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i+1 < len(b); i += 2 {
+			raw = append(raw, int(int16(binary.LittleEndian.Uint16(b[i:]))))
+		}
+	case []interface{}:
+		for _, h := range v {
+			i, _ := strconv.Atoi(fmt.Sprint(h))
+			raw = append(raw, i)
+		}
+	}
+	if len(raw) < n {
+		return nil, fmt.Errorf("invalid heightmap size: %d < %d", len(raw), n)
+	}
+	heights := make([]float32, n)
+	for i := range heights {
+		heights[i] = float32(raw[i]) / terrainMaxHeight
+	}
+	return heights, nil
+}
+
+// GetDetailCounts returns the number of the detail objects of the prototype in each cell (z * resolution + x) and the resolution.
+func (t *TerrainData) GetDetailCounts(prototype int) ([]int, int, error) {
+	db := &t.DetailDatabase
+	samples := db.PatchSamples
+	res := db.PatchCount * samples
+	counts := make([]int, res*res)
+	for i, patch := range db.Patches {
+		if i >= db.PatchCount*db.PatchCount {
+			break
+		}
+		layers, objects := patch.LayerIndices, patch.NumberOfObjects
+		if len(objects) < len(layers)*samples*samples {
+			return nil, 0, fmt.Errorf("invalid detail patch size: %d", len(objects))
+		}
+		px, pz := i%db.PatchCount, i/db.PatchCount
+		for l, index := range layers {
+			if int(index) != prototype {
+				continue
+			}
+			for z := 0; z < samples; z++ {
+				for x := 0; x < samples; x++ {
+					counts[(pz*samples+z)*res+px*samples+x] = int(objects[(l*samples+z)*samples+x])
+				}
+			}
+		}
+	}
+	return counts, res, nil
+}
+
+// GetAlphamaps returns splat alphamaps. Each channel (RGBA) of the alphamaps is a weight of the layer.
+func (t *TerrainData) GetAlphamaps() ([]*image.NRGBA, error) {
+	var images []*image.NRGBA
+	for _, ref := range t.SplatDatabase.AlphaTextures {
+		tex := t.textures[ref.FileID]
+		if tex == nil {
+			return nil, fmt.Errorf("alphamap not found: %v", ref.FileID)
+		}
+		img, err := tex.Decode()
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// GetLayers returns terrain layers or splat prototypes as terrain layers.
+func (t *TerrainData) GetLayers(assets Assets) []*TerrainLayer {
+	var layers []*TerrainLayer
+	for _, ref := range t.SplatDatabase.TerrainLayers {
+		layer, err := LoadTerrainLayer(assets, ref)
+		if err != nil {
+			layer = &TerrainLayer{TileSize: geom.Vector2{X: 1, Y: 1}}
+		}
+		layers = append(layers, layer)
+	}
+	for _, splat := range t.SplatDatabase.Splats {
+		layers = append(layers, &TerrainLayer{
+			DiffuseTexture:   splat.Texture,
+			NormalMapTexture: splat.NormalMap,
+			TileSize:         splat.TileSize,
+			TileOffset:       splat.TileOffset,
+			NormalScale:      1,
+		})
+	}
+	return layers
+}
+
+// Decode returns the image. The first row of the image is top.
+func (t *Texture2D) Decode() (*image.NRGBA, error) {
+	data, err := hex.DecodeString(t.ImageData)
+	if err != nil {
+		return nil, err
+	}
+	bpp := map[int]int{TextureFormatAlpha8: 1, TextureFormatR8: 1, TextureFormatRGB24: 3, TextureFormatRGBA32: 4, TextureFormatARGB32: 4, TextureFormatBGRA32: 4}[t.TextureFormat]
+	if bpp == 0 {
+		return nil, fmt.Errorf("unsupported texture format: %d", t.TextureFormat)
+	}
+	if len(data) < t.Width*t.Height*bpp {
+		return nil, fmt.Errorf("invalid texture size: %s", t.Name)
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, t.Width, t.Height))
+	for y := 0; y < t.Height; y++ {
+		for x := 0; x < t.Width; x++ {
+			p := data[(y*t.Width+x)*bpp:]
+			var c color.NRGBA
+			switch t.TextureFormat {
+			case TextureFormatAlpha8:
+				c = color.NRGBA{255, 255, 255, p[0]}
+			case TextureFormatR8:
+				c = color.NRGBA{p[0], 0, 0, 255}
+			case TextureFormatRGB24:
+				c = color.NRGBA{p[0], p[1], p[2], 255}
+			case TextureFormatRGBA32:
+				c = color.NRGBA{p[0], p[1], p[2], p[3]}
+			case TextureFormatARGB32:
+				c = color.NRGBA{p[1], p[2], p[3], p[0]}
+			case TextureFormatBGRA32:
+				c = color.NRGBA{p[2], p[1], p[0], p[3]}
+			}
+			// Unity: bottom-up
+			img.SetNRGBA(x, t.Height-1-y, c)
+		}
+	}
+	return img, nil
+}
+
+func LoadTerrainData(assets Assets, ref *Ref) (*TerrainData, error) {
+	asset := assets.GetAsset(ref.GUID)
+	if asset == nil {
+		return nil, fmt.Errorf("TerrainData not found: %s", ref.GUID)
+	}
+	r, err := assets.Open(asset.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var terrainData *TerrainData
+	textures := map[int64]*Texture2D{}
+	for _, doc := range ParseYamlDocuments(b) {
+		switch doc.Tag {
+		case "tag:unity3d.com,2011:156":
+			if doc.refID != strconv.FormatInt(ref.FileID, 10) {
+				continue
+			}
+			var d struct {
+				TerrainData TerrainData `yaml:"TerrainData"`
+			}
+			if err := doc.Decode(&d); err != nil {
+				return nil, err
+			}
+			terrainData = &d.TerrainData
+		case "tag:unity3d.com,2011:28":
+			var d struct {
+				Texture2D Texture2D `yaml:"Texture2D"`
+			}
+			if err := doc.Decode(&d); err == nil {
+				fileID, _ := strconv.ParseInt(doc.refID, 10, 64)
+				textures[fileID] = &d.Texture2D
+			}
+		}
+	}
+	if terrainData == nil {
+		return nil, fmt.Errorf("TerrainData not found: %s", asset.Path)
+	}
+	terrainData.textures = textures
+	return terrainData, nil
+}
+
+func LoadTerrainLayer(assets Assets, ref *Ref) (*TerrainLayer, error) {
+	asset := assets.GetAsset(ref.GUID)
+	if asset == nil {
+		return nil, fmt.Errorf("TerrainLayer not found: %s", ref.GUID)
+	}
+	r, err := assets.Open(asset.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range ParseYamlDocuments(b) {
+		var d struct {
+			TerrainLayer *TerrainLayer `yaml:"TerrainLayer"`
+		}
+		if err := doc.Decode(&d); err == nil && d.TerrainLayer != nil {
+			return d.TerrainLayer, nil
+		}
+	}
+	return nil, fmt.Errorf("TerrainLayer not found: %s", asset.Path)
+}
@@ -0,0 +1,106 @@
+package unity
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestDecodeTerrainData(t *testing.T) {
+	yaml := `%YAML 1.1
+%TAG !u! tag:unity3d.com,2011:
+--- !u!156 &15600000
+TerrainData:
+  m_Name: Terrain
+  m_SplatDatabase:
+    m_TerrainLayers: []
+    m_AlphaTextures:
+    - {fileID: 2800000}
+    m_AlphamapResolution: 2
+    m_BaseMapResolution: 16
+  m_DetailDatabase:
+    m_DetailPrototypes: []
+    m_TreeInstances:
+    - position: {x: 0.5, y: 0.25, z: 1}
+      widthScale: 1.5
+      heightScale: 2
+      rotation: 1.57
+      index: 0
+    m_TreePrototypes:
+    - prefab: {fileID: 100000, guid: 0123456789abcdef0123456789abcdef, type: 3}
+      bendFactor: 0
+    m_Patches:
+    - layerIndices: 0001
+      numberOfObjects: 0100000201010101
+    - layerIndices: [1]
+      numberOfObjects: [3, 0, 0, 0]
+    - layerIndices:
+      numberOfObjects:
+    - layerIndices:
+      numberOfObjects:
+    m_PatchCount: 2
+    m_PatchSamples: 2
+  m_Heightmap:
+    m_Heights: 0000ff3f00000000fe7f0000000000000000
+    m_Resolution: 3
+    m_Scale: {x: 5, y: 100, z: 10}
+--- !u!28 &2800000
+Texture2D:
+  m_Name: SplatAlpha 0
+  m_Width: 2
+  m_Height: 2
+  m_TextureFormat: 4
+  _typelessdata: ff000000ff00000000ff000000ff0000
+`
+	docs := ParseYamlDocuments([]byte(yaml))
+	if len(docs) != 2 {
+		t.Fatal("invalid yaml", len(docs))
+	}
+	var d struct {
+		TerrainData *TerrainData `yaml:"TerrainData"`
+	}
+	if err := docs[0].Decode(&d); err != nil {
+		t.Fatal(err)
+	}
+	data := d.TerrainData
+	if size := data.GetSize(); size.X != 10 || size.Y != 200 || size.Z != 20 {
+		t.Error("invalid size", size)
+	}
+	heights, err := data.GetHeights()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(heights) != 9 || heights[1] < 0.49 || heights[1] > 0.51 || heights[4] != 1 {
+		t.Error("invalid heights", heights)
+	}
+	trees := data.DetailDatabase.TreeInstances
+	if len(trees) != 1 || trees[0].Position.Y != 0.25 || trees[0].HeightScale != 2 || !data.DetailDatabase.TreePrototypes[0].Prefab.IsValid() {
+		t.Error("invalid trees", trees)
+	}
+
+	counts, res, err := data.GetDetailCounts(0)
+	if err != nil || res != 4 || counts[0] != 1 || counts[1*4+1] != 2 || counts[2] != 0 {
+		t.Error("invalid detail counts", counts, res, err)
+	}
+	counts, _, err = data.GetDetailCounts(1)
+	if err != nil || counts[0] != 1 || counts[1*4+1] != 1 || counts[2] != 3 || counts[3] != 0 || counts[2*4] != 0 {
+		t.Error("invalid detail counts", counts, err)
+	}
+
+	var tex struct {
+		Texture2D *Texture2D `yaml:"Texture2D"`
+	}
+	if err := docs[1].Decode(&tex); err != nil {
+		t.Fatal(err)
+	}
+	img, err := tex.Texture2D.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Unity: bottom-up
+	if c := img.At(0, 0).(color.NRGBA); c.G != 255 || c.R != 0 {
+		t.Error("invalid pixel", c)
+	}
+	if c := img.At(1, 1).(color.NRGBA); c.R != 255 {
+		t.Error("invalid pixel", c)
+	}
+}
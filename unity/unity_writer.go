@@ -0,0 +1,206 @@
+package unity
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const yamlHeader = "%YAML 1.1\n%TAG !u! tag:unity3d.com,2011:\n"
+
+// Main object file IDs of the native assets. (classID * 100000)
+const (
+	MeshFileID     = 4300000
+	MaterialFileID = 2100000
+	TextureFileID  = 2800000
+)
+
+// yaml.v2 quotes keys which are booleans in YAML 1.1. ("y", "n")
+var quotedKeyPattern = regexp.MustCompile(`(?m)^(\s*-?\s*)"(y|n)":`)
+
+// NewGUID generates a GUID from the seed. Same seed returns same GUID.
+func NewGUID(seed string) string {
+	h := md5.Sum([]byte(seed))
+	return hex.EncodeToString(h[:])
+}
+
+// classOf returns the YAML name and the class ID of the element.
+func classOf(element Element) (string, int, error) {
+	switch element.(type) {
+	case *GameObject:
+		return "GameObject", 1, nil
+	case *Material:
+		return "Material", 21, nil
+	case *Mesh:
+		return "Mesh", 43, nil
+	}
+	typ := reflect.TypeOf(componentDesc{})
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.Type == reflect.TypeOf(element) {
+			id, err := strconv.Atoi(strings.TrimPrefix(f.Tag.Get("typeid"), "unity3d.com,2011:"))
+			return f.Tag.Get("yaml"), id, err
+		}
+	}
+	return "", 0, fmt.Errorf("unknown element type: %T", element)
+}
+
+// NewYAMLDoc encodes the element. The element must be *GameObject, *Material, *Mesh or a component.
+func NewYAMLDoc(fileID int64, element Element) (*YAMLDoc, error) {
+	name, classID, err := classOf(element)
+	if err != nil {
+		return nil, err
+	}
+	b, err := yaml.Marshal(map[string]interface{}{name: element})
+	if err != nil {
+		return nil, err
+	}
+	return &YAMLDoc{
+		Tag:   "tag:unity3d.com,2011:" + strconv.Itoa(classID),
+		refID: strconv.FormatInt(fileID, 10),
+		Body:  quotedKeyPattern.ReplaceAll(b, []byte("$1$2:")),
+	}, nil
+}
+
+// WriteYamlDocuments writes the documents as an Unity YAML file.
+func WriteYamlDocuments(w io.Writer, docs []*YAMLDoc) error {
+	if _, err := io.WriteString(w, yamlHeader); err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		tag := "!u!" + strings.TrimPrefix(doc.Tag, "tag:unity3d.com,2011:")
+		if _, err := fmt.Fprintf(w, "--- %s &%s\n", tag, doc.refID); err != nil {
+			return err
+		}
+		if _, err := w.Write(doc.Body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewMetaFile returns the meta file for the importer. e.g. NativeFormatImporter, TextureImporter, PrefabImporter
+func NewMetaFile(guid, importer string, params map[string]interface{}) *MetaFile {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	params["userData"] = ""
+	params["assetBundleName"] = ""
+	params["assetBundleVariant"] = ""
+	meta := &MetaFile{FileFormatVersion: 2, GUID: guid}
+	switch importer {
+	case "NativeFormatImporter":
+		meta.NativeFormatImporter = params
+	case "TextureImporter":
+		meta.TextureImporter = params
+	default:
+		meta.RawData = map[string]interface{}{importer: params}
+	}
+	return meta
+}
+
+// AssetsWriter writes assets to .unitypackage or Assets dir.
+type AssetsWriter interface {
+	WriteAsset(assetPath string, meta *MetaFile, data []byte) error
+	Close() error
+}
+
+type packageWriter struct {
+	w   io.WriteCloser
+	gzw *gzip.Writer
+	tw  *tar.Writer
+}
+
+// NewPackageWriter returns the writer of .unitypackage (tar.gz).
+func NewPackageWriter(w io.WriteCloser) AssetsWriter {
+	gzw := gzip.NewWriter(w)
+	return &packageWriter{w: w, gzw: gzw, tw: tar.NewWriter(gzw)}
+}
+
+// CreatePackage creates .unitypackage file.
+func CreatePackage(packagePath string) (AssetsWriter, error) {
+	f, err := os.Create(packagePath)
+	if err != nil {
+		return nil, err
+	}
+	return NewPackageWriter(f), nil
+}
+
+func (p *packageWriter) writeFile(name string, data []byte) error {
+	err := p.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(data)),
+		Mode:     0644,
+		ModTime:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = p.tw.Write(data)
+	return err
+}
+
+func (p *packageWriter) WriteAsset(assetPath string, meta *MetaFile, data []byte) error {
+	metaData, err := yaml.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := p.writeFile(meta.GUID+"/pathname", []byte(assetPath)); err != nil {
+		return err
+	}
+	if err := p.writeFile(meta.GUID+"/asset.meta", metaData); err != nil {
+		return err
+	}
+	return p.writeFile(meta.GUID+"/asset", data)
+}
+
+func (p *packageWriter) Close() error {
+	if err := p.tw.Close(); err != nil {
+		return err
+	}
+	if err := p.gzw.Close(); err != nil {
+		return err
+	}
+	return p.w.Close()
+}
+
+type assetsDirWriter struct {
+	projectDir string
+}
+
+// NewAssetsDirWriter returns the writer to the project dir. Asset paths are relative to the project dir. (Assets/...)
+func NewAssetsDirWriter(projectDir string) AssetsWriter {
+	return &assetsDirWriter{projectDir: projectDir}
+}
+
+func (a *assetsDirWriter) WriteAsset(assetPath string, meta *MetaFile, data []byte) error {
+	metaData, err := yaml.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(a.projectDir, filepath.FromSlash(assetPath))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".meta", metaData, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (a *assetsDirWriter) Close() error {
+	return nil
+}
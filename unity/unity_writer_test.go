@@ -0,0 +1,105 @@
+package unity
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteMesh(t *testing.T) {
+	positions := [][]float32{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}}
+	uvs := [][]float32{{0, 0}, {1, 0}, {1, 1}, {0, 1}}
+	mesh := NewMesh("quad", map[int][][]float32{
+		VertexChannelPosition:  positions,
+		VertexChannelTexCoord0: uvs,
+	}, [][]int{{0, 1, 2}, {0, 2, 3}})
+	mesh.AddBlendShape("Push", []int{2}, []*Vector3{{Z: 1}})
+
+	doc, err := NewYAMLDoc(MeshFileID, mesh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := WriteYamlDocuments(&b, []*YAMLDoc{doc}); err != nil {
+		t.Fatal(err)
+	}
+
+	docs := ParseYamlDocuments(b.Bytes())
+	if len(docs) != 1 || docs[0].Tag != "tag:unity3d.com,2011:43" {
+		t.Fatal("invalid yaml", b.String())
+	}
+	var d struct {
+		Mesh *Mesh `yaml:"Mesh"`
+	}
+	if err := docs[0].Decode(&d); err != nil {
+		t.Fatal(err)
+	}
+
+	indices, err := d.Mesh.GetIndices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if faces := d.Mesh.GetSubMeshFaces(indices, 1); len(faces) != 1 || faces[0][2] != 3 {
+		t.Error("invalid faces", faces)
+	}
+	pos, err := d.Mesh.GetVertexAttribute(VertexChannelPosition)
+	if err != nil || len(pos) != 4 || pos[2][0] != 1 || pos[2][1] != 1 {
+		t.Error("invalid positions", pos, err)
+	}
+	uv, _ := d.Mesh.GetVertexAttribute(VertexChannelTexCoord0)
+	if len(uv) != 4 || uv[3][1] != 1 {
+		t.Error("invalid uvs", uv)
+	}
+	shapes := d.Mesh.GetBlendShapes()
+	if len(shapes) != 1 || shapes[0].Name != "Push" || shapes[0].Indices[0] != 2 || shapes[0].Deltas[0].Z != 1 {
+		t.Error("invalid blend shapes", shapes)
+	}
+}
+
+func TestWritePackage(t *testing.T) {
+	packagePath := filepath.Join(t.TempDir(), "test.unitypackage")
+	w, err := CreatePackage(packagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj := &GameObject{Name: "root", IsActive: 1, Components: []*ComponentRef{{Ref: Ref{FileID: 2}}}}
+	tr := &Transform{LocalRotation: Vector4{W: 1}, LocalScale: Vector3{X: 1, Y: 1, Z: 1}}
+	tr.GameObject = Ref{FileID: 1}
+	var docs []*YAMLDoc
+	for i, e := range []Element{obj, tr} {
+		doc, err := NewYAMLDoc(int64(i+1), e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, doc)
+	}
+	var b bytes.Buffer
+	if err := WriteYamlDocuments(&b, docs); err != nil {
+		t.Fatal(err)
+	}
+	prefabPath := "Assets/test/test.prefab"
+	if err := w.WriteAsset(prefabPath, NewMetaFile(NewGUID(prefabPath), "PrefabImporter", nil), b.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	assets, err := OpenPackage(packagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer assets.Close()
+	scene, err := LoadScene(assets, prefabPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scene.Objects) != 1 || scene.Objects[0].Name != "root" || scene.Objects[0].GetTransform() == nil {
+		t.Error("invalid prefab", scene.Objects)
+	}
+	meta, err := assets.GetMetaFile(assets.GetAssetByPath(prefabPath))
+	if err != nil || meta.GUID != NewGUID(prefabPath) {
+		t.Error("invalid meta", meta, err)
+	}
+}